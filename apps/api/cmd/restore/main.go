@@ -0,0 +1,64 @@
+// Package main is the restore command: it loads an archive written by the
+// retention task back into the database for investigation.
+//
+// Rows go to <table>_restored (e.g. audit_logs_restored), never to the live
+// table, so restored rows are not archived again nor mixed with the audit chain.
+//
+//	restore -archive audit_logs/account-1/20250101T000000Z_20250131T235959Z.ndjson.gz
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"whatpro-hub/internal/config"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+func main() {
+	key := flag.String("archive", "", "Archive key, as logged by the retention task and recorded in the audit log")
+	table := flag.String("table", "", "Table of the archive (defaults to the first segment of the key)")
+	flag.Parse()
+
+	if *key == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := config.InitDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	store, err := cfg.ArchiveStore()
+	if err != nil {
+		log.Fatalf("Failed to open archive store: %v", err)
+	}
+
+	retention := services.NewRetentionService(
+		repositories.NewRetentionRepository(db),
+		repositories.NewAccountRepository(db),
+		repositories.NewAuditRepository(db),
+		store,
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	restoredTable, rows, err := retention.Restore(ctx, *key, *table)
+	if err != nil {
+		log.Fatalf("Failed to restore %s after %d rows: %v", *key, rows, err)
+	}
+
+	log.Printf("Restored %d rows of %s into %s", rows, *key, restoredTable)
+}
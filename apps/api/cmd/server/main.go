@@ -20,6 +20,7 @@ import (
 	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/migrations"
 	"whatpro-hub/internal/seeds"
+	"whatpro-hub/internal/services"
 
 	// Swagger
 	"github.com/gofiber/swagger"
@@ -147,6 +148,10 @@ func main() {
 	// Initialize handlers
 	h := handlers.NewHandler(db, rdb, cfg)
 
+	// Receive realtime events published by every replica
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	go h.Hub.Run(hubCtx)
+
 	// =========================================================================
 	// Routes
 	// =========================================================================
@@ -165,105 +170,194 @@ func main() {
 	// API v1
 	api := app.Group("/api/v1")
 
-	// Billing
-	billing := api.Group("/billing")
-	billing.Post("/subscribe", h.SubscribeAccount)
-
 	// Auth routes (public)
 	auth := api.Group("/auth")
 	auth.Post("/sso", h.AuthSSO)
 	auth.Post("/refresh", h.AuthRefresh)
 
 	// Webhooks (public - Chatwoot will call these)
-	webhookHandler := handlers.NewWebhookHandler(cfg)
+	webhookHandler := handlers.NewWebhookHandler(cfg, h.EventService)
 	webhooks := api.Group("/webhooks")
 	webhooks.Post("/chatwoot", webhookHandler.HandleChatwootWebhook)
-	webhooks.Post("/evolution/:instanceId", h.HandleEvolutionWebhook) 
-	webhooks.Post("/asaas", h.HandleAsaasWebhook) // NEW: Payment Webhook
+	webhooks.Post("/providers/:instanceId", h.HandleProviderWebhook)
+	webhooks.Post("/evolution/:instanceId", h.HandleProviderWebhook) // Legacy Evolution URL
+	webhooks.Post("/billing/:provider", h.HandleBillingWebhook) // Payment provider webhooks
+	webhooks.Post("/asaas", h.HandleAsaasWebhook)              // Legacy Asaas webhook URL
 	webhooks.Post("/test", webhookHandler.HandleWebhookTest) 
 
+	// Real-time event stream (SSE). Registered before the protected group because
+	// EventSource cannot send headers and may authenticate with ?access_token=
+	api.Get("/accounts/:accountId/stream", middleware.StreamJWT(cfg.JWTSecret, rdb), middleware.SessionAuth(h.AuthService), middleware.RequireAccountAccess(), h.Stream)
+
 	// =========================================================================
-	// Protected routes (requires JWT authentication)
+	// Protected routes (requires JWT or API key authentication)
 	// =========================================================================
 	protected := api.Group("")
+	// API keys (X-API-Key) act as the user who created them; JWT is skipped for them.
+	// Each group below declares the scope a key needs with ResourceScope.
+	protected.Use(middleware.APIKeyAuth(h.APIKeyService, h.AuditService))
 	protected.Use(middleware.JWT(cfg.JWTSecret, rdb))
+	// Revoked sessions (logout, force-logout, refresh token reuse) stop working immediately
+	protected.Use(middleware.SessionAuth(h.AuthService))
 
 	// 5. Role-Based Rate Limiting (AFTER authentication)
 	// Applies different limits based on user role
 	protected.Use(middleware.NewRoleRateLimiter(rdb))
 
+	// Accounts suspended for non-payment are read-only until the payment clears
+	protected.Use(middleware.RequireActiveSubscription(h.BillingService, "/auth/", "/billing/"))
+
 	// Auth (protected)
-	protected.Post("/auth/logout", h.AuthLogout)
-	protected.Get("/auth/me", h.AuthMe)
+	protected.Post("/auth/logout", middleware.DenyAPIKey(), h.AuthLogout)
+	protected.Get("/auth/me", middleware.DenyAPIKey(), h.AuthMe)
+	protected.Get("/auth/sessions", middleware.DenyAPIKey(), h.ListSessions)
+	protected.Delete("/auth/sessions", middleware.DenyAPIKey(), h.RevokeOtherSessions)
+	protected.Delete("/auth/sessions/:id", middleware.DenyAPIKey(), h.RevokeSession)
 
 	// Accounts
 	accounts := protected.Group("/accounts")
-	accounts.Get("/", middleware.RequireRole("super_admin"), h.ListAccounts)
-	accounts.Get("/:id", middleware.RequireRole("admin", "super_admin"), h.GetAccount)
-	accounts.Post("/", middleware.RequireRole("super_admin"), h.CreateAccount)
-	accounts.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateAccount)
-	accounts.Post("/sync", middleware.RequireRole("super_admin"), h.SyncAccounts)
+	accounts.Get("/", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.ListAccounts)
+	accounts.Get("/:id", middleware.DenyAPIKey(), middleware.RequireRole("admin", "super_admin"), h.GetAccount)
+	accounts.Post("/", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.CreateAccount)
+	accounts.Put("/:id", middleware.DenyAPIKey(), middleware.RequireRole("admin", "super_admin"), h.UpdateAccount)
+	accounts.Post("/sync", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.SyncAccounts)
+
+	// API keys (managed by account admins with a user session only)
+	apiKeys := protected.Group("/accounts/:accountId/api-keys", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"))
+	apiKeys.Get("/", h.ListAPIKeys)
+	apiKeys.Post("/", h.CreateAPIKey)
+	apiKeys.Post("/:id/rotate", h.RotateAPIKey)
+	apiKeys.Put("/:id/expiry", h.SetAPIKeyExpiry)
+	apiKeys.Delete("/:id", h.RevokeAPIKey)
 
 	// Teams
-	teams := protected.Group("/accounts/:accountId/teams", middleware.RequireAccountAccess())
+	teams := protected.Group("/accounts/:accountId/teams", middleware.RequireAccountAccess(), middleware.ResourceScope("teams"))
 	teams.Get("/", h.ListTeams)
 	teams.Get("/:id", h.GetTeam)
-	teams.Post("/", middleware.RequireRole("admin", "super_admin"), h.CreateTeam)
-	teams.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateTeam)
-	teams.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteTeam)
+	teams.Post("/", middleware.RequirePermission(h.RoleService, services.PermTeamsManage), h.CreateTeam)
+	teams.Put("/:id", middleware.RequirePermission(h.RoleService, services.PermTeamsManage), h.UpdateTeam)
+	teams.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermTeamsManage), h.DeleteTeam)
 
 	// Team Members
 	teams.Get("/:id/members", h.ListTeamMembers)
-	teams.Post("/:id/members", middleware.RequireRole("admin", "super_admin"), h.AddTeamMember)
-	teams.Delete("/:id/members/:userId", middleware.RequireRole("admin", "super_admin"), h.RemoveTeamMember)
+	teams.Post("/:id/members", middleware.RequirePermission(h.RoleService, services.PermTeamsManage), h.AddTeamMember)
+	teams.Delete("/:id/members/:userId", middleware.RequirePermission(h.RoleService, services.PermTeamsManage), h.RemoveTeamMember)
 
 	// Users/Agents
-	users := protected.Group("/accounts/:accountId/users", middleware.RequireAccountAccess())
+	users := protected.Group("/accounts/:accountId/users", middleware.RequireAccountAccess(), middleware.ResourceScope("users"))
 	users.Get("/", h.ListUsers)
 	users.Get("/:id", h.GetUser)
-	users.Post("/", middleware.RequireRole("admin", "super_admin"), h.CreateUser)
-	users.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateUser)
-	users.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteUser)
+	users.Post("/", middleware.RequirePermission(h.RoleService, services.PermUsersManage), h.CreateUser)
+	users.Put("/:id", middleware.RequirePermission(h.RoleService, services.PermUsersManage), h.UpdateUser)
+	users.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermUsersManage), h.DeleteUser)
+	users.Delete("/:id/sessions", middleware.DenyAPIKey(), middleware.RequirePermission(h.RoleService, services.PermUsersManage), h.ForceLogoutUser)
+	users.Put("/:id/role", middleware.DenyAPIKey(), middleware.RequireRole("admin", "super_admin"), h.AssignUserRole)
+
+	// Custom roles (admins only, so a custom role cannot grant itself more)
+	roles := protected.Group("/accounts/:accountId/roles", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"))
+	roles.Get("/", h.ListRoles)
+	roles.Post("/", h.CreateRole)
+	roles.Put("/:id", h.UpdateRole)
+	roles.Delete("/:id", h.DeleteRole)
 
 	// Providers
-	providers := protected.Group("/accounts/:accountId/providers", middleware.RequireAccountAccess())
+	providers := protected.Group("/accounts/:accountId/providers", middleware.RequireAccountAccess(), middleware.ResourceScope("providers"))
 	providers.Get("/", h.ListProviders)
 	providers.Get("/:id", h.GetProvider)
-	providers.Post("/", middleware.RequireRole("admin", "super_admin"), h.CreateProvider)
-	providers.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateProvider)
-	providers.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteProvider)
+	providers.Post("/", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.CreateProvider)
+	providers.Put("/:id", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.UpdateProvider)
+	providers.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.DeleteProvider)
 	providers.Get("/:id/health", h.CheckProviderHealth)
-
-	// Kanban - Boards
-	boards := protected.Group("/accounts/:accountId/boards", middleware.RequireAccountAccess())
+	providers.Get("/:id/qrcode", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.GetProviderQRCode)
+	providers.Post("/:id/logout", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.LogoutProvider)
+	providers.Post("/:id/restart", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.RestartProvider)
+
+	// Inboxes synced from Chatwoot and the provider serving each one
+	inboxes := protected.Group("/accounts/:accountId/inboxes", middleware.RequireAccountAccess(), middleware.ResourceScope("providers"))
+	inboxes.Get("/", h.ListInboxes)
+	inboxes.Put("/:id/provider", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.BindInboxProvider)
+	inboxes.Delete("/:id/provider", middleware.RequirePermission(h.RoleService, services.PermProvidersManage), h.UnbindInboxProvider)
+
+	// Webhook executions (retries and dead-letter queue)
+	events := protected.Group("/accounts/:accountId/events", middleware.RequireAccountAccess(), middleware.ResourceScope("events"), middleware.RequirePermission(h.RoleService, services.PermEventsManage))
+	events.Get("/", h.ListEvents)
+	events.Get("/:id", h.GetEvent)
+	events.Post("/:id/replay", h.ReplayEvent)
+
+	// Audit timeline (audit logs and internal chat audit)
+	auditLogs := protected.Group("/accounts/:accountId/audit-logs", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequirePermission(h.RoleService, services.PermAuditView))
+	auditLogs.Get("/", h.ListAuditLogs)
+	auditLogs.Get("/export", h.ExportAuditLogs)
+	auditLogs.Get("/verify", h.VerifyAuditChain)
+	auditLogs.Get("/chain", h.ExportAuditChain)
+
+	// Retention of audit and event rows (admins only)
+	retention := protected.Group("/accounts/:accountId/retention", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"))
+	retention.Get("/", h.GetRetentionPolicy)
+	retention.Put("/", h.UpdateRetentionPolicy)
+
+	// Plan subscription and payments (admins only)
+	billing := protected.Group("/accounts/:accountId/billing", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"))
+	billing.Get("/subscription", h.GetSubscription)
+	billing.Post("/subscription", h.SubscribeAccount)
+	billing.Delete("/subscription", h.CancelSubscription)
+	billing.Get("/payments", h.ListPayments)
+	billing.Get("/provider", h.GetBillingProvider)
+	billing.Put("/provider", h.UpdateBillingProvider)
+	billing.Put("/subscription/plan", h.ChangeSubscriptionPlan)
+	billing.Get("/entitlements", h.GetEntitlements)
+
+	// Plans are offered to every account and managed by super admins
+	plans := protected.Group("/plans")
+	plans.Get("/", h.ListPlans)
+	plans.Get("/:id", h.GetPlan)
+	plans.Post("/", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.CreatePlan)
+	plans.Put("/:id", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.UpdatePlan)
+	plans.Delete("/:id", middleware.DenyAPIKey(), middleware.RequireRole("super_admin"), h.DeletePlan)
+
+	// Chatwoot sync of users, teams, inboxes and labels (admins only)
+	protected.Post("/accounts/:accountId/sync", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"), h.TriggerSync)
+	syncReports := protected.Group("/accounts/:accountId/sync-reports", middleware.DenyAPIKey(), middleware.RequireAccountAccess(), middleware.RequireRole("admin", "super_admin"))
+	syncReports.Get("/", h.ListSyncReports)
+	syncReports.Get("/:id", h.GetSyncReport)
+
+	// Kanban - Boards (plans with Kanban only)
+	kanbanEnabled := middleware.RequireFeature(h.EntitlementsService, services.FeatureKanban)
+	boards := protected.Group("/accounts/:accountId/boards", middleware.RequireAccountAccess(), middleware.ResourceScope("boards"), kanbanEnabled)
 	boards.Get("/", h.ListBoards)
 	boards.Get("/:id", h.GetBoard)
-	boards.Post("/", middleware.RequireRole("admin", "super_admin"), h.CreateBoard)
-	boards.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateBoard)
-	boards.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteBoard)
+	boards.Get("/:id/sla", middleware.RequireFeature(h.EntitlementsService, services.FeatureAnalytics), middleware.RequirePermission(h.RoleService, services.PermReportsView), h.GetBoardSLAReport)
+	boards.Post("/", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.CreateBoard)
+	boards.Put("/:id", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.UpdateBoard)
+	boards.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.DeleteBoard)
 
 	// Kanban - Stages
-	stages := protected.Group("/boards/:boardId/stages")
+	stages := protected.Group("/boards/:boardId/stages", middleware.ResourceScope("boards"), kanbanEnabled)
 	stages.Get("/", h.ListStages)
-	stages.Post("/", middleware.RequireRole("admin", "super_admin"), h.CreateStage)
-	stages.Put("/:id", middleware.RequireRole("admin", "super_admin"), h.UpdateStage)
-	stages.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteStage)
-	stages.Post("/reorder", middleware.RequireRole("admin", "supervisor", "super_admin"), h.ReorderStages)
+	stages.Post("/", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.CreateStage)
+	stages.Put("/:id", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.UpdateStage)
+	stages.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermBoardsManage), h.DeleteStage)
+	stages.Post("/reorder", middleware.RequirePermission(h.RoleService, services.PermStagesConfigure), h.ReorderStages)
+	stages.Get("/:id/checklist", h.ListStageChecklist)
+	stages.Post("/:id/checklist", middleware.RequirePermission(h.RoleService, services.PermStagesConfigure), h.CreateStageChecklistItem)
+	stages.Put("/:id/checklist/:itemId", middleware.RequirePermission(h.RoleService, services.PermStagesConfigure), h.UpdateStageChecklistItem)
+	stages.Delete("/:id/checklist/:itemId", middleware.RequirePermission(h.RoleService, services.PermStagesConfigure), h.DeleteStageChecklistItem)
 
 	// Kanban - Cards
-	cards := protected.Group("/boards/:boardId/cards")
+	cards := protected.Group("/boards/:boardId/cards", middleware.ResourceScope("cards"), kanbanEnabled)
 	cards.Get("/", h.ListCards)
 	cards.Get("/:id", h.GetCard)
 	cards.Post("/", h.CreateCard)
 	cards.Put("/:id", h.UpdateCard)
 	cards.Post("/:id/move", h.MoveCard)
-	cards.Delete("/:id", middleware.RequireRole("admin", "super_admin"), h.DeleteCard)
+	cards.Patch("/:id/checklist/:itemId", h.ToggleCardChecklistItem)
+	cards.Delete("/:id", middleware.RequirePermission(h.RoleService, services.PermCardsDelete), h.DeleteCard)
 
 	// =========================================================================
 	// Internal Chat Routes
 	// =========================================================================
-	chatHandler := handlers.NewChatHandler(h.ChatService)
-	chat := protected.Group("/accounts/:accountId/chat", middleware.RequireAccountAccess())
+	chatHandler := handlers.NewChatHandler(h.ChatService, h.RoleService)
+	chat := protected.Group("/accounts/:accountId/chat", middleware.RequireAccountAccess(), middleware.ResourceScope("chat"))
 	
 	// Rooms
 	chat.Get("/rooms", chatHandler.ListRooms)
@@ -278,9 +372,12 @@ func main() {
 	chat.Get("/rooms/:roomId/messages", chatHandler.ListMessages)
 	chat.Post("/rooms/:roomId/messages", chatHandler.SendMessage)
 	chat.Delete("/messages/:messageId", chatHandler.DeleteMessage)
+	chat.Get("/messages/:messageId/context", chatHandler.MessageContext)
+	chat.Get("/search", chatHandler.SearchMessages)
 	
 	// Read Status
 	chat.Post("/rooms/:roomId/read", chatHandler.MarkAsRead)
+	chat.Post("/rooms/:roomId/typing", chatHandler.Typing)
 	// Mentions
 	chat.Get("/mentions", chatHandler.ListMentions)
 	chat.Post("/mentions/:mentionId/read", chatHandler.MarkMentionRead)
@@ -288,7 +385,7 @@ func main() {
 	chat.Post("/quotes", chatHandler.CreateQuote)
 
 	// Chatwoot Proxy (for frontend to call Chatwoot APIs through our API)
-	chatwoot := protected.Group("/chatwoot")
+	chatwoot := protected.Group("/chatwoot", middleware.DenyAPIKey())
 	chatwoot.All("/*", h.ChatwootProxy)
 
 	// =========================================================================
@@ -312,6 +409,10 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	// Close open event streams so they don't hold the shutdown
+	stopHub()
+	h.Hub.Close()
+
 	// Shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
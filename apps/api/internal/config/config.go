@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,6 +14,8 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"whatpro-hub/pkg/archive"
+	"whatpro-hub/pkg/mailer"
 )
 
 // Config holds all application configuration
@@ -36,6 +40,43 @@ type Config struct {
 
 	// CORS
 	CORSOrigins string
+
+	// Archive of expired audit and event rows: a local directory or s3://bucket/prefix
+	ArchivePath        string
+	ArchiveS3Endpoint  string
+	ArchiveS3Region    string
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+
+	// Asaas billing; AsaasURL defaults to production
+	AsaasAPIKey       string
+	AsaasURL          string
+	AsaasWebhookToken string
+
+	// Mercado Pago and Stripe billing
+	MercadoPagoAccessToken   string
+	MercadoPagoWebhookSecret string
+	StripeSecretKey          string
+	StripeWebhookSecret      string
+
+	// BillingProvider bills accounts and plans without a provider of their own;
+	// BillingReturnURL is where customers return after a provider checkout
+	BillingProvider  string
+	BillingReturnURL string
+
+	// Dunning: days a past due subscription has before suspension, days a
+	// suspended one has before it is canceled (0 keeps it suspended) and the
+	// days after the due date on which payment reminders are sent
+	BillingGraceDays       int
+	BillingCancelAfterDays int
+	BillingReminderDays    []int
+
+	// SMTP server of outgoing e-mails; e-mail is disabled without SMTPHost
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 // Load reads configuration from environment variables
@@ -53,6 +94,34 @@ func Load() (*Config, error) {
 		JWTSecret:        getEnv("JWT_SECRET", ""),
 		JWTExpireMinutes: 60 * 24, // 24 hours
 		CORSOrigins:      getEnv("CORS_ORIGINS", "*"),
+
+		ArchivePath:        getEnv("ARCHIVE_PATH", ""),
+		ArchiveS3Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+		ArchiveS3Region:    getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+		ArchiveS3AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+		ArchiveS3SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+
+		AsaasAPIKey:       getEnv("ASAAS_API_KEY", ""),
+		AsaasURL:          getEnv("ASAAS_URL", ""),
+		AsaasWebhookToken: getEnv("ASAAS_WEBHOOK_TOKEN", ""),
+
+		MercadoPagoAccessToken:   getEnv("MERCADOPAGO_ACCESS_TOKEN", ""),
+		MercadoPagoWebhookSecret: getEnv("MERCADOPAGO_WEBHOOK_SECRET", ""),
+		StripeSecretKey:          getEnv("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret:      getEnv("STRIPE_WEBHOOK_SECRET", ""),
+
+		BillingProvider:  getEnv("BILLING_PROVIDER", "asaas"),
+		BillingReturnURL: getEnv("BILLING_RETURN_URL", ""),
+
+		BillingGraceDays:       getEnvInt("BILLING_GRACE_DAYS", 7),
+		BillingCancelAfterDays: getEnvInt("BILLING_CANCEL_AFTER_DAYS", 30),
+		BillingReminderDays:    getEnvInts("BILLING_REMINDER_DAYS", []int{0, 3, 6}),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
 	}
 
 	// Validate required fields
@@ -114,6 +183,27 @@ func InitRedis(cfg *Config) (*redis.Client, error) {
 	return rdb, nil
 }
 
+// ArchiveStore opens the archive store at ArchivePath; it is nil when archival is disabled
+func (c *Config) ArchiveStore() (archive.Store, error) {
+	return archive.NewStore(c.ArchivePath, archive.S3Options{
+		Endpoint:  c.ArchiveS3Endpoint,
+		Region:    c.ArchiveS3Region,
+		AccessKey: c.ArchiveS3AccessKey,
+		SecretKey: c.ArchiveS3SecretKey,
+	})
+}
+
+// Mailer returns the SMTP mailer; it is nil when SMTP_HOST is not set
+func (c *Config) Mailer() mailer.Mailer {
+	return mailer.New(mailer.Options{
+		Host:     c.SMTPHost,
+		Port:     c.SMTPPort,
+		Username: c.SMTPUsername,
+		Password: c.SMTPPassword,
+		From:     c.SMTPFrom,
+	})
+}
+
 // getEnv gets an environment variable with a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -121,3 +211,28 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInts gets a comma-separated list of integers with a default value
+func getEnvInts(key string, defaultValue []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, n)
+	}
+	return values
+}
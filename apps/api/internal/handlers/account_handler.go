@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
 )
 
 // ListAccountsRequest defines parameters for listing accounts
@@ -234,6 +236,9 @@ func (h *Handler) UpdateAccount(c *fiber.Ctx) error {
 		if err == repositories.ErrAccountNotFound {
 			return h.Error(c, fiber.StatusNotFound, "Account not found")
 		}
+		if errors.Is(err, services.ErrInvalidRetention) {
+			return h.Error(c, fiber.StatusBadRequest, err.Error())
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to update account")
 	}
 
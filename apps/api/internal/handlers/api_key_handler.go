@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/middleware"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// SetAPIKeyExpiryRequest defines parameters for changing a key's expiry
+type SetAPIKeyExpiryRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"` // null removes the expiry
+}
+
+// ListAPIKeys handles listing the API keys of an account
+// @Summary List API keys
+// @Description List the API keys of an account. Secrets are never returned.
+// @Tags API Keys
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /accounts/{accountId}/api-keys [get]
+// @Security BearerAuth
+func (h *Handler) ListAPIKeys(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	keys, err := h.APIKeyService.List(c.Context(), accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch API keys")
+	}
+
+	return h.Success(c, fiber.Map{
+		"api_keys": keys,
+		"scopes":   services.APIKeyScopes,
+	})
+}
+
+// CreateAPIKey handles issuing a new API key
+// @Summary Create API key
+// @Description Issue an API key acting on behalf of the current user, limited to the given scopes. The key is only shown in this response.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param key body services.CreateAPIKeyRequest true "Key Data"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /accounts/{accountId}/api-keys [post]
+// @Security BearerAuth
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+	userID := c.Locals("user_id").(int)
+
+	var req services.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if errs := middleware.ValidateStruct(req); len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Validation failed",
+			"status":  fiber.StatusBadRequest,
+			"details": errs,
+		})
+	}
+
+	key, plaintext, err := h.APIKeyService.Create(c.Context(), accountID, userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) || errors.Is(err, services.ErrInvalidExpiry) {
+			return h.Error(c, fiber.StatusBadRequest, err.Error())
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to create API key")
+	}
+
+	h.AuditCreate(c, "api_key", key.ID.String(), key)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+// RotateAPIKey handles replacing the secret of an API key
+// @Summary Rotate API key
+// @Description Issue a new secret for the key; the previous one stops working immediately. The key is only shown in this response.
+// @Tags API Keys
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "API Key ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/api-keys/{id}/rotate [post]
+// @Security BearerAuth
+func (h *Handler) RotateAPIKey(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid API key ID")
+	}
+
+	key, plaintext, err := h.APIKeyService.Rotate(c.Context(), accountID, id)
+	if err != nil {
+		return h.apiKeyError(c, err, "Failed to rotate API key")
+	}
+
+	h.Audit(c, services.AuditActionRotate, "api_key", key.ID.String(), nil, key)
+
+	return h.Success(c, fiber.Map{
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+// SetAPIKeyExpiry handles changing the expiry of an API key
+// @Summary Set API key expiry
+// @Description Set or remove the expiry date of an API key
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "API Key ID"
+// @Param expiry body SetAPIKeyExpiryRequest true "Expiry"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/api-keys/{id}/expiry [put]
+// @Security BearerAuth
+func (h *Handler) SetAPIKeyExpiry(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid API key ID")
+	}
+
+	var req SetAPIKeyExpiryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	key, err := h.APIKeyService.SetExpiry(c.Context(), accountID, id, req.ExpiresAt)
+	if err != nil {
+		return h.apiKeyError(c, err, "Failed to update API key")
+	}
+
+	h.AuditUpdate(c, "api_key", key.ID.String(), nil, fiber.Map{"expires_at": key.ExpiresAt})
+
+	return h.Success(c, fiber.Map{
+		"api_key": key,
+	})
+}
+
+// RevokeAPIKey handles revoking an API key
+// @Summary Revoke API key
+// @Description Permanently disable an API key
+// @Tags API Keys
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "API Key ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/api-keys/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid API key ID")
+	}
+
+	key, err := h.APIKeyService.Revoke(c.Context(), accountID, id)
+	if err != nil {
+		return h.apiKeyError(c, err, "Failed to revoke API key")
+	}
+
+	h.AuditDelete(c, "api_key", key.ID.String(), key)
+
+	return h.Success(c, fiber.Map{
+		"api_key": key,
+	})
+}
+
+// apiKeyError maps API key service errors to responses
+func (h *Handler) apiKeyError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, repositories.ErrAPIKeyNotFound):
+		return h.Error(c, fiber.StatusNotFound, "API key not found")
+	case errors.Is(err, services.ErrInvalidExpiry):
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrAPIKeyRevoked):
+		return h.Error(c, fiber.StatusConflict, "API key is revoked")
+	default:
+		return h.Error(c, fiber.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// AuditLogsRequest defines the filters of the audit timeline
+type AuditLogsRequest struct {
+	Source       string `query:"source"` // audit or chat
+	UserID       int    `query:"user_id"`
+	Action       string `query:"action"`
+	ResourceType string `query:"resource_type"`
+	ResourceID   string `query:"resource_id"`
+	From         string `query:"from"` // RFC 3339
+	To           string `query:"to"`   // RFC 3339
+	Cursor       string `query:"cursor"`
+	Limit        int    `query:"limit"`
+	Format       string `query:"format"` // Export only: csv or ndjson
+}
+
+// toQuery converts the request into a timeline query of the account
+func (r AuditLogsRequest) toQuery(accountID int) (repositories.AuditTimelineQuery, error) {
+	query := repositories.AuditTimelineQuery{AccountID: accountID, Limit: r.Limit}
+	if r.Source != "" {
+		if r.Source != "audit" && r.Source != "chat" {
+			return query, errors.New("source must be audit or chat")
+		}
+		query.Source = &r.Source
+	}
+	if r.UserID > 0 {
+		query.UserID = &r.UserID
+	}
+	if r.Action != "" {
+		query.Action = &r.Action
+	}
+	if r.ResourceType != "" {
+		query.ResourceType = &r.ResourceType
+	}
+	if r.ResourceID != "" {
+		query.ResourceID = &r.ResourceID
+	}
+	if r.From != "" {
+		from, err := time.Parse(time.RFC3339, r.From)
+		if err != nil {
+			return query, errors.New("from must be an RFC 3339 date")
+		}
+		query.StartDate = &from
+	}
+	if r.To != "" {
+		to, err := time.Parse(time.RFC3339, r.To)
+		if err != nil {
+			return query, errors.New("to must be an RFC 3339 date")
+		}
+		query.EndDate = &to
+	}
+	return query, nil
+}
+
+// ListAuditLogs handles browsing the audit timeline of an account
+// @Summary List audit logs
+// @Description Audit logs and internal chat audit entries merged into one timeline, newest first, with cursor pagination
+// @Tags Audit
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param source query string false "audit or chat"
+// @Param user_id query int false "Filter by user"
+// @Param action query string false "Filter by action"
+// @Param resource_type query string false "Filter by resource type"
+// @Param resource_id query string false "Filter by resource ID"
+// @Param from query string false "From date (RFC 3339)"
+// @Param to query string false "To date (RFC 3339)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size (max 200)"
+// @Success 200 {object} map[string]interface{}
+// @Router /accounts/{accountId}/audit-logs [get]
+// @Security BearerAuth
+func (h *Handler) ListAuditLogs(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var req AuditLogsRequest
+	if err := c.QueryParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid query parameters")
+	}
+	query, err := req.toQuery(accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	entries, next, err := h.AuditService.Timeline(query, req.Cursor)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			return h.Error(c, fiber.StatusBadRequest, "Invalid cursor")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch audit logs")
+	}
+
+	return h.SuccessWithMeta(c, entries, fiber.Map{
+		"next_cursor": next,
+		"count":       len(entries),
+	})
+}
+
+// ExportAuditLogs handles exporting the audit timeline of an account
+// @Summary Export audit logs
+// @Description Stream every timeline entry matching the filters as CSV or NDJSON. The export itself is audited.
+// @Tags Audit
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param accountId path int true "Account ID"
+// @Param format query string false "csv (default) or ndjson"
+// @Success 200 {string} string "export file"
+// @Router /accounts/{accountId}/audit-logs/export [get]
+// @Security BearerAuth
+func (h *Handler) ExportAuditLogs(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var req AuditLogsRequest
+	if err := c.QueryParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid query parameters")
+	}
+	if req.Format == "" {
+		req.Format = services.AuditExportCSV
+	}
+	if req.Format != services.AuditExportCSV && req.Format != services.AuditExportNDJSON {
+		return h.Error(c, fiber.StatusBadRequest, "format must be csv or ndjson")
+	}
+	query, err := req.toQuery(accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	h.Audit(c, services.AuditActionExport, "audit_log", "", nil, fiber.Map{
+		"format":        req.Format,
+		"source":        req.Source,
+		"user_id":       req.UserID,
+		"action":        req.Action,
+		"resource_type": req.ResourceType,
+		"resource_id":   req.ResourceID,
+		"from":          req.From,
+		"to":            req.To,
+	})
+
+	filename := fmt.Sprintf("audit-%d-%s.%s", accountID, time.Now().UTC().Format("20060102-150405"), req.Format)
+	if req.Format == services.AuditExportCSV {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	audit := h.AuditService
+	logger := h.Logger
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// Large exports outlast the server WriteTimeout; every write gets its own deadline
+		out := &deadlineWriter{w: w, conn: conn}
+		if err := audit.ExportTimeline(query, req.Format, out); err != nil {
+			// Headers are already sent; the truncated file is the only signal to the client
+			logger.Printf("[AUDIT] Export of account %d failed: %v", accountID, err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// deadlineWriter extends the connection write deadline before each write
+type deadlineWriter struct {
+	w    *bufio.Writer
+	conn net.Conn
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return d.w.Write(p)
+}
+
+// VerifyAuditChain handles verifying the audit hash chain of an account
+// @Summary Verify audit chain
+// @Description Walk the hash chain of the account audit log and report every entry that was edited, removed or reordered
+// @Tags Audit
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} services.AuditChainReport
+// @Router /accounts/{accountId}/audit-logs/verify [get]
+// @Security BearerAuth
+func (h *Handler) VerifyAuditChain(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	report, err := h.AuditService.VerifyChain(accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to verify audit chain")
+	}
+
+	return h.Success(c, report)
+}
+
+// ExportAuditChain handles exporting the signed audit hash chain of an account
+// @Summary Export signed audit chain
+// @Description Stream the account audit chain as NDJSON for offline verification: one line per entry in chain order, a manifest line with the chain head and signing key, and a line with the Ed25519 signature of the manifest line
+// @Tags Audit
+// @Produce application/x-ndjson
+// @Param accountId path int true "Account ID"
+// @Success 200 {string} string "export file"
+// @Failure 503 {object} map[string]interface{}
+// @Router /accounts/{accountId}/audit-logs/chain [get]
+// @Security BearerAuth
+func (h *Handler) ExportAuditChain(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+	if !h.AuditService.SigningEnabled() {
+		return h.Error(c, fiber.StatusServiceUnavailable, "Audit signing key is not configured")
+	}
+
+	h.Audit(c, services.AuditActionExport, "audit_chain", "", nil, fiber.Map{"account_id": accountID})
+
+	filename := fmt.Sprintf("audit-chain-%d-%s.ndjson", accountID, time.Now().UTC().Format("20060102-150405"))
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	audit := h.AuditService
+	logger := h.Logger
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		out := &deadlineWriter{w: w, conn: conn}
+		if err := audit.ExportChain(accountID, out); err != nil {
+			// Without the signature line the file fails verification, which signals the truncation
+			logger.Printf("[AUDIT] Chain export of account %d failed: %v", accountID, err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
@@ -2,13 +2,18 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"time"
 	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/services"
 	"whatpro-hub/pkg/chatwoot"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // SSORequest is the request body for SSO
@@ -34,6 +39,7 @@ type AuthResponse struct {
 // @Success 200 {object} AuthResponse
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "New agent over the plan quota"
 // @Failure 500 {object} map[string]interface{}
 // @Router /auth/sso [post]
 func (h *Handler) AuthSSO(c *fiber.Ctx) error {
@@ -44,15 +50,20 @@ func (h *Handler) AuthSSO(c *fiber.Ctx) error {
 
 	// Validate against Chatwoot
 	client := chatwoot.New(h.Config.ChatwootURL, req.Token)
-	cwUser, err := client.ValidateToken()
+	cwUser, err := client.ValidateToken(c.Context())
 	if err != nil {
 		return h.Error(c, fiber.StatusUnauthorized, "Invalid Chatwoot token")
 	}
 
-	// Find or create user in local database
+	// Find or create user in local database. Users removed by the Chatwoot sync
+	// are found too: the token proves the agent exists upstream again.
 	var user models.User
-	result := h.DB.Where("chatwoot_id = ?", cwUser.ID).First(&user)
+	result := h.DB.Unscoped().Where("chatwoot_id = ?", cwUser.ID).First(&user)
 	if result.Error != nil {
+		// A new agent takes a seat of the account's plan
+		if err := h.EntitlementsService.CanCreateResource(cwUser.AccountID, "agent"); err != nil {
+			return h.agentQuotaError(c, err)
+		}
 		// Create new user
 		user = models.User{
 			ChatwootID:   cwUser.ID,
@@ -61,21 +72,34 @@ func (h *Handler) AuthSSO(c *fiber.Ctx) error {
 			Name:         cwUser.Name,
 			AvatarURL:    cwUser.AvatarURL,
 			ChatwootRole: cwUser.Role,
-			WhatproRole:  determineWhatproRole(cwUser.Role),
+			WhatproRole:  services.WhatproRoleFor(cwUser.Role),
 		}
 		if err := h.DB.Create(&user).Error; err != nil {
 			return h.Error(c, fiber.StatusInternalServerError, "Failed to create user")
 		}
 	} else {
+		// Restoring a removed agent takes a seat again
+		if user.DeletedAt.Valid {
+			if err := h.EntitlementsService.CanCreateResource(user.AccountID, "agent"); err != nil {
+				return h.agentQuotaError(c, err)
+			}
+		}
 		// Update existing user
 		user.Name = cwUser.Name
 		user.Email = cwUser.Email
 		user.AvatarURL = cwUser.AvatarURL
 		user.ChatwootRole = cwUser.Role
-		h.DB.Save(&user)
+		user.DeletedAt = gorm.DeletedAt{}
+		h.DB.Unscoped().Save(&user)
+	}
+
+	// The token is kept for the Chatwoot proxy, which acts with the user's own permissions
+	if err := h.ChatwootProxyService.StoreToken(c.Context(), user.ID, req.Token); err != nil {
+		log.Printf("Failed to store Chatwoot token of user %d: %v", user.ID, err)
 	}
 
-	// Generate JWT
+	// Generate JWT bound to a new session (one per login/device)
+	sessionID := uuid.New()
 	claims := &middleware.UserClaims{
 		UserID:       int(user.ID),
 		ChatwootID:   user.ChatwootID,
@@ -84,6 +108,7 @@ func (h *Handler) AuthSSO(c *fiber.Ctx) error {
 		Name:         user.Name,
 		ChatwootRole: user.ChatwootRole,
 		WhatproRole:  user.WhatproRole,
+		SessionID:    sessionID.String(),
 	}
 
 	accessToken, refreshToken, expiresAt, err := middleware.GenerateTokens(h.Config.JWTSecret, claims)
@@ -91,6 +116,10 @@ func (h *Handler) AuthSSO(c *fiber.Ctx) error {
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to generate token")
 	}
 
+	if _, err := h.AuthService.CreateSession(sessionID, int(user.ID), user.AccountID, refreshToken, c.IP(), c.Get("User-Agent")); err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to create session")
+	}
+
 	return h.Success(c, AuthResponse{
 		Token:        accessToken,
 		RefreshToken: refreshToken,
@@ -99,6 +128,15 @@ func (h *Handler) AuthSSO(c *fiber.Ctx) error {
 	})
 }
 
+// agentQuotaError responds to a failed agent quota check of the SSO login
+func (h *Handler) agentQuotaError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return middleware.QuotaExceeded(c, err)
+	}
+	log.Printf("Failed to check the agent quota: %v", err)
+	return h.Error(c, fiber.StatusInternalServerError, "Failed to check the agent quota")
+}
+
 // RefreshRequest is the request body for refreshing token
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
@@ -113,6 +151,7 @@ type RefreshRequest struct {
 // @Param request body RefreshRequest true "Refresh Token"
 // @Success 200 {object} AuthResponse
 // @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "New agent over the plan quota"
 // @Router /auth/refresh [post]
 func (h *Handler) AuthRefresh(c *fiber.Ctx) error {
 	var req RefreshRequest
@@ -148,6 +187,12 @@ func (h *Handler) AuthRefresh(c *fiber.Ctx) error {
 		return h.Error(c, fiber.StatusUnauthorized, "Invalid token type")
 	}
 
+	sid, _ := claims["sid"].(string)
+	sessionID, err := uuid.Parse(sid)
+	if err != nil {
+		return h.Error(c, fiber.StatusUnauthorized, "Invalid refresh token")
+	}
+
 	// Extract User Info from Refresh Token Claims
 	userID := int(claims["user_id"].(float64))
 
@@ -166,6 +211,7 @@ func (h *Handler) AuthRefresh(c *fiber.Ctx) error {
 		Name:         user.Name,
 		ChatwootRole: user.ChatwootRole,
 		WhatproRole:  user.WhatproRole,
+		SessionID:    sessionID.String(),
 	}
 
 	accessToken, refreshToken, expiresAt, err := middleware.GenerateTokens(h.Config.JWTSecret, newClaims)
@@ -173,6 +219,20 @@ func (h *Handler) AuthRefresh(c *fiber.Ctx) error {
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to generate tokens")
 	}
 
+	// Rotate: the presented refresh token stops working. Replaying an already
+	// rotated token revokes the session, logging out every device holding it.
+	if _, err := h.AuthService.RotateRefreshToken(sessionID, req.RefreshToken, refreshToken); err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			h.Logger.Printf("[AUTH] Refresh token reuse on session %s of user %d; session revoked", sessionID, userID)
+			return h.Error(c, fiber.StatusUnauthorized, "Refresh token reused; session revoked")
+		case errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrSessionRevoked), errors.Is(err, services.ErrSessionExpired):
+			return h.Error(c, fiber.StatusUnauthorized, "Session revoked or expired")
+		default:
+			return h.Error(c, fiber.StatusInternalServerError, "Failed to refresh session")
+		}
+	}
+
 	return h.Success(c, AuthResponse{
 		Token:        accessToken,
 		RefreshToken: refreshToken,
@@ -223,11 +283,111 @@ func (h *Handler) AuthLogout(c *fiber.Ctx) error {
 		}
 	}
 
+	// 3. End the session
+	if sessionID, err := currentSessionID(c); err == nil {
+		if err := h.AuthService.RevokeSession(c.Locals("user_id").(int), sessionID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			return h.Error(c, fiber.StatusInternalServerError, "Failed to end session")
+		}
+	}
+
 	return h.Success(c, fiber.Map{
 		"message": "Logged out successfully",
 	})
 }
 
+// ListSessions handles GET /api/v1/auth/sessions
+// @Summary List my sessions
+// @Description List the active sessions (devices) of the current user with user agent, IP and last activity
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/sessions [get]
+func (h *Handler) ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	sessions, err := h.AuthService.ListSessions(userID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch sessions")
+	}
+
+	if current, err := currentSessionID(c); err == nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current
+		}
+	}
+
+	return h.Success(c, fiber.Map{
+		"sessions": sessions,
+		"total":    len(sessions),
+	})
+}
+
+// RevokeSession handles DELETE /api/v1/auth/sessions/:id
+// @Summary Revoke a session
+// @Description Log out one of the current user's devices
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /auth/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid session ID")
+	}
+
+	if err := h.AuthService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "Session not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to revoke session")
+	}
+
+	h.AuditDelete(c, "session", sessionID.String(), nil)
+
+	return h.Success(c, fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions handles DELETE /api/v1/auth/sessions
+// @Summary Revoke all other sessions
+// @Description Log out every device of the current user except this one
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/sessions [delete]
+func (h *Handler) RevokeOtherSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int)
+
+	current, err := currentSessionID(c)
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Token is not bound to a session; sign in again")
+	}
+
+	if err := h.AuthService.RevokeOtherSessions(userID, current); err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	h.Audit(c, services.AuditActionLogout, "session", current.String(), nil, fiber.Map{"scope": "other_sessions"})
+
+	return h.Success(c, fiber.Map{
+		"message": "Other sessions revoked",
+	})
+}
+
+// currentSessionID returns the session of the access token making the request
+func currentSessionID(c *fiber.Ctx) (uuid.UUID, error) {
+	sid, _ := c.Locals("session_id").(string)
+	return uuid.Parse(sid)
+}
+
 // AuthMe handles GET /api/v1/auth/me
 // @Summary Get current user
 // @Description Get details of currently logged in user
@@ -248,15 +408,3 @@ func (h *Handler) AuthMe(c *fiber.Ctx) error {
 
 	return h.Success(c, user)
 }
-
-// determineWhatproRole maps Chatwoot role to WhatPro role
-func determineWhatproRole(chatwootRole string) string {
-	switch chatwootRole {
-	case "administrator":
-		return "admin"
-	case "agent":
-		return "agent"
-	default:
-		return "agent"
-	}
-}
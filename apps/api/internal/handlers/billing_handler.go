@@ -1,39 +1,319 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+	"whatpro-hub/pkg/webhooks"
 )
 
-// HandleAsaasWebhook handles webhooks from Asaas
+// HandleBillingWebhook stores webhooks from a payment provider for background processing
+// @Summary Payment provider webhook
+// @Description Receives webhooks from asaas, mercadopago or stripe. Each provider authenticates its webhooks with its own token or signature header.
+// @Tags Billing
+// @Accept json
+// @Param provider path string true "Payment provider"
+// @Success 202
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /webhooks/billing/{provider} [post]
+func (h *Handler) HandleBillingWebhook(c *fiber.Ctx) error {
+	return h.handleBillingWebhook(c, c.Params("provider"))
+}
+
+// HandleAsaasWebhook keeps the original Asaas webhook URL working
 func (h *Handler) HandleAsaasWebhook(c *fiber.Ctx) error {
-	if err := h.BillingService.ProcessWebhook(c.Context(), c.Body()); err != nil {
-		h.Logger.Printf("Error processing payment webhook: %v", err)
+	return h.handleBillingWebhook(c, models.ProviderAsaas)
+}
+
+func (h *Handler) handleBillingWebhook(c *fiber.Ctx, provider string) error {
+	if err := h.BillingService.VerifyWebhook(provider, requestHeader(c), c.Body()); err != nil {
+		if errors.Is(err, services.ErrProviderUnavailable) {
+			return h.Error(c, fiber.StatusNotFound, "Unknown payment provider")
+		}
+		return h.Error(c, fiber.StatusUnauthorized, "Invalid webhook credentials")
+	}
+
+	if _, err := h.EventService.Record(c.Context(), "billing."+provider, 0, nil, c.Body()); err != nil {
+		if errors.Is(err, webhooks.ErrInvalidPayload) {
+			return h.Error(c, fiber.StatusBadRequest, "Invalid payload")
+		}
+		h.Logger.Printf("Error storing payment webhook: %v", err)
 		return h.Error(c, fiber.StatusInternalServerError, "Processing failed")
 	}
-	return c.SendStatus(fiber.StatusOK)
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// requestHeader copies the headers of a webhook request for signature checks
+func requestHeader(c *fiber.Ctx) http.Header {
+	header := http.Header{}
+	for name, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	return header
+}
+
+// GetBillingProvider handles getting the payment provider of an account
+// @Summary Get billing provider
+// @Description Payment provider chosen by the account, the default one and the configured ones
+// @Tags Billing
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} services.BillingProviderSelection
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/provider [get]
+// @Security BearerAuth
+func (h *Handler) GetBillingProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	selection, err := h.BillingService.GetAccountProvider(c.Context(), accountID)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	return h.Success(c, selection)
+}
+
+// UpdateBillingProvider handles choosing the payment provider of an account
+// @Summary Update billing provider
+// @Description Chooses the payment provider of the account's next subscriptions. An empty provider falls back to the plan's provider or the default one.
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param request body map[string]string true "Provider: asaas, mercadopago, stripe or empty"
+// @Success 200 {object} services.BillingProviderSelection
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/provider [put]
+// @Security BearerAuth
+func (h *Handler) UpdateBillingProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var req struct {
+		Provider string `json:"provider"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	previous, err := h.BillingService.GetAccountProvider(c.Context(), accountID)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+	if err := h.BillingService.SetAccountProvider(c.Context(), accountID, req.Provider); err != nil {
+		return h.billingError(c, err)
+	}
+	h.AuditUpdate(c, "billing_provider", fmt.Sprintf("%d", accountID), fiber.Map{"provider": previous.Provider}, fiber.Map{"provider": req.Provider})
+
+	previous.Provider = req.Provider
+	return h.Success(c, previous)
+}
+
+// GetSubscription handles getting the subscription of an account
+// @Summary Get subscription
+// @Description Live subscription of the account: its status (pending, trial, active, past_due or suspended), the checkout URL of the open charge and the dunning progress
+// @Tags Billing
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} models.Subscription
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/subscription [get]
+// @Security BearerAuth
+func (h *Handler) GetSubscription(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	sub, err := h.BillingService.GetSubscription(c.Context(), accountID)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	return h.Success(c, sub)
 }
 
 // SubscribeAccount handles plan subscription requests
+// @Summary Subscribe account to a plan
+// @Description Creates the subscription in the payment gateway, billed to the requesting user. It stays pending until the first payment is confirmed.
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param request body services.SubscribeRequest true "Plan and payment method"
+// @Success 201 {object} models.Subscription
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/subscription [post]
+// @Security BearerAuth
 func (h *Handler) SubscribeAccount(c *fiber.Ctx) error {
-	type Request struct {
-		PlanID uuid.UUID `json:"plan_id"`
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
 	}
-	
-	var req Request
+
+	var req services.SubscribeRequest
 	if err := c.BodyParser(&req); err != nil {
 		return h.Error(c, fiber.StatusBadRequest, "Invalid request")
 	}
 
-	// Assume Auth middleware sets UserID and AccountID
-	// For now mocked
-	accountID := 1 
-	userID := uint(1)
+	userID := uint(c.Locals("user_id").(int))
+	sub, err := h.BillingService.SubscribeAccount(c.Context(), accountID, userID, req)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    sub,
+	})
+}
+
+// CancelSubscription handles canceling the subscription of an account
+// @Summary Cancel subscription
+// @Tags Billing
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} models.Subscription
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/subscription [delete]
+// @Security BearerAuth
+func (h *Handler) CancelSubscription(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
 
-	sub, err := h.BillingService.SubscribeAccount(c.Context(), accountID, req.PlanID, userID)
+	sub, err := h.BillingService.CancelSubscription(c.Context(), accountID)
 	if err != nil {
-		return h.Error(c, fiber.StatusInternalServerError, err.Error())
+		return h.billingError(c, err)
+	}
+
+	return h.Success(c, sub)
+}
+
+// ChangePlanRequest is the plan a subscription moves to
+type ChangePlanRequest struct {
+	PlanID uuid.UUID `json:"plan_id"`
+}
+
+// ChangeSubscriptionPlan handles upgrading or downgrading the subscription of an account
+// @Summary Change subscription plan
+// @Description Moves the subscription to another plan in the payment gateway and applies the plan's features to the account entitlements. Resources the account has beyond the new limits are kept and listed in over_quota.
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param request body ChangePlanRequest true "New plan"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/subscription/plan [put]
+// @Security BearerAuth
+func (h *Handler) ChangeSubscriptionPlan(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var req ChangePlanRequest
+	if err := c.BodyParser(&req); err != nil || req.PlanID == uuid.Nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request")
+	}
+
+	sub, change, err := h.BillingService.ChangePlan(c.Context(), accountID, req.PlanID)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	h.AuditUpdate(c, "subscription", sub.ID.String(), nil, fiber.Map{"plan_id": sub.PlanID})
+
+	result := fiber.Map{"subscription": sub, "over_quota": []services.QuotaUsage{}}
+	if change != nil {
+		result["entitlements"] = change.Current
+		result["over_quota"] = change.OverQuota
+	}
+	return h.Success(c, result)
+}
+
+// GetEntitlements handles getting the limits of an account and its usage
+// @Summary Get entitlements
+// @Description Limits granted by the account's plan, how many agents, teams, integrations and inboxes it has, and which of them are over quota after a downgrade
+// @Tags Billing
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} services.EntitlementsReport
+// @Router /accounts/{accountId}/billing/entitlements [get]
+// @Security BearerAuth
+func (h *Handler) GetEntitlements(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
 	}
 
-	return c.JSON(sub)
+	report, err := h.EntitlementsService.Report(c.Context(), accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to get entitlements")
+	}
+
+	return h.Success(c, report)
+}
+
+// ListPayments handles listing the charges of the subscription of an account
+// @Summary List subscription payments
+// @Description Charges of the account's subscription, as reported by the payment gateway
+// @Tags Billing
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {array} models.Transaction
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/billing/payments [get]
+// @Security BearerAuth
+func (h *Handler) ListPayments(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	payments, err := h.BillingService.ListPayments(c.Context(), accountID)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	return h.Success(c, payments)
+}
+
+func (h *Handler) billingError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidPaymentMethod), errors.Is(err, services.ErrProviderUnavailable),
+		errors.Is(err, services.ErrInvalidPlanFeatures), errors.Is(err, services.ErrPlanInactive):
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrAccountNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Account not found")
+	case errors.Is(err, repositories.ErrPlanNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Plan not found")
+	case errors.Is(err, repositories.ErrSubscriptionNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Subscription not found")
+	case errors.Is(err, services.ErrSubscriptionExists), errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrSamePlan):
+		return h.Error(c, fiber.StatusConflict, err.Error())
+	default:
+		return h.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
 }
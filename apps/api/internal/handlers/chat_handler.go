@@ -13,11 +13,12 @@ import (
 // ChatHandler handles chat HTTP requests
 type ChatHandler struct {
 	chatService *services.ChatService
+	roles       *services.RoleService
 }
 
 // NewChatHandler creates a new chat handler
-func NewChatHandler(chatService *services.ChatService) *ChatHandler {
-	return &ChatHandler{chatService: chatService}
+func NewChatHandler(chatService *services.ChatService, roles *services.RoleService) *ChatHandler {
+	return &ChatHandler{chatService: chatService, roles: roles}
 }
 
 // ============================================================================
@@ -303,6 +304,118 @@ func (h *ChatHandler) ListMessages(c *fiber.Ctx) error {
 	})
 }
 
+// SearchMessages godoc
+// @Summary Search messages
+// @Description Full-text search over the messages of every room the current user belongs to. Snippets are HTML-escaped with matches wrapped in <mark>.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param q query string true "Search terms (websearch syntax: quotes, OR, -word)"
+// @Param room_id query string false "Room ID" format(uuid)
+// @Param sender_id query int false "Sender user ID"
+// @Param from query string false "Sent at or after (RFC3339)"
+// @Param to query string false "Sent at or before (RFC3339)"
+// @Param message_type query string false "text, system or mention"
+// @Param page query int false "Page"
+// @Param limit query int false "Results per page (max 100)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /accounts/{accountId}/chat/search [get]
+// @Security BearerAuth
+func (h *ChatHandler) SearchMessages(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+	userID := c.Locals("user_id").(int)
+
+	var req services.SearchMessagesRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid query parameters",
+			"message": err.Error(),
+		})
+	}
+	if req.Query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query (q) is required",
+		})
+	}
+
+	if roomIDStr := c.Query("room_id"); roomIDStr != "" {
+		roomID, err := uuid.Parse(roomIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid room ID",
+			})
+		}
+		req.RoomID = &roomID
+	}
+	for param, target := range map[string]**time.Time{"from": &req.From, "to": &req.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid " + param + " date, use RFC3339",
+				})
+			}
+			*target = &t
+		}
+	}
+
+	hits, total, err := h.chatService.SearchMessages(c.Context(), accountID, userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to search messages",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  hits,
+		"count": len(hits),
+		"total": total,
+	})
+}
+
+// MessageContext godoc
+// @Summary Get message context
+// @Description Get the messages around a message in chronological order, e.g. to jump to a search hit
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param messageId path string true "Message ID" format(uuid)
+// @Param before query int false "Older messages to include (default 10, max 50)"
+// @Param after query int false "Newer messages to include (default 10, max 50)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /accounts/{accountId}/chat/messages/{messageId}/context [get]
+// @Security BearerAuth
+func (h *ChatHandler) MessageContext(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+	userID := c.Locals("user_id").(int)
+
+	messageID, err := uuid.Parse(c.Params("messageId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	messages, err := h.chatService.GetMessageContext(c.Context(), accountID, userID, messageID, c.QueryInt("before", 10), c.QueryInt("after", 10))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Failed to get message context",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":       messages,
+		"count":      len(messages),
+		"message_id": messageID,
+	})
+}
+
 // SendMessage godoc
 // @Summary Send message
 // @Description Send a message to a room
@@ -358,7 +471,7 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 
 // DeleteMessage godoc
 // @Summary Delete message
-// @Description Soft-delete a message (sender or moderator only)
+// @Description Soft-delete a message (sender, room moderator or chat.moderate permission only)
 // @Tags Chat
 // @Accept json
 // @Produce json
@@ -381,7 +494,16 @@ func (h *ChatHandler) DeleteMessage(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.chatService.DeleteMessage(c.Context(), accountID, actorID, messageID); err != nil {
+	role, _ := c.Locals("whatpro_role").(string)
+	moderate, err := h.roles.HasPermission(c.Context(), accountID, actorID, role, services.PermChatModerate)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to resolve permissions",
+			"message": err.Error(),
+		})
+	}
+
+	if err := h.chatService.DeleteMessage(c.Context(), accountID, actorID, messageID, moderate); err != nil {
 		status := fiber.StatusBadRequest
 		if err.Error() == "message not found" {
 			status = fiber.StatusNotFound
@@ -439,6 +561,55 @@ func (h *ChatHandler) MarkAsRead(c *fiber.Ctx) error {
 	})
 }
 
+// Typing godoc
+// @Summary Send typing indicator
+// @Description Tell the other room members that the current user is typing. Clients should refresh it every few seconds while typing.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param roomId path string true "Room ID" format(uuid)
+// @Param body body object false "{\"typing\": true}"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /accounts/{accountId}/chat/rooms/{roomId}/typing [post]
+// @Security BearerAuth
+func (h *ChatHandler) Typing(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+	userID := c.Locals("user_id").(int)
+	roomIDStr := c.Params("roomId")
+
+	roomID, err := uuid.Parse(roomIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid room ID",
+		})
+	}
+
+	req := struct {
+		Typing bool `json:"typing"`
+	}{Typing: true}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"message": err.Error(),
+			})
+		}
+	}
+
+	if err := h.chatService.SetTyping(c.Context(), accountID, userID, roomID, req.Typing); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Failed to send typing indicator",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Typing indicator sent",
+	})
+}
+
 // ============================================================================
 // MENTIONS
 // ============================================================================
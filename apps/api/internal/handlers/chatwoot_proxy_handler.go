@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// ChatwootProxy handles forwarding a request to the Chatwoot API
+// @Summary Chatwoot API proxy
+// @Description Forwards whitelisted Chatwoot endpoints of the session's account (e.g. accounts/1/conversations) with the Chatwoot token of the signed-in user. GET responses are cached for a few seconds; X-Cache tells whether the response came from the cache.
+// @Tags Chatwoot
+// @Produce json
+// @Param path path string true "Chatwoot path relative to /api/v1, e.g. accounts/1/conversations"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /chatwoot/{path} [get]
+// @Security BearerAuth
+func (h *Handler) ChatwootProxy(c *fiber.Ctx) error {
+	resp, err := h.ChatwootProxyService.Forward(c.Context(), services.ProxyRequest{
+		UserID:      uint(c.Locals("user_id").(int)),
+		AccountID:   c.Locals("account_id").(int),
+		Method:      c.Method(),
+		Path:        c.Params("*"),
+		Query:       string(c.Request().URI().QueryString()),
+		ContentType: c.Get(fiber.HeaderContentType),
+		Body:        c.Body(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrProxyPathNotAllowed), errors.Is(err, services.ErrProxyAccountMismatch):
+			return h.Error(c, fiber.StatusForbidden, err.Error())
+		case errors.Is(err, services.ErrChatwootTokenMissing), errors.Is(err, repositories.ErrUserNotFound):
+			return h.Error(c, fiber.StatusUnauthorized, services.ErrChatwootTokenMissing.Error())
+		default:
+			return h.Error(c, fiber.StatusBadGateway, "Chatwoot request failed")
+		}
+	}
+
+	cache := "MISS"
+	if resp.Cached {
+		cache = "HIT"
+	}
+	c.Set("X-Cache", cache)
+	if resp.ContentType != "" {
+		c.Set(fiber.HeaderContentType, resp.ContentType)
+	}
+	return c.Status(resp.StatusCode).Send(resp.Body)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// ListEventsRequest defines parameters for listing webhook executions
+type ListEventsRequest struct {
+	Page      int    `query:"page"`
+	Limit     int    `query:"limit"`
+	Status    string `query:"status"`     // pending, processing, success, retry, dead
+	EventType string `query:"event_type"` // prefix match, e.g. "chatwoot" or "provider.evolution"
+}
+
+// ListEvents handles listing stored webhook executions of an account
+// @Summary List webhook executions
+// @Description List stored webhooks with their processing status (use status=dead for the dead-letter queue)
+// @Tags Events
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param status query string false "Filter by status"
+// @Param event_type query string false "Filter by event type prefix"
+// @Success 200 {object} map[string]interface{}
+// @Router /accounts/{accountId}/events [get]
+func (h *Handler) ListEvents(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var req ListEventsRequest
+	if err := c.QueryParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid query parameters")
+	}
+
+	filters := map[string]interface{}{
+		"status":     req.Status,
+		"event_type": req.EventType,
+	}
+
+	execs, total, err := h.EventService.ListExecutions(c.Context(), accountID, filters, req.Page, req.Limit)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch events")
+	}
+
+	return h.SuccessWithMeta(c, execs, fiber.Map{
+		"page":  req.Page,
+		"limit": req.Limit,
+		"total": total,
+	})
+}
+
+// GetEvent handles fetching a webhook execution with its payload
+// @Summary Get webhook execution
+// @Tags Events
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "Execution ID (UUID)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/events/{id} [get]
+func (h *Handler) GetEvent(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid event ID")
+	}
+
+	exec, err := h.EventService.GetExecution(c.Context(), accountID, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrExecutionNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "Event not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch event")
+	}
+
+	return h.Success(c, exec)
+}
+
+// ReplayEvent handles re-processing a finished webhook execution
+// @Summary Replay webhook execution
+// @Description Reset the retry counter of a failed or dead execution and enqueue it again
+// @Tags Events
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "Execution ID (UUID)"
+// @Success 202 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Execution still in progress or already processed"
+// @Router /accounts/{accountId}/events/{id}/replay [post]
+func (h *Handler) ReplayEvent(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid event ID")
+	}
+
+	exec, err := h.EventService.Replay(c.Context(), accountID, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrExecutionNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "Event not found")
+		}
+		if errors.Is(err, services.ErrExecutionInProgress) || errors.Is(err, services.ErrExecutionSucceeded) {
+			return h.Error(c, fiber.StatusConflict, err.Error())
+		}
+		h.Logger.Printf("Error replaying event %s: %v", id, err)
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to replay event")
+	}
+
+	c.Status(fiber.StatusAccepted)
+	return h.Success(c, exec)
+}
@@ -1,27 +1,46 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
-	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/providers"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/webhooks"
 )
 
-// HandleEvolutionWebhook handles webhooks from Evolution API
-func (h *Handler) HandleEvolutionWebhook(c *fiber.Ctx) error {
-	instanceToken := c.Params("instanceId") // or token
-	
-	var payload models.JSON
-	if err := c.BodyParser(&payload); err != nil {
-		return h.Error(c, fiber.StatusBadRequest, "Invalid payload")
+// HandleProviderWebhook stores webhooks from WhatsApp providers (Evolution, uazapi, baileys)
+// for background processing, once their credentials match the provider's API key
+func (h *Handler) HandleProviderWebhook(c *fiber.Ctx) error {
+	instanceID := c.Params("instanceId") // provider UUID or instance name
+
+	provider, err := h.GatewayService.ResolveProvider(c.Context(), instanceID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrProviderNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "Provider not found")
+		}
+		h.Logger.Printf("Error resolving provider %s: %v", instanceID, err)
+		return h.Error(c, fiber.StatusInternalServerError, "Processing failed")
+	}
+
+	if err := h.GatewayService.VerifyProviderWebhook(c.Context(), provider, requestHeader(c), c.Body()); err != nil {
+		switch {
+		case errors.Is(err, providers.ErrInvalidWebhook):
+			return h.Error(c, fiber.StatusUnauthorized, "Invalid webhook credentials")
+		case errors.Is(err, webhooks.ErrInvalidPayload):
+			return h.Error(c, fiber.StatusBadRequest, "Invalid payload")
+		}
+		h.Logger.Printf("Error verifying webhook of provider %s: %v", provider.ID, err)
+		return h.Error(c, fiber.StatusInternalServerError, "Processing failed")
 	}
 
-	// Async processing? Or Sync? 
-	// For high throughput, we might want to push to queue.
-	// For now, sync processing with DB log.
-	
-	if err := h.GatewayService.ProcessEvolutionWebhook(c.Context(), instanceToken, payload); err != nil {
-		h.Logger.Printf("Error processing webhook: %v", err)
+	if _, err := h.EventService.Record(c.Context(), "provider."+provider.Type, provider.AccountID, &provider.ID, c.Body()); err != nil {
+		if errors.Is(err, webhooks.ErrInvalidPayload) {
+			return h.Error(c, fiber.StatusBadRequest, "Invalid payload")
+		}
+		h.Logger.Printf("Error storing provider webhook: %v", err)
 		return h.Error(c, fiber.StatusInternalServerError, "Processing failed")
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.SendStatus(fiber.StatusAccepted)
 }
@@ -12,8 +12,10 @@ import (
 
 	"whatpro-hub/internal/config"
 	"whatpro-hub/internal/middleware"
+	"whatpro-hub/internal/realtime"
 	"whatpro-hub/internal/repositories"
 	"whatpro-hub/internal/services"
+	"whatpro-hub/internal/workers"
 	"whatpro-hub/pkg/chatwoot"
 )
 
@@ -30,9 +32,18 @@ type Handler struct {
 	EntitlementsService *services.EntitlementsService // Added EntitlementsService
 	AuditService        *services.AuditService
 	KanbanService       *services.KanbanService
+	SLAService          *services.SLAService
 	GatewayService      *services.GatewayService
+	EventService        *services.EventService
 	BillingService      *services.BillingService
 	ChatService         *services.ChatService // Internal Chat Service
+	APIKeyService       *services.APIKeyService
+	RoleService         *services.RoleService
+	RetentionService    *services.RetentionService
+	SyncService         *services.SyncService
+	InboxService        *services.InboxService
+	ChatwootProxyService *services.ChatwootProxyService
+	Hub                 *realtime.Hub
 	Validator           *validator.Validate
 	Logger              *log.Logger
 }
@@ -49,30 +60,76 @@ func NewHandler(db *gorm.DB, rdb *redis.Client, cfg *config.Config) *Handler {
 	gatewayRepo := repositories.NewGatewayRepository(db)
 	billingRepo := repositories.NewBillingRepository(db)
 	sessionRepo := repositories.NewSessionRepository(db)
+	inboxRepo := repositories.NewInboxRepository(db)
 
 	// Initialize services
 	accountService := services.NewAccountService(accountRepo, cfg.ChatwootURL, cfg.ChatwootAPIKey)
-	auditService := services.NewAuditService(auditRepo)
-	teamService := services.NewTeamService(teamRepo, userRepo)
-	userService := services.NewUserService(userRepo)
+	// Audit chain exports are signed with AUDIT_SIGNING_KEY (base64 Ed25519 seed)
+	var auditSigner *services.AuditSigner
+	if seed := getEnv("AUDIT_SIGNING_KEY", ""); seed != "" {
+		signer, err := services.NewAuditSigner(seed)
+		if err != nil {
+			log.Fatalf("Failed to initialize audit signer: %v", err)
+		}
+		auditSigner = signer
+	}
+	auditService := services.NewAuditService(auditRepo, auditSigner)
+	entitlementsService := services.NewEntitlementsService(db, auditRepo) // Plan changes are audited
+	teamService := services.NewTeamService(teamRepo, userRepo, entitlementsService)
+	userService := services.NewUserService(userRepo, entitlementsService)
 	authService := services.NewAuthService(sessionRepo, userRepo)
-	entitlementsService := services.NewEntitlementsService(db) // Initialize EntitlementsService
-	kanbanService := services.NewKanbanService(kanbanRepo)
-	gatewayService := services.NewGatewayService(gatewayRepo, nil, accountRepo) // TODO: Add ProviderRepo
-	billingService := services.NewBillingService(billingRepo, userRepo, "ASAAS_API_KEY")
+	billingService := services.NewBillingService(billingRepo, userRepo, accountRepo, entitlementsService, rdb, cfg.BillingProvider, services.NewPaymentProviders(cfg)...)
 
 	// Provider service needs encryption key (32 bytes for AES-256)
 	// You should set ENCRYPTION_KEY in your .env file
 	encryptionKey := getEnv("ENCRYPTION_KEY", "12345678901234567890123456789012") // 32 bytes
-	providerService, err := services.NewProviderService(providerRepo, encryptionKey)
+	providerService, err := services.NewProviderService(providerRepo, encryptionKey, entitlementsService)
 	if err != nil {
 		log.Fatalf("Failed to initialize provider service: %v", err)
 	}
 
+	// Realtime events fan out through Redis so every replica reaches its own clients
+	hub := realtime.NewHub(rdb)
+
 	// Initialize Chat service
 	chatRepo := repositories.NewChatRepository(db)
 	chatwootClient := chatwoot.New(cfg.ChatwootURL, cfg.ChatwootAPIKey)
-	chatService := services.NewChatService(chatRepo, auditRepo, userRepo, chatwootClient)
+	chatService := services.NewChatService(chatRepo, auditRepo, userRepo, chatwootClient, hub)
+	slaService := services.NewSLAService(kanbanRepo, userRepo, chatService)
+
+	// Gateway service relays WhatsApp traffic between providers and Chatwoot
+	gatewayService := services.NewGatewayService(gatewayRepo, providerRepo, inboxRepo, accountRepo, providerService, chatwootClient)
+
+	// Inbound webhooks are stored and handed to the worker through the Asynq queue
+	queue, err := workers.NewQueue(cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize webhook queue: %v", err)
+	}
+	eventService := services.NewEventService(gatewayRepo, queue)
+
+	// API keys act on behalf of the user who created them
+	apiKeyService := services.NewAPIKeyService(repositories.NewAPIKeyRepository(db), userRepo)
+
+	// Custom role permissions are cached in Redis
+	roleService := services.NewRoleService(repositories.NewRoleRepository(db), rdb)
+
+	// Retention policies are managed here; the worker archives the expired rows
+	retentionService := services.NewRetentionService(repositories.NewRetentionRepository(db), accountRepo, auditRepo, nil)
+
+	// Each synced inbox is served by at most one provider
+	inboxService := services.NewInboxService(inboxRepo, providerRepo)
+
+	// Chatwoot syncs requested here run in the worker
+	syncService := services.NewSyncService(repositories.NewSyncRepository(db), accountRepo, sessionRepo, entitlementsService, chatwootClient, queue)
+
+	// The Chatwoot proxy calls Chatwoot with each user's own token, stored encrypted
+	chatwootProxyService, err := services.NewChatwootProxyService(userRepo, rdb, cfg.ChatwootURL, encryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize Chatwoot proxy: %v", err)
+	}
+
+	// Card moves are recorded as events; the worker runs the stage AutoActions
+	kanbanService := services.NewKanbanService(kanbanRepo, eventService, hub, entitlementsService)
 
 	return &Handler{
 		DB:                  db,
@@ -86,9 +143,18 @@ func NewHandler(db *gorm.DB, rdb *redis.Client, cfg *config.Config) *Handler {
 		EntitlementsService: entitlementsService, // Injected EntitlementsService
 		AuditService:        auditService,
 		KanbanService:       kanbanService,
+		SLAService:          slaService,
 		GatewayService:      gatewayService,
+		EventService:        eventService,
 		BillingService:      billingService,
 		ChatService:         chatService, // Internal Chat
+		APIKeyService:       apiKeyService,
+		RoleService:         roleService,
+		RetentionService:    retentionService,
+		SyncService:         syncService,
+		InboxService:        inboxService,
+		ChatwootProxyService: chatwootProxyService,
+		Hub:                 hub,
 		Validator:           middleware.GetValidator(),
 		Logger:              log.Default(),
 	}
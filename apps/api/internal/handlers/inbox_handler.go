@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// BindInboxProviderRequest defines the provider that serves an inbox
+type BindInboxProviderRequest struct {
+	ProviderID string `json:"provider_id" validate:"required,uuid"`
+}
+
+// ListInboxes handles listing the synced inboxes of an account
+// @Summary List inboxes
+// @Description Chatwoot inboxes synced for the account, with the WhatsApp provider serving each one
+// @Tags Inboxes
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {array} models.Inbox
+// @Router /accounts/{accountId}/inboxes [get]
+// @Security BearerAuth
+func (h *Handler) ListInboxes(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	inboxes, err := h.InboxService.ListInboxes(c.Context(), accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch inboxes")
+	}
+
+	return h.Success(c, inboxes)
+}
+
+// BindInboxProvider handles choosing the provider that serves an inbox
+// @Summary Bind provider to inbox
+// @Description Replies sent from the inbox go out through the provider, and its inbound messages are posted to the inbox. A provider serves one inbox.
+// @Tags Inboxes
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "Inbox ID"
+// @Param request body BindInboxProviderRequest true "Provider"
+// @Success 200 {object} models.Inbox
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /accounts/{accountId}/inboxes/{id}/provider [put]
+// @Security BearerAuth
+func (h *Handler) BindInboxProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid inbox ID")
+	}
+
+	var req BindInboxProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	providerID, err := uuid.Parse(req.ProviderID)
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid provider ID")
+	}
+
+	inbox, previous, err := h.InboxService.BindProvider(c.Context(), accountID, uint(id), providerID)
+	if err != nil {
+		return h.inboxError(c, err, "Failed to bind provider")
+	}
+
+	h.AuditUpdate(c, "inbox", fmt.Sprintf("%d", inbox.ID), fiber.Map{"provider_id": previous}, fiber.Map{"provider_id": providerID})
+
+	return h.Success(c, inbox)
+}
+
+// UnbindInboxProvider handles removing the provider of an inbox
+// @Summary Unbind provider from inbox
+// @Tags Inboxes
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "Inbox ID"
+// @Success 200 {object} models.Inbox
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/inboxes/{id}/provider [delete]
+// @Security BearerAuth
+func (h *Handler) UnbindInboxProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid inbox ID")
+	}
+
+	inbox, previous, err := h.InboxService.UnbindProvider(c.Context(), accountID, uint(id))
+	if err != nil {
+		return h.inboxError(c, err, "Failed to unbind provider")
+	}
+
+	if previous != nil {
+		h.AuditUpdate(c, "inbox", fmt.Sprintf("%d", inbox.ID), fiber.Map{"provider_id": previous}, fiber.Map{"provider_id": nil})
+	}
+
+	return h.Success(c, inbox)
+}
+
+// inboxError maps inbox service errors to responses
+func (h *Handler) inboxError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, repositories.ErrInboxNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Inbox not found")
+	case errors.Is(err, repositories.ErrProviderNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Provider not found")
+	case errors.Is(err, services.ErrProviderAlreadyBound):
+		return h.Error(c, fiber.StatusConflict, err.Error())
+	default:
+		return h.Error(c, fiber.StatusInternalServerError, fallback)
+	}
+}
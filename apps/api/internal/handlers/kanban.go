@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
 )
 
 // ListBoards handles listing boards
@@ -64,6 +69,9 @@ func (h *Handler) CreateBoard(c *fiber.Ctx) error {
 	}
 
 	if err := h.KanbanService.CreateBoard(c.Context(), board); err != nil {
+		if errors.Is(err, services.ErrFeatureDisabled) {
+			return middleware.FeatureDisabled(c, services.FeatureKanban)
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to create board")
 	}
 
@@ -126,10 +134,11 @@ func (h *Handler) CreateStage(c *fiber.Ctx) error {
 	accountID := c.Locals("account_id").(int)
 
 	var req struct {
-		BoardID  string `json:"board_id" validate:"required"`
-		Name     string `json:"name" validate:"required"`
-		Color    string `json:"color"`
-		Position int    `json:"position"`
+		BoardID     string              `json:"board_id" validate:"required"`
+		Name        string              `json:"name" validate:"required"`
+		Color       string              `json:"color"`
+		Position    int                 `json:"position"`
+		AutoActions models.StageActions `json:"auto_actions"`
 	}
 
 	if err := h.Validate(c, &req); err != nil {
@@ -142,13 +151,17 @@ func (h *Handler) CreateStage(c *fiber.Ctx) error {
 	}
 
 	stage := &models.Stage{
-		BoardID:  boardID,
-		Name:     req.Name,
-		Color:    req.Color,
-		Position: req.Position,
+		BoardID:     boardID,
+		Name:        req.Name,
+		Color:       req.Color,
+		Position:    req.Position,
+		AutoActions: req.AutoActions,
 	}
 
 	if err := h.KanbanService.CreateStage(c.Context(), accountID, stage); err != nil {
+		if errors.Is(err, services.ErrInvalidAutoAction) {
+			return h.Error(c, fiber.StatusBadRequest, err.Error())
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to create stage")
 	}
 
@@ -173,6 +186,9 @@ func (h *Handler) UpdateStage(c *fiber.Ctx) error {
 	}
 
 	if err := h.KanbanService.UpdateStage(c.Context(), accountID, id, req); err != nil {
+		if errors.Is(err, services.ErrInvalidAutoAction) {
+			return h.Error(c, fiber.StatusBadRequest, err.Error())
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to update stage")
 	}
 
@@ -283,6 +299,7 @@ func (h *Handler) MoveCard(c *fiber.Ctx) error {
 	var req struct {
 		StageID  string `json:"stage_id" validate:"required"`
 		Position int    `json:"position"`
+		Override bool   `json:"override"` // Skip the required checklist (requires checklist.override)
 	}
 	
 	if err := h.Validate(c, &req); err != nil {
@@ -295,11 +312,44 @@ func (h *Handler) MoveCard(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("user_id").(int)
+
+	if req.Override {
+		role, _ := c.Locals("whatpro_role").(string)
+		allowed, err := h.RoleService.HasPermission(c.Context(), accountID, userID, role, services.PermChecklistOverride)
+		if err != nil {
+			return h.Error(c, fiber.StatusInternalServerError, "Failed to resolve permissions")
+		}
+		if !allowed {
+			return h.Error(c, fiber.StatusForbidden, "Missing permission to override the checklist")
+		}
+	}
 	
-	if err := h.KanbanService.MoveCard(c.Context(), accountID, id, stageID, req.Position, &userID); err != nil {
+	overridden, err := h.KanbanService.MoveCard(c.Context(), accountID, id, stageID, req.Position, &userID, req.Override)
+	if err != nil {
+		var incomplete *services.ChecklistIncompleteError
+		if errors.As(err, &incomplete) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"success":  false,
+				"error":    "Required checklist items are incomplete",
+				"status":   fiber.StatusUnprocessableEntity,
+				"code":     "checklist_incomplete",
+				"stage_id": incomplete.StageID,
+				"items":    incomplete.Items,
+			})
+		}
+		if err == repositories.ErrCardNotFound || err == repositories.ErrStageNotFound {
+			return h.Error(c, fiber.StatusNotFound, err.Error())
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to move card")
 	}
 
+	if len(overridden) > 0 {
+		h.Audit(c, services.AuditActionOverride, "card_checklist", id.String(), nil, fiber.Map{
+			"to_stage_id":      stageID,
+			"incomplete_items": overridden,
+		})
+	}
+
 	return h.Success(c, fiber.Map{"message": "Card moved successfully"})
 }
 
@@ -396,3 +446,187 @@ func (h *Handler) ListCards(c *fiber.Ctx) error {
 	}
 	return h.Success(c, fiber.Map{"cards": allCards})
 }
+
+// GetBoardSLAReport handles the SLA breach report of a board
+// @Summary Board SLA report
+// @Description Breach counts per stage and per agent since a date (default: last 30 days)
+// @Tags Kanban
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "Board ID (UUID)"
+// @Param since query string false "Start date (RFC3339)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/boards/{id}/sla [get]
+func (h *Handler) GetBoardSLAReport(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid board ID")
+	}
+
+	since := time.Now().AddDate(0, 0, -30)
+	if raw := c.Query("since"); raw != "" {
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return h.Error(c, fiber.StatusBadRequest, "Invalid since date (use RFC3339)")
+		}
+	}
+
+	report, err := h.SLAService.GetBoardReport(c.Context(), accountID, id, since)
+	if err != nil {
+		if err == repositories.ErrBoardNotFound {
+			return h.Error(c, fiber.StatusNotFound, "Board not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to build SLA report")
+	}
+
+	return h.Success(c, report)
+}
+
+// ToggleCardChecklistItem handles completing or reopening a checklist item of a card
+func (h *Handler) ToggleCardChecklistItem(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid card ID")
+	}
+	itemID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid checklist item ID")
+	}
+
+	var req struct {
+		IsCompleted bool `json:"is_completed"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	item, err := h.KanbanService.ToggleChecklistItem(c.Context(), accountID, cardID, itemID, req.IsCompleted)
+	if err != nil {
+		if err == repositories.ErrCardNotFound || err == repositories.ErrChecklistItemNotFound {
+			return h.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to update checklist item")
+	}
+
+	return h.Success(c, fiber.Map{"item": item})
+}
+
+// ListStageChecklist handles listing the checklist template of a stage
+func (h *Handler) ListStageChecklist(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+
+	stageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid stage ID")
+	}
+
+	items, err := h.KanbanService.ListStageChecklist(c.Context(), accountID, stageID)
+	if err != nil {
+		if err == repositories.ErrStageNotFound {
+			return h.Error(c, fiber.StatusNotFound, "Stage not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to list checklist")
+	}
+
+	return h.Success(c, fiber.Map{"items": items})
+}
+
+// CreateStageChecklistItem handles adding an item to the checklist template of a stage
+func (h *Handler) CreateStageChecklistItem(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+
+	stageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid stage ID")
+	}
+
+	var req struct {
+		Text       string `json:"text" validate:"required"`
+		IsRequired bool   `json:"is_required"`
+		Position   int    `json:"position"`
+	}
+	if err := h.Validate(c, &req); err != nil {
+		return err
+	}
+
+	item := &models.ChecklistItem{
+		Text:       req.Text,
+		IsRequired: req.IsRequired,
+		Position:   req.Position,
+	}
+	if err := h.KanbanService.CreateStageChecklistItem(c.Context(), accountID, stageID, item); err != nil {
+		if err == repositories.ErrStageNotFound {
+			return h.Error(c, fiber.StatusNotFound, "Stage not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to create checklist item")
+	}
+
+	h.AuditCreate(c, "stage_checklist_item", item.ID.String(), item)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"item":    item,
+	})
+}
+
+// UpdateStageChecklistItem handles updating an item of the checklist template of a stage
+func (h *Handler) UpdateStageChecklistItem(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+
+	stageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid stage ID")
+	}
+	itemID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid checklist item ID")
+	}
+
+	var req map[string]interface{}
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	item, err := h.KanbanService.UpdateStageChecklistItem(c.Context(), accountID, stageID, itemID, req)
+	if err != nil {
+		if err == repositories.ErrStageNotFound || err == repositories.ErrChecklistItemNotFound {
+			return h.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to update checklist item")
+	}
+
+	return h.Success(c, fiber.Map{"item": item})
+}
+
+// DeleteStageChecklistItem handles removing an item from the checklist template of a stage
+func (h *Handler) DeleteStageChecklistItem(c *fiber.Ctx) error {
+	accountID := c.Locals("account_id").(int)
+
+	stageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid stage ID")
+	}
+	itemID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid checklist item ID")
+	}
+
+	if err := h.KanbanService.DeleteStageChecklistItem(c.Context(), accountID, stageID, itemID); err != nil {
+		if err == repositories.ErrStageNotFound || err == repositories.ErrChecklistItemNotFound {
+			return h.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to delete checklist item")
+	}
+
+	h.AuditDelete(c, "stage_checklist_item", itemID.String(), nil)
+
+	return h.Success(c, fiber.Map{"message": "Checklist item deleted successfully"})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/middleware"
+	"whatpro-hub/internal/services"
+)
+
+// ListPlans handles listing the plans
+// @Summary List plans
+// @Description Plans accounts may subscribe to. Super admins see the deactivated ones with include_inactive=true.
+// @Tags Plans
+// @Produce json
+// @Param include_inactive query bool false "Include deactivated plans (super admins only)"
+// @Success 200 {array} models.Plan
+// @Router /plans [get]
+// @Security BearerAuth
+func (h *Handler) ListPlans(c *fiber.Ctx) error {
+	role, _ := c.Locals("whatpro_role").(string)
+	includeInactive := c.QueryBool("include_inactive") && role == "super_admin"
+
+	plans, err := h.BillingService.ListPlans(c.Context(), includeInactive)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to list plans")
+	}
+
+	return h.Success(c, plans)
+}
+
+// GetPlan handles getting a plan
+// @Summary Get plan
+// @Tags Plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {object} models.Plan
+// @Failure 404 {object} map[string]interface{}
+// @Router /plans/{id} [get]
+// @Security BearerAuth
+func (h *Handler) GetPlan(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid plan ID")
+	}
+
+	plan, err := h.BillingService.GetPlan(c.Context(), id)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	return h.Success(c, plan)
+}
+
+// CreatePlan handles creating a plan
+// @Summary Create plan
+// @Description Features set the entitlements of subscribed accounts: max_inboxes, max_agents, max_teams, max_integrations and max_monthly_messages (negative is unlimited), kanban_enabled and analytics_enabled
+// @Tags Plans
+// @Accept json
+// @Produce json
+// @Param plan body services.PlanRequest true "Plan"
+// @Success 201 {object} models.Plan
+// @Failure 400 {object} map[string]interface{}
+// @Router /plans [post]
+// @Security BearerAuth
+func (h *Handler) CreatePlan(c *fiber.Ctx) error {
+	req, failed := h.parsePlanRequest(c)
+	if failed {
+		return nil
+	}
+
+	plan, err := h.BillingService.CreatePlan(c.Context(), req)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	h.AuditCreate(c, "plan", plan.ID.String(), plan)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    plan,
+	})
+}
+
+// UpdatePlan handles updating a plan
+// @Summary Update plan
+// @Description Updates a plan and applies its features to the entitlements of every account subscribed to it. Accounts left with more resources than the new limits are listed in over_quota, by account ID.
+// @Tags Plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Param plan body services.PlanRequest true "Plan"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /plans/{id} [put]
+// @Security BearerAuth
+func (h *Handler) UpdatePlan(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid plan ID")
+	}
+
+	req, failed := h.parsePlanRequest(c)
+	if failed {
+		return nil
+	}
+
+	plan, previous, overQuota, err := h.BillingService.UpdatePlan(c.Context(), id, req)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	h.AuditUpdate(c, "plan", plan.ID.String(), previous, plan)
+
+	return h.Success(c, fiber.Map{
+		"plan":       plan,
+		"over_quota": overQuota,
+	})
+}
+
+// DeletePlan handles deactivating a plan
+// @Summary Deactivate plan
+// @Description Plans are not deleted: a deactivated plan is no longer offered, and accounts subscribed to it keep it
+// @Tags Plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {object} models.Plan
+// @Failure 404 {object} map[string]interface{}
+// @Router /plans/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeletePlan(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid plan ID")
+	}
+
+	plan, err := h.BillingService.DeactivatePlan(c.Context(), id)
+	if err != nil {
+		return h.billingError(c, err)
+	}
+
+	h.AuditDelete(c, "plan", plan.ID.String(), plan)
+
+	return h.Success(c, plan)
+}
+
+// parsePlanRequest parses and validates a plan body; failed means the error response was sent
+func (h *Handler) parsePlanRequest(c *fiber.Ctx) (services.PlanRequest, bool) {
+	var req services.PlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+		return req, true
+	}
+	if errs := middleware.ValidateStruct(req); len(errs) > 0 {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Validation failed",
+			"status":  fiber.StatusBadRequest,
+			"details": errs,
+		})
+		return req, true
+	}
+	return req, false
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/providers"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
 )
 
 // ListProvidersRequest defines parameters for listing providers
@@ -159,20 +164,9 @@ func (h *Handler) CreateProvider(c *fiber.Ctx) error {
 		return err
 	}
 
-	// CHECK ENTITLEMENTS (Quota)
-	if err := h.EntitlementsService.CanCreateResource(accountID, "provider"); err != nil {
-		return h.Error(c, fiber.StatusForbidden, err.Error())
-	}
-
-	// Validate provider type
-	validTypes := map[string]bool{
-		"evolution":  true,
-		"uazapi":     true,
-		"baileys":    true,
-		"cloud_api":  true,
-	}
-	if !validTypes[req.Type] {
-		return h.Error(c, fiber.StatusBadRequest, "Invalid provider type. Must be: evolution, uazapi, baileys, or cloud_api")
+	// Validate provider type against the registered drivers
+	if !providers.IsSupported(req.Type) {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid provider type. Must be one of: "+strings.Join(providers.Types(), ", "))
 	}
 
 	provider := &models.Provider{
@@ -186,6 +180,9 @@ func (h *Handler) CreateProvider(c *fiber.Ctx) error {
 	}
 
 	if err := h.ProviderService.CreateProvider(c.Context(), provider, req.APIKey); err != nil {
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return middleware.QuotaExceeded(c, err)
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to create provider")
 	}
 
@@ -240,6 +237,9 @@ func (h *Handler) UpdateProvider(c *fiber.Ctx) error {
 		updates["name"] = *req.Name
 	}
 	if req.Type != nil {
+		if !providers.IsSupported(*req.Type) {
+			return h.Error(c, fiber.StatusBadRequest, "Invalid provider type. Must be one of: "+strings.Join(providers.Types(), ", "))
+		}
 		updates["type"] = *req.Type
 	}
 	if req.BaseURL != nil {
@@ -351,3 +351,106 @@ func (h *Handler) CheckProviderHealth(c *fiber.Ctx) error {
 		"checked_at":  time.Now().Format(time.RFC3339),
 	})
 }
+
+// GetProviderQRCode starts pairing and returns the instance QR code
+// @Summary Get provider QR code
+// @Description Connect the WhatsApp instance and return the QR code to scan
+// @Tags Providers
+// @Produce json
+// @Param id path string true "Provider ID (UUID)"
+// @Success 200 {object} map[string]interface{}
+// @Router /providers/{id}/qrcode [get]
+func (h *Handler) GetProviderQRCode(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid provider ID")
+	}
+
+	qr, err := h.ProviderService.GetQRCode(c.Context(), accountID, id)
+	if err != nil {
+		return h.providerActionError(c, err, "Failed to fetch QR code")
+	}
+
+	return h.Success(c, fiber.Map{
+		"provider_id": id,
+		"qrcode":      qr,
+	})
+}
+
+// LogoutProvider disconnects the WhatsApp session of a provider
+// @Summary Logout provider
+// @Description Log the WhatsApp session out of the provider instance
+// @Tags Providers
+// @Produce json
+// @Param id path string true "Provider ID (UUID)"
+// @Success 200 {object} map[string]interface{}
+// @Router /providers/{id}/logout [post]
+func (h *Handler) LogoutProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid provider ID")
+	}
+
+	if err := h.ProviderService.LogoutProvider(c.Context(), accountID, id); err != nil {
+		return h.providerActionError(c, err, "Failed to logout provider")
+	}
+
+	h.Audit(c, services.AuditActionUpdate, "provider", id.String(), nil, fiber.Map{"action": "logout"})
+
+	return h.Success(c, fiber.Map{
+		"message": "Provider logged out successfully",
+	})
+}
+
+// RestartProvider restarts a provider instance
+// @Summary Restart provider
+// @Description Restart the WhatsApp instance without logging out
+// @Tags Providers
+// @Produce json
+// @Param id path string true "Provider ID (UUID)"
+// @Success 200 {object} map[string]interface{}
+// @Router /providers/{id}/restart [post]
+func (h *Handler) RestartProvider(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid provider ID")
+	}
+
+	if err := h.ProviderService.RestartProvider(c.Context(), accountID, id); err != nil {
+		return h.providerActionError(c, err, "Failed to restart provider")
+	}
+
+	h.Audit(c, services.AuditActionUpdate, "provider", id.String(), nil, fiber.Map{"action": "restart"})
+
+	return h.Success(c, fiber.Map{
+		"message": "Provider restarted successfully",
+	})
+}
+
+// providerActionError maps driver errors to HTTP responses
+func (h *Handler) providerActionError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, repositories.ErrProviderNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Provider not found")
+	case errors.Is(err, providers.ErrNotSupported), errors.Is(err, providers.ErrUnsupportedType):
+		return h.Error(c, fiber.StatusNotImplemented, err.Error())
+	}
+
+	h.Logger.Printf("%s: %v", message, err)
+	return h.Error(c, fiber.StatusBadGateway, message)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// GetRetentionPolicy handles reading the retention policy of an account
+// @Summary Get retention policy
+// @Description Days after which audit logs, chat audit entries and finished webhook executions are archived and deleted. 0 keeps rows forever.
+// @Tags Audit
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} services.RetentionPolicy
+// @Router /accounts/{accountId}/retention [get]
+// @Security BearerAuth
+func (h *Handler) GetRetentionPolicy(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	policy, err := h.RetentionService.GetPolicy(c.Context(), accountID)
+	if err != nil {
+		return h.retentionError(c, err, "Failed to fetch retention policy")
+	}
+
+	return h.Success(c, policy)
+}
+
+// UpdateRetentionPolicy handles changing the retention policy of an account
+// @Summary Update retention policy
+// @Description Set the retention of each table in days; 0 keeps rows forever. Expired rows are archived every night before they are deleted.
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param policy body services.RetentionPolicy true "Retention policy"
+// @Success 200 {object} services.RetentionPolicy
+// @Failure 400 {object} map[string]interface{}
+// @Router /accounts/{accountId}/retention [put]
+// @Security BearerAuth
+func (h *Handler) UpdateRetentionPolicy(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	var policy services.RetentionPolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	old, err := h.RetentionService.GetPolicy(c.Context(), accountID)
+	if err != nil {
+		return h.retentionError(c, err, "Failed to update retention policy")
+	}
+	if err := h.RetentionService.SetPolicy(c.Context(), accountID, policy); err != nil {
+		return h.retentionError(c, err, "Failed to update retention policy")
+	}
+
+	h.AuditUpdate(c, "retention_policy", c.Params("accountId"), old, policy)
+
+	return h.Success(c, policy)
+}
+
+// retentionError maps retention service errors to responses
+func (h *Handler) retentionError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, repositories.ErrAccountNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Account not found")
+	case errors.Is(err, services.ErrInvalidRetention):
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	default:
+		return h.Error(c, fiber.StatusInternalServerError, fallback)
+	}
+}
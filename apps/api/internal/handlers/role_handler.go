@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/middleware"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// AssignRoleRequest defines parameters for assigning a custom role to a user
+type AssignRoleRequest struct {
+	CustomRoleID *uint `json:"custom_role_id"` // null removes the custom role
+}
+
+// ListRoles handles listing the custom roles of an account
+// @Summary List roles
+// @Description List the custom roles of an account, the permissions they can grant and the permissions of the built-in roles
+// @Tags Roles
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /accounts/{accountId}/roles [get]
+// @Security BearerAuth
+func (h *Handler) ListRoles(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	roles, err := h.RoleService.List(c.Context(), accountID)
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch roles")
+	}
+
+	return h.Success(c, fiber.Map{
+		"roles":       roles,
+		"permissions": services.AllPermissions,
+		"builtin":     services.BuiltinPermissions,
+	})
+}
+
+// CreateRole handles creating a custom role
+// @Summary Create role
+// @Description Create a custom role with a set of permissions
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param role body services.RoleRequest true "Role Data"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /accounts/{accountId}/roles [post]
+// @Security BearerAuth
+func (h *Handler) CreateRole(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	req, failed := h.parseRoleRequest(c)
+	if failed {
+		return nil
+	}
+
+	role, err := h.RoleService.Create(c.Context(), accountID, req)
+	if err != nil {
+		return h.roleError(c, err, "Failed to create role")
+	}
+
+	h.AuditCreate(c, "custom_role", fmt.Sprintf("%d", role.ID), role)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"role":    role,
+	})
+}
+
+// UpdateRole handles updating a custom role
+// @Summary Update role
+// @Description Replace the name, description and permissions of a custom role
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "Role ID"
+// @Param role body services.RoleRequest true "Role Data"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/roles/{id} [put]
+// @Security BearerAuth
+func (h *Handler) UpdateRole(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid role ID")
+	}
+
+	req, failed := h.parseRoleRequest(c)
+	if failed {
+		return nil
+	}
+
+	old, err := h.RoleService.Get(c.Context(), accountID, uint(id))
+	if err != nil {
+		return h.roleError(c, err, "Failed to update role")
+	}
+
+	role, err := h.RoleService.Update(c.Context(), accountID, uint(id), req)
+	if err != nil {
+		return h.roleError(c, err, "Failed to update role")
+	}
+
+	h.AuditUpdate(c, "custom_role", fmt.Sprintf("%d", role.ID), old, role)
+
+	return h.Success(c, fiber.Map{
+		"role": role,
+	})
+}
+
+// DeleteRole handles deleting a custom role
+// @Summary Delete role
+// @Description Delete a custom role. Its users keep only their built-in role.
+// @Tags Roles
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "Role ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/roles/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeleteRole(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid role ID")
+	}
+
+	role, err := h.RoleService.Delete(c.Context(), accountID, uint(id))
+	if err != nil {
+		return h.roleError(c, err, "Failed to delete role")
+	}
+
+	h.AuditDelete(c, "custom_role", fmt.Sprintf("%d", role.ID), role)
+
+	return h.Success(c, fiber.Map{
+		"message": "Role deleted successfully",
+	})
+}
+
+// AssignUserRole handles assigning a custom role to a user
+// @Summary Assign custom role
+// @Description Set or remove (null) the custom role of a user
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "User ID"
+// @Param role body AssignRoleRequest true "Role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/users/{id}/role [put]
+// @Security BearerAuth
+func (h *Handler) AssignUserRole(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req AssignRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.RoleService.AssignToUser(c.Context(), accountID, id, req.CustomRoleID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "User not found")
+		}
+		return h.roleError(c, err, "Failed to assign role")
+	}
+
+	h.AuditUpdate(c, "user", fmt.Sprintf("%d", id), nil, fiber.Map{"custom_role_id": req.CustomRoleID})
+
+	return h.Success(c, fiber.Map{
+		"user_id":        id,
+		"custom_role_id": req.CustomRoleID,
+	})
+}
+
+// parseRoleRequest parses and validates a role body; failed means the error response was sent
+func (h *Handler) parseRoleRequest(c *fiber.Ctx) (services.RoleRequest, bool) {
+	var req services.RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.Error(c, fiber.StatusBadRequest, "Invalid request body")
+		return req, true
+	}
+	if errs := middleware.ValidateStruct(req); len(errs) > 0 {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Validation failed",
+			"status":  fiber.StatusBadRequest,
+			"details": errs,
+		})
+		return req, true
+	}
+	return req, false
+}
+
+// roleError maps role service errors to responses
+func (h *Handler) roleError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, repositories.ErrRoleNotFound):
+		return h.Error(c, fiber.StatusNotFound, "Role not found")
+	case errors.Is(err, services.ErrInvalidPermission):
+		return h.Error(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrRoleNameTaken):
+		return h.Error(c, fiber.StatusConflict, err.Error())
+	default:
+		return h.Error(c, fiber.StatusInternalServerError, fallback)
+	}
+}
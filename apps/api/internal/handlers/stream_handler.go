@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/realtime"
+	"whatpro-hub/internal/services"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream sends a comment so proxies keep it open
+	streamKeepAlive = 25 * time.Second
+	// streamWriteTimeout bounds a single write to a stream client
+	streamWriteTimeout = 10 * time.Second
+	// streamAccessTimeout bounds the room membership check of an event
+	streamAccessTimeout = 5 * time.Second
+)
+
+// Stream handles the Server-Sent Events stream of an account
+// @Summary Real-time event stream
+// @Description Server-Sent Events with chat messages, deletions, reads, mentions, typing indicators and Kanban card changes. Chat events only reach room members; mentions only reach the mentioned user. Browsers may pass the token as the access_token query parameter.
+// @Tags Events
+// @Produce text/event-stream
+// @Param accountId path int true "Account ID"
+// @Success 200 {string} string "event stream"
+// @Router /accounts/{accountId}/stream [get]
+// @Security BearerAuth
+func (h *Handler) Stream(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+	userID := c.Locals("user_id").(int)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx, Traefik)
+
+	sub := h.Hub.Subscribe(accountID, userID)
+	access := newRoomAccess(h.ChatService, accountID, userID)
+	conn := c.Context().Conn()
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		// The server WriteTimeout would cut the stream; every write gets its own deadline
+		write := func(format string, args ...interface{}) bool {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			fmt.Fprintf(w, format, args...)
+			return w.Flush() == nil
+		}
+
+		if !write("retry: 3000\n: connected\n\n") {
+			return
+		}
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return // Server shutting down
+				}
+				if !access.allowed(event) {
+					continue
+				}
+				if !write("id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data) {
+					return
+				}
+			case <-keepAlive.C:
+				if !write(": ping\n\n") {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// roomAccess caches the room memberships of a stream client. Membership
+// changes of a room drop its cached entry, so removed members stop receiving events.
+type roomAccess struct {
+	chat      *services.ChatService
+	accountID int
+	userID    int
+	rooms     map[uuid.UUID]bool
+}
+
+func newRoomAccess(chat *services.ChatService, accountID, userID int) *roomAccess {
+	return &roomAccess{
+		chat:      chat,
+		accountID: accountID,
+		userID:    userID,
+		rooms:     make(map[uuid.UUID]bool),
+	}
+}
+
+// allowed reports whether the client may receive an event, applying the same checks as ChatService.GetRoom
+func (a *roomAccess) allowed(event realtime.Event) bool {
+	if event.RoomID == nil {
+		return true
+	}
+	roomID := *event.RoomID
+
+	if event.Type == realtime.EventMemberAdded || event.Type == realtime.EventMemberRemoved {
+		delete(a.rooms, roomID)
+	}
+
+	if ok, cached := a.rooms[roomID]; cached {
+		return ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamAccessTimeout)
+	defer cancel()
+	_, err := a.chat.GetRoom(ctx, a.accountID, a.userID, roomID)
+	a.rooms[roomID] = err == nil
+	return err == nil
+}
@@ -21,12 +21,3 @@ func (h *Handler) ChatwootWebhook(c *fiber.Ctx) error {
 	// For now, just acknowledge
 	return c.SendStatus(fiber.StatusOK)
 }
-
-// =========================================================================
-// Chatwoot Proxy Handler
-// =========================================================================
-
-func (h *Handler) ChatwootProxy(c *fiber.Ctx) error {
-	// TODO: Proxy requests to Chatwoot API
-	return h.Error(c, fiber.StatusNotImplemented, "Not implemented yet")
-}
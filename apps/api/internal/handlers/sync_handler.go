@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
+)
+
+// TriggerSync handles queueing a Chatwoot sync of an account
+// @Summary Sync account from Chatwoot
+// @Description Queue a sync of the users, teams, team members, inboxes and labels of the account. Its outcome is stored as a sync report.
+// @Tags Accounts
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /accounts/{accountId}/sync [post]
+// @Security BearerAuth
+func (h *Handler) TriggerSync(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	if err := h.SyncService.Enqueue(c.Context(), accountID); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrAccountNotFound):
+			return h.Error(c, fiber.StatusNotFound, "Account not found")
+		case errors.Is(err, services.ErrSyncInProgress):
+			return h.Error(c, fiber.StatusConflict, err.Error())
+		default:
+			return h.Error(c, fiber.StatusInternalServerError, "Failed to queue sync")
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"message": "Sync queued",
+		},
+	})
+}
+
+// ListSyncReports handles listing the latest sync reports of an account
+// @Summary List sync reports
+// @Description Reports of the Chatwoot syncs of the account, newest first, with created/updated/removed counts per entity and errors
+// @Tags Accounts
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param limit query int false "Max reports (default and max 100)"
+// @Success 200 {array} models.SyncReport
+// @Router /accounts/{accountId}/sync-reports [get]
+// @Security BearerAuth
+func (h *Handler) ListSyncReports(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	reports, err := h.SyncService.ListReports(c.Context(), accountID, c.QueryInt("limit"))
+	if err != nil {
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch sync reports")
+	}
+
+	return h.Success(c, reports)
+}
+
+// GetSyncReport handles fetching a sync report
+// @Summary Get sync report
+// @Tags Accounts
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path string true "Report ID (UUID)"
+// @Success 200 {object} models.SyncReport
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/sync-reports/{id} [get]
+// @Security BearerAuth
+func (h *Handler) GetSyncReport(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid report ID")
+	}
+
+	report, err := h.SyncService.GetReport(c.Context(), accountID, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrSyncReportNotFound) {
+			return h.Error(c, fiber.StatusNotFound, "Sync report not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to fetch sync report")
+	}
+
+	return h.Success(c, report)
+}
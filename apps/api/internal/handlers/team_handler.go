@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
 )
 
 // CreateTeamRequest defines parameters for creating a team
@@ -121,11 +124,6 @@ func (h *Handler) CreateTeam(c *fiber.Ctx) error {
 		return err
 	}
 
-	// CHECK ENTITLEMENTS (Quota)
-	if err := h.EntitlementsService.CanCreateResource(accountID, "team"); err != nil {
-		return h.Error(c, fiber.StatusForbidden, err.Error())
-	}
-
 	team := &models.Team{
 		AccountID:   accountID,
 		Name:        req.Name,
@@ -138,6 +136,9 @@ func (h *Handler) CreateTeam(c *fiber.Ctx) error {
 	}
 
 	if err := h.TeamService.CreateTeam(c.Context(), team); err != nil {
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return middleware.QuotaExceeded(c, err)
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to create team")
 	}
 
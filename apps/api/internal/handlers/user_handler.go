@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/middleware"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/internal/services"
 )
 
 
@@ -112,11 +115,6 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 		return err
 	}
 
-	// CHECK ENTITLEMENTS (Quota)
-	if err := h.EntitlementsService.CanCreateResource(accountID, "agent"); err != nil {
-		return h.Error(c, fiber.StatusForbidden, err.Error())
-	}
-
 	user := &models.User{
 		AccountID:   accountID,
 		Name:        req.Name,
@@ -129,6 +127,9 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 		if err == repositories.ErrUserAlreadyExists {
 			return h.Error(c, fiber.StatusConflict, "User with this email already exists")
 		}
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return middleware.QuotaExceeded(c, err)
+		}
 		return h.Error(c, fiber.StatusInternalServerError, "Failed to create user")
 	}
 
@@ -239,6 +240,42 @@ func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "User deleted successfully"})
 }
 
+// ForceLogoutUser handles DELETE /api/v1/accounts/:accountId/users/:id/sessions
+// @Summary Force logout a user
+// @Description Revoke every session of a user of the account
+// @Tags Users
+// @Security ApiKeyAuth
+// @Produce json
+// @Param accountId path int true "Account ID"
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /accounts/{accountId}/users/{id}/sessions [delete]
+func (h *Handler) ForceLogoutUser(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("accountId")
+	if err != nil || accountID < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid account ID")
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return h.Error(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := h.AuthService.ForceLogout(c.Context(), accountID, id); err != nil {
+		if err == repositories.ErrUserNotFound {
+			return h.Error(c, fiber.StatusNotFound, "User not found")
+		}
+		return h.Error(c, fiber.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	h.Audit(c, services.AuditActionLogout, "user", fmt.Sprintf("%d", id), nil, fiber.Map{"forced": true})
+
+	return h.Success(c, fiber.Map{
+		"message": "User logged out from all sessions",
+	})
+}
+
 // CreateUserRequest defines the payload for creating a user
 type CreateUserRequest struct {
 	Name         string `json:"name" validate:"required"`
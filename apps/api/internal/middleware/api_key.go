@@ -1,17 +1,18 @@
 package middleware
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"strings"
-	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/services"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
-// APIKeyAuth middleware for validating X-API-Key header
-func APIKeyAuth(db *gorm.DB) fiber.Handler {
+// APIKeyAuth middleware for validating X-API-Key header.
+// A valid key authenticates the request as the user who created it, so the
+// account and role checks further down apply unchanged; RequireScope then
+// limits what the key may reach.
+func APIKeyAuth(keys *services.APIKeyService, audit *services.AuditService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// 1. Get Key from Header
 		apiKey := c.Get("X-API-Key")
@@ -19,51 +20,106 @@ func APIKeyAuth(db *gorm.DB) fiber.Handler {
 			return c.Next() // Fallback to other auth methods if not present
 		}
 
-		// Format: wp_live_<prefix>.<secret>
-		parts := strings.Split(apiKey, ".")
-		if len(parts) != 2 {
+		// 2. Resolve key and the user behind it
+		key, user, err := keys.Authenticate(c.Context(), apiKey)
+		if err != nil {
+			message := "Invalid API Key"
+			switch {
+			case errors.Is(err, services.ErrAPIKeyRevoked):
+				message = "API Key revoked"
+			case errors.Is(err, services.ErrAPIKeyExpired):
+				message = "API Key expired"
+			case !errors.Is(err, services.ErrInvalidAPIKey):
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to validate API Key",
+				})
+			}
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid API Key format",
+				"error": message,
 			})
 		}
 
-		prefixPart := parts[0] // wp_live_prefix
-		secret := parts[1]
-
-		// Extract real prefix (remove wp_live_)
-		if !strings.HasPrefix(prefixPart, "wp_live_") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid API Key prefix",
-			})
+		// Keys never act across accounts, even when created by a super_admin
+		role := user.WhatproRole
+		if role == "super_admin" {
+			role = "admin"
 		}
-		prefix := strings.TrimPrefix(prefixPart, "wp_live_")
 
-		// 2. Compute Hash of Secret
-		hash := sha256.New()
-		hash.Write([]byte(secret))
-		hashedSecret := hex.EncodeToString(hash.Sum(nil))
+		// 3. Store in Context
+		c.Locals("user_id", int(user.ID))
+		c.Locals("chatwoot_id", user.ChatwootID)
+		c.Locals("account_id", key.AccountID)
+		c.Locals("email", user.Email)
+		c.Locals("name", user.Name)
+		c.Locals("chatwoot_role", user.ChatwootRole)
+		c.Locals("whatpro_role", role)
+		c.Locals("api_key_id", key.ID)
+		c.Locals("scopes", services.KeyScopes(key))
+		c.Locals("auth_method", "api_key")
 
-		// 3. Find Key in DB by Prefix AND Hash
-		var keyRecord models.APIKey
-		if err := db.Where("prefix = ? AND key_hash = ?", prefix, hashedSecret).First(&keyRecord).Error; err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid API Key",
-			})
+		// 4. Record the use
+		audit.Log(c, services.AuditActionUse, "api_key", key.ID.String(), nil, map[string]interface{}{
+			"method": c.Method(),
+			"path":   c.Path(),
+		})
+
+		return c.Next()
+	}
+}
+
+// IsAPIKeyRequest reports whether the request was authenticated with an API key
+func IsAPIKeyRequest(c *fiber.Ctx) bool {
+	method, _ := c.Locals("auth_method").(string)
+	return method == "api_key"
+}
+
+// RequireScope lets API key requests through only if the key has one of the
+// scopes. Requests authenticated with a user JWT are not restricted.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !IsAPIKeyRequest(c) {
+			return c.Next()
 		}
 
-		// 4. Check Revocation/Expiry
-		if keyRecord.RevokedAt != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "API Key revoked",
-			})
+		granted, _ := c.Locals("scopes").([]string)
+		for _, scope := range scopes {
+			for _, g := range granted {
+				if g == scope {
+					return c.Next()
+				}
+			}
 		}
 
-		// 5. Store in Context
-		c.Locals("account_id", keyRecord.AccountID)
-		c.Locals("api_key_id", keyRecord.ID)
-		c.Locals("scopes", keyRecord.Scopes)
-		c.Locals("auth_method", "api_key")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Forbidden",
+			"message": "API key lacks the required scope: " + strings.Join(scopes, " or "),
+		})
+	}
+}
 
+// ResourceScope requires <resource>:read for safe methods and <resource>:write otherwise
+func ResourceScope(resource string) fiber.Handler {
+	read := RequireScope(resource+":read", resource+":write")
+	write := RequireScope(resource + ":write")
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return read(c)
+		default:
+			return write(c)
+		}
+	}
+}
+
+// DenyAPIKey blocks API key requests from routes reserved to users
+func DenyAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if IsAPIKeyRequest(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Forbidden",
+				"message": "API keys cannot access this resource",
+			})
+		}
 		return c.Next()
 	}
 }
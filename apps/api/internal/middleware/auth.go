@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"whatpro-hub/internal/services"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
@@ -22,13 +23,30 @@ type UserClaims struct {
 	Name         string `json:"name"`
 	ChatwootRole string `json:"chatwoot_role"`
 	WhatproRole  string `json:"whatpro_role"`
+	SessionID    string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // JWT returns the JWT authentication middleware
 func JWT(secret string, rdb *redis.Client) fiber.Handler {
-	return jwtware.New(jwtware.Config{
+	return jwtware.New(jwtConfig(secret, rdb))
+}
+
+// StreamJWT authenticates event streams. Browsers cannot set headers on
+// EventSource, so the token may also be sent as the access_token query parameter.
+func StreamJWT(secret string, rdb *redis.Client) fiber.Handler {
+	cfg := jwtConfig(secret, rdb)
+	cfg.TokenLookup = "header:Authorization,query:access_token"
+	cfg.AuthScheme = "Bearer"
+	return jwtware.New(cfg)
+}
+
+// jwtConfig builds the shared JWT middleware configuration
+func jwtConfig(secret string, rdb *redis.Client) jwtware.Config {
+	return jwtware.Config{
 		SigningKey: jwtware.SigningKey{Key: []byte(secret)},
+		// Requests already authenticated by APIKeyAuth carry no token
+		Filter: IsAPIKeyRequest,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "Unauthorized",
@@ -61,10 +79,13 @@ func JWT(secret string, rdb *redis.Client) fiber.Handler {
 			c.Locals("name", claims["name"].(string))
 			c.Locals("chatwoot_role", claims["chatwoot_role"].(string))
 			c.Locals("whatpro_role", claims["whatpro_role"].(string))
+			if sid, ok := claims["sid"].(string); ok {
+				c.Locals("session_id", sid)
+			}
 
 			return c.Next()
 		},
-	})
+	}
 }
 
 // RequireRole checks if the user has one of the required roles
@@ -91,6 +112,32 @@ func RequireRole(roles ...string) fiber.Handler {
 	}
 }
 
+// RequirePermission checks if the user holds a permission through their
+// built-in role or their account's custom role
+func RequirePermission(roles *services.RoleService, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		accountID := c.Locals("account_id").(int)
+		userRole := c.Locals("whatpro_role").(string)
+
+		allowed, err := roles.HasPermission(c.Context(), accountID, userID, userRole, permission)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Internal Server Error",
+				"message": "Failed to resolve permissions",
+			})
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Forbidden",
+				"message": "Missing permission: " + permission,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
 // RequireAccountAccess ensures the user has access to the requested account
 func RequireAccountAccess() fiber.Handler {
 	return func(c *fiber.Ctx) error {
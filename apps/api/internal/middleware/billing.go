@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/services"
+)
+
+// RequireActiveSubscription blocks writes of accounts whose subscription is
+// suspended for non-payment with 402 Payment Required. Reads keep working, as
+// do paths containing any of the exempt segments (e.g. "/billing/", so the
+// account can pay). The check fails open when the subscription cannot be read.
+func RequireActiveSubscription(billing *services.BillingService, exempt ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		if role, _ := c.Locals("whatpro_role").(string); role == "super_admin" {
+			return c.Next()
+		}
+		for _, segment := range exempt {
+			if strings.Contains(c.Path(), segment) {
+				return c.Next()
+			}
+		}
+
+		accountID, _ := c.Locals("account_id").(int)
+		suspended, err := billing.AccountSuspended(c.Context(), accountID)
+		if err != nil {
+			log.Printf("Failed to check the subscription of account %d: %v", accountID, err)
+			return c.Next()
+		}
+		if suspended {
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"error":   "Payment Required",
+				"code":    "subscription_suspended",
+				"message": "The subscription of this account is suspended for non-payment. Changes are blocked until the payment clears.",
+			})
+		}
+
+		return c.Next()
+	}
+}
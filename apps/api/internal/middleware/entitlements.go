@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"whatpro-hub/internal/services"
+)
+
+// RequireFeature blocks requests of accounts whose plan does not include a
+// feature (services.FeatureKanban, services.FeatureAnalytics) with 403
+// feature_disabled. The check fails open when the entitlements cannot be read.
+func RequireFeature(entitlements *services.EntitlementsService, feature string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		accountID, _ := c.Locals("account_id").(int)
+		err := entitlements.RequireFeature(c.Context(), accountID, feature)
+		switch {
+		case err == nil:
+			return c.Next()
+		case errors.Is(err, services.ErrFeatureDisabled):
+			return FeatureDisabled(c, feature)
+		default:
+			log.Printf("Failed to check feature %s of account %d: %v", feature, accountID, err)
+			return c.Next()
+		}
+	}
+}
+
+// FeatureDisabled responds 403 to a request for a feature outside the account's plan
+func FeatureDisabled(c *fiber.Ctx, feature string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":   "Forbidden",
+		"code":    "feature_disabled",
+		"feature": feature,
+		"message": "The plan of this account does not include " + feature + ".",
+	})
+}
+
+// QuotaExceeded responds 403 to a create over a plan limit, with the current
+// usage and limit when err is a *services.QuotaError
+func QuotaExceeded(c *fiber.Ctx, err error) error {
+	body := fiber.Map{
+		"error":   "Forbidden",
+		"code":    "quota_exceeded",
+		"message": err.Error(),
+	}
+	var quota *services.QuotaError
+	if errors.As(err, &quota) {
+		body["resource"] = quota.Resource
+		body["usage"] = quota.Usage
+		body["limit"] = quota.Limit
+	}
+	return c.Status(fiber.StatusForbidden).JSON(body)
+}
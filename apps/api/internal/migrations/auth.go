@@ -7,26 +7,27 @@ import (
 
 // Session tracks active user sessions for device management and revocation
 type Session struct {
-	ID           string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	UserID       int       `gorm:"index;not null"`
-	AccountID    int       `gorm:"index;not null"`
-	RefreshToken string    `gorm:"type:text;not null"` // Storing hash ideally, but for MVP checking existence
-	UserAgent    string    `gorm:"type:text"`
-	IPAddress    string    `gorm:"type:varchar(45)"`
-	ExpiresAt    time.Time `gorm:"index"`
-	RevokedAt    *time.Time
-	CreatedAt    time.Time
-	LastSeenAt   time.Time
+	ID               string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID           int       `gorm:"index;not null"`
+	AccountID        int       `gorm:"index;not null"`
+	RefreshTokenHash string    `gorm:"size:64"` // SHA-256 of the current refresh token
+	UserAgent        string    `gorm:"type:text"`
+	IPAddress        string    `gorm:"type:varchar(45)"`
+	ExpiresAt        time.Time `gorm:"index"`
+	RevokedAt        *time.Time
+	CreatedAt        time.Time
+	LastSeenAt       time.Time
 }
 
 // APIKey allows server-to-server authentication
 type APIKey struct {
 	ID        string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	AccountID int        `gorm:"index;not null"`
+	CreatedBy int        `gorm:"index"`         // User the key acts on behalf of
 	Name      string     `gorm:"size:100;not null"`
 	Prefix    string     `gorm:"size:10;index;unique;not null"`
-	KeyHash   string     `gorm:"text;not null"` // Store bcrypt hash
-	Scopes    string     `gorm:"type:text"`     // JSON or comma-separated scopes
+	KeyHash   string     `gorm:"text;not null"` // SHA-256 of the secret
+	Scopes    string     `gorm:"type:text"`     // Comma-separated scopes
 	LastUsedAt *time.Time
 	ExpiresAt  *time.Time
 	RevokedAt  *time.Time
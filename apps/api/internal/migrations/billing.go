@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+// MigrateBilling runs migrations for the plan, subscription and transaction tables
+func MigrateBilling(db *gorm.DB) error {
+	if err := db.AutoMigrate(
+		&models.Plan{},
+		&models.Subscription{},
+		&models.Transaction{},
+	); err != nil {
+		return err
+	}
+
+	// "overdue" was the status of unpaid subscriptions before the dunning states
+	return db.Model(&models.Subscription{}).
+		Where("status = ?", "overdue").
+		Update("status", models.SubscriptionPastDue).Error
+}
@@ -25,6 +25,13 @@ func MigrateChat(db *gorm.DB) error {
 		return err
 	}
 
+	// Full-text search vector, kept in sync by Postgres (Portuguese dictionary, see repositories.ChatSearchConfig)
+	searchColumn := "ALTER TABLE internal_chat_messages ADD COLUMN IF NOT EXISTS search_vector tsvector " +
+		"GENERATED ALWAYS AS (to_tsvector('portuguese', coalesce(content, ''))) STORED"
+	if err := db.Exec(searchColumn).Error; err != nil {
+		return err
+	}
+
 	// Create additional indexes
 	indexes := []string{
 		// Rooms: account + type for filtering
@@ -47,6 +54,8 @@ func MigrateChat(db *gorm.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_chat_mentions_message ON internal_chat_mentions(message_id)",
 		// Quotes: by message
 		"CREATE INDEX IF NOT EXISTS idx_chat_quotes_message ON internal_chat_quotes(message_id)",
+		// Messages: full-text search
+		"CREATE INDEX IF NOT EXISTS idx_chat_messages_search ON internal_chat_messages USING GIN(search_vector)",
 	}
 
 	for _, idx := range indexes {
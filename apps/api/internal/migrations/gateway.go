@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+// MigrateGateway runs migrations for the WhatsApp <-> Chatwoot gateway tables
+func MigrateGateway(db *gorm.DB) error {
+	if err := db.AutoMigrate(
+		&models.MessageMapping{},
+		&models.EventExecution{},
+		&models.GatewayLog{},
+	); err != nil {
+		return err
+	}
+
+	indexes := []string{
+		// Mappings: one row per provider message. Message IDs are chosen by the
+		// sender, so they are only unique within a provider.
+		"DROP INDEX IF EXISTS idx_message_mappings_wa_message",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_message_mappings_provider_wa_message ON message_mappings(provider_id, wa_message_id) WHERE wa_message_id <> ''",
+		// Mappings: conversation lookups for outbound routing
+		"CREATE INDEX IF NOT EXISTS idx_message_mappings_conversation ON message_mappings(chatwoot_conversation_id, created_at DESC)",
+		// Executions: retry sweeps
+		"CREATE INDEX IF NOT EXISTS idx_event_executions_status_retry ON event_executions(status, next_retry_at)",
+	}
+
+	for _, idx := range indexes {
+		if err := db.Exec(idx).Error; err != nil {
+			log.Printf("Warning: index creation failed: %v", err)
+		}
+	}
+
+	return nil
+}
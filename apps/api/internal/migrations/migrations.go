@@ -23,11 +23,13 @@ func RunMigrations(db *gorm.DB) error {
 	log.Println("🗑️ Dropping existing tables for fresh migration...")
 	db.Migrator().DropTable(
 		&models.AuditLog{},
+		&models.AuditChainHead{},
 		&models.Session{},
 		&models.CardHistory{},
 		&models.Card{},
 		&models.Stage{},
 		&models.Board{},
+		&models.Inbox{},
 		&models.Provider{},
 		&models.TeamMember{},
 		&models.Team{},
@@ -39,15 +41,22 @@ func RunMigrations(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.Account{},
 		&models.User{},
+		&models.CustomRole{},
 		&models.Team{},
 		&models.TeamMember{},
+		&models.Inbox{},
+		&models.Label{},
+		&models.SyncReport{},
 		&models.Provider{},
 		&models.Board{},
 		&models.Stage{},
+		&models.Company{},
 		&models.Card{},
+		&models.ChecklistItem{},
 		&models.CardHistory{},
 		&models.Session{},
 		&models.AuditLog{},
+		&models.AuditChainHead{},
 	); err != nil {
 		return fmt.Errorf("auto-migrate failed: %w", err)
 	}
@@ -62,6 +71,12 @@ func RunMigrations(db *gorm.DB) error {
 	if err := MigrateChat(db); err != nil {
 		return fmt.Errorf("failed to migrate internal chat tables: %w", err)
 	}
+	if err := MigrateGateway(db); err != nil {
+		return fmt.Errorf("failed to migrate gateway tables: %w", err)
+	}
+	if err := MigrateBilling(db); err != nil {
+		return fmt.Errorf("failed to migrate billing tables: %w", err)
+	}
 
 	// Create indexes
 	if err := createIndexes(db); err != nil {
@@ -95,6 +110,12 @@ func createIndexes(db *gorm.DB) error {
 		// TeamMembers - composite indexes
 		"CREATE INDEX IF NOT EXISTS idx_team_members_team_user ON team_members(team_id, user_id)",
 		
+		// Inboxes - a provider serves one live inbox
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_inboxes_provider ON inboxes(provider_id) WHERE provider_id IS NOT NULL AND deleted_at IS NULL",
+		
+		// SyncReports
+		"CREATE INDEX IF NOT EXISTS idx_sync_reports_account_started ON sync_reports(account_id, started_at DESC)",
+		
 		// Providers
 		"CREATE INDEX IF NOT EXISTS idx_providers_account_status ON providers(account_id, status)",
 		"CREATE INDEX IF NOT EXISTS idx_providers_type ON providers(type)",
@@ -113,8 +134,13 @@ func createIndexes(db *gorm.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_cards_stage_position ON cards(stage_id, position)",
 		
 		// CardHistory
+		// ChecklistItems
+		"CREATE INDEX IF NOT EXISTS idx_checklist_items_card_stage ON checklist_items(card_id, stage_id)",
+		
 		"CREATE INDEX IF NOT EXISTS idx_card_history_card ON card_histories(card_id)",
 		"CREATE INDEX IF NOT EXISTS idx_card_history_created ON card_histories(created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_card_history_card_stage ON card_histories(card_id, to_stage_id, created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_card_history_sla ON card_histories((metadata->>'board_id'), created_at) WHERE action = 'sla_breached'",
 		
 		// Sessions
 		"CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)",
@@ -125,6 +151,8 @@ func createIndexes(db *gorm.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_audit_logs_user ON audit_logs(user_id)",
 		"CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs(resource_type, resource_id)",
 		"CREATE INDEX IF NOT EXISTS idx_audit_logs_created ON audit_logs(created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_logs_account_created ON audit_logs(account_id, created_at DESC)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_account_sequence ON audit_logs(account_id, sequence) WHERE sequence > 0",
 	}
 
 	for _, idx := range indexes {
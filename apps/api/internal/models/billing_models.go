@@ -13,6 +13,33 @@ const (
 	ProviderStripe      = "stripe"
 )
 
+// Payment methods of a subscription
+const (
+	PaymentMethodPix        = "pix"
+	PaymentMethodBoleto     = "boleto"
+	PaymentMethodCreditCard = "credit_card"
+)
+
+// Subscription statuses. Subscriptions move trial/pending -> active ->
+// past_due -> suspended -> canceled, and back to active once a charge is paid.
+const (
+	SubscriptionPending   = "pending"
+	SubscriptionTrial     = "trial"
+	SubscriptionActive    = "active"
+	SubscriptionPastDue   = "past_due"
+	SubscriptionSuspended = "suspended"
+	SubscriptionCanceled  = "canceled"
+)
+
+// Transaction statuses
+const (
+	TransactionPending  = "pending"
+	TransactionPaid     = "paid"
+	TransactionFailed   = "failed"
+	TransactionRefunded = "refunded"
+	TransactionCanceled = "canceled"
+)
+
 // Plan represents a SaaS pricing tier
 type Plan struct {
 	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
@@ -26,6 +53,10 @@ type Plan struct {
 	// External Provider IDs (Mapping)
 	AsaasID       string `json:"asaas_id,omitempty"`
 	MercadoPagoID string `json:"mercadopago_id,omitempty"`
+	StripePriceID string `json:"stripe_price_id,omitempty"` // Recurring price charged by Stripe
+
+	// Provider bills this plan; empty uses the account or default provider
+	Provider string `json:"provider,omitempty"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -37,15 +68,24 @@ type Subscription struct {
 	AccountID int       `gorm:"index" json:"account_id"`
 	PlanID    uuid.UUID `gorm:"type:uuid;index" json:"plan_id"`
 	
-	Status        string     `gorm:"default:trial" json:"status"` // active, overdue, trial, canceled
-	Provider      string     `json:"provider"`                    // asaas, mercadopago
+	Status        string     `gorm:"default:trial;index" json:"status"` // pending, trial, active, past_due, suspended, canceled
+	Provider      string     `json:"provider"`                    // asaas, mercadopago, stripe
 	ProviderSubID string     `gorm:"index" json:"provider_sub_id"` // Subscription ID in external system
+	CheckoutURL   string     `json:"checkout_url,omitempty"`       // Where the customer pays or authorizes it
 	
 	CurrentPeriodStart time.Time `json:"current_period_start"`
 	CurrentPeriodEnd   time.Time `json:"current_period_end"`
 	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty"`
 	CanceledAt         *time.Time `json:"canceled_at,omitempty"`
 
+	// Dunning: who is reminded to pay and how far the reminders went
+	BillingEmail   string     `json:"billing_email,omitempty"`
+	BillingPhone   string     `json:"billing_phone,omitempty"`
+	PastDueSince   *time.Time `json:"past_due_since,omitempty"`
+	SuspendedAt    *time.Time `json:"suspended_at,omitempty"`
+	RemindersSent  int        `gorm:"default:0" json:"reminders_sent"`
+	LastReminderAt *time.Time `json:"last_reminder_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -58,8 +98,8 @@ type Transaction struct {
 	
 	Amount        float64   `json:"amount"`
 	Currency      string    `json:"currency"`
-	Status        string    `json:"status"` // paid, pending, failed, refunded
-	ProviderID    string    `json:"provider_id"` // Transaction ID in provider
+	Status        string    `json:"status"` // paid, pending, failed, refunded, canceled
+	ProviderID    string    `gorm:"index" json:"provider_id"` // Transaction ID in provider
 	InvoiceURL    string    `json:"invoice_url"`
 	PaymentMethod string    `json:"payment_method"` // credit_card, pix, boleto
 	
@@ -5,20 +5,23 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-// APIKey allows server-to-server auth
+// APIKey allows server-to-server auth.
+// A key acts on behalf of the user who created it, restricted to its scopes.
 type APIKey struct {
-	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	AccountID int        `gorm:"index;not null"`
-	Name      string     `gorm:"size:100;not null"`
-	Prefix    string     `gorm:"size:10;index;unique;not null"`
-	KeyHash   string     `gorm:"text;not null"`
-	Scopes    string     `gorm:"type:text"`
-	LastUsedAt *time.Time
-	ExpiresAt  *time.Time
-	RevokedAt  *time.Time
-	CreatedAt  time.Time
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AccountID  int        `gorm:"index;not null" json:"account_id"`
+	CreatedBy  int        `gorm:"index" json:"created_by"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:10;index;unique;not null" json:"prefix"`
+	KeyHash    string     `gorm:"text;not null" json:"-"`
+	Scopes     string     `gorm:"type:text" json:"scopes"` // Comma-separated, e.g. "cards:read,cards:write"
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // AccountEntitlements defines limits for an account
@@ -77,8 +80,22 @@ type User struct {
 	WhatproRole        string    `gorm:"default:agent" json:"whatpro_role"`
 	CustomRoleID       *int      `json:"custom_role_id,omitempty"`
 	AvailabilityStatus string    `gorm:"default:online" json:"availability_status"`
+	ChatwootToken      string    `gorm:"type:text" json:"-"` // Access token from the last SSO, encrypted; used by the Chatwoot proxy
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"` // Set when the agent is removed from Chatwoot
+}
+
+// CustomRole is an account-defined role. Its permissions are granted on top
+// of the user's built-in WhatproRole.
+type CustomRole struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	AccountID   int         `gorm:"uniqueIndex:idx_custom_roles_account_name" json:"account_id"`
+	Name        string      `gorm:"size:100;not null;uniqueIndex:idx_custom_roles_account_name" json:"name"`
+	Description string      `json:"description"`
+	Permissions StringArray `gorm:"type:text[]" json:"permissions"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
 }
 
 // Team represents a Chatwoot team (synced)
@@ -91,6 +108,7 @@ type Team struct {
 	AllowAutoAssign bool      `gorm:"default:true" json:"allow_auto_assign"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"` // Set when the team is removed from Chatwoot
 }
 
 // TeamMember represents team membership
@@ -101,6 +119,60 @@ type TeamMember struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Inbox represents a Chatwoot inbox (synced)
+type Inbox struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	ChatwootID       int            `gorm:"uniqueIndex" json:"chatwoot_id"`
+	AccountID        int            `gorm:"index" json:"account_id"`
+	Name             string         `json:"name"`
+	ChannelType      string         `json:"channel_type"`
+	EnableAutoAssign bool           `json:"enable_auto_assign"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// WhatsApp provider serving the inbox: it receives the agents' replies and
+	// its inbound messages are posted to the inbox. A provider serves one inbox,
+	// enforced by the unique index idx_inboxes_provider.
+	ProviderID *uuid.UUID `gorm:"type:uuid;index" json:"provider_id,omitempty"`
+	Provider   *Provider  `gorm:"foreignKey:ProviderID;constraint:OnDelete:SET NULL" json:"provider,omitempty"`
+}
+
+// Label represents a Chatwoot label (synced)
+type Label struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	ChatwootID    int            `gorm:"uniqueIndex" json:"chatwoot_id"`
+	AccountID     int            `gorm:"index" json:"account_id"`
+	Title         string         `json:"title"`
+	Description   string         `json:"description"`
+	Color         string         `json:"color"`
+	ShowOnSidebar bool           `json:"show_on_sidebar"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// SyncReport records one synchronization of an account with Chatwoot
+type SyncReport struct {
+	ID         uuid.UUID   `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	AccountID  int         `gorm:"index" json:"account_id"`
+	Trigger    string      `json:"trigger"` // schedule, manual
+	Status     string      `json:"status"`  // success, partial, failed
+	Counts     JSON        `gorm:"type:jsonb;default:'{}'" json:"counts"` // Per entity: created, updated, removed
+	Errors     StringArray `gorm:"type:text[]" json:"errors"`
+	OverQuota  bool        `gorm:"index;default:false" json:"over_quota"` // Entities over the plan limits were not mirrored
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// SyncReport statuses
+const (
+	SyncStatusSuccess = "success"
+	SyncStatusPartial = "partial" // Some entities failed; the others were synced
+	SyncStatusFailed  = "failed"
+)
+
 // Company represents a Business Entity (B2B Context)
 type Company struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
@@ -116,7 +188,7 @@ type Company struct {
 type ChecklistItem struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	CardID      *uuid.UUID `gorm:"type:uuid;index" json:"card_id,omitempty"`  // If instance
-	StageID     *uuid.UUID `gorm:"type:uuid;index" json:"stage_id,omitempty"` // If template
+	StageID     *uuid.UUID `gorm:"type:uuid;index" json:"stage_id,omitempty"` // If template; on instances, the stage that created it
 	Text        string     `json:"text"`
 	IsCompleted bool       `gorm:"default:false" json:"is_completed"`
 	IsRequired  bool       `gorm:"default:false" json:"is_required"`
@@ -162,7 +234,7 @@ type Stage struct {
 	Color       string    `gorm:"default:#4ECDC4" json:"color"`
 	Position    int       `json:"position"`
 	SLAHours    *int      `json:"sla_hours,omitempty"`
-	AutoActions JSON      `gorm:"type:jsonb;default:'[]'" json:"auto_actions"`
+	AutoActions StageActions `gorm:"type:jsonb;default:'[]'" json:"auto_actions"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Cards             []Card          `gorm:"foreignKey:StageID" json:"cards,omitempty"`
@@ -187,6 +259,8 @@ type Card struct {
 	Labels                 StringArray `gorm:"type:text[]" json:"labels"`
 	CustomAttributes       JSON       `gorm:"type:jsonb;default:'{}'" json:"custom_attributes"`
 	Position               int        `json:"position"`
+	SLABreached            bool       `gorm:"default:false;index" json:"sla_breached"`
+	SLABreachedAt          *time.Time `json:"sla_breached_at,omitempty"`
 	CreatedAt              time.Time       `json:"created_at"`
 	UpdatedAt              time.Time       `json:"updated_at"`
 	SelectedCompanyID      *uuid.UUID      `gorm:"type:uuid;index" json:"selected_company_id,omitempty"`
@@ -199,7 +273,7 @@ type CardHistory struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	CardID      uuid.UUID  `gorm:"type:uuid;index" json:"card_id"`
 	UserID      *int       `json:"user_id,omitempty"`
-	Action      string     `json:"action"` // created, moved, updated, archived
+	Action      string     `json:"action"` // created, moved, updated, archived, automation, sla_breached
 	FromStageID *uuid.UUID `gorm:"type:uuid" json:"from_stage_id,omitempty"`
 	ToStageID   *uuid.UUID `gorm:"type:uuid" json:"to_stage_id,omitempty"`
 	Metadata    JSON       `gorm:"type:jsonb;default:'{}'" json:"metadata"`
@@ -219,6 +293,25 @@ type AuditLog struct {
 	IPAddress    string    `json:"ip_address"`
 	UserAgent    string    `json:"user_agent"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Hash chain: each entry commits to the previous entry of its account.
+	// Entries written before the chain existed have sequence 0.
+	Sequence int64  `gorm:"default:0" json:"sequence"`
+	PrevHash string `gorm:"size:64" json:"prev_hash"`
+	Hash     string `gorm:"size:64" json:"hash"`
+}
+
+// AuditChainHead is the last chained audit entry of an account. Its row is
+// locked while an entry is appended, which serializes the account's chain.
+// Entries up to ArchivedSequence were moved to archives by retention; the
+// chain left in the database starts after them, from ArchivedHash.
+type AuditChainHead struct {
+	AccountID        int       `gorm:"primaryKey;autoIncrement:false" json:"account_id"`
+	Sequence         int64     `json:"sequence"`
+	Hash             string    `gorm:"size:64" json:"hash"`
+	ArchivedSequence int64     `gorm:"default:0" json:"archived_sequence"`
+	ArchivedHash     string    `gorm:"size:64" json:"archived_hash,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 // ============================================================================
@@ -233,6 +326,7 @@ type MessageMapping struct {
 	
 	// IDs
 	ChatwootMessageID *int      `gorm:"index" json:"chatwoot_message_id,omitempty"`
+	ChatwootConversationID *int `gorm:"index" json:"chatwoot_conversation_id,omitempty"`
 	WAMessageID       string    `gorm:"index" json:"wa_message_id"` // Provider's message ID
 	WAConversationID  string    `gorm:"index" json:"wa_conversation_id"` // E.g., remote JID
 	
@@ -251,9 +345,9 @@ type EventExecution struct {
 	AccountID      int       `gorm:"index" json:"account_id"`
 	ProviderID     *uuid.UUID `gorm:"type:uuid;index" json:"provider_id,omitempty"`
 	
-	EventType      string    `json:"event_type"` // e.g., "message.created", "status.update"
+	EventType      string    `json:"event_type"` // <source>.<event>, e.g. "chatwoot.message_created", "provider.evolution"
 	Payload        JSON      `gorm:"type:jsonb" json:"payload"`
-	Status         string    `gorm:"default:pending" json:"status"` // pending, processing, success, retry, failed
+	Status         string    `gorm:"default:pending" json:"status"` // pending, processing, success, retry, dead
 	
 	Retries        int       `gorm:"default:0" json:"retries"`
 	MaxRetries     int       `gorm:"default:3" json:"max_retries"`
@@ -267,6 +361,15 @@ type EventExecution struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// EventExecution statuses
+const (
+	EventStatusPending    = "pending"
+	EventStatusProcessing = "processing"
+	EventStatusSuccess    = "success"
+	EventStatusRetry      = "retry"
+	EventStatusDead       = "dead" // Dead-letter: retries exhausted, waits for a manual replay
+)
+
 // GatewayLog provides diagnostic logs for the gateway
 type GatewayLog struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
@@ -277,18 +380,20 @@ type GatewayLog struct {
 	CreatedAt time.Time `json:"created_at" gorm:"index"`
 }
 
-// Session represents a user session
+// Session represents a user session (one login on one device).
+// Its refresh tokens rotate on every use; only the hash of the current one is kept.
 type Session struct {
-	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
-	UserID       uint       `gorm:"index" json:"user_id"`
-	AccountID    int        `gorm:"index" json:"account_id"`
-	Token        string     `gorm:"uniqueIndex" json:"token"`
-	RefreshToken string     `gorm:"index" json:"refresh_token"`
-	UserAgent    string     `json:"user_agent"`
-	IPAddress    string     `json:"ip_address"`
-	ExpiresAt    time.Time  `json:"expires_at"`
-	LastSeenAt   *time.Time `json:"last_seen_at"`
-	RevokedAt    *time.Time `json:"revoked_at"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	UserID           uint       `gorm:"index" json:"user_id"`
+	AccountID        int        `gorm:"index" json:"account_id"`
+	RefreshTokenHash string     `gorm:"size:64" json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Current bool `gorm:"-" json:"current"` // Set for the session making the request
 }
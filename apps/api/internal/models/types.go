@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
@@ -45,3 +46,59 @@ func (a StringArray) Value() (driver.Value, error) {
 func (a *StringArray) Scan(value interface{}) error {
 	return pq.Array(a).Scan(value)
 }
+
+// Stage automation triggers
+const (
+	StageTriggerEnter = "on_enter"
+	StageTriggerLeave = "on_leave"
+)
+
+// Stage automation action types
+const (
+	StageActionAssignAgent     = "assign_agent"
+	StageActionAssignTeam      = "assign_team"
+	StageActionAddLabels       = "add_labels"
+	StageActionRemoveLabels    = "remove_labels"
+	StageActionSendWhatsApp    = "send_whatsapp"
+	StageActionCreateChecklist = "create_checklist"
+	StageActionPostChat        = "post_chat"
+	StageActionWebhook         = "webhook"
+)
+
+// StageAction is an automation rule run when a card enters or leaves a stage.
+// Only the fields used by its Type are set.
+type StageAction struct {
+	Trigger string     `json:"trigger"` // on_enter, on_leave
+	Type    string     `json:"type"`
+	AgentID int        `json:"agent_id,omitempty"` // assign_agent (Chatwoot user ID)
+	TeamID  int        `json:"team_id,omitempty"`  // assign_team (Chatwoot team ID)
+	Labels  []string   `json:"labels,omitempty"`   // add_labels, remove_labels
+	Message string     `json:"message,omitempty"`  // send_whatsapp, post_chat; supports {{placeholders}}
+	Items   []string   `json:"items,omitempty"`    // create_checklist
+	RoomID  *uuid.UUID `json:"room_id,omitempty"`  // post_chat
+	URL     string     `json:"url,omitempty"`      // webhook
+}
+
+// StageActions is a custom type for the stage auto_actions JSONB column
+type StageActions []StageAction
+
+// Value implements driver.Valuer
+func (a StageActions) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner
+func (a *StageActions) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
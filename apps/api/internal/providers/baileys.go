@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"whatpro-hub/pkg/webhooks"
+)
+
+func init() {
+	Register("baileys", func(cfg Config) ProviderDriver { return &BaileysDriver{cfg: cfg} })
+}
+
+// BaileysDriver talks to a baileys-api server where each instance is a session
+type BaileysDriver struct {
+	cfg Config
+}
+
+func (d *BaileysDriver) headers() map[string]string {
+	return map[string]string{"x-api-key": d.cfg.APIKey}
+}
+
+func (d *BaileysDriver) session() string {
+	return url.PathEscape(d.cfg.InstanceName)
+}
+
+// SendText sends a text message
+func (d *BaileysDriver) SendText(ctx context.Context, to, text string) (string, error) {
+	return d.send(ctx, to, map[string]interface{}{"text": text})
+}
+
+// SendMedia sends an image, video, audio or document
+func (d *BaileysDriver) SendMedia(ctx context.Context, to string, media Media) (string, error) {
+	message := map[string]interface{}{
+		media.Type: map[string]string{"url": media.URL},
+		"caption":  media.Caption,
+	}
+	if media.FileName != "" {
+		message["fileName"] = media.FileName
+	}
+	return d.send(ctx, to, message)
+}
+
+func (d *BaileysDriver) send(ctx context.Context, to string, message map[string]interface{}) (string, error) {
+	var resp struct {
+		Data struct {
+			Key struct {
+				ID string `json:"id"`
+			} `json:"key"`
+		} `json:"data"`
+	}
+	err := doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/chats/send?id="+d.session(), d.headers(),
+		map[string]interface{}{"receiver": normalizeNumber(to), "message": message}, &resp)
+	return resp.Data.Key.ID, err
+}
+
+// QRCode creates the session and returns its QR code
+func (d *BaileysDriver) QRCode(ctx context.Context) (*QRCode, error) {
+	var resp struct {
+		Data struct {
+			QR string `json:"qr"`
+		} `json:"data"`
+	}
+	if err := doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/sessions/add", d.headers(),
+		map[string]interface{}{"id": d.cfg.InstanceName}, &resp); err != nil {
+		return nil, err
+	}
+	return &QRCode{Base64: resp.Data.QR}, nil
+}
+
+// ConnectionState returns the session state
+func (d *BaileysDriver) ConnectionState(ctx context.Context) (ConnectionState, error) {
+	var resp struct {
+		Data struct {
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := doJSON(ctx, http.MethodGet, d.cfg.BaseURL+"/sessions/status/"+d.session(), d.headers(), nil, &resp); err != nil {
+		return StateDisconnected, err
+	}
+
+	switch resp.Data.Status {
+	case "authenticated":
+		return StateConnected, nil
+	case "connecting", "connected":
+		// "connected" means the socket is open but the QR code was not scanned yet
+		return StateConnecting, nil
+	}
+	return StateDisconnected, nil
+}
+
+// Logout deletes the session
+func (d *BaileysDriver) Logout(ctx context.Context) error {
+	return doJSON(ctx, http.MethodDelete, d.cfg.BaseURL+"/sessions/delete/"+d.session(), d.headers(), nil, nil)
+}
+
+// Restart is not exposed by baileys-api
+func (d *BaileysDriver) Restart(ctx context.Context) error {
+	return ErrNotSupported
+}
+
+// VerifyWebhook checks the x-api-key header baileys-api sends with its webhooks
+func (d *BaileysDriver) VerifyWebhook(header http.Header, body []byte) error {
+	return verifySecret(d.cfg.APIKey, header.Get("x-api-key"))
+}
+
+// ParseWebhook normalizes the raw Baileys events forwarded by baileys-api
+func (d *BaileysDriver) ParseWebhook(body []byte) ([]InboundEvent, error) {
+	var webhook struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, webhooks.ErrInvalidPayload
+	}
+
+	switch webhook.Event {
+	case "messages.upsert":
+		var data struct {
+			Messages []webhooks.EvolutionMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(webhook.Data, &data); err != nil {
+			return nil, webhooks.ErrInvalidPayload
+		}
+		events := make([]InboundEvent, 0, len(data.Messages))
+		for i := range data.Messages {
+			msg := &data.Messages[i]
+			events = append(events, InboundEvent{
+				Kind: EventMessage,
+				Name: webhook.Event,
+				Message: &InboundMessage{
+					ID:        msg.Key.ID,
+					ChatID:    msg.Key.RemoteJID,
+					FromMe:    msg.Key.FromMe,
+					PushName:  msg.PushName,
+					Text:      msg.Text(),
+					Timestamp: msg.MessageTimestamp,
+				},
+			})
+		}
+		return events, nil
+
+	case "messages.update":
+		var updates []struct {
+			Key    webhooks.EvolutionMessageKey `json:"key"`
+			Update struct {
+				Status int `json:"status"`
+			} `json:"update"`
+		}
+		if err := json.Unmarshal(webhook.Data, &updates); err != nil {
+			return nil, webhooks.ErrInvalidPayload
+		}
+		events := make([]InboundEvent, 0, len(updates))
+		for _, u := range updates {
+			status := baileysMessageStatus(u.Update.Status)
+			if status == "" {
+				continue
+			}
+			events = append(events, InboundEvent{
+				Kind:   EventStatus,
+				Name:   webhook.Event,
+				Status: &StatusUpdate{MessageID: u.Key.ID, ChatID: u.Key.RemoteJID, Status: status},
+			})
+		}
+		return events, nil
+
+	case "connection.update":
+		var data struct {
+			Connection string `json:"connection"`
+		}
+		if err := json.Unmarshal(webhook.Data, &data); err != nil {
+			return nil, webhooks.ErrInvalidPayload
+		}
+		if data.Connection == "" {
+			return nil, nil
+		}
+		return []InboundEvent{{Kind: EventConnection, Name: webhook.Event, State: evolutionState(data.Connection)}}, nil
+	}
+
+	return nil, nil
+}
+
+// baileysMessageStatus maps the proto WebMessageInfo status enum
+func baileysMessageStatus(status int) string {
+	switch status {
+	case 0:
+		return StatusFailed
+	case 2:
+		return StatusSent
+	case 3:
+		return StatusDelivered
+	case 4, 5:
+		return StatusRead
+	}
+	return ""
+}
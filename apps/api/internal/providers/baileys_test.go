@@ -0,0 +1,75 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBaileysDriver_API(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chats/send", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "sess1" || r.Header.Get("x-api-key") != "key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Receiver string                 `json:"receiver"`
+			Message  map[string]interface{} `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Receiver != "5511999999999" || body.Message["text"] != "hi" {
+			t.Errorf("unexpected body: %+v", body)
+		}
+		w.Write([]byte(`{"success":true,"data":{"key":{"id":"BL-1"}}}`))
+	})
+	mux.HandleFunc("/sessions/status/sess1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"status":"authenticated"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	driver, _ := New("baileys", Config{BaseURL: srv.URL, APIKey: "key", InstanceName: "sess1"})
+	ctx := context.Background()
+
+	id, err := driver.SendText(ctx, "5511999999999", "hi")
+	if err != nil || id != "BL-1" {
+		t.Fatalf("SendText = %q, %v", id, err)
+	}
+
+	state, err := driver.ConnectionState(ctx)
+	if err != nil || state != StateConnected {
+		t.Fatalf("ConnectionState = %q, %v", state, err)
+	}
+}
+
+func TestBaileysDriver_ParseWebhook(t *testing.T) {
+	driver := &BaileysDriver{}
+
+	events, err := driver.ParseWebhook([]byte(`{"event":"messages.upsert","data":{"type":"notify","messages":[{"key":{"remoteJid":"5511@s.whatsapp.net","id":"BL-9"},"message":{"conversation":"bom dia"}}]}}`))
+	if err != nil || len(events) != 1 || events[0].Message.Text != "bom dia" {
+		t.Fatalf("unexpected message event: %+v, %v", events, err)
+	}
+
+	events, err = driver.ParseWebhook([]byte(`{"event":"messages.update","data":[{"key":{"id":"BL-1"},"update":{"status":4}}]}`))
+	if err != nil || len(events) != 1 || events[0].Status.Status != StatusRead {
+		t.Fatalf("unexpected status event: %+v, %v", events, err)
+	}
+}
+
+func TestBaileysDriver_VerifyWebhook(t *testing.T) {
+	driver := &BaileysDriver{cfg: Config{APIKey: "key"}}
+
+	header := http.Header{}
+	header.Set("x-api-key", "key")
+	if err := driver.VerifyWebhook(header, nil); err != nil {
+		t.Fatalf("expected the API key to be accepted, got %v", err)
+	}
+	header.Set("x-api-key", "nope")
+	if err := driver.VerifyWebhook(header, nil); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected a wrong key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package providers implements the WhatsApp backends behind a Provider
+package providers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported provider type")
+	ErrNotSupported    = errors.New("operation not supported by provider")
+	ErrInvalidWebhook  = errors.New("invalid webhook credentials")
+)
+
+// ConnectionState is the normalized connection state of a WhatsApp instance.
+// Values match models.Provider.Status.
+type ConnectionState string
+
+const (
+	StateConnected    ConnectionState = "connected"
+	StateConnecting   ConnectionState = "connecting"
+	StateDisconnected ConnectionState = "disconnected"
+	// StateUnknown is a state the driver does not recognize; it never replaces
+	// the stored status
+	StateUnknown ConnectionState = "unknown"
+)
+
+// Message delivery statuses, matching models.MessageMapping.Status
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusFailed    = "failed"
+)
+
+// Config holds what a driver needs to talk to a provider instance
+type Config struct {
+	BaseURL      string
+	APIKey       string
+	InstanceName string
+}
+
+// Media describes an attachment sent to WhatsApp
+type Media struct {
+	Type     string // image, video, audio, document
+	URL      string
+	FileName string
+	Caption  string
+}
+
+// QRCode is the pairing information of a disconnected instance
+type QRCode struct {
+	Code        string `json:"code,omitempty"`
+	Base64      string `json:"base64,omitempty"` // data:image/png;base64,...
+	PairingCode string `json:"pairing_code,omitempty"`
+}
+
+// EventKind identifies the type of a normalized inbound event
+type EventKind string
+
+const (
+	EventMessage    EventKind = "message"
+	EventStatus     EventKind = "status"
+	EventConnection EventKind = "connection"
+)
+
+// InboundMessage is a WhatsApp message received by the provider
+type InboundMessage struct {
+	ID        string
+	ChatID    string // remote JID
+	FromMe    bool
+	PushName  string
+	Text      string
+	Timestamp int64
+}
+
+// StatusUpdate is a delivery receipt for a previously sent message
+type StatusUpdate struct {
+	MessageID string
+	ChatID    string
+	Status    string // sent, delivered, read, failed
+}
+
+// InboundEvent is a provider webhook event normalized across drivers
+type InboundEvent struct {
+	Kind    EventKind
+	Name    string // Provider specific event name
+	Message *InboundMessage
+	Status  *StatusUpdate
+	State   ConnectionState
+}
+
+// ProviderDriver is implemented by every WhatsApp backend
+type ProviderDriver interface {
+	// SendText sends a text message and returns the WhatsApp message ID
+	SendText(ctx context.Context, to, text string) (string, error)
+	// SendMedia sends a media message and returns the WhatsApp message ID
+	SendMedia(ctx context.Context, to string, media Media) (string, error)
+	// QRCode starts pairing and returns the QR code to scan
+	QRCode(ctx context.Context) (*QRCode, error)
+	// ConnectionState returns the current connection state of the instance
+	ConnectionState(ctx context.Context) (ConnectionState, error)
+	// Logout disconnects the WhatsApp session from the instance
+	Logout(ctx context.Context) error
+	// Restart restarts the instance without logging out
+	Restart(ctx context.Context) error
+	// VerifyWebhook checks that a webhook was sent by the instance, returning
+	// ErrInvalidWebhook when its credentials do not match
+	VerifyWebhook(header http.Header, body []byte) error
+	// ParseWebhook normalizes an inbound webhook payload. Unknown events are dropped.
+	ParseWebhook(body []byte) ([]InboundEvent, error)
+}
+
+// verifySecret compares a webhook credential with the provider's in constant
+// time. A provider without a secret accepts no webhook.
+func verifySecret(expected, got string) error {
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(got)) != 1 {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
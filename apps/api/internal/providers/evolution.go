@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"whatpro-hub/pkg/webhooks"
+)
+
+func init() {
+	Register("evolution", func(cfg Config) ProviderDriver { return &EvolutionDriver{cfg: cfg} })
+}
+
+// EvolutionDriver talks to Evolution API v2
+type EvolutionDriver struct {
+	cfg Config
+}
+
+func (d *EvolutionDriver) url(path string) string {
+	return d.cfg.BaseURL + path + "/" + d.cfg.InstanceName
+}
+
+func (d *EvolutionDriver) headers() map[string]string {
+	return map[string]string{"apikey": d.cfg.APIKey}
+}
+
+// SendText sends a text message
+func (d *EvolutionDriver) SendText(ctx context.Context, to, text string) (string, error) {
+	var resp evolutionSendResponse
+	err := doJSON(ctx, http.MethodPost, d.url("/message/sendText"), d.headers(),
+		map[string]interface{}{"number": normalizeNumber(to), "text": text}, &resp)
+	return resp.Key.ID, err
+}
+
+// SendMedia sends an image, video, audio or document
+func (d *EvolutionDriver) SendMedia(ctx context.Context, to string, media Media) (string, error) {
+	var resp evolutionSendResponse
+	err := doJSON(ctx, http.MethodPost, d.url("/message/sendMedia"), d.headers(),
+		map[string]interface{}{
+			"number":    normalizeNumber(to),
+			"mediatype": media.Type,
+			"media":     media.URL,
+			"fileName":  media.FileName,
+			"caption":   media.Caption,
+		}, &resp)
+	return resp.Key.ID, err
+}
+
+// QRCode connects the instance and returns its QR code
+func (d *EvolutionDriver) QRCode(ctx context.Context) (*QRCode, error) {
+	var resp struct {
+		Code        string `json:"code"`
+		Base64      string `json:"base64"`
+		PairingCode string `json:"pairingCode"`
+	}
+	if err := doJSON(ctx, http.MethodGet, d.url("/instance/connect"), d.headers(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &QRCode{Code: resp.Code, Base64: resp.Base64, PairingCode: resp.PairingCode}, nil
+}
+
+// ConnectionState returns the instance state
+func (d *EvolutionDriver) ConnectionState(ctx context.Context) (ConnectionState, error) {
+	var resp struct {
+		Instance struct {
+			State string `json:"state"`
+		} `json:"instance"`
+	}
+	if err := doJSON(ctx, http.MethodGet, d.url("/instance/connectionState"), d.headers(), nil, &resp); err != nil {
+		return StateDisconnected, err
+	}
+	return evolutionState(resp.Instance.State), nil
+}
+
+// Logout logs the WhatsApp session out of the instance
+func (d *EvolutionDriver) Logout(ctx context.Context) error {
+	return doJSON(ctx, http.MethodDelete, d.url("/instance/logout"), d.headers(), nil, nil)
+}
+
+// Restart restarts the instance
+func (d *EvolutionDriver) Restart(ctx context.Context) error {
+	return doJSON(ctx, http.MethodPost, d.url("/instance/restart"), d.headers(), nil, nil)
+}
+
+// VerifyWebhook checks the apikey Evolution sends in the body of every webhook
+func (d *EvolutionDriver) VerifyWebhook(header http.Header, body []byte) error {
+	var webhook struct {
+		APIKey string `json:"apikey"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return webhooks.ErrInvalidPayload
+	}
+	return verifySecret(d.cfg.APIKey, webhook.APIKey)
+}
+
+// ParseWebhook normalizes messages.upsert, messages.update and connection.update events
+func (d *EvolutionDriver) ParseWebhook(body []byte) ([]InboundEvent, error) {
+	webhook, err := webhooks.ParseEvolutionWebhook(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch webhook.Event {
+	case webhooks.EvolutionMessagesUpsert:
+		msg, err := webhooks.ParseEvolutionMessage(webhook.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []InboundEvent{{
+			Kind: EventMessage,
+			Name: webhook.Event,
+			Message: &InboundMessage{
+				ID:        msg.Key.ID,
+				ChatID:    msg.Key.RemoteJID,
+				FromMe:    msg.Key.FromMe,
+				PushName:  msg.PushName,
+				Text:      msg.Text(),
+				Timestamp: msg.MessageTimestamp,
+			},
+		}}, nil
+
+	case webhooks.EvolutionMessagesUpdate:
+		update, err := webhooks.ParseEvolutionMessageStatus(webhook.Data)
+		if err != nil {
+			return nil, err
+		}
+		status := evolutionMessageStatus(update.Status)
+		if status == "" {
+			return nil, nil
+		}
+		return []InboundEvent{{
+			Kind:   EventStatus,
+			Name:   webhook.Event,
+			Status: &StatusUpdate{MessageID: update.KeyID, ChatID: update.RemoteJID, Status: status},
+		}}, nil
+
+	case webhooks.EvolutionConnectionUpdate:
+		conn, err := webhooks.ParseEvolutionConnection(webhook.Data)
+		if err != nil {
+			return nil, err
+		}
+		state := evolutionState(conn.State)
+		if state == StateUnknown {
+			return nil, nil
+		}
+		return []InboundEvent{{Kind: EventConnection, Name: webhook.Event, State: state}}, nil
+	}
+
+	return nil, nil
+}
+
+type evolutionSendResponse struct {
+	Key struct {
+		ID string `json:"id"`
+	} `json:"key"`
+}
+
+// evolutionState maps Evolution instance states. Anything else, including a
+// missing state, is StateUnknown rather than a disconnection.
+func evolutionState(state string) ConnectionState {
+	switch state {
+	case "open":
+		return StateConnected
+	case "connecting":
+		return StateConnecting
+	case "close", "refused":
+		return StateDisconnected
+	}
+	return StateUnknown
+}
+
+// evolutionMessageStatus maps Evolution receipt statuses
+func evolutionMessageStatus(status string) string {
+	switch status {
+	case "SERVER_ACK":
+		return StatusSent
+	case "DELIVERY_ACK":
+		return StatusDelivered
+	case "READ", "PLAYED":
+		return StatusRead
+	case "ERROR":
+		return StatusFailed
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newEvolutionFake(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/message/sendText/inst1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apikey") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if body["number"] != "5511999999999" || body["text"] != "hello" {
+			t.Errorf("unexpected body: %v", body)
+		}
+		w.Write([]byte(`{"key":{"id":"WA-1","remoteJid":"5511999999999@s.whatsapp.net"}}`))
+	})
+	mux.HandleFunc("/message/sendMedia/inst1", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["mediatype"] != "image" || body["media"] != "https://cdn/x.png" {
+			t.Errorf("unexpected body: %v", body)
+		}
+		w.Write([]byte(`{"key":{"id":"WA-2"}}`))
+	})
+	mux.HandleFunc("/instance/connectionState/inst1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"instance":{"instanceName":"inst1","state":"open"}}`))
+	})
+	mux.HandleFunc("/instance/connect/inst1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"pairingCode":"ABCD-1234","code":"2@xyz","base64":"data:image/png;base64,AAA"}`))
+	})
+	mux.HandleFunc("/instance/logout/inst1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte(`{"status":"SUCCESS"}`))
+	})
+	mux.HandleFunc("/instance/restart/inst1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEvolutionDriver_API(t *testing.T) {
+	srv := newEvolutionFake(t)
+	driver, err := New("evolution", Config{BaseURL: srv.URL, APIKey: "secret", InstanceName: "inst1"})
+	if err != nil {
+		t.Fatalf("new driver: %v", err)
+	}
+	ctx := context.Background()
+
+	id, err := driver.SendText(ctx, "5511999999999@s.whatsapp.net", "hello")
+	if err != nil || id != "WA-1" {
+		t.Fatalf("SendText = %q, %v", id, err)
+	}
+
+	id, err = driver.SendMedia(ctx, "+55 11 99999-9999", Media{Type: "image", URL: "https://cdn/x.png"})
+	if err != nil || id != "WA-2" {
+		t.Fatalf("SendMedia = %q, %v", id, err)
+	}
+
+	state, err := driver.ConnectionState(ctx)
+	if err != nil || state != StateConnected {
+		t.Fatalf("ConnectionState = %q, %v", state, err)
+	}
+
+	qr, err := driver.QRCode(ctx)
+	if err != nil || qr.PairingCode != "ABCD-1234" || qr.Base64 == "" {
+		t.Fatalf("QRCode = %+v, %v", qr, err)
+	}
+
+	if err := driver.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if err := driver.Restart(ctx); err == nil {
+		t.Fatal("Restart: expected error on 500")
+	}
+}
+
+func TestEvolutionDriver_ParseWebhook(t *testing.T) {
+	driver := &EvolutionDriver{}
+
+	events, err := driver.ParseWebhook([]byte(`{
+		"event": "MESSAGES_UPSERT",
+		"instance": "inst1",
+		"data": {
+			"key": {"remoteJid": "5511999999999@s.whatsapp.net", "fromMe": false, "id": "WA-9"},
+			"pushName": "Maria",
+			"message": {"extendedTextMessage": {"text": "oi"}},
+			"messageTimestamp": 1700000000
+		}
+	}`))
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ParseWebhook = %v, %v", events, err)
+	}
+	msg := events[0].Message
+	if events[0].Kind != EventMessage || msg.ID != "WA-9" || msg.Text != "oi" || msg.PushName != "Maria" {
+		t.Fatalf("unexpected message event: %+v", msg)
+	}
+
+	events, err = driver.ParseWebhook([]byte(`{"event":"messages.update","data":{"keyId":"WA-1","remoteJid":"x@s.whatsapp.net","status":"READ"}}`))
+	if err != nil || len(events) != 1 || events[0].Status.Status != StatusRead || events[0].Status.MessageID != "WA-1" {
+		t.Fatalf("unexpected status event: %+v, %v", events, err)
+	}
+
+	events, err = driver.ParseWebhook([]byte(`{"event":"connection.update","data":{"instance":"inst1","state":"close"}}`))
+	if err != nil || len(events) != 1 || events[0].State != StateDisconnected {
+		t.Fatalf("unexpected connection event: %+v, %v", events, err)
+	}
+
+	events, err = driver.ParseWebhook([]byte(`{"event":"presence.update","data":{}}`))
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected unknown events to be dropped, got %+v, %v", events, err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, providerType := range []string{"evolution", "uazapi", "baileys"} {
+		if !IsSupported(providerType) {
+			t.Errorf("%s driver is not registered", providerType)
+		}
+	}
+
+	if _, err := New("telegram", Config{}); err == nil {
+		t.Fatal("expected error for unknown provider type")
+	}
+}
+
+func TestEvolutionDriver_VerifyWebhook(t *testing.T) {
+	driver := &EvolutionDriver{cfg: Config{APIKey: "secret"}}
+
+	if err := driver.VerifyWebhook(nil, []byte(`{"event":"messages.upsert","apikey":"secret"}`)); err != nil {
+		t.Fatalf("expected the instance apikey to be accepted, got %v", err)
+	}
+	for _, body := range []string{
+		`{"event":"messages.upsert","apikey":"wrong"}`,
+		`{"event":"messages.upsert"}`,
+	} {
+		if err := driver.VerifyWebhook(nil, []byte(body)); !errors.Is(err, ErrInvalidWebhook) {
+			t.Fatalf("expected %s to be rejected, got %v", body, err)
+		}
+	}
+
+	// A provider without a key accepts nothing
+	if err := (&EvolutionDriver{}).VerifyWebhook(nil, []byte(`{"apikey":""}`)); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected an empty key to be rejected, got %v", err)
+	}
+}
+
+func TestEvolutionState(t *testing.T) {
+	cases := map[string]ConnectionState{
+		"open":       StateConnected,
+		"connecting": StateConnecting,
+		"close":      StateDisconnected,
+		"":           StateUnknown,
+		"syncing":    StateUnknown,
+	}
+	for state, want := range cases {
+		if got := evolutionState(state); got != want {
+			t.Fatalf("evolutionState(%q) = %q, want %q", state, got, want)
+		}
+	}
+
+	// A connection.update without a known state does not touch the provider
+	events, err := (&EvolutionDriver{}).ParseWebhook([]byte(`{"event":"connection.update","data":{"instance":"inst1"}}`))
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected the event to be dropped, got %+v, %v", events, err)
+	}
+}
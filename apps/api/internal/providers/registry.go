@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"whatpro-hub/internal/models"
+)
+
+// Factory builds a driver for a provider instance
+type Factory func(cfg Config) ProviderDriver
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a driver available for a Provider.Type
+func Register(providerType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[providerType]; exists {
+		panic("providers: driver already registered for " + providerType)
+	}
+	registry[providerType] = factory
+}
+
+// New returns the driver registered for a provider type
+func New(providerType string, cfg Config) (ProviderDriver, error) {
+	registryMu.RLock()
+	factory, ok := registry[providerType]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, providerType)
+	}
+	return factory(cfg), nil
+}
+
+// ForProvider returns the driver for a stored provider and its decrypted API key
+func ForProvider(provider *models.Provider, apiKey string) (ProviderDriver, error) {
+	return New(provider.Type, Config{
+		BaseURL:      provider.BaseURL,
+		APIKey:       apiKey,
+		InstanceName: provider.InstanceName,
+	})
+}
+
+// IsSupported reports whether a driver is registered for a provider type
+func IsSupported(providerType string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	_, ok := registry[providerType]
+	return ok
+}
+
+// Types returns the registered provider types in alphabetical order
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"whatpro-hub/pkg/webhooks"
+)
+
+func init() {
+	Register("uazapi", func(cfg Config) ProviderDriver { return &UazapiDriver{cfg: cfg} })
+}
+
+// UazapiDriver talks to uazapiGO v2. Each instance has its own token, so the
+// instance name is not part of the URL.
+type UazapiDriver struct {
+	cfg Config
+}
+
+func (d *UazapiDriver) headers() map[string]string {
+	return map[string]string{"token": d.cfg.APIKey}
+}
+
+// SendText sends a text message
+func (d *UazapiDriver) SendText(ctx context.Context, to, text string) (string, error) {
+	var resp uazapiSendResponse
+	err := doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/send/text", d.headers(),
+		map[string]interface{}{"number": normalizeNumber(to), "text": text}, &resp)
+	return resp.messageID(), err
+}
+
+// SendMedia sends an image, video, audio or document
+func (d *UazapiDriver) SendMedia(ctx context.Context, to string, media Media) (string, error) {
+	var resp uazapiSendResponse
+	err := doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/send/media", d.headers(),
+		map[string]interface{}{
+			"number":  normalizeNumber(to),
+			"type":    media.Type,
+			"file":    media.URL,
+			"docName": media.FileName,
+			"text":    media.Caption,
+		}, &resp)
+	return resp.messageID(), err
+}
+
+// QRCode connects the instance and returns its QR code
+func (d *UazapiDriver) QRCode(ctx context.Context) (*QRCode, error) {
+	var resp uazapiInstanceResponse
+	if err := doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/instance/connect", d.headers(), map[string]interface{}{}, &resp); err != nil {
+		return nil, err
+	}
+	return &QRCode{Base64: resp.Instance.QRCode, PairingCode: resp.Instance.PairCode}, nil
+}
+
+// ConnectionState returns the instance state
+func (d *UazapiDriver) ConnectionState(ctx context.Context) (ConnectionState, error) {
+	var resp uazapiInstanceResponse
+	if err := doJSON(ctx, http.MethodGet, d.cfg.BaseURL+"/instance/status", d.headers(), nil, &resp); err != nil {
+		return StateDisconnected, err
+	}
+	return uazapiState(resp.Instance.Status), nil
+}
+
+// Logout disconnects the WhatsApp session
+func (d *UazapiDriver) Logout(ctx context.Context) error {
+	return doJSON(ctx, http.MethodPost, d.cfg.BaseURL+"/instance/disconnect", d.headers(), map[string]interface{}{}, nil)
+}
+
+// Restart is not exposed by uazapi
+func (d *UazapiDriver) Restart(ctx context.Context) error {
+	return ErrNotSupported
+}
+
+// VerifyWebhook checks the instance token uazapi sends in the body of every webhook
+func (d *UazapiDriver) VerifyWebhook(header http.Header, body []byte) error {
+	var webhook struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return webhooks.ErrInvalidPayload
+	}
+	return verifySecret(d.cfg.APIKey, webhook.Token)
+}
+
+// ParseWebhook normalizes messages, messages_update and connection events
+func (d *UazapiDriver) ParseWebhook(body []byte) ([]InboundEvent, error) {
+	var webhook struct {
+		EventType string `json:"EventType"`
+		Message   struct {
+			ID               string `json:"id"`
+			MessageID        string `json:"messageid"`
+			ChatID           string `json:"chatid"`
+			FromMe           bool   `json:"fromMe"`
+			SenderName       string `json:"senderName"`
+			Text             string `json:"text"`
+			MessageTimestamp int64  `json:"messageTimestamp"`
+			IsGroup          bool   `json:"isGroup"`
+		} `json:"message"`
+		Event struct {
+			Type       string   `json:"Type"`
+			Chat       string   `json:"Chat"`
+			MessageIDs []string `json:"MessageIDs"`
+		} `json:"event"`
+		Instance struct {
+			Status string `json:"status"`
+		} `json:"instance"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, webhooks.ErrInvalidPayload
+	}
+
+	switch webhook.EventType {
+	case "messages":
+		id := webhook.Message.MessageID
+		if id == "" {
+			id = webhook.Message.ID
+		}
+		return []InboundEvent{{
+			Kind: EventMessage,
+			Name: webhook.EventType,
+			Message: &InboundMessage{
+				ID:        id,
+				ChatID:    webhook.Message.ChatID,
+				FromMe:    webhook.Message.FromMe,
+				PushName:  webhook.Message.SenderName,
+				Text:      webhook.Message.Text,
+				Timestamp: webhook.Message.MessageTimestamp,
+			},
+		}}, nil
+
+	case "messages_update":
+		status := uazapiMessageStatus(webhook.Event.Type)
+		if status == "" {
+			return nil, nil
+		}
+		events := make([]InboundEvent, 0, len(webhook.Event.MessageIDs))
+		for _, id := range webhook.Event.MessageIDs {
+			events = append(events, InboundEvent{
+				Kind:   EventStatus,
+				Name:   webhook.EventType,
+				Status: &StatusUpdate{MessageID: id, ChatID: webhook.Event.Chat, Status: status},
+			})
+		}
+		return events, nil
+
+	case "connection":
+		return []InboundEvent{{Kind: EventConnection, Name: webhook.EventType, State: uazapiState(webhook.Instance.Status)}}, nil
+	}
+
+	return nil, nil
+}
+
+type uazapiSendResponse struct {
+	ID        string `json:"id"`
+	MessageID string `json:"messageid"`
+}
+
+func (r uazapiSendResponse) messageID() string {
+	if r.MessageID != "" {
+		return r.MessageID
+	}
+	return r.ID
+}
+
+type uazapiInstanceResponse struct {
+	Instance struct {
+		Status   string `json:"status"`
+		QRCode   string `json:"qrcode"`
+		PairCode string `json:"paircode"`
+	} `json:"instance"`
+}
+
+// uazapiState maps uazapi instance states
+func uazapiState(status string) ConnectionState {
+	switch status {
+	case "connected":
+		return StateConnected
+	case "connecting":
+		return StateConnecting
+	}
+	return StateDisconnected
+}
+
+// uazapiMessageStatus maps uazapi receipt types
+func uazapiMessageStatus(receipt string) string {
+	switch receipt {
+	case "Sent":
+		return StatusSent
+	case "Delivered":
+		return StatusDelivered
+	case "Read", "ReadSelf", "Played":
+		return StatusRead
+	case "Failed":
+		return StatusFailed
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUazapiDriver_API(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/send/text", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("token") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"messageid":"UZ-1","status":"Pending"}`))
+	})
+	mux.HandleFunc("/instance/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"instance":{"status":"connecting"}}`))
+	})
+	mux.HandleFunc("/instance/connect", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"instance":{"status":"connecting","qrcode":"data:image/png;base64,QQ","paircode":"PAIR"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	driver, _ := New("uazapi", Config{BaseURL: srv.URL, APIKey: "tok"})
+	ctx := context.Background()
+
+	id, err := driver.SendText(ctx, "5511999999999", "hello")
+	if err != nil || id != "UZ-1" {
+		t.Fatalf("SendText = %q, %v", id, err)
+	}
+
+	state, err := driver.ConnectionState(ctx)
+	if err != nil || state != StateConnecting {
+		t.Fatalf("ConnectionState = %q, %v", state, err)
+	}
+
+	qr, err := driver.QRCode(ctx)
+	if err != nil || qr.Base64 != "data:image/png;base64,QQ" || qr.PairingCode != "PAIR" {
+		t.Fatalf("QRCode = %+v, %v", qr, err)
+	}
+
+	if err := driver.Restart(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Restart = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestUazapiDriver_ParseWebhook(t *testing.T) {
+	driver := &UazapiDriver{}
+
+	events, err := driver.ParseWebhook([]byte(`{"EventType":"messages","message":{"messageid":"UZ-9","chatid":"5511999999999@s.whatsapp.net","senderName":"João","text":"olá"}}`))
+	if err != nil || len(events) != 1 || events[0].Message.ID != "UZ-9" || events[0].Message.Text != "olá" {
+		t.Fatalf("unexpected message event: %+v, %v", events, err)
+	}
+
+	events, err = driver.ParseWebhook([]byte(`{"EventType":"messages_update","event":{"Type":"Delivered","Chat":"x","MessageIDs":["A","B"]}}`))
+	if err != nil || len(events) != 2 || events[1].Status.MessageID != "B" || events[1].Status.Status != StatusDelivered {
+		t.Fatalf("unexpected status events: %+v, %v", events, err)
+	}
+}
+
+func TestUazapiDriver_VerifyWebhook(t *testing.T) {
+	driver := &UazapiDriver{cfg: Config{APIKey: "tok"}}
+
+	if err := driver.VerifyWebhook(nil, []byte(`{"EventType":"messages","token":"tok"}`)); err != nil {
+		t.Fatalf("expected the instance token to be accepted, got %v", err)
+	}
+	if err := driver.VerifyWebhook(nil, []byte(`{"EventType":"messages","token":"other"}`)); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected a wrong token to be rejected, got %v", err)
+	}
+}
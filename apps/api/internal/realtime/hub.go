@@ -0,0 +1,225 @@
+// Package realtime fans out account events to the clients connected to any API replica
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// channelPrefix is the Redis pub/sub channel of an account, followed by its ID
+const channelPrefix = "whatpro:realtime:"
+
+// subscriptionBuffer is how many events a slow client may lag behind before events are dropped
+const subscriptionBuffer = 64
+
+// Event types pushed to the stream
+const (
+	EventMessageCreated = "chat.message_created"
+	EventMessageDeleted = "chat.message_deleted"
+	EventRoomRead       = "chat.read"
+	EventMention        = "chat.mention"
+	EventTyping         = "chat.typing"
+	EventMemberAdded    = "chat.member_added"
+	EventMemberRemoved  = "chat.member_removed"
+	EventCardCreated    = "kanban.card_created"
+	EventCardMoved      = "kanban.card_moved"
+	EventCardUpdated    = "kanban.card_updated"
+)
+
+// Event is a message pushed to the clients of an account.
+// Chat events carry RoomID and only reach the members of the room;
+// events with UserID only reach that user.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	AccountID int             `json:"account_id"`
+	RoomID    *uuid.UUID      `json:"room_id,omitempty"`
+	UserID    *int            `json:"user_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEvent creates an event with data encoded as JSON
+func NewEvent(eventType string, accountID int, data interface{}) Event {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode realtime event %s: %v", eventType, err)
+		raw = []byte("null")
+	}
+	return Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		AccountID: accountID,
+		Data:      raw,
+		CreatedAt: time.Now(),
+	}
+}
+
+// ForRoom restricts the event to the members of a chat room
+func (e Event) ForRoom(roomID uuid.UUID) Event {
+	e.RoomID = &roomID
+	return e
+}
+
+// ForUser restricts the event to a single user
+func (e Event) ForUser(userID int) Event {
+	e.UserID = &userID
+	return e
+}
+
+// Publisher delivers events to the connected clients. Publishing is best effort:
+// the change that produced the event has already been stored.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Hub publishes events through Redis and delivers the events of every replica
+// to the subscriptions of this one. Without Redis, events stay in this process.
+type Hub struct {
+	redis *redis.Client
+
+	mu     sync.RWMutex
+	subs   map[int]map[*Subscription]struct{} // By account
+	closed bool
+}
+
+// NewHub creates a new Hub
+func NewHub(rdb *redis.Client) *Hub {
+	return &Hub{
+		redis: rdb,
+		subs:  make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event to the subscribers of its account on every replica
+func (h *Hub) Publish(ctx context.Context, event Event) {
+	if h.redis == nil {
+		h.dispatch(event)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode realtime event %s: %v", event.Type, err)
+		return
+	}
+	if err := h.redis.Publish(ctx, channelPrefix+strconv.Itoa(event.AccountID), payload).Err(); err != nil {
+		log.Printf("Failed to publish realtime event %s: %v", event.Type, err)
+	}
+}
+
+// Run receives the events published by every replica until ctx is cancelled
+func (h *Hub) Run(ctx context.Context) {
+	if h.redis == nil {
+		return
+	}
+
+	pubsub := h.redis.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	// The channel reconnects on its own when the Redis connection drops
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("Invalid realtime event on %s: %v", msg.Channel, err)
+				continue
+			}
+			if strings.TrimPrefix(msg.Channel, channelPrefix) != strconv.Itoa(event.AccountID) {
+				continue
+			}
+			h.dispatch(event)
+		}
+	}
+}
+
+// Subscribe registers a client of a user. The subscription must be closed when the client leaves.
+func (h *Hub) Subscribe(accountID, userID int) *Subscription {
+	sub := &Subscription{
+		AccountID: accountID,
+		UserID:    userID,
+		C:         make(chan Event, subscriptionBuffer),
+		hub:       h,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.C)
+		return sub
+	}
+	if h.subs[accountID] == nil {
+		h.subs[accountID] = make(map[*Subscription]struct{})
+	}
+	h.subs[accountID][sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription so streaming clients disconnect on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for accountID, subs := range h.subs {
+		for sub := range subs {
+			close(sub.C)
+		}
+		delete(h.subs, accountID)
+	}
+}
+
+// dispatch hands an event to the local subscriptions of its account.
+// A subscription whose buffer is full misses the event instead of blocking the others.
+func (h *Hub) dispatch(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs[event.AccountID] {
+		if event.UserID != nil && *event.UserID != sub.UserID {
+			continue
+		}
+		select {
+		case sub.C <- event:
+		default:
+			log.Printf("Realtime subscription of user %d is full; dropping %s", sub.UserID, event.Type)
+		}
+	}
+}
+
+// Subscription receives the events of an account addressed to a user
+type Subscription struct {
+	AccountID int
+	UserID    int
+	C         chan Event
+
+	hub *Hub
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if subs, ok := s.hub.subs[s.AccountID]; ok {
+		if _, ok := subs[s]; ok {
+			delete(subs, s)
+			close(s.C)
+			if len(subs) == 0 {
+				delete(s.hub.subs, s.AccountID)
+			}
+		}
+	}
+}
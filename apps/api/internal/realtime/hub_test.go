@@ -0,0 +1,47 @@
+package realtime
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHubDeliversWithinAccount(t *testing.T) {
+	hub := NewHub(nil)
+	alice := hub.Subscribe(1, 10)
+	bob := hub.Subscribe(1, 20)
+	other := hub.Subscribe(2, 30)
+	defer alice.Close()
+	defer bob.Close()
+	defer other.Close()
+
+	hub.Publish(context.Background(), NewEvent(EventCardCreated, 1, map[string]string{"title": "Novo"}))
+	hub.Publish(context.Background(), NewEvent(EventMention, 1, nil).ForUser(20))
+
+	if len(alice.C) != 1 {
+		t.Fatalf("alice got %d events, want only the card event", len(alice.C))
+	}
+	if len(bob.C) != 2 {
+		t.Fatalf("bob got %d events, want the card event and the mention", len(bob.C))
+	}
+	if len(other.C) != 0 {
+		t.Fatalf("another account received %d events", len(other.C))
+	}
+	if event := <-alice.C; string(event.Data) != `{"title":"Novo"}` {
+		t.Fatalf("unexpected event data %s", event.Data)
+	}
+}
+
+func TestHubCloseEndsSubscriptions(t *testing.T) {
+	hub := NewHub(nil)
+	sub := hub.Subscribe(1, 10)
+
+	hub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("subscription should be closed")
+	}
+	sub.Close() // Closing again after shutdown must not panic
+
+	if _, ok := <-hub.Subscribe(1, 10).C; ok {
+		t.Fatalf("subscriptions after shutdown should start closed")
+	}
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"whatpro-hub/internal/models"
+)
+
+// AuditChainGenesis is the previous hash of the first entry of every account chain
+const AuditChainGenesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// auditChainPayload is the canonical form of an entry that its hash covers.
+// Offline verifiers rebuild it from an exported entry: the same keys in this
+// order, JSON values re-encoded with sorted keys, empty values as null and
+// created_at in UTC RFC 3339 with nanoseconds. The hash is the hex SHA-256
+// of the compact JSON encoding.
+type auditChainPayload struct {
+	Sequence     int64       `json:"sequence"`
+	PrevHash     string      `json:"prev_hash"`
+	ID           string      `json:"id"`
+	AccountID    int         `json:"account_id"`
+	UserID       *int        `json:"user_id"`
+	Action       string      `json:"action"`
+	ResourceType string      `json:"resource_type"`
+	ResourceID   string      `json:"resource_id"`
+	OldValues    interface{} `json:"old_values"`
+	NewValues    interface{} `json:"new_values"`
+	IPAddress    string      `json:"ip_address"`
+	UserAgent    string      `json:"user_agent"`
+	CreatedAt    string      `json:"created_at"`
+}
+
+// AuditEntryHash computes the chain hash of an audit entry
+func AuditEntryHash(entry *models.AuditLog) string {
+	payload, _ := json.Marshal(auditChainPayload{
+		Sequence:     entry.Sequence,
+		PrevHash:     entry.PrevHash,
+		ID:           entry.ID.String(),
+		AccountID:    entry.AccountID,
+		UserID:       entry.UserID,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		OldValues:    canonicalAuditValues(entry.OldValues),
+		NewValues:    canonicalAuditValues(entry.NewValues),
+		IPAddress:    entry.IPAddress,
+		UserAgent:    entry.UserAgent,
+		CreatedAt:    entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalAuditValues re-decodes values the way they come back from jsonb, so
+// the hash of a stored entry matches the hash computed before the insert
+func canonicalAuditValues(values models.JSON) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// appendChained links the entry to the head of its account chain and stores it
+func (r *AuditRepository) appendChained(entry *models.AuditLog) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.AuditChainHead{AccountID: entry.AccountID, Hash: AuditChainGenesis}).Error; err != nil {
+			return err
+		}
+
+		var head models.AuditChainHead
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&head, "account_id = ?", entry.AccountID).Error; err != nil {
+			return err
+		}
+
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.New()
+		}
+		// Postgres keeps microseconds; hash the value that will be read back
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Sequence = head.Sequence + 1
+		entry.PrevHash = head.Hash
+		entry.Hash = AuditEntryHash(entry)
+
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AuditChainHead{}).
+			Where("account_id = ?", entry.AccountID).
+			Updates(map[string]interface{}{
+				"sequence":   entry.Sequence,
+				"hash":       entry.Hash,
+				"updated_at": entry.CreatedAt,
+			}).Error
+	})
+}
+
+// FindChainHead returns the chain head of an account, or nil if it has no chained entries
+func (r *AuditRepository) FindChainHead(accountID int) (*models.AuditChainHead, error) {
+	var head models.AuditChainHead
+	if err := r.db.First(&head, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &head, nil
+}
+
+// FindChainBatch returns chained entries of an account after a sequence, in chain order
+func (r *AuditRepository) FindChainBatch(accountID int, afterSequence int64, limit int) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	err := r.db.Where("account_id = ? AND sequence > ?", accountID, afterSequence).
+		Order("sequence ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// CountUnchained counts the entries of an account written before the chain existed
+func (r *AuditRepository) CountUnchained(accountID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.AuditLog{}).Where("account_id = ? AND sequence = 0", accountID).Count(&count).Error
+	return count, err
+}
+
+// ChainedAccountIDs returns the accounts that have an audit chain
+func (r *AuditRepository) ChainedAccountIDs() ([]int, error) {
+	var ids []int
+	err := r.db.Model(&models.AuditChainHead{}).Order("account_id ASC").Pluck("account_id", &ids).Error
+	return ids, err
+}
@@ -4,6 +4,7 @@ package repositories
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"whatpro-hub/internal/models"
 )
@@ -18,9 +19,9 @@ func NewAuditRepository(db *gorm.DB) *AuditRepository {
 	return &AuditRepository{db: db}
 }
 
-// Create inserts a new audit log entry
+// Create appends a new audit log entry to the hash chain of its account
 func (r *AuditRepository) Create(log *models.AuditLog) error {
-	return r.db.Create(log).Error
+	return r.appendChained(log)
 }
 
 // FindByResource retrieves audit logs for a specific resource
@@ -142,3 +143,87 @@ func (r *AuditRepository) FindWithFilters(filters AuditQueryFilters) ([]models.A
 
 	return logs, total, err
 }
+
+// AuditTimelineEntry is an entry of the account audit timeline, which merges
+// audit_logs with the internal chat audit (source "chat")
+type AuditTimelineEntry struct {
+	ID           uuid.UUID   `json:"id"`
+	Source       string      `json:"source"` // "audit" or "chat"
+	AccountID    int         `json:"account_id"`
+	UserID       *int        `json:"user_id,omitempty"`
+	Action       string      `json:"action"`
+	ResourceType string      `json:"resource_type"`
+	ResourceID   string      `json:"resource_id"`
+	OldValues    models.JSON `json:"old_values,omitempty"`
+	NewValues    models.JSON `json:"new_values,omitempty"`
+	IPAddress    string      `json:"ip_address,omitempty"`
+	UserAgent    string      `json:"user_agent,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// AuditCursor is the position after the last entry of a timeline page
+type AuditCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// AuditTimelineQuery holds filters for the account audit timeline
+type AuditTimelineQuery struct {
+	AccountID    int
+	Source       *string
+	UserID       *int
+	Action       *string
+	ResourceType *string
+	ResourceID   *string
+	StartDate    *time.Time
+	EndDate      *time.Time
+	After        *AuditCursor // Entries older than the cursor
+	Limit        int
+}
+
+// auditTimelineSQL merges both audit tables into one shape. Chat entries are
+// typed by what their target is: a message for deletions, a room otherwise.
+const auditTimelineSQL = `
+	SELECT id, 'audit' AS source, account_id, user_id, action, resource_type, resource_id,
+		old_values, new_values, ip_address, user_agent, created_at
+	FROM audit_logs WHERE account_id = @account
+	UNION ALL
+	SELECT id, 'chat' AS source, account_id, actor_id AS user_id, action,
+		CASE WHEN action = 'message_deleted' THEN 'chat_message' ELSE 'chat_room' END AS resource_type,
+		target_id AS resource_id, NULL AS old_values, metadata AS new_values,
+		'' AS ip_address, '' AS user_agent, created_at
+	FROM internal_chat_audit WHERE account_id = @account`
+
+// FindTimeline returns a page of the account audit timeline, newest first
+func (r *AuditRepository) FindTimeline(query AuditTimelineQuery) ([]AuditTimelineEntry, error) {
+	q := r.db.Table("(?) AS timeline", r.db.Raw(auditTimelineSQL, map[string]interface{}{"account": query.AccountID}))
+
+	if query.Source != nil {
+		q = q.Where("source = ?", *query.Source)
+	}
+	if query.UserID != nil {
+		q = q.Where("user_id = ?", *query.UserID)
+	}
+	if query.Action != nil {
+		q = q.Where("action = ?", *query.Action)
+	}
+	if query.ResourceType != nil {
+		q = q.Where("resource_type = ?", *query.ResourceType)
+	}
+	if query.ResourceID != nil {
+		q = q.Where("resource_id = ?", *query.ResourceID)
+	}
+	if query.StartDate != nil {
+		q = q.Where("created_at >= ?", *query.StartDate)
+	}
+	if query.EndDate != nil {
+		q = q.Where("created_at <= ?", *query.EndDate)
+	}
+	if query.After != nil {
+		q = q.Where("(created_at, id) < (?, ?)", query.After.CreatedAt, query.After.ID)
+	}
+
+	var entries []AuditTimelineEntry
+	err := q.Order("created_at DESC, id DESC").Limit(query.Limit).Find(&entries).Error
+	return entries, err
+}
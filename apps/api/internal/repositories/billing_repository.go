@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,6 +10,12 @@ import (
 	"whatpro-hub/internal/models"
 )
 
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrPlanNotFound         = errors.New("plan not found")
+	ErrTransactionNotFound  = errors.New("transaction not found")
+)
+
 // BillingRepository handles database operations for billing
 type BillingRepository struct {
 	db *gorm.DB
@@ -24,13 +31,25 @@ func (r *BillingRepository) CreateSubscription(ctx context.Context, sub *models.
 	return r.db.WithContext(ctx).Create(sub).Error
 }
 
-// GetSubscriptionByAccount returns the active subscription for an account
+// liveSubscriptionStatuses are the statuses of a subscription that is not canceled
+var liveSubscriptionStatuses = []string{
+	models.SubscriptionPending,
+	models.SubscriptionTrial,
+	models.SubscriptionActive,
+	models.SubscriptionPastDue,
+	models.SubscriptionSuspended,
+}
+
+// GetSubscriptionByAccount returns the live (not canceled) subscription for an account
 func (r *BillingRepository) GetSubscriptionByAccount(ctx context.Context, accountID int) (*models.Subscription, error) {
 	var sub models.Subscription
 	if err := r.db.WithContext(ctx).
-		Where("account_id = ? AND status IN ?", accountID, []string{"active", "trial", "overdue"}).
+		Where("account_id = ? AND status IN ?", accountID, liveSubscriptionStatuses).
 		Order("created_at DESC").
 		First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
 		return nil, err
 	}
 	return &sub, nil
@@ -42,10 +61,31 @@ func (r *BillingRepository) UpdateSubscription(ctx context.Context, sub *models.
 	return r.db.WithContext(ctx).Save(sub).Error
 }
 
+// ListSubscriptionsByStatus returns the subscriptions in any of the given statuses
+func (r *BillingRepository) ListSubscriptionsByStatus(ctx context.Context, statuses ...string) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	if err := r.db.WithContext(ctx).Where("status IN ?", statuses).Order("created_at").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// ListSubscriptionsByPlan returns the live subscriptions of a plan
+func (r *BillingRepository) ListSubscriptionsByPlan(ctx context.Context, planID uuid.UUID) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	if err := r.db.WithContext(ctx).Where("plan_id = ? AND status IN ?", planID, liveSubscriptionStatuses).Order("created_at").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
 // FindSubscriptionByProviderID finds a subscription by external ID
 func (r *BillingRepository) FindSubscriptionByProviderID(ctx context.Context, providerSubID string) (*models.Subscription, error) {
 	var sub models.Subscription
 	if err := r.db.WithContext(ctx).Where("provider_sub_id = ?", providerSubID).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
 		return nil, err
 	}
 	return &sub, nil
@@ -56,19 +96,58 @@ func (r *BillingRepository) CreateTransaction(ctx context.Context, tx *models.Tr
 	return r.db.WithContext(ctx).Create(tx).Error
 }
 
-// ListPlans returns all active plans
-func (r *BillingRepository) ListPlans(ctx context.Context) ([]models.Plan, error) {
+// FindTransactionByProviderID finds a transaction by its ID in the payment provider
+func (r *BillingRepository) FindTransactionByProviderID(ctx context.Context, providerID string) (*models.Transaction, error) {
+	var tx models.Transaction
+	if err := r.db.WithContext(ctx).Where("provider_id = ?", providerID).First(&tx).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// UpdateTransaction updates a transaction
+func (r *BillingRepository) UpdateTransaction(ctx context.Context, tx *models.Transaction) error {
+	return r.db.WithContext(ctx).Save(tx).Error
+}
+
+// ListPlans returns the active plans, or all of them when includeInactive is set
+func (r *BillingRepository) ListPlans(ctx context.Context, includeInactive bool) ([]models.Plan, error) {
 	var plans []models.Plan
-	if err := r.db.WithContext(ctx).Where("is_active = ?", true).Find(&plans).Error; err != nil {
+	query := r.db.WithContext(ctx).Order("price")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Find(&plans).Error; err != nil {
 		return nil, err
 	}
 	return plans, nil
 }
 
+// CreatePlan creates a new plan
+func (r *BillingRepository) CreatePlan(ctx context.Context, plan *models.Plan) error {
+	if plan.ID == uuid.Nil {
+		plan.ID = uuid.New()
+	}
+	// Select all columns so a plan created inactive is not switched on by the column default
+	return r.db.WithContext(ctx).Select("*").Create(plan).Error
+}
+
+// UpdatePlan updates a plan
+func (r *BillingRepository) UpdatePlan(ctx context.Context, plan *models.Plan) error {
+	plan.UpdatedAt = time.Now()
+	return r.db.WithContext(ctx).Save(plan).Error
+}
+
 // GetPlan returns a plan by ID
 func (r *BillingRepository) GetPlan(ctx context.Context, id uuid.UUID) (*models.Plan, error) {
 	var plan models.Plan
 	if err := r.db.WithContext(ctx).First(&plan, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
 		return nil, err
 	}
 	return &plan, nil
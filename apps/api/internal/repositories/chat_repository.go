@@ -231,6 +231,120 @@ func (r *ChatRepository) SoftDeleteMessage(ctx context.Context, messageID uuid.U
 		Update("deleted_at", now).Error
 }
 
+// ============================================================================
+// SEARCH
+// ============================================================================
+
+// ChatSearchConfig is the text search configuration of the message search vector.
+// Accounts default to pt_BR, so messages are stemmed with the Portuguese dictionary.
+const ChatSearchConfig = "portuguese"
+
+// Snippet highlight delimiters; private use characters never typed by users
+const (
+	ChatSearchHighlightStart = "\uE000"
+	ChatSearchHighlightStop  = "\uE001"
+)
+
+// ChatSearchFilter narrows a message search to the rooms of a user
+type ChatSearchFilter struct {
+	Query       string
+	UserID      int // Only rooms this user belongs to
+	SenderID    int
+	RoomID      *uuid.UUID
+	From        *time.Time
+	To          *time.Time
+	MessageType string
+}
+
+// ChatSearchHit is a message matching a search with its highlighted snippet
+type ChatSearchHit struct {
+	models.InternalChatMessage
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SearchMessages runs a full-text search over the messages of the rooms the user
+// belongs to, best matches first
+func (r *ChatRepository) SearchMessages(ctx context.Context, accountID int, filter ChatSearchFilter, limit, offset int) ([]ChatSearchHit, int64, error) {
+	query := r.db.WithContext(ctx).
+		Table("internal_chat_messages AS m").
+		Joins("JOIN internal_chat_members mb ON mb.room_id = m.room_id AND mb.user_id = ?", filter.UserID).
+		Where("m.account_id = ? AND m.deleted_at IS NULL", accountID).
+		Where("m.search_vector @@ websearch_to_tsquery(?, ?)", ChatSearchConfig, filter.Query)
+
+	if filter.SenderID > 0 {
+		query = query.Where("m.sender_id = ?", filter.SenderID)
+	}
+	if filter.RoomID != nil {
+		query = query.Where("m.room_id = ?", *filter.RoomID)
+	}
+	if filter.From != nil {
+		query = query.Where("m.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("m.created_at <= ?", *filter.To)
+	}
+	if filter.MessageType != "" {
+		query = query.Where("m.message_type = ?", filter.MessageType)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	headlineOptions := "StartSel=" + ChatSearchHighlightStart + ", StopSel=" + ChatSearchHighlightStop +
+		", MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \""
+
+	var hits []ChatSearchHit
+	err := query.
+		Select("m.*, "+
+			"ts_headline(?, m.content, websearch_to_tsquery(?, ?), ?) AS snippet, "+
+			"ts_rank(m.search_vector, websearch_to_tsquery(?, ?)) AS rank",
+			ChatSearchConfig, ChatSearchConfig, filter.Query, headlineOptions,
+			ChatSearchConfig, filter.Query).
+		Order("rank DESC, m.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&hits).Error
+	return hits, total, err
+}
+
+// GetMessagesAround returns up to before messages older and after messages newer
+// than the given message of its room, in chronological order with the message itself
+func (r *ChatRepository) GetMessagesAround(ctx context.Context, message *models.InternalChatMessage, before, after int) ([]models.InternalChatMessage, error) {
+	var older, newer []models.InternalChatMessage
+
+	err := r.db.WithContext(ctx).
+		Where("room_id = ? AND deleted_at IS NULL", message.RoomID).
+		Where("(created_at, id) < (?, ?)", message.CreatedAt, message.ID).
+		Preload("Sender").
+		Order("created_at DESC, id DESC").
+		Limit(before).
+		Find(&older).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.WithContext(ctx).
+		Where("room_id = ? AND deleted_at IS NULL", message.RoomID).
+		Where("(created_at, id) > (?, ?)", message.CreatedAt, message.ID).
+		Preload("Sender").
+		Order("created_at ASC, id ASC").
+		Limit(after).
+		Find(&newer).Error
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.InternalChatMessage, 0, len(older)+1+len(newer))
+	for i := len(older) - 1; i >= 0; i-- {
+		messages = append(messages, older[i])
+	}
+	messages = append(messages, *message)
+	return append(messages, newer...), nil
+}
+
 // ============================================================================
 // MENTIONS
 // ============================================================================
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,6 +10,11 @@ import (
 	"whatpro-hub/internal/models"
 )
 
+var (
+	ErrMappingNotFound   = errors.New("message mapping not found")
+	ErrExecutionNotFound = errors.New("event execution not found")
+)
+
 // GatewayRepository handles database operations for the gateway
 type GatewayRepository struct {
 	db *gorm.DB
@@ -24,39 +30,123 @@ func (r *GatewayRepository) CreateExecution(ctx context.Context, exec *models.Ev
 	return r.db.WithContext(ctx).Create(exec).Error
 }
 
+// FindExecutionByID returns an event execution by ID
+func (r *GatewayRepository) FindExecutionByID(ctx context.Context, id uuid.UUID) (*models.EventExecution, error) {
+	var exec models.EventExecution
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&exec).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExecutionNotFound
+		}
+		return nil, err
+	}
+	return &exec, nil
+}
+
+// FindExecutionForAccount returns an event execution by ID scoped to an account
+func (r *GatewayRepository) FindExecutionForAccount(ctx context.Context, id uuid.UUID, accountID int) (*models.EventExecution, error) {
+	var exec models.EventExecution
+	if err := r.db.WithContext(ctx).Where("id = ? AND account_id = ?", id, accountID).First(&exec).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExecutionNotFound
+		}
+		return nil, err
+	}
+	return &exec, nil
+}
+
+// ListExecutions returns executions of an account, newest first
+func (r *GatewayRepository) ListExecutions(ctx context.Context, accountID int, filters map[string]interface{}, limit, offset int) ([]models.EventExecution, int64, error) {
+	var execs []models.EventExecution
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.EventExecution{}).Where("account_id = ?", accountID)
+	if status, ok := filters["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType, ok := filters["event_type"].(string); ok && eventType != "" {
+		query = query.Where("event_type LIKE ?", eventType+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Payloads can be large; they are only returned by the detail endpoint
+	err := query.Omit("payload").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&execs).Error
+	return execs, total, err
+}
+
+// ClaimExecution atomically moves a pending or retrying execution to processing.
+// It returns false when another worker already claimed it or it is finished.
+func (r *GatewayRepository) ClaimExecution(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.EventExecution{}).
+		Where("id = ? AND status IN ?", id, []string{models.EventStatusPending, models.EventStatusRetry}).
+		Updates(map[string]interface{}{
+			"status":     models.EventStatusProcessing,
+			"started_at": time.Now(),
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
 // UpdateExecutionStatus updates the status and error of an execution
 func (r *GatewayRepository) UpdateExecutionStatus(ctx context.Context, id uuid.UUID, status string, errStr string) error {
 	updates := map[string]interface{}{
 		"status":      status,
 		"finished_at": time.Now(),
 		"updated_at":  time.Now(),
-	}
-	if errStr != "" {
-		updates["error"] = errStr
-	}
-	
-	// Schedule retry if status is retry
-	if status == "retry" {
-		updates["retries"] = gorm.Expr("retries + 1")
-		// Exponential backoff: 30s, 60s, 120s...
-		// We can't do complex math in map easily without fetching first, 
-		// so for now just add 30s. A proper service would calc this.
-		updates["next_retry_at"] = time.Now().Add(30 * time.Second)
-		updates["status"] = "retry" // Ensure status is set
+		"error":       errStr,
 	}
 
 	return r.db.WithContext(ctx).Model(&models.EventExecution{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// ScheduleExecutionRetry records a failed attempt and when to try again
+func (r *GatewayRepository) ScheduleExecutionRetry(ctx context.Context, id uuid.UUID, nextRetryAt time.Time, errStr string) error {
+	return r.db.WithContext(ctx).Model(&models.EventExecution{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":        models.EventStatusRetry,
+			"retries":       gorm.Expr("retries + 1"),
+			"next_retry_at": nextRetryAt,
+			"finished_at":   time.Now(),
+			"updated_at":    time.Now(),
+			"error":         errStr,
+		}).Error
+}
+
+// ResetExecution puts an execution back to pending with a fresh retry budget
+func (r *GatewayRepository) ResetExecution(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.EventExecution{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":        models.EventStatusPending,
+			"retries":       0,
+			"next_retry_at": nil,
+			"started_at":    nil,
+			"finished_at":   nil,
+			"error":         "",
+			"updated_at":    time.Now(),
+		}).Error
+}
+
 // CreateMapping creates a new message mapping
 func (r *GatewayRepository) CreateMapping(ctx context.Context, mapping *models.MessageMapping) error {
 	return r.db.WithContext(ctx).Create(mapping).Error
 }
 
-// FindMappingByWAID finds a mapping by WhatsApp Message ID
-func (r *GatewayRepository) FindMappingByWAID(ctx context.Context, waMessageID string) (*models.MessageMapping, error) {
+// FindMappingByWAID finds a mapping of a provider by WhatsApp Message ID.
+// Message IDs are chosen by the sender, so the lookup is scoped to the provider.
+func (r *GatewayRepository) FindMappingByWAID(ctx context.Context, providerID uuid.UUID, waMessageID string) (*models.MessageMapping, error) {
 	var mapping models.MessageMapping
-	if err := r.db.WithContext(ctx).Where("wa_message_id = ?", waMessageID).First(&mapping).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("provider_id = ? AND wa_message_id = ?", providerID, waMessageID).First(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMappingNotFound
+		}
 		return nil, err
 	}
 	return &mapping, nil
@@ -66,11 +156,59 @@ func (r *GatewayRepository) FindMappingByWAID(ctx context.Context, waMessageID s
 func (r *GatewayRepository) FindMappingByCWID(ctx context.Context, cwMessageID int) (*models.MessageMapping, error) {
 	var mapping models.MessageMapping
 	if err := r.db.WithContext(ctx).Where("chatwoot_message_id = ?", cwMessageID).First(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMappingNotFound
+		}
 		return nil, err
 	}
 	return &mapping, nil
 }
 
+// UpdateMapping saves changes to an existing mapping
+func (r *GatewayRepository) UpdateMapping(ctx context.Context, mapping *models.MessageMapping) error {
+	mapping.UpdatedAt = time.Now()
+	return r.db.WithContext(ctx).Save(mapping).Error
+}
+
+// FindLatestMappingByConversation returns the most recent mapping of a Chatwoot
+// conversation of an account. Conversation IDs repeat across accounts, so the
+// lookup is always scoped to one; providerID narrows it to a provider unless it is uuid.Nil.
+func (r *GatewayRepository) FindLatestMappingByConversation(ctx context.Context, accountID int, providerID uuid.UUID, conversationID int) (*models.MessageMapping, error) {
+	var mapping models.MessageMapping
+	query := r.db.WithContext(ctx).
+		Where("account_id = ? AND chatwoot_conversation_id = ? AND wa_conversation_id <> ''", accountID, conversationID)
+	if providerID != uuid.Nil {
+		query = query.Where("provider_id = ?", providerID)
+	}
+	if err := query.Order("created_at DESC").First(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMappingNotFound
+		}
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// UpdateMappingStatus updates the delivery status of a mapping of a provider by WhatsApp Message ID
+func (r *GatewayRepository) UpdateMappingStatus(ctx context.Context, providerID uuid.UUID, waMessageID string, status string) error {
+	result := r.db.WithContext(ctx).Model(&models.MessageMapping{}).
+		Where("provider_id = ? AND wa_message_id = ?", providerID, waMessageID).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrMappingNotFound
+	}
+
+	return nil
+}
+
 // CreateLog writes a log entry
 func (r *GatewayRepository) CreateLog(ctx context.Context, log *models.GatewayLog) error {
 	return r.db.WithContext(ctx).Create(log).Error
@@ -80,9 +218,31 @@ func (r *GatewayRepository) CreateLog(ctx context.Context, log *models.GatewayLo
 func (r *GatewayRepository) GetPendingRetries(ctx context.Context, limit int) ([]models.EventExecution, error) {
 	var execs []models.EventExecution
 	err := r.db.WithContext(ctx).
-		Where("status = ? AND next_retry_at <= ?", "retry", time.Now()).
-		Where("retries < max_retries").
+		Where("status = ? AND next_retry_at <= ?", models.EventStatusRetry, time.Now()).
+		Where("retries <= max_retries").
 		Limit(limit).
 		Find(&execs).Error
 	return execs, err
 }
+
+// GetStaleExecutions fetches executions stuck in pending or processing since before a cutoff,
+// e.g. because enqueueing failed or a worker died mid-task
+func (r *GatewayRepository) GetStaleExecutions(ctx context.Context, before time.Time, limit int) ([]models.EventExecution, error) {
+	var execs []models.EventExecution
+	err := r.db.WithContext(ctx).
+		Where("(status = ? AND created_at < ?) OR (status = ? AND started_at < ?)",
+			models.EventStatusPending, before, models.EventStatusProcessing, before).
+		Limit(limit).
+		Find(&execs).Error
+	return execs, err
+}
+
+// ReleaseExecution returns a stuck processing execution to pending
+func (r *GatewayRepository) ReleaseExecution(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.EventExecution{}).
+		Where("id = ? AND status = ?", id, models.EventStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":     models.EventStatusPending,
+			"updated_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,41 @@
+//go:build integration
+
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestInboxRepository_ProviderServesOneInbox(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	accountA, _, _, _, _, providerA := seedTenantData(t, db)
+	first := models.Inbox{ChatwootID: 3101, AccountID: int(accountA.ID), Name: "Vendas"}
+	second := models.Inbox{ChatwootID: 3102, AccountID: int(accountA.ID), Name: "Suporte"}
+	for _, inbox := range []*models.Inbox{&first, &second} {
+		if err := db.Create(inbox).Error; err != nil {
+			t.Fatalf("create inbox: %v", err)
+		}
+	}
+
+	repo := NewInboxRepository(db)
+	if err := repo.SetProvider(ctx, first.ID, &providerA.ID); err != nil {
+		t.Fatalf("bind first inbox: %v", err)
+	}
+	// A bind that raced past the service check is refused by the unique index
+	if err := repo.SetProvider(ctx, second.ID, &providerA.ID); !errors.Is(err, ErrProviderInUse) {
+		t.Fatalf("expected ErrProviderInUse binding a second inbox, got %v", err)
+	}
+
+	if err := repo.SetProvider(ctx, first.ID, nil); err != nil {
+		t.Fatalf("unbind first inbox: %v", err)
+	}
+	if err := repo.SetProvider(ctx, second.ID, &providerA.ID); err != nil {
+		t.Fatalf("bind second inbox after unbind: %v", err)
+	}
+}
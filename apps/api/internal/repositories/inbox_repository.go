@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+var (
+	ErrInboxNotFound = errors.New("inbox not found")
+	ErrProviderInUse = errors.New("provider already serves another inbox")
+)
+
+// inboxProviderIndex keeps a provider on one live inbox (see migrations)
+const inboxProviderIndex = "idx_inboxes_provider"
+
+// InboxRepository handles the synced Chatwoot inboxes and their provider bindings
+type InboxRepository struct {
+	db *gorm.DB
+}
+
+// NewInboxRepository creates a new InboxRepository
+func NewInboxRepository(db *gorm.DB) *InboxRepository {
+	return &InboxRepository{db: db}
+}
+
+// FindAll returns the inboxes of an account with their provider
+func (r *InboxRepository) FindAll(ctx context.Context, accountID int) ([]models.Inbox, error) {
+	var inboxes []models.Inbox
+	err := r.db.WithContext(ctx).
+		Preload("Provider").
+		Where("account_id = ?", accountID).
+		Order("name ASC").
+		Find(&inboxes).Error
+	return inboxes, err
+}
+
+// FindByIDForAccount returns an inbox of an account
+func (r *InboxRepository) FindByIDForAccount(ctx context.Context, id uint, accountID int) (*models.Inbox, error) {
+	var inbox models.Inbox
+	if err := r.db.WithContext(ctx).Where("id = ? AND account_id = ?", id, accountID).First(&inbox).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInboxNotFound
+		}
+		return nil, err
+	}
+	return &inbox, nil
+}
+
+// FindByProvider returns the inbox a provider is bound to
+func (r *InboxRepository) FindByProvider(ctx context.Context, providerID uuid.UUID) (*models.Inbox, error) {
+	var inbox models.Inbox
+	if err := r.db.WithContext(ctx).Where("provider_id = ?", providerID).First(&inbox).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInboxNotFound
+		}
+		return nil, err
+	}
+	return &inbox, nil
+}
+
+// SetProvider binds an inbox to a provider, or unbinds it when providerID is nil.
+// Binding a provider that serves another inbox fails with ErrProviderInUse.
+func (r *InboxRepository) SetProvider(ctx context.Context, id uint, providerID *uuid.UUID) error {
+	err := r.db.WithContext(ctx).Model(&models.Inbox{}).Where("id = ?", id).Update("provider_id", providerID).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == inboxProviderIndex {
+		return ErrProviderInUse
+	}
+	return err
+}
@@ -14,6 +14,8 @@ var (
 	ErrBoardNotFound = errors.New("board not found")
 	ErrStageNotFound = errors.New("stage not found")
 	ErrCardNotFound  = errors.New("card not found")
+
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
 )
 
 // KanbanRepository handles kanban database operations
@@ -73,6 +75,22 @@ func (r *KanbanRepository) ListBoards(ctx context.Context, accountID int) ([]mod
 	return boards, nil
 }
 
+// GetDefaultBoard returns the default board of an account with its stages
+func (r *KanbanRepository) GetDefaultBoard(ctx context.Context, accountID int) (*models.Board, error) {
+	var board models.Board
+	if err := r.db.WithContext(ctx).Preload("Stages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("account_id = ? AND is_default = ?", accountID, true).
+		Order("created_at ASC").
+		First(&board).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBoardNotFound
+		}
+		return nil, err
+	}
+	return &board, nil
+}
+
 // UpdateBoard updates an existing board
 func (r *KanbanRepository) UpdateBoard(ctx context.Context, board *models.Board) error {
 	board.UpdatedAt = time.Now()
@@ -222,6 +240,22 @@ func (r *KanbanRepository) UpdateCard(ctx context.Context, card *models.Card) er
 	return nil
 }
 
+// UpdateCardFields updates selected columns of a card without overwriting the rest
+func (r *KanbanRepository) UpdateCardFields(ctx context.Context, id uuid.UUID, updates map[string]interface{}) error {
+	updates["updated_at"] = time.Now()
+	return r.db.WithContext(ctx).Model(&models.Card{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// NextCardPosition returns the position after the last card of a stage
+func (r *KanbanRepository) NextCardPosition(ctx context.Context, stageID uuid.UUID) (int, error) {
+	var position int
+	err := r.db.WithContext(ctx).Model(&models.Card{}).
+		Where("stage_id = ?", stageID).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&position).Error
+	return position, err
+}
+
 // DeleteCard deletes a card
 func (r *KanbanRepository) DeleteCard(ctx context.Context, id uuid.UUID) error {
 	result := r.db.WithContext(ctx).Delete(&models.Card{}, "id = ?", id)
@@ -234,10 +268,14 @@ func (r *KanbanRepository) DeleteCard(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// FindCardByConversationID finds a card linked to a Chatwoot conversation
-func (r *KanbanRepository) FindCardByConversationID(ctx context.Context, conversationID int) (*models.Card, error) {
+// FindCardByConversationForAccount finds the card of an account linked to a Chatwoot conversation
+func (r *KanbanRepository) FindCardByConversationForAccount(ctx context.Context, conversationID, accountID int) (*models.Card, error) {
 	var card models.Card
-	if err := r.db.WithContext(ctx).Where("chatwoot_conversation_id = ?", conversationID).
+	if err := r.db.WithContext(ctx).
+		Table("cards").
+		Joins("JOIN stages ON stages.id = cards.stage_id").
+		Joins("JOIN boards ON boards.id = stages.board_id").
+		Where("cards.chatwoot_conversation_id = ? AND boards.account_id = ?", conversationID, accountID).
 		First(&card).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrCardNotFound
@@ -252,6 +290,92 @@ func (r *KanbanRepository) LogCardHistory(ctx context.Context, history *models.C
 	return r.db.WithContext(ctx).Create(history).Error
 }
 
+// =========================================================================
+// SLA OPERATIONS
+// =========================================================================
+
+// SLABreach is a card that stayed in its stage longer than the stage SLA
+type SLABreach struct {
+	CardID     uuid.UUID
+	AccountID  int
+	BoardID    uuid.UUID
+	StageID    uuid.UUID
+	StageName  string
+	SLAHours   int
+	Title      string
+	AssigneeID *int
+	EnteredAt  time.Time
+}
+
+// SLABreachCount is the number of breaches of a stage or an agent
+type SLABreachCount struct {
+	Key      string `json:"key"`
+	Breaches int64  `json:"breaches"`
+}
+
+// FindSLABreaches returns unflagged cards whose time in the current stage exceeds its SLA.
+// The stage entry time is the latest history move into the stage, or the card creation.
+func (r *KanbanRepository) FindSLABreaches(ctx context.Context, now time.Time, limit int) ([]SLABreach, error) {
+	var breaches []SLABreach
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT cards.id AS card_id, boards.account_id, boards.id AS board_id,
+			stages.id AS stage_id, stages.name AS stage_name, stages.sla_hours,
+			cards.title, cards.assignee_id, entered.entered_at
+		FROM cards
+		JOIN stages ON stages.id = cards.stage_id
+		JOIN boards ON boards.id = stages.board_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(MAX(h.created_at), cards.created_at) AS entered_at
+			FROM card_histories h
+			WHERE h.card_id = cards.id AND h.to_stage_id = cards.stage_id
+				AND h.action IN ('created', 'moved')
+				AND h.from_stage_id IS DISTINCT FROM h.to_stage_id -- reorders do not restart the clock
+		) entered
+		WHERE stages.sla_hours > 0
+			AND cards.sla_breached = false
+			AND entered.entered_at < ? - stages.sla_hours * INTERVAL '1 hour'
+		ORDER BY entered.entered_at ASC
+		LIMIT ?`, now, limit).Scan(&breaches).Error
+	return breaches, err
+}
+
+// MarkCardSLABreached flags a card as breached.
+// It returns false when the card was already flagged (e.g. by a concurrent run).
+func (r *KanbanRepository) MarkCardSLABreached(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Card{}).
+		Where("id = ? AND sla_breached = ?", id, false).
+		Updates(map[string]interface{}{
+			"sla_breached":    true,
+			"sla_breached_at": at,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountSLABreaches counts the sla_breached history entries of a board since a date,
+// grouped by a metadata key (stage_id or assignee_id)
+func (r *KanbanRepository) CountSLABreaches(ctx context.Context, boardID uuid.UUID, since time.Time, groupBy string) ([]SLABreachCount, error) {
+	var counts []SLABreachCount
+	err := r.db.WithContext(ctx).Model(&models.CardHistory{}).
+		Select("COALESCE(metadata->>?, '') AS key, COUNT(*) AS breaches", groupBy).
+		Where("action = ? AND metadata->>'board_id' = ? AND created_at >= ?", "sla_breached", boardID.String(), since).
+		Group("key").
+		Order("breaches DESC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// CountOpenSLABreaches counts the cards of a board currently flagged as breached, per stage
+func (r *KanbanRepository) CountOpenSLABreaches(ctx context.Context, boardID uuid.UUID) ([]SLABreachCount, error) {
+	var counts []SLABreachCount
+	err := r.db.WithContext(ctx).Model(&models.Card{}).
+		Select("cards.stage_id::text AS key, COUNT(*) AS breaches").
+		Joins("JOIN stages ON stages.id = cards.stage_id").
+		Where("stages.board_id = ? AND cards.sla_breached = ?", boardID, true).
+		Group("cards.stage_id").
+		Scan(&counts).Error
+	return counts, err
+}
+
 // =========================================================================
 // CHECKLIST & CONTEXT OPERATIONS
 // =========================================================================
@@ -299,6 +423,67 @@ func (r *KanbanRepository) AddChecklistItem(ctx context.Context, item *models.Ch
 	return r.db.WithContext(ctx).Create(item).Error
 }
 
+// GetChecklistItem returns a checklist item by ID
+func (r *KanbanRepository) GetChecklistItem(ctx context.Context, id uuid.UUID) (*models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	if err := r.db.WithContext(ctx).First(&item, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChecklistItemNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// DeleteChecklistItem deletes a checklist item
+func (r *KanbanRepository) DeleteChecklistItem(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&models.ChecklistItem{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChecklistItemNotFound
+	}
+	return nil
+}
+
+// ListChecklistTemplate returns the template items of a stage
+func (r *KanbanRepository) ListChecklistTemplate(ctx context.Context, stageID uuid.UUID) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+	err := r.db.WithContext(ctx).
+		Where("stage_id = ? AND card_id IS NULL", stageID).
+		Order("position ASC").
+		Find(&items).Error
+	return items, err
+}
+
+// CopyChecklistTemplate copies the template items of a stage onto a card.
+// Items the card already got from the stage (e.g. on a previous visit) are not duplicated.
+func (r *KanbanRepository) CopyChecklistTemplate(ctx context.Context, cardID, stageID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Exec(`
+		INSERT INTO checklist_items (id, card_id, stage_id, text, is_completed, is_required, position)
+		SELECT uuid_generate_v4(), ?, t.stage_id, t.text, false, t.is_required, t.position
+		FROM checklist_items t
+		WHERE t.stage_id = ? AND t.card_id IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM checklist_items i
+				WHERE i.card_id = ? AND i.stage_id = t.stage_id AND i.text = t.text
+			)`, cardID, stageID, cardID)
+	return result.RowsAffected, result.Error
+}
+
+// ListIncompleteRequiredItems returns the open required items of a card that block
+// it from leaving a stage: the ones copied from that stage and the card's own items
+func (r *KanbanRepository) ListIncompleteRequiredItems(ctx context.Context, cardID, stageID uuid.UUID) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+	err := r.db.WithContext(ctx).
+		Where("card_id = ? AND is_required = ? AND is_completed = ?", cardID, true, false).
+		Where("stage_id = ? OR stage_id IS NULL", stageID).
+		Order("position ASC").
+		Find(&items).Error
+	return items, err
+}
+
 // ListCompanies return all companies for an account
 func (r *KanbanRepository) ListCompanies(ctx context.Context, accountID int) ([]models.Company, error) {
 	var companies []models.Company
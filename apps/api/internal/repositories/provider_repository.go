@@ -4,6 +4,7 @@ package repositories
 import (
 	"context"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -76,6 +77,46 @@ func (r *ProviderRepository) FindByIDForAccount(ctx context.Context, id uuid.UUI
 	}
 	return &provider, nil
 }
+
+// FindByInstanceName returns an active provider by its instance name
+func (r *ProviderRepository) FindByInstanceName(ctx context.Context, instanceName string) (*models.Provider, error) {
+	var provider models.Provider
+	if err := r.db.WithContext(ctx).
+		Where("instance_name = ? AND status <> ?", instanceName, "inactive").
+		Order("created_at DESC").
+		First(&provider).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProviderNotFound
+		}
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// FindByChatwootInbox returns the active provider bound to a Chatwoot inbox.
+// Providers configured before inboxes were synced name their inbox in
+// metadata.chatwoot_inbox_id; they are used while the inbox has no binding.
+func (r *ProviderRepository) FindByChatwootInbox(ctx context.Context, accountID, inboxID int) (*models.Provider, error) {
+	var provider models.Provider
+	err := r.db.WithContext(ctx).
+		Joins("JOIN inboxes ON inboxes.provider_id = providers.id AND inboxes.deleted_at IS NULL").
+		Where("inboxes.account_id = ? AND inboxes.chatwoot_id = ? AND providers.status <> ?", accountID, inboxID, "inactive").
+		First(&provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = r.db.WithContext(ctx).
+			Where("account_id = ? AND metadata->>'chatwoot_inbox_id' = ? AND status <> ?", accountID, strconv.Itoa(inboxID), "inactive").
+			Where("NOT EXISTS (SELECT 1 FROM inboxes WHERE inboxes.account_id = providers.account_id AND inboxes.chatwoot_id = ? AND inboxes.provider_id IS NOT NULL AND inboxes.deleted_at IS NULL)", inboxID).
+			Order("created_at DESC").
+			First(&provider).Error
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProviderNotFound
+		}
+		return nil, err
+	}
+	return &provider, nil
+}
 
 // FindByAccountID returns all providers for an account
 func (r *ProviderRepository) FindByAccountID(ctx context.Context, accountID int) ([]models.Provider, error) {
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+// ArchiveRow is a row being archived, serialized by Postgres with row_to_json
+type ArchiveRow struct {
+	Doc       string
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ArchiveQuery selects the expired rows of an account in a table. Table and
+// Filter are SQL fragments and must come from code, never from requests.
+type ArchiveQuery struct {
+	Table     string
+	Filter    string // Extra condition, e.g. only finished executions
+	AccountID int
+	Cutoff    time.Time   // Rows created before it are expired
+	After     *ArchiveRow // Rows after this one
+	Through   *ArchiveRow // Rows up to this one
+}
+
+// RetentionRepository moves expired rows to archives and back
+type RetentionRepository struct {
+	db *gorm.DB
+}
+
+// NewRetentionRepository creates a new RetentionRepository
+func NewRetentionRepository(db *gorm.DB) *RetentionRepository {
+	return &RetentionRepository{db: db}
+}
+
+// AccountsWithRetention returns the accounts that have a retention policy in their settings
+func (r *RetentionRepository) AccountsWithRetention(ctx context.Context) ([]models.Account, error) {
+	var accounts []models.Account
+	err := r.db.WithContext(ctx).Where("settings->'retention' IS NOT NULL").Order("id ASC").Find(&accounts).Error
+	return accounts, err
+}
+
+// FindExpired returns a batch of expired rows in (created_at, id) order
+func (r *RetentionRepository) FindExpired(ctx context.Context, query ArchiveQuery, limit int) ([]ArchiveRow, error) {
+	where, args := query.where("t.")
+	sql := fmt.Sprintf(`SELECT row_to_json(t)::text AS doc, t.created_at, t.id FROM %s t WHERE %s
+		ORDER BY t.created_at ASC, t.id ASC LIMIT ?`, query.Table, where)
+
+	var rows []ArchiveRow
+	err := r.db.WithContext(ctx).Raw(sql, append(args, limit)...).Scan(&rows).Error
+	return rows, err
+}
+
+// DeleteArchived deletes a batch of the expired rows up to query.Through and
+// returns how many were deleted
+func (r *RetentionRepository) DeleteArchived(ctx context.Context, query ArchiveQuery, limit int) (int64, error) {
+	where, args := query.where("")
+	sql := fmt.Sprintf(`DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s LIMIT ?)`, query.Table, query.Table, where)
+
+	result := r.db.WithContext(ctx).Exec(sql, append(args, limit)...)
+	return result.RowsAffected, result.Error
+}
+
+// MarkAuditArchived moves the start of the account's audit chain past the
+// newest chained entry of the archived audit logs
+func (r *RetentionRepository) MarkAuditArchived(ctx context.Context, query ArchiveQuery) error {
+	where, args := query.where("")
+	var last models.AuditLog
+	err := r.db.WithContext(ctx).Where(where+" AND sequence > 0", args...).Order("sequence DESC").Limit(1).Find(&last).Error
+	if err != nil || last.Sequence == 0 {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Model(&models.AuditChainHead{}).
+		Where("account_id = ? AND archived_sequence < ?", query.AccountID, last.Sequence).
+		Updates(map[string]interface{}{
+			"archived_sequence": last.Sequence,
+			"archived_hash":     last.Hash,
+		}).Error
+}
+
+// RestoreRows inserts archived rows into <table>_restored, a copy of the
+// table kept apart from live data, and returns how many were new
+func (r *RetentionRepository) RestoreRows(ctx context.Context, table string, docs []string) (int64, error) {
+	restored := table + "_restored"
+	setup := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS)", restored, table),
+		fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_id ON %s(id)", restored, restored),
+	}
+	for _, sql := range setup {
+		if err := r.db.WithContext(ctx).Exec(sql).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	sql := fmt.Sprintf(`INSERT INTO %s SELECT * FROM json_populate_recordset(NULL::%s, ?::json) ON CONFLICT (id) DO NOTHING`, restored, restored)
+	result := r.db.WithContext(ctx).Exec(sql, "["+strings.Join(docs, ",")+"]")
+	return result.RowsAffected, result.Error
+}
+
+func (q ArchiveQuery) where(alias string) (string, []interface{}) {
+	conds := []string{alias + "account_id = ?", alias + "created_at < ?"}
+	args := []interface{}{q.AccountID, q.Cutoff}
+	if q.Filter != "" {
+		conds = append(conds, q.Filter)
+	}
+	if q.After != nil {
+		conds = append(conds, fmt.Sprintf("(%screated_at, %sid) > (?, ?)", alias, alias))
+		args = append(args, q.After.CreatedAt, q.After.ID)
+	}
+	if q.Through != nil {
+		conds = append(conds, fmt.Sprintf("(%screated_at, %sid) <= (?, ?)", alias, alias))
+		args = append(args, q.Through.CreatedAt, q.Through.ID)
+	}
+	return strings.Join(conds, " AND "), args
+}
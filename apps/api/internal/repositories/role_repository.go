@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// RoleRepository handles custom role database operations
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// Create stores a new custom role
+func (r *RoleRepository) Create(ctx context.Context, role *models.CustomRole) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+// ListByAccount returns the custom roles of an account ordered by name
+func (r *RoleRepository) ListByAccount(ctx context.Context, accountID int) ([]models.CustomRole, error) {
+	var roles []models.CustomRole
+	err := r.db.WithContext(ctx).
+		Where("account_id = ?", accountID).
+		Order("name ASC").
+		Find(&roles).Error
+	return roles, err
+}
+
+// GetForAccount returns a custom role by ID scoped to an account
+func (r *RoleRepository) GetForAccount(ctx context.Context, id uint, accountID int) (*models.CustomRole, error) {
+	var role models.CustomRole
+	if err := r.db.WithContext(ctx).First(&role, "id = ? AND account_id = ?", id, accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// NameTaken reports whether another role of the account already uses the name
+func (r *RoleRepository) NameTaken(ctx context.Context, accountID int, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.CustomRole{}).
+		Where("account_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", accountID, name, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Update saves the name, description and permissions of a role
+func (r *RoleRepository) Update(ctx context.Context, role *models.CustomRole) error {
+	return r.db.WithContext(ctx).Model(role).Select("name", "description", "permissions").Updates(role).Error
+}
+
+// Delete removes a role and unassigns it from its users
+func (r *RoleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("custom_role_id = ?", id).Update("custom_role_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.CustomRole{}, id).Error
+	})
+}
+
+// UserIDs returns the users assigned to a role
+func (r *RoleRepository) UserIDs(ctx context.Context, id uint) ([]int, error) {
+	var ids []int
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("custom_role_id = ?", id).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// AssignToUser sets (or clears, with nil) the custom role of a user of the account
+func (r *RoleRepository) AssignToUser(ctx context.Context, accountID, userID int, roleID *uint) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND account_id = ?", userID, accountID).
+		Update("custom_role_id", roleID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// FindForUser returns the custom role assigned to a user, or nil
+func (r *RoleRepository) FindForUser(ctx context.Context, accountID, userID int) (*models.CustomRole, error) {
+	var role models.CustomRole
+	err := r.db.WithContext(ctx).
+		Joins("JOIN users ON users.custom_role_id = custom_roles.id").
+		Where("users.id = ? AND custom_roles.account_id = ?", userID, accountID).
+		First(&role).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
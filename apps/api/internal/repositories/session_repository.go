@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"whatpro-hub/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -9,9 +11,12 @@ import (
 type SessionRepository interface {
 	Create(session *models.Session) error
 	FindByID(id uuid.UUID) (*models.Session, error)
+	ListActiveForUser(userID int) ([]models.Session, error)
 	Revoke(id uuid.UUID) error
 	RevokeAllForUser(userID int) error
-	UpdateLastSeen(id uuid.UUID) error
+	RevokeOthersForUser(userID int, keep uuid.UUID) error
+	RotateRefreshToken(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	TouchLastSeen(id uuid.UUID, now time.Time, interval time.Duration) error
 }
 
 type sessionRepository struct {
@@ -32,14 +37,44 @@ func (r *sessionRepository) FindByID(id uuid.UUID) (*models.Session, error) {
 	return &session, err
 }
 
+// ListActiveForUser returns the sessions that are neither revoked nor expired, most recently used first
+func (r *sessionRepository) ListActiveForUser(userID int) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > NOW()", userID).
+		Order("last_seen_at DESC NULLS LAST").
+		Find(&sessions).Error
+	return sessions, err
+}
+
 func (r *sessionRepository) Revoke(id uuid.UUID) error {
-	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("revoked_at", gorm.Expr("NOW()")).Error
+	return r.db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", gorm.Expr("NOW()")).Error
 }
 
 func (r *sessionRepository) RevokeAllForUser(userID int) error {
 	return r.db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", gorm.Expr("NOW()")).Error
 }
 
-func (r *sessionRepository) UpdateLastSeen(id uuid.UUID) error {
-	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", gorm.Expr("NOW()")).Error
+func (r *sessionRepository) RevokeOthersForUser(userID int, keep uuid.UUID) error {
+	return r.db.Model(&models.Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keep).Update("revoked_at", gorm.Expr("NOW()")).Error
+}
+
+// RotateRefreshToken swaps the refresh token hash only if oldHash is still current,
+// so two requests racing with the same token cannot both succeed
+func (r *sessionRepository) RotateRefreshToken(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": newHash,
+			"expires_at":         expiresAt,
+			"last_seen_at":       gorm.Expr("NOW()"),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// TouchLastSeen records activity on the session, writing at most once per interval
+func (r *sessionRepository) TouchLastSeen(id uuid.UUID, now time.Time, interval time.Duration) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", id, now.Add(-interval)).
+		Update("last_seen_at", now).Error
 }
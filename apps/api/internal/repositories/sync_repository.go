@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+var ErrSyncReportNotFound = errors.New("sync report not found")
+
+// SyncRepository stores the entities mirrored from Chatwoot and the reports of each sync
+type SyncRepository struct {
+	db *gorm.DB
+}
+
+// NewSyncRepository creates a new SyncRepository
+func NewSyncRepository(db *gorm.DB) *SyncRepository {
+	return &SyncRepository{db: db}
+}
+
+// FindMirrored loads into dest the rows of an account that mirror a Chatwoot
+// entity, removed ones included so they can be restored
+func (r *SyncRepository) FindMirrored(ctx context.Context, accountID int, dest interface{}) error {
+	return r.db.WithContext(ctx).Unscoped().
+		Where("account_id = ? AND chatwoot_id > 0", accountID).
+		Order("id ASC").
+		Find(dest).Error
+}
+
+// FindUsersByChatwootIDs returns the users of any account with the given Chatwoot IDs, removed ones included
+func (r *SyncRepository) FindUsersByChatwootIDs(ctx context.Context, chatwootIDs []int) ([]models.User, error) {
+	var users []models.User
+	if len(chatwootIDs) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Unscoped().Where("chatwoot_id IN ?", chatwootIDs).Find(&users).Error
+	return users, err
+}
+
+// Create inserts a mirrored row
+func (r *SyncRepository) Create(ctx context.Context, value interface{}) error {
+	return r.db.WithContext(ctx).Create(value).Error
+}
+
+// Save updates a mirrored row; removed rows are updated too, which restores them
+// when their DeletedAt was cleared. Inbox bindings are managed locally and kept.
+func (r *SyncRepository) Save(ctx context.Context, value interface{}) error {
+	return r.db.WithContext(ctx).Unscoped().Omit("ProviderID").Save(value).Error
+}
+
+// Remove soft-deletes a mirrored row
+func (r *SyncRepository) Remove(ctx context.Context, model interface{}, id uint) error {
+	return r.db.WithContext(ctx).Delete(model, id).Error
+}
+
+// RemoveInbox soft-deletes an inbox and frees the provider bound to it
+func (r *SyncRepository) RemoveInbox(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.Inbox{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"provider_id": nil, "deleted_at": time.Now()}).Error
+}
+
+// FindTeamMembers returns the memberships of the given teams
+func (r *SyncRepository) FindTeamMembers(ctx context.Context, teamIDs []uint) ([]models.TeamMember, error) {
+	var members []models.TeamMember
+	if len(teamIDs) == 0 {
+		return members, nil
+	}
+	err := r.db.WithContext(ctx).Where("team_id IN ?", teamIDs).Find(&members).Error
+	return members, err
+}
+
+// AddTeamMember adds a user to a team
+func (r *SyncRepository) AddTeamMember(ctx context.Context, teamID, userID uint) error {
+	return r.db.WithContext(ctx).Create(&models.TeamMember{TeamID: teamID, UserID: userID}).Error
+}
+
+// RemoveTeamMember deletes a membership
+func (r *SyncRepository) RemoveTeamMember(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.TeamMember{}, id).Error
+}
+
+// CreateReport stores the report of a sync
+func (r *SyncRepository) CreateReport(ctx context.Context, report *models.SyncReport) error {
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+// ListReports returns the latest sync reports of an account, newest first
+func (r *SyncRepository) ListReports(ctx context.Context, accountID, limit int) ([]models.SyncReport, error) {
+	var reports []models.SyncReport
+	err := r.db.WithContext(ctx).
+		Where("account_id = ?", accountID).
+		Order("started_at DESC").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// FindReport returns a sync report of an account
+func (r *SyncRepository) FindReport(ctx context.Context, accountID int, id uuid.UUID) (*models.SyncReport, error) {
+	var report models.SyncReport
+	err := r.db.WithContext(ctx).Where("id = ? AND account_id = ?", id, accountID).First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSyncReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -110,7 +110,7 @@ func (r *TeamRepository) GetMembers(ctx context.Context, teamID uint) ([]models.
 	err := r.db.WithContext(ctx).
 		Table("users").
 		Joins("JOIN team_members ON team_members.user_id = users.id").
-		Where("team_members.team_id = ?", teamID).
+		Where("team_members.team_id = ? AND users.deleted_at IS NULL", teamID).
 		Find(&users).Error
 	return users, err
 }
@@ -121,7 +121,7 @@ func (r *TeamRepository) GetMembersForAccount(ctx context.Context, teamID uint,
 		Table("users").
 		Joins("JOIN team_members ON team_members.user_id = users.id").
 		Joins("JOIN teams ON teams.id = team_members.team_id").
-		Where("team_members.team_id = ? AND teams.account_id = ?", teamID, accountID).
+		Where("team_members.team_id = ? AND teams.account_id = ? AND users.deleted_at IS NULL", teamID, accountID).
 		Find(&users).Error
 	return users, err
 }
@@ -179,3 +179,50 @@ func TestTenantIsolation_CardHistory(t *testing.T) {
 		t.Fatalf("expected card after history: %v", err)
 	}
 }
+
+func TestTenantIsolation_MessageMappings(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	accountA, accountB, _, _, _, providerA := seedTenantData(t, db)
+	providerB := models.Provider{
+		AccountID:    int(accountB.ID),
+		Name:         "Provider B",
+		Type:         "evolution",
+		BaseURL:      "http://example.com",
+		InstanceName: "inst-b",
+		Status:       "connected",
+	}
+	if err := db.Create(&providerB).Error; err != nil {
+		t.Fatalf("create provider B: %v", err)
+	}
+
+	gatewayRepo := NewGatewayRepository(db)
+	waID := "WA-" + uuid.NewString()
+	mapping := &models.MessageMapping{
+		AccountID:   int(accountA.ID),
+		ProviderID:  providerA.ID,
+		WAMessageID: waID,
+		Direction:   "c2p",
+		Status:      "sent",
+	}
+	if err := gatewayRepo.CreateMapping(ctx, mapping); err != nil {
+		t.Fatalf("create mapping: %v", err)
+	}
+
+	// Another provider reporting the same message ID sees nothing
+	if _, err := gatewayRepo.FindMappingByWAID(ctx, providerB.ID, waID); err != ErrMappingNotFound {
+		t.Fatalf("expected mapping not found for another provider, got %v", err)
+	}
+	if err := gatewayRepo.UpdateMappingStatus(ctx, providerB.ID, waID, "read"); err != ErrMappingNotFound {
+		t.Fatalf("expected status update to fail for another provider, got %v", err)
+	}
+
+	if err := gatewayRepo.UpdateMappingStatus(ctx, providerA.ID, waID, "delivered"); err != nil {
+		t.Fatalf("update status for owner: %v", err)
+	}
+	found, err := gatewayRepo.FindMappingByWAID(ctx, providerA.ID, waID)
+	if err != nil || found.Status != "delivered" {
+		t.Fatalf("expected delivered mapping for provider A, got %+v, %v", found, err)
+	}
+}
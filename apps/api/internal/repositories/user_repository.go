@@ -21,6 +21,7 @@ type UserRepository interface {
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	Create(ctx context.Context, user *models.User) error
 	Update(ctx context.Context, user *models.User) error
+	SetChatwootToken(ctx context.Context, id uint, encrypted string) error
 	Delete(ctx context.Context, id uint) error
 	DeleteForAccount(ctx context.Context, id uint, accountID int) error
 }
@@ -102,6 +103,11 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 	return r.db.WithContext(ctx).Save(user).Error
 }
 
+// SetChatwootToken stores the encrypted Chatwoot access token of a user
+func (r *userRepository) SetChatwootToken(ctx context.Context, id uint, encrypted string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("chatwoot_token", encrypted).Error
+}
+
 func (r *userRepository) Delete(ctx context.Context, id uint) error {
 	result := r.db.WithContext(ctx).Delete(&models.User{}, id)
 	if result.Error != nil {
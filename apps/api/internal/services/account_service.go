@@ -82,6 +82,9 @@ func (s *AccountService) UpdateAccount(ctx context.Context, id uint, updates map
 		account.Features = features
 	}
 	if settings, ok := updates["settings"].(models.JSON); ok {
+		if _, err := ParseRetentionPolicy(settings); err != nil {
+			return err
+		}
 		account.Settings = settings
 	}
 
@@ -98,7 +101,7 @@ func (s *AccountService) SyncFromChatwoot(ctx context.Context) error {
 	log.Println("🔄 Syncing accounts from Chatwoot...")
 
 	// Get all accounts from Chatwoot
-	cwAccounts, err := s.chatwootClient.ListAccounts()
+	cwAccounts, err := s.chatwootClient.ListAccounts(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch accounts from Chatwoot: %w", err)
 	}
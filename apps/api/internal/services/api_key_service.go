@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+// apiKeyPrefix starts every issued key: wp_live_<prefix>.<secret>
+const apiKeyPrefix = "wp_live_"
+
+// apiKeyTouchInterval throttles the last_used_at writes of busy keys
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+	ErrAPIKeyExpired = errors.New("API key expired")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrInvalidExpiry = errors.New("expires_at must be in the future")
+)
+
+// APIKeyScopes lists the scopes a key can be granted
+var APIKeyScopes = []string{
+	"boards:read", "boards:write",
+	"cards:read", "cards:write",
+	"chat:read", "chat:write",
+	"providers:read", "providers:write",
+	"teams:read", "teams:write",
+	"users:read", "users:write",
+	"events:read", "events:write",
+}
+
+// APIKeyService issues and validates API keys
+type APIKeyService struct {
+	repo     *repositories.APIKeyRepository
+	userRepo repositories.UserRepository
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(repo *repositories.APIKeyRepository, userRepo repositories.UserRepository) *APIKeyService {
+	return &APIKeyService{repo: repo, userRepo: userRepo}
+}
+
+// CreateAPIKeyRequest represents an API key creation request
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Create issues a key acting on behalf of createdBy. The plaintext key is
+// returned only here; just its hash is stored.
+func (s *APIKeyService) Create(ctx context.Context, accountID, createdBy int, req CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	prefix, secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.APIKey{
+		AccountID: accountID,
+		CreatedBy: createdBy,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashAPIKeySecret(secret),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, formatAPIKey(prefix, secret), nil
+}
+
+// List returns the keys of an account
+func (s *APIKeyService) List(ctx context.Context, accountID int) ([]models.APIKey, error) {
+	return s.repo.ListByAccount(ctx, accountID)
+}
+
+// Rotate replaces the secret of an active key; the previous one stops working immediately
+func (s *APIKeyService) Rotate(ctx context.Context, accountID int, id uuid.UUID) (*models.APIKey, string, error) {
+	key, err := s.repo.GetForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.RevokedAt != nil {
+		return nil, "", ErrAPIKeyRevoked
+	}
+
+	prefix, secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.repo.Update(ctx, key.ID, map[string]interface{}{
+		"prefix":   prefix,
+		"key_hash": hashAPIKeySecret(secret),
+	}); err != nil {
+		return nil, "", err
+	}
+
+	key.Prefix = prefix
+	return key, formatAPIKey(prefix, secret), nil
+}
+
+// Revoke disables a key permanently
+func (s *APIKeyService) Revoke(ctx context.Context, accountID int, id uuid.UUID) (*models.APIKey, error) {
+	key, err := s.repo.GetForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := time.Now()
+	if err := s.repo.Update(ctx, key.ID, map[string]interface{}{"revoked_at": now}); err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+	return key, nil
+}
+
+// SetExpiry sets or clears (nil) the expiry of a key
+func (s *APIKeyService) SetExpiry(ctx context.Context, accountID int, id uuid.UUID, expiresAt *time.Time) (*models.APIKey, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	key, err := s.repo.GetForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, key.ID, map[string]interface{}{"expires_at": expiresAt}); err != nil {
+		return nil, err
+	}
+	key.ExpiresAt = expiresAt
+	return key, nil
+}
+
+// Authenticate resolves a plaintext key to the key record and the user it acts for
+func (s *APIKeyService) Authenticate(ctx context.Context, raw string) (*models.APIKey, *models.User, error) {
+	prefix, secret, ok := parseAPIKey(raw)
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.FindByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil {
+		return nil, nil, ErrAPIKeyRevoked
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+
+	user, err := s.userRepo.FindByIDForAccount(ctx, uint(key.CreatedBy), key.AccountID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey // The user behind the key is gone
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, key.ID, now, apiKeyTouchInterval); err != nil {
+		return nil, nil, err
+	}
+	return key, user, nil
+}
+
+// KeyScopes splits the stored scopes of a key
+func KeyScopes(key *models.APIKey) []string {
+	if key.Scopes == "" {
+		return nil
+	}
+	return strings.Split(key.Scopes, ",")
+}
+
+// normalizeScopes validates, deduplicates and sorts requested scopes
+func normalizeScopes(scopes []string) ([]string, error) {
+	known := make(map[string]bool, len(APIKeyScopes))
+	for _, scope := range APIKeyScopes {
+		known[scope] = true
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !known[scope] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// generateAPIKey returns a random public prefix and secret
+func generateAPIKey() (string, string, error) {
+	buf := make([]byte, 4+32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(buf[:4]), hex.EncodeToString(buf[4:]), nil
+}
+
+func formatAPIKey(prefix, secret string) string {
+	return apiKeyPrefix + prefix + "." + secret
+}
+
+// parseAPIKey splits wp_live_<prefix>.<secret>
+func parseAPIKey(raw string) (string, string, bool) {
+	prefixPart, secret, ok := strings.Cut(raw, ".")
+	if !ok || secret == "" || !strings.HasPrefix(prefixPart, apiKeyPrefix) {
+		return "", "", false
+	}
+	prefix := strings.TrimPrefix(prefixPart, apiKeyPrefix)
+	if prefix == "" {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{"cards:write", " boards:read", "cards:write"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(scopes, ",") != "boards:read,cards:write" {
+		t.Fatalf("unexpected scopes %v", scopes)
+	}
+
+	if _, err := normalizeScopes([]string{"cards:delete"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("unknown scope should fail with ErrInvalidScope, got %v", err)
+	}
+	if _, err := normalizeScopes(nil); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("empty scopes should fail with ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestAPIKeyFormat(t *testing.T) {
+	prefix, secret, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gotPrefix, gotSecret, ok := parseAPIKey(formatAPIKey(prefix, secret))
+	if !ok || gotPrefix != prefix || gotSecret != secret {
+		t.Fatalf("round trip failed: %q %q %v", gotPrefix, gotSecret, ok)
+	}
+
+	for _, raw := range []string{"", "wp_live_.secret", "wp_live_abc.", "wp_test_abc.secret", "wp_live_abc"} {
+		if _, _, ok := parseAPIKey(raw); ok {
+			t.Fatalf("%q should not parse", raw)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+// AsaasSandboxURL is the base URL of the Asaas sandbox, for ASAAS_URL in development
+const AsaasSandboxURL = "https://sandbox.asaas.com/api/v3"
+
+// asaasPageSize is the largest page the Asaas list endpoints return
+const asaasPageSize = 100
+
+// AsaasProvider is the implementation for Asaas (API v3)
+type AsaasProvider struct {
+	APIKey       string
+	URL          string
+	WebhookToken string // Sent by Asaas in the asaas-access-token header
+	HTTPClient   *http.Client
+}
+
+// NewAsaasProvider creates an Asaas provider; an empty baseURL uses production
+func NewAsaasProvider(apiKey, baseURL, webhookToken string) *AsaasProvider {
+	if baseURL == "" {
+		baseURL = "https://api.asaas.com/v3"
+	}
+	return &AsaasProvider{
+		APIKey:       apiKey,
+		URL:          strings.TrimRight(baseURL, "/"),
+		WebhookToken: webhookToken,
+		HTTPClient:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Name identifies Asaas in subscriptions, plans and webhook routes
+func (p *AsaasProvider) Name() string {
+	return models.ProviderAsaas
+}
+
+// asaasCustomer is a customer of the Asaas API
+type asaasCustomer struct {
+	ID                string `json:"id,omitempty"`
+	Name              string `json:"name"`
+	Email             string `json:"email,omitempty"`
+	CpfCnpj           string `json:"cpfCnpj,omitempty"`
+	ExternalReference string `json:"externalReference,omitempty"`
+}
+
+// asaasPayment is a charge of the Asaas API
+type asaasPayment struct {
+	ID                string  `json:"id"`
+	Subscription      string  `json:"subscription"`
+	Value             float64 `json:"value"`
+	BillingType       string  `json:"billingType"`
+	Status            string  `json:"status"`
+	InvoiceURL        string  `json:"invoiceUrl"`
+	PaymentDate       string  `json:"paymentDate"`
+	ClientPaymentDate string  `json:"clientPaymentDate"`
+	Deleted           bool    `json:"deleted"`
+}
+
+// CreateCustomer returns the Asaas customer of an account, creating it on first use
+func (p *AsaasProvider) CreateCustomer(ctx context.Context, customer PaymentCustomer) (string, error) {
+	reference := asaasReference(customer.AccountID)
+
+	var existing struct {
+		Data []asaasCustomer `json:"data"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/customers?externalReference="+url.QueryEscape(reference), nil, &existing); err != nil {
+		return "", err
+	}
+	if len(existing.Data) > 0 {
+		return existing.Data[0].ID, nil
+	}
+
+	var created asaasCustomer
+	err := p.do(ctx, http.MethodPost, "/customers", asaasCustomer{
+		Name:              customer.Name,
+		Email:             customer.Email,
+		CpfCnpj:           customer.Document,
+		ExternalReference: reference,
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// CreateSubscription creates a monthly subscription charged with the requested
+// billing type. The invoice of its first charge is the checkout URL.
+func (p *AsaasProvider) CreateSubscription(ctx context.Context, req SubscriptionRequest) (*ProviderSubscription, error) {
+	billingType, ok := asaasBillingTypes[req.PaymentMethod]
+	if !ok {
+		return nil, ErrInvalidPaymentMethod
+	}
+
+	body := map[string]interface{}{
+		"customer":          req.CustomerID,
+		"billingType":       billingType,
+		"value":             req.Plan.Price,
+		"nextDueDate":       req.FirstDueDate.Format("2006-01-02"),
+		"cycle":             "MONTHLY",
+		"description":       req.Plan.Name,
+		"externalReference": asaasReference(req.AccountID),
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/subscriptions", body, &created); err != nil {
+		return nil, err
+	}
+
+	sub := &ProviderSubscription{ID: created.ID}
+	var first struct {
+		Data []asaasPayment `json:"data"`
+	}
+	query := url.Values{"subscription": {created.ID}, "offset": {"0"}, "limit": {"1"}}
+	if err := p.do(ctx, http.MethodGet, "/payments?"+query.Encode(), nil, &first); err == nil && len(first.Data) > 0 {
+		sub.CheckoutURL = first.Data[0].InvoiceURL
+	}
+	return sub, nil
+}
+
+// CancelSubscription cancels a subscription; its pending charges are removed by Asaas
+func (p *AsaasProvider) CancelSubscription(ctx context.Context, subID string) error {
+	return p.do(ctx, http.MethodDelete, "/subscriptions/"+url.PathEscape(subID), nil, nil)
+}
+
+// ChangeSubscriptionPlan charges the price of another plan from the next
+// charge on; charges already issued are updated too
+func (p *AsaasProvider) ChangeSubscriptionPlan(ctx context.Context, subID string, plan *models.Plan) error {
+	body := map[string]interface{}{
+		"value":                 plan.Price,
+		"description":           plan.Name,
+		"updatePendingPayments": true,
+	}
+	return p.do(ctx, http.MethodPost, "/subscriptions/"+url.PathEscape(subID), body, nil)
+}
+
+// ListPayments returns every charge of a subscription
+func (p *AsaasProvider) ListPayments(ctx context.Context, subID string) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	for offset := 0; ; offset += asaasPageSize {
+		query := url.Values{
+			"subscription": {subID},
+			"offset":       {strconv.Itoa(offset)},
+			"limit":        {strconv.Itoa(asaasPageSize)},
+		}
+
+		var page struct {
+			HasMore bool           `json:"hasMore"`
+			Data    []asaasPayment `json:"data"`
+		}
+		if err := p.do(ctx, http.MethodGet, "/payments?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, payment := range page.Data {
+			transactions = append(transactions, *asaasTransaction(payment, ""))
+		}
+		if !page.HasMore || len(page.Data) == 0 {
+			return transactions, nil
+		}
+	}
+}
+
+// VerifyWebhook checks the access token Asaas sends with each webhook
+func (p *AsaasProvider) VerifyWebhook(header http.Header, payload []byte) error {
+	token := header.Get("asaas-access-token")
+	if p.WebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.WebhookToken)) != 1 {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// ParseWebhook parses the PAYMENT_* events of Asaas; other events are ignored
+func (p *AsaasProvider) ParseWebhook(ctx context.Context, payload []byte) (*PaymentEvent, error) {
+	var webhook struct {
+		Event   string        `json:"event"`
+		Payment *asaasPayment `json:"payment"`
+	}
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, fmt.Errorf("invalid Asaas webhook: %w", err)
+	}
+	if !strings.HasPrefix(webhook.Event, "PAYMENT_") {
+		return nil, nil
+	}
+	if webhook.Payment == nil || webhook.Payment.ID == "" {
+		return nil, fmt.Errorf("asaas %s webhook without payment", webhook.Event)
+	}
+
+	return &PaymentEvent{
+		Event:          webhook.Event,
+		SubscriptionID: webhook.Payment.Subscription,
+		Transaction:    asaasTransaction(*webhook.Payment, webhook.Event),
+	}, nil
+}
+
+// do performs a request against the Asaas API and decodes the response into out
+func (p *AsaasProvider) do(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.URL+endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("access_token", p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "whatpro-hub")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Errors []struct {
+				Code        string `json:"code"`
+				Description string `json:"description"`
+			} `json:"errors"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure) == nil && len(failure.Errors) > 0 {
+			return fmt.Errorf("asaas %s %s: status %d: %s", method, endpoint, resp.StatusCode, failure.Errors[0].Description)
+		}
+		return fmt.Errorf("asaas %s %s: status %d", method, endpoint, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+var asaasBillingTypes = map[string]string{
+	models.PaymentMethodPix:        "PIX",
+	models.PaymentMethodBoleto:     "BOLETO",
+	models.PaymentMethodCreditCard: "CREDIT_CARD",
+}
+
+// asaasTransaction converts an Asaas charge. The event, when set, takes
+// precedence over the charge status for removed and refused charges.
+func asaasTransaction(payment asaasPayment, event string) *models.Transaction {
+	tx := &models.Transaction{
+		Amount:     payment.Value,
+		Currency:   "BRL",
+		Status:     asaasStatus(payment.Status),
+		ProviderID: payment.ID,
+		InvoiceURL: payment.InvoiceURL,
+	}
+	for method, billingType := range asaasBillingTypes {
+		if billingType == payment.BillingType {
+			tx.PaymentMethod = method
+		}
+	}
+
+	switch event {
+	case "PAYMENT_DELETED":
+		tx.Status = models.TransactionCanceled
+	case "PAYMENT_CREDIT_CARD_CAPTURE_REFUSED", "PAYMENT_REPROVED_BY_RISK_ANALYSIS":
+		tx.Status = models.TransactionFailed
+	}
+	if payment.Deleted {
+		tx.Status = models.TransactionCanceled
+	}
+
+	if tx.Status == models.TransactionPaid {
+		for _, date := range []string{payment.ClientPaymentDate, payment.PaymentDate} {
+			if paidAt, err := time.Parse("2006-01-02", date); err == nil {
+				tx.PaidAt = &paidAt
+				break
+			}
+		}
+	}
+	return tx
+}
+
+// asaasStatus maps the status of an Asaas charge to a transaction status
+func asaasStatus(status string) string {
+	switch status {
+	case "RECEIVED", "CONFIRMED", "RECEIVED_IN_CASH", "DUNNING_RECEIVED":
+		return models.TransactionPaid
+	case "OVERDUE", "DUNNING_REQUESTED":
+		return models.TransactionFailed
+	case "REFUNDED", "REFUND_REQUESTED", "REFUND_IN_PROGRESS", "CHARGEBACK_REQUESTED", "CHARGEBACK_DISPUTE", "AWAITING_CHARGEBACK_REVERSAL":
+		return models.TransactionRefunded
+	default:
+		return models.TransactionPending
+	}
+}
+
+// asaasReference is the externalReference tying Asaas records to an account
+func asaasReference(accountID int) string {
+	return "account:" + strconv.Itoa(accountID)
+}
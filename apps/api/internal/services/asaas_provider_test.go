@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+// newAsaasFake serves the Asaas v3 endpoints used by AsaasProvider
+func newAsaasFake(t *testing.T) (*httptest.Server, map[string]bool) {
+	t.Helper()
+	calls := map[string]bool{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/customers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("access_token") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			calls["customers.search"] = true
+			if r.URL.Query().Get("externalReference") != "account:7" {
+				t.Errorf("unexpected customer reference: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"object":"list","hasMore":false,"data":[]}`))
+		case http.MethodPost:
+			calls["customers.create"] = true
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["cpfCnpj"] != "24971563792" || body["externalReference"] != "account:7" {
+				t.Errorf("unexpected customer: %v", body)
+			}
+			w.Write([]byte(`{"id":"cus_1"}`))
+		}
+	})
+	mux.HandleFunc("/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		calls["subscriptions.create"] = true
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["customer"] != "cus_1" || body["billingType"] != "PIX" || body["value"] != 99.9 || body["nextDueDate"] != "2025-03-10" {
+			t.Errorf("unexpected subscription: %v", body)
+		}
+		w.Write([]byte(`{"id":"sub_1","status":"ACTIVE"}`))
+	})
+	mux.HandleFunc("/subscriptions/sub_1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		calls["subscriptions.delete"] = true
+		w.Write([]byte(`{"deleted":true,"id":"sub_1"}`))
+	})
+	mux.HandleFunc("/payments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("subscription") != "sub_1" {
+			t.Errorf("unexpected payments query: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("offset") == "0" {
+			fmt.Fprint(w, `{"hasMore":true,"data":[{"id":"pay_1","subscription":"sub_1","value":99.9,"billingType":"PIX","status":"RECEIVED","paymentDate":"2025-02-10","invoiceUrl":"https://asaas.com/i/pay_1"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"hasMore":false,"data":[{"id":"pay_2","subscription":"sub_1","value":99.9,"billingType":"BOLETO","status":"OVERDUE"}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+func TestAsaasSubscriptionLifecycle(t *testing.T) {
+	srv, calls := newAsaasFake(t)
+	p := NewAsaasProvider("key", srv.URL, "")
+	ctx := context.Background()
+
+	customerID, err := p.CreateCustomer(ctx, PaymentCustomer{AccountID: 7, Name: "Acme", Document: "24971563792"})
+	if err != nil || customerID != "cus_1" {
+		t.Fatalf("create customer: %q, %v", customerID, err)
+	}
+
+	sub, err := p.CreateSubscription(ctx, SubscriptionRequest{
+		CustomerID:    customerID,
+		AccountID:     7,
+		Plan:          &models.Plan{Name: "Pro", Price: 99.9},
+		PaymentMethod: models.PaymentMethodPix,
+		FirstDueDate:  time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil || sub.ID != "sub_1" || sub.CheckoutURL != "https://asaas.com/i/pay_1" {
+		t.Fatalf("create subscription: %+v, %v", sub, err)
+	}
+	subID := sub.ID
+
+	payments, err := p.ListPayments(ctx, subID)
+	if err != nil {
+		t.Fatalf("list payments: %v", err)
+	}
+	if len(payments) != 2 || payments[0].Status != models.TransactionPaid || payments[0].PaidAt == nil ||
+		payments[1].Status != models.TransactionFailed || payments[1].PaymentMethod != models.PaymentMethodBoleto {
+		t.Fatalf("unexpected payments: %+v", payments)
+	}
+
+	if err := p.CancelSubscription(ctx, subID); err != nil {
+		t.Fatalf("cancel subscription: %v", err)
+	}
+
+	for _, call := range []string{"customers.search", "customers.create", "subscriptions.create", "subscriptions.delete"} {
+		if !calls[call] {
+			t.Fatalf("%s was not called", call)
+		}
+	}
+}
+
+func TestAsaasRejectsInvalidPaymentMethod(t *testing.T) {
+	p := NewAsaasProvider("key", "http://127.0.0.1:0", "")
+	_, err := p.CreateSubscription(context.Background(), SubscriptionRequest{Plan: &models.Plan{}, PaymentMethod: "cash"})
+	if err != ErrInvalidPaymentMethod {
+		t.Fatalf("expected ErrInvalidPaymentMethod, got %v", err)
+	}
+}
+
+func TestAsaasWebhook(t *testing.T) {
+	p := NewAsaasProvider("key", "", "whsec")
+
+	header := http.Header{}
+	if err := p.VerifyWebhook(header, nil); err != ErrInvalidWebhook {
+		t.Fatalf("missing token should be rejected, got %v", err)
+	}
+	header.Set("asaas-access-token", "whsec")
+	if err := p.VerifyWebhook(header, nil); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	ctx := context.Background()
+	event, err := p.ParseWebhook(ctx, []byte(`{"event":"PAYMENT_RECEIVED","payment":{"id":"pay_9","subscription":"sub_1","value":49.9,"billingType":"CREDIT_CARD","status":"RECEIVED","invoiceUrl":"https://asaas.com/i/pay_9","paymentDate":"2025-02-10"}}`))
+	if err != nil {
+		t.Fatalf("parse webhook: %v", err)
+	}
+	tx := event.Transaction
+	if event.SubscriptionID != "sub_1" || tx.ProviderID != "pay_9" || tx.Status != models.TransactionPaid || tx.Amount != 49.9 || tx.PaymentMethod != models.PaymentMethodCreditCard {
+		t.Fatalf("unexpected event: %+v %+v", event, tx)
+	}
+
+	event, err = p.ParseWebhook(ctx, []byte(`{"event":"PAYMENT_DELETED","payment":{"id":"pay_9","subscription":"sub_1","status":"PENDING"}}`))
+	if err != nil || event.Transaction.Status != models.TransactionCanceled {
+		t.Fatalf("deleted payment should be canceled: %+v, %v", event, err)
+	}
+
+	event, err = p.ParseWebhook(ctx, []byte(`{"event":"SUBSCRIPTION_CREATED","subscription":{"id":"sub_1"}}`))
+	if err != nil || event != nil {
+		t.Fatalf("non-payment events should be ignored: %+v, %v", event, err)
+	}
+}
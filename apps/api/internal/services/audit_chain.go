@@ -0,0 +1,281 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+// maxChainBreaks caps the breaks listed in a report; a rewritten table would otherwise list every entry
+const maxChainBreaks = 100
+
+// ErrSigningDisabled is returned by signed exports when no signing key is configured
+var ErrSigningDisabled = errors.New("audit signing key is not configured")
+
+// AuditSigner signs audit chain exports with an Ed25519 key
+type AuditSigner struct {
+	key   ed25519.PrivateKey
+	KeyID string
+}
+
+// NewAuditSigner creates a signer from a base64-encoded 32-byte Ed25519 seed
+func NewAuditSigner(seed string) (*AuditSigner, error) {
+	raw, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(raw) != ed25519.SeedSize {
+		return nil, fmt.Errorf("audit signing key must be a base64-encoded %d-byte seed", ed25519.SeedSize)
+	}
+	key := ed25519.NewKeyFromSeed(raw)
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &AuditSigner{key: key, KeyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+// PublicKey returns the base64-encoded public key auditors verify exports with
+func (s *AuditSigner) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the base64-encoded signature of message
+func (s *AuditSigner) Sign(message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, message))
+}
+
+// SigningEnabled reports whether signed chain exports are available
+func (s *AuditService) SigningEnabled() bool {
+	return s.signer != nil
+}
+
+// AuditChainBreak is a point where the chain of an account does not verify
+type AuditChainBreak struct {
+	Sequence int64      `json:"sequence"`
+	EntryID  *uuid.UUID `json:"entry_id,omitempty"`
+	Reason   string     `json:"reason"`
+}
+
+// AuditChainReport is the result of walking the audit chain of an account
+type AuditChainReport struct {
+	AccountID    int               `json:"account_id"`
+	Valid        bool              `json:"valid"`
+	Entries      int64             `json:"entries"`
+	HeadSequence int64             `json:"head_sequence"`
+	HeadHash     string            `json:"head_hash"`
+	Unchained    int64             `json:"unchained"` // Entries written before the chain existed
+	Breaks       []AuditChainBreak `json:"breaks"`
+	VerifiedAt   time.Time         `json:"verified_at"`
+}
+
+// AuditChainManifest closes a chain export. Its line is what the signature covers.
+type AuditChainManifest struct {
+	Type          string    `json:"type"` // "manifest"
+	Version       int       `json:"version"`
+	AccountID     int       `json:"account_id"`
+	Entries       int64     `json:"entries"`
+	HeadSequence  int64     `json:"head_sequence"`
+	HeadHash      string    `json:"head_hash"`
+	StartSequence int64     `json:"start_sequence"` // Entries up to it are archived
+	StartHash     string    `json:"start_hash"`     // Previous hash of the first exported entry
+	HashAlgorithm string    `json:"hash_algorithm"`
+	Valid         bool      `json:"valid"`
+	Breaks        int       `json:"breaks"`
+	KeyID         string    `json:"key_id"`
+	PublicKey     string    `json:"public_key"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// AuditChainSignature is the last line of a chain export
+type AuditChainSignature struct {
+	Type      string `json:"type"` // "signature"
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// VerifyChain walks the audit chain of an account up to its current head and reports every break
+func (s *AuditService) VerifyChain(accountID int) (*AuditChainReport, error) {
+	report := &AuditChainReport{AccountID: accountID, HeadHash: repositories.AuditChainGenesis}
+
+	unchained, err := s.repo.CountUnchained(accountID)
+	if err != nil {
+		return nil, err
+	}
+	report.Unchained = unchained
+
+	head, err := s.repo.FindChainHead(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := newChainVerifier(head)
+	if head != nil {
+		err = s.walkChain(accountID, head, func(entry *models.AuditLog) error {
+			verifier.check(entry)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		verifier.finish(head)
+		report.HeadSequence = head.Sequence
+		report.HeadHash = head.Hash
+	}
+
+	report.Entries = verifier.entries
+	report.Breaks = verifier.breaks
+	report.Valid = len(verifier.breaks) == 0
+	report.VerifiedAt = time.Now().UTC()
+	return report, nil
+}
+
+// ExportChain writes the audit chain of an account to w as NDJSON: one line
+// per entry in chain order, a manifest line with the head of the chain, and a
+// line with the Ed25519 signature of the manifest line's exact bytes.
+func (s *AuditService) ExportChain(accountID int, w io.Writer) error {
+	if s.signer == nil {
+		return ErrSigningDisabled
+	}
+
+	head, err := s.repo.FindChainHead(accountID)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		head = &models.AuditChainHead{AccountID: accountID, Hash: repositories.AuditChainGenesis}
+	}
+
+	encoder := json.NewEncoder(w)
+	verifier := newChainVerifier(head)
+	err = s.walkChain(accountID, head, func(entry *models.AuditLog) error {
+		verifier.check(entry)
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		return err
+	}
+	verifier.finish(head)
+
+	manifest, err := json.Marshal(AuditChainManifest{
+		Type:          "manifest",
+		Version:       1,
+		AccountID:     accountID,
+		Entries:       verifier.entries,
+		HeadSequence:  head.Sequence,
+		HeadHash:      head.Hash,
+		StartSequence: verifier.start,
+		StartHash:     verifier.startHash,
+		HashAlgorithm: "sha256",
+		Valid:         len(verifier.breaks) == 0,
+		Breaks:        len(verifier.breaks),
+		KeyID:         s.signer.KeyID,
+		PublicKey:     s.signer.PublicKey(),
+		GeneratedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(manifest, '\n')); err != nil {
+		return err
+	}
+
+	return encoder.Encode(AuditChainSignature{
+		Type:      "signature",
+		Algorithm: "ed25519",
+		KeyID:     s.signer.KeyID,
+		Signature: s.signer.Sign(manifest),
+	})
+}
+
+// ChainedAccounts returns the accounts that have an audit chain
+func (s *AuditService) ChainedAccounts() ([]int, error) {
+	return s.repo.ChainedAccountIDs()
+}
+
+// walkChain calls fn for each chained entry of an account that is not
+// archived, up to the head
+func (s *AuditService) walkChain(accountID int, head *models.AuditChainHead, fn func(*models.AuditLog) error) error {
+	headSequence := head.Sequence
+	after := head.ArchivedSequence
+	for after < headSequence {
+		entries, err := s.repo.FindChainBatch(accountID, after, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			// Entries appended after the head was read belong to the next run
+			if entries[i].Sequence > headSequence {
+				return nil
+			}
+			if err := fn(&entries[i]); err != nil {
+				return err
+			}
+		}
+		if len(entries) < exportBatchSize {
+			return nil
+		}
+		after = entries[len(entries)-1].Sequence
+	}
+	return nil
+}
+
+// chainVerifier checks entries handed to it in chain order
+type chainVerifier struct {
+	start     int64
+	startHash string
+	entries   int64
+	next      int64
+	prev      string
+	breaks    []AuditChainBreak
+}
+
+// newChainVerifier starts after the archived part of the chain, or at the genesis
+func newChainVerifier(head *models.AuditChainHead) *chainVerifier {
+	v := &chainVerifier{startHash: repositories.AuditChainGenesis, breaks: []AuditChainBreak{}}
+	if head != nil && head.ArchivedSequence > 0 {
+		v.start = head.ArchivedSequence
+		v.startHash = head.ArchivedHash
+	}
+	v.next = v.start + 1
+	v.prev = v.startHash
+	return v
+}
+
+func (v *chainVerifier) check(entry *models.AuditLog) {
+	v.entries++
+	id := entry.ID
+
+	if entry.Sequence != v.next {
+		v.fail(entry.Sequence, nil, fmt.Sprintf("entries %d to %d are missing", v.next, entry.Sequence-1))
+	}
+	if entry.PrevHash != v.prev {
+		v.fail(entry.Sequence, &id, "previous hash does not match the preceding entry")
+	}
+	if repositories.AuditEntryHash(entry) != entry.Hash {
+		v.fail(entry.Sequence, &id, "entry content does not match its hash")
+	}
+
+	v.next = entry.Sequence + 1
+	v.prev = entry.Hash
+}
+
+// finish compares the last entry with the head, which detects removed tail entries
+func (v *chainVerifier) finish(head *models.AuditChainHead) {
+	if v.next-1 != head.Sequence {
+		v.fail(head.Sequence, nil, fmt.Sprintf("chain ends at entry %d but its head is entry %d", v.next-1, head.Sequence))
+	} else if v.prev != head.Hash {
+		v.fail(head.Sequence, nil, "last entry does not match the chain head")
+	}
+}
+
+func (v *chainVerifier) fail(sequence int64, entryID *uuid.UUID, reason string) {
+	if len(v.breaks) < maxChainBreaks {
+		v.breaks = append(v.breaks, AuditChainBreak{Sequence: sequence, EntryID: entryID, Reason: reason})
+	}
+}
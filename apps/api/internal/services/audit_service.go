@@ -2,10 +2,18 @@
 package services
 
 import (
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
 )
@@ -13,13 +21,15 @@ import (
 // AuditService handles audit logging operations
 type AuditService struct {
 	repo   *repositories.AuditRepository
+	signer *AuditSigner
 	logger *log.Logger
 }
 
-// NewAuditService creates a new AuditService
-func NewAuditService(repo *repositories.AuditRepository) *AuditService {
+// NewAuditService creates a new AuditService. signer may be nil to disable signed chain exports.
+func NewAuditService(repo *repositories.AuditRepository, signer *AuditSigner) *AuditService {
 	return &AuditService{
 		repo:   repo,
+		signer: signer,
 		logger: log.Default(),
 	}
 }
@@ -28,13 +38,16 @@ func NewAuditService(repo *repositories.AuditRepository) *AuditService {
 type AuditAction string
 
 const (
-	AuditActionCreate AuditAction = "create"
-	AuditActionUpdate AuditAction = "update"
-	AuditActionDelete AuditAction = "delete"
-	AuditActionLogin  AuditAction = "login"
-	AuditActionLogout AuditAction = "logout"
-	AuditActionExport AuditAction = "export"
-	AuditActionImport AuditAction = "import"
+	AuditActionCreate   AuditAction = "create"
+	AuditActionUpdate   AuditAction = "update"
+	AuditActionDelete   AuditAction = "delete"
+	AuditActionLogin    AuditAction = "login"
+	AuditActionLogout   AuditAction = "logout"
+	AuditActionExport   AuditAction = "export"
+	AuditActionImport   AuditAction = "import"
+	AuditActionOverride AuditAction = "override"
+	AuditActionRotate   AuditAction = "rotate"
+	AuditActionUse      AuditAction = "use"
 )
 
 // Log creates an audit log entry asynchronously
@@ -134,6 +147,158 @@ func (s *AuditService) GetWithFilters(filters repositories.AuditQueryFilters) ([
 	return s.repo.FindWithFilters(filters)
 }
 
+// ============================================================================
+// Timeline
+// ============================================================================
+
+const (
+	// defaultTimelineLimit is the page size when none is requested
+	defaultTimelineLimit = 50
+	// maxTimelineLimit caps the page size of the timeline
+	maxTimelineLimit = 200
+	// exportBatchSize is how many entries an export reads per query
+	exportBatchSize = 500
+)
+
+// Audit export formats
+const (
+	AuditExportCSV    = "csv"
+	AuditExportNDJSON = "ndjson"
+)
+
+// ErrInvalidCursor is returned for a malformed timeline cursor
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Timeline returns a page of the account audit timeline (audit logs and internal
+// chat audit merged, newest first) and the cursor of the next page, empty on the last one
+func (s *AuditService) Timeline(query repositories.AuditTimelineQuery, cursor string) ([]repositories.AuditTimelineEntry, string, error) {
+	if cursor != "" {
+		after, err := decodeAuditCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query.After = after
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultTimelineLimit
+	}
+	if query.Limit > maxTimelineLimit {
+		query.Limit = maxTimelineLimit
+	}
+
+	// Fetch one extra entry to know whether another page follows
+	limit := query.Limit
+	query.Limit++
+	entries, err := s.repo.FindTimeline(query)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) <= limit {
+		return entries, "", nil
+	}
+
+	entries = entries[:limit]
+	return entries, encodeAuditCursor(entries[limit-1]), nil
+}
+
+// ExportTimeline writes every timeline entry matching the query to w, reading in batches
+func (s *AuditService) ExportTimeline(query repositories.AuditTimelineQuery, format string, w io.Writer) error {
+	var csvWriter *csv.Writer
+	if format == AuditExportCSV {
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"id", "source", "created_at", "user_id", "action", "resource_type", "resource_id", "ip_address", "user_agent", "old_values", "new_values"})
+	}
+	encoder := json.NewEncoder(w)
+
+	query.After = nil
+	query.Limit = exportBatchSize
+	for {
+		entries, err := s.repo.FindTimeline(query)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if csvWriter != nil {
+				if err := csvWriter.Write(auditCSVRecord(entry)); err != nil {
+					return err
+				}
+			} else if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+
+		if len(entries) < exportBatchSize {
+			return nil
+		}
+		last := entries[len(entries)-1]
+		query.After = &repositories.AuditCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+func auditCSVRecord(entry repositories.AuditTimelineEntry) []string {
+	userID := ""
+	if entry.UserID != nil {
+		userID = strconv.Itoa(*entry.UserID)
+	}
+	return []string{
+		entry.ID.String(),
+		entry.Source,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		userID,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.IPAddress,
+		entry.UserAgent,
+		auditJSONField(entry.OldValues),
+		auditJSONField(entry.NewValues),
+	}
+}
+
+func auditJSONField(values models.JSON) string {
+	if len(values) == 0 {
+		return ""
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// encodeAuditCursor encodes the position of an entry as an opaque token
+func encodeAuditCursor(entry repositories.AuditTimelineEntry) string {
+	raw := entry.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + entry.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(cursor string) (*repositories.AuditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	entryID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &repositories.AuditCursor{CreatedAt: at, ID: entryID}, nil
+}
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+func TestAuditCursorRoundTrip(t *testing.T) {
+	entry := repositories.AuditTimelineEntry{
+		ID:        uuid.New(),
+		CreatedAt: time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.UTC),
+	}
+
+	cursor, err := decodeAuditCursor(encodeAuditCursor(entry))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cursor.ID != entry.ID || !cursor.CreatedAt.Equal(entry.CreatedAt) {
+		t.Fatalf("cursor %+v does not point at the entry", cursor)
+	}
+
+	if _, err := decodeAuditCursor("not-a-cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("malformed cursor should fail with ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestAuditCSVRecord(t *testing.T) {
+	userID := 7
+	record := auditCSVRecord(repositories.AuditTimelineEntry{
+		ID:           uuid.New(),
+		Source:       "chat",
+		UserID:       &userID,
+		Action:       "message_deleted",
+		ResourceType: "chat_message",
+		NewValues:    models.JSON{"room_id": "abc"},
+		CreatedAt:    time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	if len(record) != 11 {
+		t.Fatalf("record has %d columns, want 11", len(record))
+	}
+	if record[3] != "7" || record[2] != "2026-03-01T12:00:00Z" {
+		t.Fatalf("unexpected user or date columns: %v", record)
+	}
+	if record[9] != "" || record[10] != `{"room_id":"abc"}` {
+		t.Fatalf("unexpected value columns: %q %q", record[9], record[10])
+	}
+}
+
+// buildChain links entries the way the repository appends them
+func buildChain(n int) []*models.AuditLog {
+	prev := repositories.AuditChainGenesis
+	entries := make([]*models.AuditLog, n)
+	for i := range entries {
+		entry := &models.AuditLog{
+			ID:        uuid.New(),
+			AccountID: 1,
+			Action:    "update",
+			NewValues: models.JSON{"name": "board", "position": i},
+			CreatedAt: time.Date(2026, 3, 1, 12, i, 0, 0, time.UTC),
+			Sequence:  int64(i + 1),
+			PrevHash:  prev,
+		}
+		entry.Hash = repositories.AuditEntryHash(entry)
+		prev = entry.Hash
+		entries[i] = entry
+	}
+	return entries
+}
+
+func verifyChain(entries []*models.AuditLog, head *models.AuditChainHead) []AuditChainBreak {
+	verifier := newChainVerifier(head)
+	for _, entry := range entries {
+		verifier.check(entry)
+	}
+	verifier.finish(head)
+	return verifier.breaks
+}
+
+func TestAuditChainVerification(t *testing.T) {
+	entries := buildChain(4)
+	head := &models.AuditChainHead{AccountID: 1, Sequence: 4, Hash: entries[3].Hash}
+
+	if breaks := verifyChain(entries, head); len(breaks) != 0 {
+		t.Fatalf("intact chain reported breaks: %+v", breaks)
+	}
+
+	// Editing an entry breaks its hash
+	edited := buildChain(4)
+	edited[1].NewValues["name"] = "renamed"
+	head.Hash = edited[3].Hash
+	if breaks := verifyChain(edited, head); len(breaks) != 1 || breaks[0].Sequence != 2 {
+		t.Fatalf("edited entry not detected: %+v", breaks)
+	}
+
+	// Removing an entry leaves a gap
+	if breaks := verifyChain([]*models.AuditLog{entries[0], entries[2], entries[3]}, &models.AuditChainHead{Sequence: 4, Hash: entries[3].Hash}); len(breaks) == 0 {
+		t.Fatalf("removed entry not detected")
+	}
+
+	// Removing the last entry leaves the chain short of its head
+	if breaks := verifyChain(entries[:3], &models.AuditChainHead{Sequence: 4, Hash: entries[3].Hash}); len(breaks) != 1 {
+		t.Fatalf("truncated chain not detected: %+v", breaks)
+	}
+
+	// Archived entries are skipped; the rest links to the archived hash
+	archived := &models.AuditChainHead{Sequence: 4, Hash: entries[3].Hash, ArchivedSequence: 2, ArchivedHash: entries[1].Hash}
+	if breaks := verifyChain(entries[2:], archived); len(breaks) != 0 {
+		t.Fatalf("chain after archived entries reported breaks: %+v", breaks)
+	}
+}
+
+func TestAuditSignerSignature(t *testing.T) {
+	signer, err := NewAuditSigner(base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	manifest := []byte(`{"type":"manifest","head_sequence":4}`)
+	publicKey, _ := base64.StdEncoding.DecodeString(signer.PublicKey())
+	signature, _ := base64.StdEncoding.DecodeString(signer.Sign(manifest))
+	if !ed25519.Verify(publicKey, manifest, signature) {
+		t.Fatalf("signature does not verify with the published public key")
+	}
+
+	if _, err := NewAuditSigner("too-short"); err == nil {
+		t.Fatalf("invalid seed should be rejected")
+	}
+}
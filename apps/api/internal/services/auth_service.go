@@ -1,12 +1,29 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sessionTTL is how long a session stays valid without being refreshed
+const sessionTTL = 7 * 24 * time.Hour
+
+// sessionTouchInterval throttles the last_seen_at writes of active sessions
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionRevoked     = errors.New("session revoked")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
 )
 
 type AuthService struct {
@@ -21,63 +38,130 @@ func NewAuthService(sessionRepo repositories.SessionRepository, userRepo reposit
 	}
 }
 
-// CreateSession creates a new session for a user
-func (s *AuthService) CreateSession(userID, accountID int, ip, userAgent string) (*models.Session, string, error) {
-	// 1. Generate Refresh Token (Opaque or JWT, here using UUID for simplicity/opacity)
-	refreshToken := uuid.New().String()
-
-	// 2. Create Session Record
+// CreateSession creates a new session for a user. The refresh token issued
+// for it is stored hashed.
+func (s *AuthService) CreateSession(sessionID uuid.UUID, userID, accountID int, refreshToken, ip, userAgent string) (*models.Session, error) {
+	now := time.Now()
 	session := &models.Session{
-		UserID:       uint(userID),
-		AccountID:    accountID,
-		RefreshToken: refreshToken, 
-		IPAddress:    ip,
-		UserAgent:    userAgent,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour), // 7 days expiration
-		LastSeenAt:   nil, // Handled by pointer logic if needed, or set to Now
+		ID:               sessionID,
+		UserID:           uint(userID),
+		AccountID:        accountID,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		IPAddress:        ip,
+		UserAgent:        userAgent,
+		ExpiresAt:        now.Add(sessionTTL),
+		LastSeenAt:       &now,
 	}
-	now := time.Now()
-	session.LastSeenAt = &now
 
 	if err := s.SessionRepo.Create(session); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	return session, refreshToken, nil
+	return session, nil
 }
 
-// VerifySession checks if a session is valid and active
-func (s *AuthService) VerifySession(sessionID uuid.UUID, refreshToken string) (*models.Session, error) {
-	session, err := s.SessionRepo.FindByID(sessionID)
+// RotateRefreshToken replaces the current refresh token of a session with next.
+// Presenting any other token means an old one was replayed: the whole session
+// (every token descending from its login) is revoked.
+func (s *AuthService) RotateRefreshToken(sessionID uuid.UUID, presented, next string) (*models.Session, error) {
+	session, err := s.activeSession(sessionID)
 	if err != nil {
-		return nil, errors.New("intervals: session not found")
+		return nil, err
 	}
 
-	if session.RevokedAt != nil {
-		return nil, errors.New("intervals: session revoked")
+	rotated, err := s.SessionRepo.RotateRefreshToken(sessionID, hashRefreshToken(presented), hashRefreshToken(next), time.Now().Add(sessionTTL))
+	if err != nil {
+		return nil, err
 	}
-
-	if time.Now().After(session.ExpiresAt) {
-		return nil, errors.New("intervals: session expired")
+	if !rotated {
+		if err := s.SessionRepo.Revoke(sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
 	}
 
-	// In production, compare Hash(refreshToken)
-	if session.RefreshToken != refreshToken {
-		return nil, errors.New("intervals: invalid token")
+	return session, nil
+}
+
+// VerifySession checks if a session is valid and active
+func (s *AuthService) VerifySession(sessionID uuid.UUID) (*models.Session, error) {
+	session, err := s.activeSession(sessionID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update LastSeen
-	s.SessionRepo.UpdateLastSeen(sessionID)
+	if err := s.SessionRepo.TouchLastSeen(sessionID, time.Now(), sessionTouchInterval); err != nil {
+		return nil, err
+	}
 
 	return session, nil
 }
 
-// RevokeSession revokes a single session
-func (s *AuthService) RevokeSession(sessionID uuid.UUID) error {
+// ListSessions returns the active sessions of a user
+func (s *AuthService) ListSessions(userID int) ([]models.Session, error) {
+	return s.SessionRepo.ListActiveForUser(userID)
+}
+
+// RevokeSession revokes a single session of a user
+func (s *AuthService) RevokeSession(userID int, sessionID uuid.UUID) error {
+	session, err := s.findSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != uint(userID) {
+		return ErrSessionNotFound
+	}
 	return s.SessionRepo.Revoke(sessionID)
 }
 
+// RevokeOtherSessions revokes every session of a user except the current one
+func (s *AuthService) RevokeOtherSessions(userID int, current uuid.UUID) error {
+	return s.SessionRepo.RevokeOthersForUser(userID, current)
+}
+
 // RevokeAllSessions revokes all sessions for a user
 func (s *AuthService) RevokeAllUserSessions(userID int) error {
 	return s.SessionRepo.RevokeAllForUser(userID)
 }
+
+// ForceLogout revokes all sessions of a user of the account
+func (s *AuthService) ForceLogout(ctx context.Context, accountID, userID int) error {
+	if _, err := s.UserRepo.FindByIDForAccount(ctx, uint(userID), accountID); err != nil {
+		return err
+	}
+	return s.SessionRepo.RevokeAllForUser(userID)
+}
+
+func (s *AuthService) findSession(sessionID uuid.UUID) (*models.Session, error) {
+	session, err := s.SessionRepo.FindByID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *AuthService) activeSession(sessionID uuid.UUID) (*models.Session, error) {
+	session, err := s.findSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+)
+
+// memorySessions is an in-memory SessionRepository
+type memorySessions map[uuid.UUID]*models.Session
+
+func (m memorySessions) Create(session *models.Session) error {
+	m[session.ID] = session
+	return nil
+}
+
+func (m memorySessions) FindByID(id uuid.UUID) (*models.Session, error) {
+	session, ok := m[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (m memorySessions) ListActiveForUser(userID int) ([]models.Session, error) { return nil, nil }
+
+func (m memorySessions) Revoke(id uuid.UUID) error {
+	now := time.Now()
+	m[id].RevokedAt = &now
+	return nil
+}
+
+func (m memorySessions) RevokeAllForUser(userID int) error { return nil }
+
+func (m memorySessions) RevokeOthersForUser(userID int, keep uuid.UUID) error { return nil }
+
+func (m memorySessions) RotateRefreshToken(id uuid.UUID, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	session := m[id]
+	if session.RevokedAt != nil || session.RefreshTokenHash != oldHash {
+		return false, nil
+	}
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+func (m memorySessions) TouchLastSeen(id uuid.UUID, now time.Time, interval time.Duration) error {
+	return nil
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	sessions := memorySessions{}
+	auth := NewAuthService(sessions, nil)
+
+	sessionID := uuid.New()
+	if _, err := auth.CreateSession(sessionID, 1, 1, "refresh-1", "127.0.0.1", "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sessions[sessionID].RefreshTokenHash == "refresh-1" {
+		t.Fatalf("refresh token stored in plain text")
+	}
+
+	if _, err := auth.RotateRefreshToken(sessionID, "refresh-1", "refresh-2"); err != nil {
+		t.Fatalf("first rotation failed: %v", err)
+	}
+
+	// Replaying the rotated token revokes the session, including the newest token
+	if _, err := auth.RotateRefreshToken(sessionID, "refresh-1", "refresh-3"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse should fail with ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := auth.RotateRefreshToken(sessionID, "refresh-2", "refresh-4"); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("session should be revoked after reuse, got %v", err)
+	}
+	if _, err := auth.VerifySession(sessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("revoked session should not verify, got %v", err)
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/chatwoot"
+)
+
+// EventStageTransition is the event type recorded when a card changes stage
+const EventStageTransition = "kanban.stage_transition"
+
+var (
+	// ErrInvalidAutoAction is returned when a stage automation rule is malformed
+	ErrInvalidAutoAction = errors.New("invalid auto action")
+
+	errNoConversation = errors.New("card is not linked to a Chatwoot conversation")
+
+	errBlockedWebhookAddress = errors.New("webhook address is not public")
+)
+
+// blockedWebhookNetworks are the special-purpose ranges outbound webhooks may
+// not reach, on top of loopback, private and link-local addresses
+var blockedWebhookNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "This" network
+	mustParseCIDR("100.64.0.0/10"), // Carrier-grade NAT, used by some cloud metadata services
+	mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"), // Benchmarking
+	mustParseCIDR("240.0.0.0/4"),   // Reserved
+}
+
+// StageTransition is the payload of a kanban.stage_transition event.
+// FromStageID is nil when the card was just created.
+type StageTransition struct {
+	CardID      uuid.UUID  `json:"card_id"`
+	FromStageID *uuid.UUID `json:"from_stage_id,omitempty"`
+	ToStageID   uuid.UUID  `json:"to_stage_id"`
+	UserID      *int       `json:"user_id,omitempty"`
+}
+
+// AutomationService runs the AutoActions of stages when cards move between them
+type AutomationService struct {
+	kanbanRepo *repositories.KanbanRepository
+	gateway    *GatewayService
+	chat       *ChatService
+	chatwoot   *chatwoot.Client
+	httpClient *http.Client
+}
+
+// NewAutomationService creates a new AutomationService
+func NewAutomationService(kanbanRepo *repositories.KanbanRepository, gateway *GatewayService, chat *ChatService, chatwootClient *chatwoot.Client) *AutomationService {
+	return &AutomationService{
+		kanbanRepo: kanbanRepo,
+		gateway:    gateway,
+		chat:       chat,
+		chatwoot:   chatwootClient,
+		httpClient: newWebhookClient(),
+	}
+}
+
+// newWebhookClient returns the client of outbound webhooks. It only connects
+// to public addresses, checked on the resolved IP so DNS rebinding cannot
+// reach internal services, and does not follow redirects.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedWebhookIP(ip) {
+				return fmt.Errorf("%w: %s", errBlockedWebhookAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// No proxy: the dialer must see the webhook host itself
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// RunTransition executes the on_leave actions of the previous stage and the
+// on_enter actions of the new one. Every action is recorded in the card history.
+// Action failures are recorded but not retried, since actions are not idempotent.
+func (s *AutomationService) RunTransition(ctx context.Context, accountID int, t *StageTransition) error {
+	card, err := s.kanbanRepo.GetCardForAccount(ctx, t.CardID, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCardNotFound) {
+			return nil // Card deleted before the worker got to it
+		}
+		return err
+	}
+
+	if t.FromStageID != nil {
+		if err := s.runStage(ctx, accountID, card, *t.FromStageID, models.StageTriggerLeave, t); err != nil {
+			return err
+		}
+	}
+	return s.runStage(ctx, accountID, card, t.ToStageID, models.StageTriggerEnter, t)
+}
+
+// runStage executes the actions of one stage matching the trigger
+func (s *AutomationService) runStage(ctx context.Context, accountID int, card *models.Card, stageID uuid.UUID, trigger string, t *StageTransition) error {
+	stage, err := s.kanbanRepo.GetStageForAccount(ctx, stageID, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrStageNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	for _, action := range stage.AutoActions {
+		if action.Trigger != trigger {
+			continue
+		}
+
+		metadata := models.JSON{
+			"stage_id": stage.ID,
+			"trigger":  trigger,
+			"type":     action.Type,
+			"status":   "success",
+		}
+		if actionErr := s.runAction(ctx, accountID, card, stage, action, t); actionErr != nil {
+			log.Printf("Auto action %s of stage %s failed for card %s: %v", action.Type, stage.ID, card.ID, actionErr)
+			metadata["status"] = "failed"
+			metadata["error"] = actionErr.Error()
+		}
+
+		history := &models.CardHistory{
+			CardID:    card.ID,
+			Action:    "automation",
+			Metadata:  metadata,
+			CreatedAt: time.Now(),
+		}
+		if err := s.kanbanRepo.LogCardHistory(ctx, history); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAction executes a single action
+func (s *AutomationService) runAction(ctx context.Context, accountID int, card *models.Card, stage *models.Stage, action models.StageAction, t *StageTransition) error {
+	switch action.Type {
+	case models.StageActionAssignAgent:
+		if card.ChatwootConversationID == 0 {
+			return errNoConversation
+		}
+		if err := s.chatwoot.AssignConversation(ctx, accountID, card.ChatwootConversationID, action.AgentID); err != nil {
+			return err
+		}
+		return s.kanbanRepo.UpdateCardFields(ctx, card.ID, map[string]interface{}{"assignee_id": action.AgentID})
+
+	case models.StageActionAssignTeam:
+		if card.ChatwootConversationID == 0 {
+			return errNoConversation
+		}
+		return s.chatwoot.AssignConversationTeam(ctx, accountID, card.ChatwootConversationID, action.TeamID)
+
+	case models.StageActionAddLabels, models.StageActionRemoveLabels:
+		return s.updateLabels(ctx, accountID, card, action)
+
+	case models.StageActionSendWhatsApp:
+		if card.ChatwootConversationID == 0 {
+			return errNoConversation
+		}
+		return s.gateway.SendConversationText(ctx, accountID, card.ChatwootConversationID, renderActionMessage(action.Message, card, stage))
+
+	case models.StageActionCreateChecklist:
+		for i, text := range action.Items {
+			cardID := card.ID
+			item := &models.ChecklistItem{
+				CardID:   &cardID,
+				Text:     text,
+				Position: i,
+			}
+			if err := s.kanbanRepo.AddChecklistItem(ctx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case models.StageActionPostChat:
+		senderID := 0
+		if t.UserID != nil {
+			senderID = *t.UserID
+		}
+		_, err := s.chat.PostSystemMessage(ctx, accountID, *action.RoomID, senderID, renderActionMessage(action.Message, card, stage))
+		return err
+
+	case models.StageActionWebhook:
+		return s.postWebhook(ctx, accountID, card, action, t)
+	}
+
+	return fmt.Errorf("%w: unknown type %q", ErrInvalidAutoAction, action.Type)
+}
+
+// updateLabels adds or removes labels on the Chatwoot conversation and mirrors them on the card
+func (s *AutomationService) updateLabels(ctx context.Context, accountID int, card *models.Card, action models.StageAction) error {
+	if card.ChatwootConversationID == 0 {
+		return errNoConversation
+	}
+
+	current, err := s.chatwoot.ListConversationLabels(ctx, accountID, card.ChatwootConversationID)
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]bool, len(action.Labels))
+	for _, label := range action.Labels {
+		changed[label] = true
+	}
+
+	var labels []string
+	for _, label := range current {
+		if action.Type == models.StageActionRemoveLabels && changed[label] {
+			continue
+		}
+		labels = append(labels, label)
+		delete(changed, label)
+	}
+	if action.Type == models.StageActionAddLabels {
+		for _, label := range action.Labels {
+			if changed[label] {
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	labels, err = s.chatwoot.SetConversationLabels(ctx, accountID, card.ChatwootConversationID, labels)
+	if err != nil {
+		return err
+	}
+	return s.kanbanRepo.UpdateCardFields(ctx, card.ID, map[string]interface{}{"labels": models.StringArray(labels)})
+}
+
+// postWebhook calls an outbound webhook with the card and the transition
+func (s *AutomationService) postWebhook(ctx context.Context, accountID int, card *models.Card, action models.StageAction, t *StageTransition) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":         EventStageTransition,
+		"account_id":    accountID,
+		"from_stage_id": t.FromStageID,
+		"to_stage_id":   t.ToStageID,
+		"card":          card,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, action.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// renderActionMessage fills the {{placeholders}} of an action message
+func renderActionMessage(message string, card *models.Card, stage *models.Stage) string {
+	return strings.NewReplacer(
+		"{{contact_name}}", card.ContactName,
+		"{{card_title}}", card.Title,
+		"{{stage_name}}", stage.Name,
+		"{{conversation_id}}", fmt.Sprint(card.ChatwootConversationID),
+	).Replace(message)
+}
+
+// ValidateStageActions checks that every action has a known trigger and type
+// and carries the parameters its type needs
+func ValidateStageActions(actions models.StageActions) error {
+	for i, action := range actions {
+		if err := validateStageAction(action); err != nil {
+			return fmt.Errorf("%w: auto_actions[%d]: %s", ErrInvalidAutoAction, i, err)
+		}
+	}
+	return nil
+}
+
+func validateStageAction(action models.StageAction) error {
+	if action.Trigger != models.StageTriggerEnter && action.Trigger != models.StageTriggerLeave {
+		return fmt.Errorf("trigger must be %s or %s", models.StageTriggerEnter, models.StageTriggerLeave)
+	}
+
+	switch action.Type {
+	case models.StageActionAssignAgent:
+		if action.AgentID <= 0 {
+			return errors.New("agent_id is required")
+		}
+	case models.StageActionAssignTeam:
+		if action.TeamID <= 0 {
+			return errors.New("team_id is required")
+		}
+	case models.StageActionAddLabels, models.StageActionRemoveLabels:
+		if len(action.Labels) == 0 {
+			return errors.New("labels are required")
+		}
+	case models.StageActionSendWhatsApp:
+		if strings.TrimSpace(action.Message) == "" {
+			return errors.New("message is required")
+		}
+	case models.StageActionCreateChecklist:
+		if len(action.Items) == 0 {
+			return errors.New("items are required")
+		}
+	case models.StageActionPostChat:
+		if action.RoomID == nil {
+			return errors.New("room_id is required")
+		}
+		if strings.TrimSpace(action.Message) == "" {
+			return errors.New("message is required")
+		}
+	case models.StageActionWebhook:
+		u, err := url.Parse(action.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return errors.New("url must be an absolute http(s) URL")
+		}
+		if !publicWebhookHost(u.Hostname()) {
+			return errors.New("url must point to a public host")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", action.Type)
+	}
+	return nil
+}
+
+// publicWebhookHost rejects IP literals outside the public internet and the
+// host names of local or internal services (localhost, single-label names
+// such as the compose services, .local and .internal). Names that resolve to
+// internal addresses are refused when the webhook is dialed.
+func publicWebhookHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return !blockedWebhookIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.Contains(host, ".") {
+		return false
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// blockedWebhookIP tells whether an address is loopback, private, link-local
+// (including the 169.254.169.254 metadata service) or otherwise not public
+func blockedWebhookIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+)
+
+func TestValidateStageActions(t *testing.T) {
+	roomID := uuid.New()
+	valid := models.StageActions{
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionAssignAgent, AgentID: 7},
+		{Trigger: models.StageTriggerLeave, Type: models.StageActionAddLabels, Labels: []string{"vip"}},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionPostChat, RoomID: &roomID, Message: "Novo card: {{card_title}}"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "https://example.com/hook"},
+	}
+	if err := ValidateStageActions(valid); err != nil {
+		t.Fatalf("valid actions rejected: %v", err)
+	}
+
+	invalid := []models.StageAction{
+		{Trigger: "on_move", Type: models.StageActionAssignAgent, AgentID: 7},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionAssignTeam},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionSendWhatsApp, Message: "  "},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionPostChat, Message: "oi"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "ftp://example.com"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://127.0.0.1:8080/hook"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://169.254.169.254/latest/meta-data"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://10.0.0.5/hook"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://[::1]/hook"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://localhost:6379"},
+		{Trigger: models.StageTriggerEnter, Type: models.StageActionWebhook, URL: "http://redis:6379"},
+		{Trigger: models.StageTriggerEnter, Type: "delete_card"},
+	}
+	for _, action := range invalid {
+		err := ValidateStageActions(models.StageActions{action})
+		if !errors.Is(err, ErrInvalidAutoAction) {
+			t.Fatalf("action %+v: expected ErrInvalidAutoAction, got %v", action, err)
+		}
+	}
+}
+
+func TestRenderActionMessage(t *testing.T) {
+	card := &models.Card{Title: "Pedido 42", ContactName: "Ana", ChatwootConversationID: 9}
+	stage := &models.Stage{Name: "Proposta"}
+
+	got := renderActionMessage("Olá {{contact_name}}, {{card_title}} está em {{stage_name}} (#{{conversation_id}})", card, stage)
+	want := "Olá Ana, Pedido 42 está em Proposta (#9)"
+	if got != want {
+		t.Fatalf("renderActionMessage = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newWebhookClient().Get(server.URL)
+	if !errors.Is(err, errBlockedWebhookAddress) {
+		t.Fatalf("expected the loopback test server to be refused, got %v", err)
+	}
+}
@@ -4,110 +4,251 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"whatpro-hub/internal/config"
 	"whatpro-hub/internal/models"
 	"whatpro-hub/internal/repositories"
 )
 
+var (
+	ErrInvalidPaymentMethod = errors.New("payment method not supported by the payment provider")
+	ErrInvalidWebhook       = errors.New("invalid webhook credentials")
+	ErrSubscriptionExists   = errors.New("account already has a subscription")
+	ErrProviderUnavailable  = errors.New("payment provider not available")
+	ErrPlanInactive         = errors.New("plan is not available")
+	ErrSamePlan             = errors.New("subscription is already on this plan")
+)
+
+// billingProviderSetting is the Account.Settings key of the provider chosen by an account
+const billingProviderSetting = "billing_provider"
+
+// suspensionCacheTTL bounds how long the suspension of an account is cached for write checks
+const suspensionCacheTTL = time.Minute
+
+// PaymentCustomer is who pays for an account
+type PaymentCustomer struct {
+	AccountID int
+	Name      string
+	Email     string
+	Document  string // CPF or CNPJ
+}
+
+// SubscriptionRequest describes a subscription to create in a payment gateway
+type SubscriptionRequest struct {
+	CustomerID    string
+	AccountID     int
+	Plan          *models.Plan
+	PaymentMethod string // pix, boleto or credit_card
+	FirstDueDate  time.Time
+}
+
+// ProviderSubscription is a subscription created in a payment gateway
+type ProviderSubscription struct {
+	ID          string
+	CheckoutURL string // Where the payer completes the first payment, when the gateway has one
+}
+
+// PaymentEvent is a payment webhook parsed by a provider
+type PaymentEvent struct {
+	Event          string // Provider event name, e.g. PAYMENT_RECEIVED
+	SubscriptionID string // Subscription ID in the provider; empty for one-off charges
+	Transaction    *models.Transaction
+}
+
 // PaymentProvider interface defines methods for payment gateways
 type PaymentProvider interface {
-	CreateCustomer(ctx context.Context, user *models.User) (string, error)
-	CreateSubscription(ctx context.Context, customerID string, planID string) (string, error)
+	Name() string
+	CreateCustomer(ctx context.Context, customer PaymentCustomer) (string, error)
+	CreateSubscription(ctx context.Context, req SubscriptionRequest) (*ProviderSubscription, error)
 	CancelSubscription(ctx context.Context, subID string) error
-	ParseWebhook(payload []byte) (*models.Transaction, error)
+	// ChangeSubscriptionPlan charges the price of another plan from the next charge on
+	ChangeSubscriptionPlan(ctx context.Context, subID string, plan *models.Plan) error
+	ListPayments(ctx context.Context, subID string) ([]models.Transaction, error)
+	// VerifyWebhook authenticates a webhook before it is stored
+	VerifyWebhook(header http.Header, payload []byte) error
+	// ParseWebhook returns nil for events that do not concern payments
+	ParseWebhook(ctx context.Context, payload []byte) (*PaymentEvent, error)
 }
 
-// AsaasProvider is the implementation for Asaas
-type AsaasProvider struct {
-	APIKey string
-	URL    string
+// NewPaymentProviders returns the payment gateways that have credentials configured
+func NewPaymentProviders(cfg *config.Config) []PaymentProvider {
+	var providers []PaymentProvider
+	if cfg.AsaasAPIKey != "" {
+		providers = append(providers, NewAsaasProvider(cfg.AsaasAPIKey, cfg.AsaasURL, cfg.AsaasWebhookToken))
+	}
+	if cfg.MercadoPagoAccessToken != "" {
+		providers = append(providers, NewMercadoPagoProvider(cfg.MercadoPagoAccessToken, cfg.MercadoPagoWebhookSecret, cfg.BillingReturnURL))
+	}
+	if cfg.StripeSecretKey != "" {
+		providers = append(providers, NewStripeProvider(cfg.StripeSecretKey, cfg.StripeWebhookSecret))
+	}
+	return providers
 }
 
-func NewAsaasProvider(apiKey string) *AsaasProvider {
-	return &AsaasProvider{APIKey: apiKey, URL: "https://api.asaas.com/v3"}
+// SubscribeRequest is an account's request to subscribe to a plan
+type SubscribeRequest struct {
+	PlanID        uuid.UUID `json:"plan_id"`
+	PaymentMethod string    `json:"payment_method"` // pix, boleto or credit_card
+	Document      string    `json:"document"`       // CPF or CNPJ of the payer
+	Phone         string    `json:"phone"`          // WhatsApp number reminded of unpaid charges
 }
 
-// CreateCustomer creates a customer in Asaas
-func (p *AsaasProvider) CreateCustomer(ctx context.Context, user *models.User) (string, error) {
-	// TODO: Call Asaas API
-	return "cus_" + uuid.NewString(), nil // Stub
+// PlanRequest is a plan created or updated by a super admin
+type PlanRequest struct {
+	Name          string      `json:"name" validate:"required,max=100"`
+	Description   string      `json:"description"`
+	Price         float64     `json:"price" validate:"gte=0"`
+	Currency      string      `json:"currency" validate:"omitempty,len=3"`
+	Features      models.JSON `json:"features"` // Entitlements granted by the plan, e.g. max_agents, kanban_enabled
+	IsActive      *bool       `json:"is_active"`
+	AsaasID       string      `json:"asaas_id"`
+	MercadoPagoID string      `json:"mercadopago_id"`
+	StripePriceID string      `json:"stripe_price_id"`
+	Provider      string      `json:"provider"`
 }
 
-// CreateSubscription creates a subscription in Asaas
-func (p *AsaasProvider) CreateSubscription(ctx context.Context, customerID string, planID string) (string, error) {
-	// TODO: Call Asaas API
-	return "sub_" + uuid.NewString(), nil // Stub
+// BillingProviderSelection is the payment provider chosen by an account and the available ones
+type BillingProviderSelection struct {
+	Provider  string   `json:"provider"` // Empty to use the plan's provider or the default one
+	Default   string   `json:"default"`
+	Available []string `json:"available"`
 }
 
-// CancelSubscription cancels a subscription
-func (p *AsaasProvider) CancelSubscription(ctx context.Context, subID string) error {
-	return nil // Stub
+// BillingService handles subscription logic
+type BillingService struct {
+	repo            *repositories.BillingRepository
+	users           repositories.UserRepository
+	accounts        *repositories.AccountRepository
+	entitlements    *EntitlementsService
+	redis           *redis.Client
+	providers       map[string]PaymentProvider
+	defaultProvider string
 }
 
-// ParseWebhook parses incoming Asaas webhooks
-func (p *AsaasProvider) ParseWebhook(payload []byte) (*models.Transaction, error) {
-	// TODO: Parse standard Asaas JSON
-	return &models.Transaction{
-		Status: "paid",
-		Amount: 99.90,
-		ProviderID: "pay_" + uuid.NewString(),
-	}, nil
+// NewBillingService creates a new BillingService. Accounts and plans may pick
+// any of the given providers; the others use defaultProvider.
+func NewBillingService(repo *repositories.BillingRepository, users repositories.UserRepository, accounts *repositories.AccountRepository, entitlements *EntitlementsService, rdb *redis.Client, defaultProvider string, providers ...PaymentProvider) *BillingService {
+	s := &BillingService{
+		repo:            repo,
+		users:           users,
+		accounts:        accounts,
+		entitlements:    entitlements,
+		redis:           rdb,
+		providers:       make(map[string]PaymentProvider, len(providers)),
+		defaultProvider: defaultProvider,
+	}
+	for _, p := range providers {
+		s.providers[p.Name()] = p
+	}
+	return s
 }
 
+// GetAccountProvider returns the payment provider chosen by an account, by Chatwoot account ID
+func (s *BillingService) GetAccountProvider(ctx context.Context, accountID int) (*BillingProviderSelection, error) {
+	account, err := s.accounts.FindByChatwootID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
 
-// BillingService handles subscription logic
-type BillingService struct {
-	repo     *repositories.BillingRepository
-	users    repositories.UserRepository
-	provider PaymentProvider
+	selection := &BillingProviderSelection{Default: s.defaultProvider, Available: []string{}}
+	selection.Provider, _ = account.Settings[billingProviderSetting].(string)
+	for name := range s.providers {
+		selection.Available = append(selection.Available, name)
+	}
+	sort.Strings(selection.Available)
+	return selection, nil
 }
 
-// NewBillingService creates a new BillingService
-func NewBillingService(repo *repositories.BillingRepository, users repositories.UserRepository, apiKey string) *BillingService {
-	return &BillingService{
-		repo:     repo,
-		users:    users,
-		provider: NewAsaasProvider(apiKey),
+// SetAccountProvider stores the payment provider of an account's next
+// subscriptions; an empty name goes back to the plan's or the default one
+func (s *BillingService) SetAccountProvider(ctx context.Context, accountID int, name string) error {
+	if _, ok := s.providers[name]; name != "" && !ok {
+		return ErrProviderUnavailable
+	}
+
+	account, err := s.accounts.FindByChatwootID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	settings := account.Settings
+	if settings == nil {
+		settings = models.JSON{}
+	}
+	if name == "" {
+		delete(settings, billingProviderSetting)
+	} else {
+		settings[billingProviderSetting] = name
 	}
+	return s.accounts.UpdateSettings(ctx, account.ID, settings)
 }
 
-// SubscribeAccount subscribes an account to a plan
-func (s *BillingService) SubscribeAccount(ctx context.Context, accountID int, planID uuid.UUID, userID uint) (*models.Subscription, error) {
-	// 1. Get User/Owner for billing details
+// SubscribeAccount subscribes an account to a plan, billed to the requesting user
+func (s *BillingService) SubscribeAccount(ctx context.Context, accountID int, userID uint, req SubscribeRequest) (*models.Subscription, error) {
+	// 1. One live subscription per account
+	if _, err := s.repo.GetSubscriptionByAccount(ctx, accountID); err == nil {
+		return nil, ErrSubscriptionExists
+	} else if !errors.Is(err, repositories.ErrSubscriptionNotFound) {
+		return nil, err
+	}
+
+	// 2. Get User/Owner for billing details
 	user, err := s.users.FindByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2. Get Plan to link
-	plan, err := s.repo.GetPlan(ctx, planID)
+	// 3. Get Plan to link and the gateway that bills it
+	plan, err := s.repo.GetPlan(ctx, req.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.providerFor(ctx, accountID, plan)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Create Remote Customer (Idempotent)
-	customerID, err := s.provider.CreateCustomer(ctx, user)
+	// 4. Create Remote Customer (Idempotent)
+	customerID, err := provider.CreateCustomer(ctx, PaymentCustomer{
+		AccountID: accountID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Document:  req.Document,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment profile: %w", err)
 	}
 
-	// 4. Create Remote Subscription
-	subID, err := s.provider.CreateSubscription(ctx, customerID, plan.AsaasID)
+	// 5. Create Remote Subscription, first charge due today
+	now := time.Now()
+	remote, err := provider.CreateSubscription(ctx, SubscriptionRequest{
+		CustomerID:    customerID,
+		AccountID:     accountID,
+		Plan:          plan,
+		PaymentMethod: req.PaymentMethod,
+		FirstDueDate:  now,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create subscription: %w", err)
 	}
 
-	// 5. Save Local Subscription
+	// 6. Save Local Subscription
 	sub := &models.Subscription{
 		AccountID:          accountID,
 		PlanID:             plan.ID,
-		Status:             "pending",
-		Provider:           models.ProviderAsaas,
-		ProviderSubID:      subID,
-		CurrentPeriodStart: time.Now(),
-		CurrentPeriodEnd:   time.Now().AddDate(0, 1, 0), // 1 month
+		Status:             models.SubscriptionPending,
+		Provider:           provider.Name(),
+		ProviderSubID:      remote.ID,
+		CheckoutURL:        remote.CheckoutURL,
+		BillingEmail:       user.Email,
+		BillingPhone:       req.Phone,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   now.AddDate(0, 1, 0), // 1 month
 	}
 
 	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
@@ -117,34 +258,397 @@ func (s *BillingService) SubscribeAccount(ctx context.Context, accountID int, pl
 	return sub, nil
 }
 
+// CancelSubscription cancels the live subscription of an account
+func (s *BillingService) CancelSubscription(ctx context.Context, accountID int) (*models.Subscription, error) {
+	sub, err := s.repo.GetSubscriptionByAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.provider(sub.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := provider.CancelSubscription(ctx, sub.ProviderSubID); err != nil {
+		return nil, fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+
+	if err := TransitionSubscription(sub, models.SubscriptionCanceled, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.SaveSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.applyEntitlements(ctx, sub)
+	return sub, nil
+}
+
+// ChangePlan moves the live subscription of an account to another plan,
+// upgrading or downgrading its entitlements right away. The change is nil
+// when the entitlements were not applied.
+func (s *BillingService) ChangePlan(ctx context.Context, accountID int, planID uuid.UUID) (*models.Subscription, *EntitlementsChange, error) {
+	sub, err := s.repo.GetSubscriptionByAccount(ctx, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sub.PlanID == planID {
+		return nil, nil, ErrSamePlan
+	}
+	plan, err := s.repo.GetPlan(ctx, planID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !plan.IsActive {
+		return nil, nil, ErrPlanInactive
+	}
+	provider, err := s.provider(sub.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := provider.ChangeSubscriptionPlan(ctx, sub.ProviderSubID, plan); err != nil {
+		return nil, nil, fmt.Errorf("failed to change plan: %w", err)
+	}
+
+	sub.PlanID = plan.ID
+	if err := s.SaveSubscription(ctx, sub); err != nil {
+		return nil, nil, err
+	}
+	// The gateway bills the new plan already, so a failure here does not undo the change
+	change, err := s.SyncEntitlements(ctx, sub)
+	if err != nil {
+		log.Printf("Failed to apply plan %s to account %d: %v", plan.ID, accountID, err)
+	}
+	return sub, change, nil
+}
+
+// SyncEntitlements gives an account the entitlements of its subscription's
+// plan, or the free ones once it is canceled. Pending subscriptions grant
+// nothing until paid; the change is nil for them.
+func (s *BillingService) SyncEntitlements(ctx context.Context, sub *models.Subscription) (*EntitlementsChange, error) {
+	if s.entitlements == nil || sub.Status == models.SubscriptionPending {
+		return nil, nil
+	}
+
+	var plan *models.Plan
+	if sub.Status != models.SubscriptionCanceled {
+		p, err := s.repo.GetPlan(ctx, sub.PlanID)
+		if err != nil {
+			return nil, err
+		}
+		plan = p
+	}
+
+	change, err := s.entitlements.ApplyPlan(ctx, sub.AccountID, plan)
+	if err != nil {
+		return nil, err
+	}
+	if len(change.OverQuota) > 0 {
+		log.Printf("Account %d is over quota after its entitlements changed: %+v", sub.AccountID, change.OverQuota)
+	}
+	return change, nil
+}
+
+// applyEntitlements syncs the entitlements of a subscription whose status
+// changed; failures are logged so the status change stands
+func (s *BillingService) applyEntitlements(ctx context.Context, sub *models.Subscription) {
+	if _, err := s.SyncEntitlements(ctx, sub); err != nil {
+		log.Printf("Failed to apply the plan of subscription %s to account %d: %v", sub.ID, sub.AccountID, err)
+	}
+}
+
+// ListPlans returns the plans offered to accounts, and the retired ones when includeInactive is set
+func (s *BillingService) ListPlans(ctx context.Context, includeInactive bool) ([]models.Plan, error) {
+	return s.repo.ListPlans(ctx, includeInactive)
+}
+
+// GetPlan returns a plan by ID
+func (s *BillingService) GetPlan(ctx context.Context, id uuid.UUID) (*models.Plan, error) {
+	return s.repo.GetPlan(ctx, id)
+}
+
+// CreatePlan creates a plan
+func (s *BillingService) CreatePlan(ctx context.Context, req PlanRequest) (*models.Plan, error) {
+	plan := &models.Plan{IsActive: true}
+	if err := s.fillPlan(plan, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// UpdatePlan updates a plan and applies its features to the accounts
+// subscribed to it. It returns the previous plan and, by account, the
+// resources left over quota by the new features.
+func (s *BillingService) UpdatePlan(ctx context.Context, id uuid.UUID, req PlanRequest) (*models.Plan, *models.Plan, map[int][]QuotaUsage, error) {
+	plan, err := s.repo.GetPlan(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	previous := *plan
+	if err := s.fillPlan(plan, req); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.repo.UpdatePlan(ctx, plan); err != nil {
+		return nil, nil, nil, err
+	}
+
+	subs, err := s.repo.ListSubscriptionsByPlan(ctx, plan.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	overQuota := map[int][]QuotaUsage{}
+	for i := range subs {
+		change, err := s.SyncEntitlements(ctx, &subs[i])
+		if err != nil {
+			log.Printf("Failed to apply plan %s to account %d: %v", plan.ID, subs[i].AccountID, err)
+			continue
+		}
+		if change != nil && len(change.OverQuota) > 0 {
+			overQuota[subs[i].AccountID] = change.OverQuota
+		}
+	}
+	return plan, &previous, overQuota, nil
+}
+
+// DeactivatePlan stops offering a plan; its subscriptions keep it
+func (s *BillingService) DeactivatePlan(ctx context.Context, id uuid.UUID) (*models.Plan, error) {
+	plan, err := s.repo.GetPlan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	plan.IsActive = false
+	if err := s.repo.UpdatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// fillPlan validates a plan request and copies it into plan
+func (s *BillingService) fillPlan(plan *models.Plan, req PlanRequest) error {
+	if _, err := PlanEntitlements(0, req.Features); err != nil {
+		return err
+	}
+	if _, ok := s.providers[req.Provider]; req.Provider != "" && !ok {
+		return fmt.Errorf("%w: %q", ErrProviderUnavailable, req.Provider)
+	}
+
+	plan.Name = req.Name
+	plan.Description = req.Description
+	plan.Price = req.Price
+	plan.Currency = req.Currency
+	if plan.Currency == "" {
+		plan.Currency = "BRL"
+	}
+	plan.Features = req.Features
+	if req.IsActive != nil {
+		plan.IsActive = *req.IsActive
+	}
+	plan.AsaasID = req.AsaasID
+	plan.MercadoPagoID = req.MercadoPagoID
+	plan.StripePriceID = req.StripePriceID
+	plan.Provider = req.Provider
+	return nil
+}
+
+// GetSubscription returns the live subscription of an account
+func (s *BillingService) GetSubscription(ctx context.Context, accountID int) (*models.Subscription, error) {
+	return s.repo.GetSubscriptionByAccount(ctx, accountID)
+}
+
+// SaveSubscription stores a subscription and drops the cached suspension of its account
+func (s *BillingService) SaveSubscription(ctx context.Context, sub *models.Subscription) error {
+	if err := s.repo.UpdateSubscription(ctx, sub); err != nil {
+		return err
+	}
+	if s.redis != nil {
+		if err := s.redis.Del(ctx, suspensionCacheKey(sub.AccountID)).Err(); err != nil {
+			log.Printf("Failed to invalidate suspension of account %d: %v", sub.AccountID, err)
+		}
+	}
+	return nil
+}
+
+// AccountSuspended tells whether the subscription of an account is suspended
+// for non-payment. Accounts without a subscription are not suspended.
+func (s *BillingService) AccountSuspended(ctx context.Context, accountID int) (bool, error) {
+	key := suspensionCacheKey(accountID)
+	if s.redis != nil {
+		cached, err := s.redis.Get(ctx, key).Result()
+		if err == nil {
+			return cached == "1", nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Suspension cache unavailable: %v", err)
+		}
+	}
+
+	suspended := false
+	sub, err := s.repo.GetSubscriptionByAccount(ctx, accountID)
+	switch {
+	case err == nil:
+		suspended = sub.Status == models.SubscriptionSuspended
+	case !errors.Is(err, repositories.ErrSubscriptionNotFound):
+		return false, err
+	}
+
+	if s.redis != nil {
+		value := "0"
+		if suspended {
+			value = "1"
+		}
+		if err := s.redis.Set(ctx, key, value, suspensionCacheTTL).Err(); err != nil {
+			log.Printf("Failed to cache suspension of account %d: %v", accountID, err)
+		}
+	}
+	return suspended, nil
+}
+
+// ListPayments returns the charges of the live subscription of an account, as reported by the provider
+func (s *BillingService) ListPayments(ctx context.Context, accountID int) ([]models.Transaction, error) {
+	sub, err := s.repo.GetSubscriptionByAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.provider(sub.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := provider.ListPayments(ctx, sub.ProviderSubID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payments: %w", err)
+	}
+	for i := range payments {
+		payments[i].SubscriptionID = sub.ID
+		payments[i].AccountID = sub.AccountID
+	}
+	return payments, nil
+}
+
+// VerifyWebhook authenticates a webhook of a payment provider
+func (s *BillingService) VerifyWebhook(providerName string, header http.Header, payload []byte) error {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return err
+	}
+	return provider.VerifyWebhook(header, payload)
+}
+
 // ProcessWebhook handles provider callbacks
-func (s *BillingService) ProcessWebhook(ctx context.Context, payload []byte) error {
+func (s *BillingService) ProcessWebhook(ctx context.Context, providerName string, payload []byte) error {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return err
+	}
+
 	// 1. Parse generic transaction
-	tx, err := s.provider.ParseWebhook(payload)
+	event, err := provider.ParseWebhook(ctx, payload)
 	if err != nil {
 		return err
 	}
+	if event == nil || event.SubscriptionID == "" {
+		return nil // Not a subscription charge
+	}
 
 	// 2. Find Subscription
-	sub, err := s.repo.FindSubscriptionByProviderID(ctx, tx.ProviderID) // Assumes we map payment -> sub
+	sub, err := s.repo.FindSubscriptionByProviderID(ctx, event.SubscriptionID)
 	if err != nil {
-		return errors.New("subscription not found for payment")
+		return fmt.Errorf("subscription %s of payment %s: %w", event.SubscriptionID, event.Transaction.ProviderID, err)
+	}
+	if sub.Provider != providerName {
+		return fmt.Errorf("subscription %s belongs to %s, not %s", event.SubscriptionID, sub.Provider, providerName)
 	}
 
-	// 3. Log Transaction
+	// 3. Record Transaction; each charge gets several events (created, confirmed, received...)
+	tx := event.Transaction
 	tx.SubscriptionID = sub.ID
 	tx.AccountID = sub.AccountID
-	s.repo.CreateTransaction(ctx, tx)
+	wasPaid := false
+	existing, err := s.repo.FindTransactionByProviderID(ctx, tx.ProviderID)
+	switch {
+	case err == nil:
+		wasPaid = existing.Status == models.TransactionPaid
+		if wasPaid && tx.Status != models.TransactionPaid && tx.Status != models.TransactionRefunded {
+			// A late or redelivered event of a settled charge: only a refund moves it
+			log.Printf("Ignoring %s event of paid payment %s (%s)", tx.Status, tx.ProviderID, event.Event)
+			return nil
+		}
+		tx.ID = existing.ID
+		tx.CreatedAt = existing.CreatedAt
+		if err := s.repo.UpdateTransaction(ctx, tx); err != nil {
+			return err
+		}
+	case errors.Is(err, repositories.ErrTransactionNotFound):
+		if err := s.repo.CreateTransaction(ctx, tx); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
 
-	// 4. Update Subscription Status if Paid
-	if tx.Status == "paid" {
-		sub.Status = "active"
-		sub.CurrentPeriodEnd = time.Now().AddDate(0, 1, 0) // Renew
-		return s.repo.UpdateSubscription(ctx, sub)
-	} else if tx.Status == "failed" {
-		sub.Status = "overdue"
-		return s.repo.UpdateSubscription(ctx, sub)
+	// 4. Move the subscription: a paid charge clears any dunning, a failed one starts it
+	now := time.Now()
+	switch tx.Status {
+	case models.TransactionPaid:
+		if wasPaid {
+			return nil // Renewed already
+		}
+		activated := sub.Status != models.SubscriptionActive
+		if err := TransitionSubscription(sub, models.SubscriptionActive, now); err != nil {
+			log.Printf("Payment %s not applied to subscription %s: %v", tx.ProviderID, sub.ID, err)
+			return nil
+		}
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = now.AddDate(0, 1, 0) // Renew
+		if err := s.SaveSubscription(ctx, sub); err != nil {
+			return err
+		}
+		if activated {
+			s.applyEntitlements(ctx, sub)
+		}
+		return nil
+	case models.TransactionFailed:
+		if sub.Status == models.SubscriptionPastDue || sub.Status == models.SubscriptionSuspended || sub.Status == models.SubscriptionCanceled {
+			return nil // Already in dunning
+		}
+		if err := TransitionSubscription(sub, models.SubscriptionPastDue, now); err != nil {
+			return err
+		}
+		return s.SaveSubscription(ctx, sub)
+	case models.TransactionRefunded:
+		log.Printf("Payment %s of subscription %s refunded (%s)", tx.ProviderID, sub.ID, event.Event)
 	}
 
 	return nil
 }
+
+// providerFor picks the gateway of a new subscription: the account's choice,
+// then the plan's, then the default one
+func (s *BillingService) providerFor(ctx context.Context, accountID int, plan *models.Plan) (PaymentProvider, error) {
+	account, err := s.accounts.FindByChatwootID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if name, _ := account.Settings[billingProviderSetting].(string); name != "" {
+		return s.provider(name)
+	}
+	if plan.Provider != "" {
+		return s.provider(plan.Provider)
+	}
+	return s.provider(s.defaultProvider)
+}
+
+func suspensionCacheKey(accountID int) string {
+	return fmt.Sprintf("billing:suspended:%d", accountID)
+}
+
+func (s *BillingService) provider(name string) (PaymentProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrProviderUnavailable, name)
+	}
+	return provider, nil
+}
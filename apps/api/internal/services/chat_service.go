@@ -4,12 +4,14 @@ package services
 import (
 	"context"
 	"errors"
+	"html"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/realtime"
 	"whatpro-hub/internal/repositories"
 	"whatpro-hub/pkg/chatwoot"
 )
@@ -20,15 +22,18 @@ type ChatService struct {
 	auditRepo  *repositories.AuditRepository
 	userRepo   repositories.UserRepository
 	chatwootClient *chatwoot.Client
+	hub            realtime.Publisher
 }
 
-// NewChatService creates a new chat service
-func NewChatService(chatRepo *repositories.ChatRepository, auditRepo *repositories.AuditRepository, userRepo repositories.UserRepository, chatwootClient *chatwoot.Client) *ChatService {
+// NewChatService creates a new chat service.
+// Messages, reads, mentions and typing indicators are pushed to connected clients through hub.
+func NewChatService(chatRepo *repositories.ChatRepository, auditRepo *repositories.AuditRepository, userRepo repositories.UserRepository, chatwootClient *chatwoot.Client, hub realtime.Publisher) *ChatService {
 	return &ChatService{
 		chatRepo:  chatRepo,
 		auditRepo: auditRepo,
 		userRepo: userRepo,
 		chatwootClient: chatwootClient,
+		hub:            hub,
 	}
 }
 
@@ -180,6 +185,8 @@ func (s *ChatService) AddMember(ctx context.Context, accountID, actorID int, roo
 		"target_user_id": targetUserID,
 	})
 
+	s.publish(ctx, realtime.NewEvent(realtime.EventMemberAdded, accountID, member).ForRoom(roomID))
+
 	return nil
 }
 
@@ -219,6 +226,11 @@ func (s *ChatService) RemoveMember(ctx context.Context, accountID, actorID int,
 		"target_user_id": targetUserID,
 	})
 
+	s.publish(ctx, realtime.NewEvent(realtime.EventMemberRemoved, accountID, map[string]interface{}{
+		"room_id": roomID,
+		"user_id": targetUserID,
+	}).ForRoom(roomID))
+
 	return nil
 }
 
@@ -317,9 +329,135 @@ func (s *ChatService) SendMessage(ctx context.Context, accountID, userID int, ro
 		message.Quote = quote
 	}
 
+	s.publish(ctx, realtime.NewEvent(realtime.EventMessageCreated, accountID, message).ForRoom(roomID))
+
+	return message, nil
+}
+
+// PostSystemMessage posts an automated message into a room on behalf of senderID,
+// or of the room creator when senderID is 0. Mentions in the content notify users.
+func (s *ChatService) PostSystemMessage(ctx context.Context, accountID int, roomID uuid.UUID, senderID int, content string) (*models.InternalChatMessage, error) {
+	room, err := s.chatRepo.GetRoomByID(ctx, accountID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if senderID == 0 {
+		senderID = room.CreatedBy
+	}
+
+	message := &models.InternalChatMessage{
+		RoomID:      room.ID,
+		AccountID:   accountID,
+		SenderID:    senderID,
+		Content:     content,
+		MessageType: models.ChatMessageTypeSystem,
+	}
+
+	if err := s.chatRepo.CreateMessage(ctx, message); err != nil {
+		return nil, err
+	}
+
+	if err := s.handleMentions(ctx, accountID, room.ID, message, 0); err != nil {
+		return nil, err
+	}
+
+	s.publish(ctx, realtime.NewEvent(realtime.EventMessageCreated, accountID, message).ForRoom(room.ID))
+
 	return message, nil
 }
 
+// ============================================================================
+// SEARCH
+// ============================================================================
+
+// Context window limits around a search hit
+const (
+	defaultMessageContext = 10
+	maxMessageContext     = 50
+)
+
+// SearchMessagesRequest represents a message search
+type SearchMessagesRequest struct {
+	Query       string     `query:"q"`
+	SenderID    int        `query:"sender_id"`
+	RoomID      *uuid.UUID `query:"-"`
+	From        *time.Time `query:"-"`
+	To          *time.Time `query:"-"`
+	MessageType string     `query:"message_type"`
+	Page        int        `query:"page"`
+	Limit       int        `query:"limit"`
+}
+
+// SearchMessages finds messages across every room the user belongs to.
+// Snippets are HTML-escaped with the matches wrapped in <mark> tags.
+func (s *ChatService) SearchMessages(ctx context.Context, accountID, userID int, req SearchMessagesRequest) ([]repositories.ChatSearchHit, int64, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, 0, errors.New("search query is required")
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	hits, total, err := s.chatRepo.SearchMessages(ctx, accountID, repositories.ChatSearchFilter{
+		Query:       query,
+		UserID:      userID,
+		SenderID:    req.SenderID,
+		RoomID:      req.RoomID,
+		From:        req.From,
+		To:          req.To,
+		MessageType: req.MessageType,
+	}, req.Limit, (req.Page-1)*req.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range hits {
+		hits[i].Snippet = highlightSnippet(hits[i].Snippet)
+	}
+	return hits, total, nil
+}
+
+// GetMessageContext returns the messages around a message, e.g. to jump to a search hit.
+// Older and newer pages are loaded by calling it again with the first or last message.
+func (s *ChatService) GetMessageContext(ctx context.Context, accountID, userID int, messageID uuid.UUID, before, after int) ([]models.InternalChatMessage, error) {
+	message, err := s.chatRepo.GetMessageByID(ctx, accountID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil || message.DeletedAt != nil {
+		return nil, errors.New("message not found")
+	}
+
+	if _, err := s.GetRoom(ctx, accountID, userID, message.RoomID); err != nil {
+		return nil, err
+	}
+
+	return s.chatRepo.GetMessagesAround(ctx, message, clampContext(before), clampContext(after))
+}
+
+// clampContext limits the number of messages loaded on each side of a hit
+func clampContext(n int) int {
+	if n < 0 {
+		return defaultMessageContext
+	}
+	if n > maxMessageContext {
+		return maxMessageContext
+	}
+	return n
+}
+
+// highlightSnippet escapes a ts_headline snippet and turns its match delimiters into <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		repositories.ChatSearchHighlightStart, "<mark>",
+		repositories.ChatSearchHighlightStop, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
+
 // ListMentions returns mentions for a user
 func (s *ChatService) ListMentions(ctx context.Context, accountID, userID int, unreadOnly bool) ([]models.InternalChatMention, error) {
 	return s.chatRepo.ListMentionsByUser(ctx, accountID, userID, unreadOnly)
@@ -335,8 +473,9 @@ func (s *ChatService) CreateQuote(ctx context.Context, accountID int, messageID
 	return s.createQuoteFromChatwoot(ctx, accountID, messageID, &req)
 }
 
-// DeleteMessage soft-deletes a message (owner or moderator only)
-func (s *ChatService) DeleteMessage(ctx context.Context, accountID, actorID int, messageID uuid.UUID) error {
+// DeleteMessage soft-deletes a message (owner or moderator only).
+// moderate lets holders of the chat.moderate permission delete any message.
+func (s *ChatService) DeleteMessage(ctx context.Context, accountID, actorID int, messageID uuid.UUID, moderate bool) error {
 	message, err := s.chatRepo.GetMessageByID(ctx, accountID, messageID)
 	if err != nil {
 		return err
@@ -345,8 +484,8 @@ func (s *ChatService) DeleteMessage(ctx context.Context, accountID, actorID int,
 		return errors.New("message not found")
 	}
 
-	// Owner can delete, or moderator of room
-	if message.SenderID != actorID {
+	// Owner can delete, or moderator of room, or an account-wide chat moderator
+	if message.SenderID != actorID && !moderate {
 		if err := s.requireModeratorRole(ctx, message.RoomID, actorID); err != nil {
 			return errors.New("permission denied: only sender or moderator can delete")
 		}
@@ -361,6 +500,12 @@ func (s *ChatService) DeleteMessage(ctx context.Context, accountID, actorID int,
 		"room_id": message.RoomID.String(),
 	})
 
+	s.publish(ctx, realtime.NewEvent(realtime.EventMessageDeleted, accountID, map[string]interface{}{
+		"room_id":    message.RoomID,
+		"message_id": messageID,
+		"deleted_by": actorID,
+	}).ForRoom(message.RoomID))
+
 	return nil
 }
 
@@ -415,6 +560,7 @@ func (s *ChatService) handleMentions(ctx context.Context, accountID int, roomID
 			if err := s.chatRepo.CreateMention(ctx, mention); err != nil {
 				return err
 			}
+			s.publish(ctx, realtime.NewEvent(realtime.EventMention, accountID, mention).ForUser(userID))
 		}
 	}
 
@@ -426,18 +572,18 @@ func (s *ChatService) createQuoteFromChatwoot(ctx context.Context, accountID int
 		return nil, errors.New("chatwoot client not configured")
 	}
 
-	conversation, err := s.chatwootClient.GetConversation(req.ChatwootAccountID, req.ConversationID)
+	conversation, err := s.chatwootClient.GetConversation(ctx, req.ChatwootAccountID, req.ConversationID)
 	if err != nil {
 		return nil, err
 	}
-	messagesPayload, err := s.chatwootClient.GetConversationMessages(req.ChatwootAccountID, req.ConversationID)
+	messages, err := s.chatwootClient.ListMessages(ctx, req.ChatwootAccountID, req.ConversationID, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	snapshot := models.JSON{
 		"conversation": conversation,
-		"messages":     messagesPayload,
+		"messages":     messages,
 		"target_message_id": req.ChatwootMessageID,
 	}
 
@@ -472,7 +618,37 @@ func (s *ChatService) MarkRoomAsRead(ctx context.Context, accountID, userID int,
 		return errors.New("access denied: not a member")
 	}
 
-	return s.chatRepo.UpdateLastRead(ctx, roomID, userID)
+	if err := s.chatRepo.UpdateLastRead(ctx, roomID, userID); err != nil {
+		return err
+	}
+
+	s.publish(ctx, realtime.NewEvent(realtime.EventRoomRead, accountID, map[string]interface{}{
+		"room_id": roomID,
+		"user_id": userID,
+		"read_at": time.Now(),
+	}).ForRoom(roomID))
+
+	return nil
+}
+
+// ============================================================================
+// TYPING
+// ============================================================================
+
+// SetTyping tells the other members of a room that the user started or stopped typing.
+// Nothing is stored; clients expire the indicator when no refresh arrives.
+func (s *ChatService) SetTyping(ctx context.Context, accountID, userID int, roomID uuid.UUID, typing bool) error {
+	if _, err := s.GetRoom(ctx, accountID, userID, roomID); err != nil {
+		return err
+	}
+
+	s.publish(ctx, realtime.NewEvent(realtime.EventTyping, accountID, map[string]interface{}{
+		"room_id": roomID,
+		"user_id": userID,
+		"typing":  typing,
+	}).ForRoom(roomID))
+
+	return nil
 }
 
 // ============================================================================
@@ -490,6 +666,13 @@ func (s *ChatService) requireModeratorRole(ctx context.Context, roomID uuid.UUID
 	return nil
 }
 
+// publish pushes an event to the connected clients when a hub is configured
+func (s *ChatService) publish(ctx context.Context, event realtime.Event) {
+	if s.hub != nil {
+		s.hub.Publish(ctx, event)
+	}
+}
+
 func (s *ChatService) logAudit(ctx context.Context, accountID, actorID int, action, targetID string, metadata models.JSON) {
 	audit := &models.InternalChatAudit{
 		AccountID: accountID,
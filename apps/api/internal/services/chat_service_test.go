@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	"whatpro-hub/internal/repositories"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	raw := "<b>cliente</b> pediu o " + repositories.ChatSearchHighlightStart + "boleto" + repositories.ChatSearchHighlightStop + " & nota"
+
+	got := highlightSnippet(raw)
+	want := "&lt;b&gt;cliente&lt;/b&gt; pediu o <mark>boleto</mark> &amp; nota"
+	if got != want {
+		t.Fatalf("highlightSnippet = %q, want %q", got, want)
+	}
+}
+
+func TestClampContext(t *testing.T) {
+	if got := clampContext(-1); got != defaultMessageContext {
+		t.Fatalf("negative context = %d, want default %d", got, defaultMessageContext)
+	}
+	if got := clampContext(0); got != 0 {
+		t.Fatalf("zero context = %d, want 0", got)
+	}
+	if got := clampContext(500); got != maxMessageContext {
+		t.Fatalf("large context = %d, want %d", got, maxMessageContext)
+	}
+}
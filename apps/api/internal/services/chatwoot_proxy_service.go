@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/crypto"
+)
+
+const (
+	// chatwootProxyCacheTTL bounds how long a proxied GET response is served from Redis
+	chatwootProxyCacheTTL = 15 * time.Second
+	// chatwootProxyMaxBody caps the size of a proxied response
+	chatwootProxyMaxBody = 10 << 20
+)
+
+var (
+	ErrChatwootTokenMissing = errors.New("no Chatwoot token stored for this user, sign in again")
+	ErrProxyPathNotAllowed  = errors.New("chatwoot path not allowed")
+	ErrProxyAccountMismatch = errors.New("chatwoot account does not match the session account")
+)
+
+// proxyPath splits a proxied path into its account ID and the rest of the path
+var proxyPath = regexp.MustCompile(`^accounts/(\d+)/([a-z_/0-9]+)$`)
+
+// proxyRoutes are the Chatwoot endpoints the frontend may call, relative to the account
+var proxyRoutes = []struct {
+	method string
+	path   *regexp.Regexp
+}{
+	{http.MethodGet, regexp.MustCompile(`^(inboxes|labels|agents|teams|canned_responses|custom_attribute_definitions)$`)},
+	{http.MethodGet, regexp.MustCompile(`^conversations(/meta|/search)?$`)},
+	{http.MethodGet, regexp.MustCompile(`^conversations/\d+(/messages|/labels)?$`)},
+	{http.MethodPost, regexp.MustCompile(`^conversations$`)},
+	{http.MethodPost, regexp.MustCompile(`^conversations/\d+/(messages|toggle_status|toggle_priority|assignments|labels|custom_attributes)$`)},
+	{http.MethodGet, regexp.MustCompile(`^contacts(/search|/\d+(/conversations)?)?$`)},
+	{http.MethodPost, regexp.MustCompile(`^contacts$`)},
+	{http.MethodPut, regexp.MustCompile(`^contacts/\d+$`)},
+}
+
+// ProxyRequest is a frontend request to forward to Chatwoot
+type ProxyRequest struct {
+	UserID      uint
+	AccountID   int    // Chatwoot account of the session
+	Method      string
+	Path        string // accounts/{id}/..., relative to /api/v1
+	Query       string
+	ContentType string
+	Body        []byte
+}
+
+// ProxyResponse is the Chatwoot response to a proxied request
+type ProxyResponse struct {
+	StatusCode  int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	Cached      bool   `json:"-"`
+}
+
+// ChatwootProxyService forwards frontend requests to Chatwoot with the
+// Chatwoot token of the signed-in user, so the platform API key never leaves
+// the hub and Chatwoot applies the user's own permissions
+type ChatwootProxyService struct {
+	users     repositories.UserRepository
+	encryptor *crypto.Encryptor
+	redis     *redis.Client
+	baseURL   string
+	client    *http.Client
+}
+
+// NewChatwootProxyService creates a new ChatwootProxyService. rdb may be nil to disable caching.
+func NewChatwootProxyService(users repositories.UserRepository, rdb *redis.Client, baseURL, encryptionKey string) (*ChatwootProxyService, error) {
+	encryptor, err := crypto.NewEncryptor(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize encryptor: %w", err)
+	}
+	return &ChatwootProxyService{
+		users:     users,
+		encryptor: encryptor,
+		redis:     rdb,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// StoreToken encrypts and stores the Chatwoot access token of a user
+func (s *ChatwootProxyService) StoreToken(ctx context.Context, userID uint, token string) error {
+	encrypted, err := s.encryptor.Encrypt(token)
+	if err != nil {
+		return err
+	}
+	return s.users.SetChatwootToken(ctx, userID, encrypted)
+}
+
+// Forward sends a request to Chatwoot. GET responses are cached per user for
+// a few seconds; any successful write of the user drops their cached responses.
+func (s *ChatwootProxyService) Forward(ctx context.Context, req ProxyRequest) (*ProxyResponse, error) {
+	if err := checkProxyPath(req.Method, req.Path, req.AccountID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ChatwootToken == "" {
+		return nil, ErrChatwootTokenMissing
+	}
+	token, err := s.encryptor.Decrypt(user.ChatwootToken)
+	if err != nil {
+		return nil, ErrChatwootTokenMissing
+	}
+
+	var cacheKey string
+	if req.Method == http.MethodGet {
+		cacheKey = s.cacheKey(ctx, req)
+		if cached := s.cached(ctx, cacheKey); cached != nil {
+			return cached, nil
+		}
+	}
+
+	resp, err := s.send(ctx, req, token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Method == http.MethodGet && resp.StatusCode == http.StatusOK:
+		s.store(ctx, cacheKey, resp)
+	case req.Method != http.MethodGet && resp.StatusCode >= 200 && resp.StatusCode < 300:
+		s.invalidate(ctx, req.UserID)
+	}
+	return resp, nil
+}
+
+func (s *ChatwootProxyService) send(ctx context.Context, req ProxyRequest, token string) (*ProxyResponse, error) {
+	target := s.baseURL + "/api/v1/" + req.Path
+	if req.Query != "" {
+		target += "?" + req.Query
+	}
+
+	var body io.Reader
+	if len(req.Body) > 0 {
+		body = bytes.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("api_access_token", token)
+	httpReq.Header.Set("Accept", "application/json")
+	if req.ContentType != "" {
+		httpReq.Header.Set("Content-Type", req.ContentType)
+	}
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("chatwoot unreachable: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, chatwootProxyMaxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chatwoot response: %w", err)
+	}
+	if len(data) > chatwootProxyMaxBody {
+		return nil, fmt.Errorf("chatwoot response exceeds %d bytes", chatwootProxyMaxBody)
+	}
+
+	return &ProxyResponse{
+		StatusCode:  httpResp.StatusCode,
+		ContentType: httpResp.Header.Get("Content-Type"),
+		Body:        data,
+	}, nil
+}
+
+// checkProxyPath allows whitelisted endpoints of the session's account only
+func checkProxyPath(method, path string, accountID int) error {
+	match := proxyPath.FindStringSubmatch(path)
+	if match == nil {
+		return ErrProxyPathNotAllowed
+	}
+	if id, err := strconv.Atoi(match[1]); err != nil || id != accountID {
+		return ErrProxyAccountMismatch
+	}
+	for _, route := range proxyRoutes {
+		if route.method == method && route.path.MatchString(match[2]) {
+			return nil
+		}
+	}
+	return ErrProxyPathNotAllowed
+}
+
+// cacheKey scopes cached responses to the user and to their current
+// generation, which is bumped on writes
+func (s *ChatwootProxyService) cacheKey(ctx context.Context, req ProxyRequest) string {
+	if s.redis == nil {
+		return ""
+	}
+	generation, err := s.redis.Get(ctx, proxyGenerationKey(req.UserID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Chatwoot proxy cache unavailable: %v", err)
+		return ""
+	}
+	sum := sha256.Sum256([]byte(req.Path + "?" + req.Query))
+	return fmt.Sprintf("chatwoot:proxy:user:%d:%s:%s", req.UserID, generation, hex.EncodeToString(sum[:]))
+}
+
+func (s *ChatwootProxyService) cached(ctx context.Context, key string) *ProxyResponse {
+	if key == "" {
+		return nil
+	}
+	data, err := s.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Chatwoot proxy cache unavailable: %v", err)
+		}
+		return nil
+	}
+	var resp ProxyResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil
+	}
+	resp.Cached = true
+	return &resp
+}
+
+func (s *ChatwootProxyService) store(ctx context.Context, key string, resp *ProxyResponse) {
+	if key == "" {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := s.redis.Set(ctx, key, data, chatwootProxyCacheTTL).Err(); err != nil {
+		log.Printf("Failed to cache Chatwoot response: %v", err)
+	}
+}
+
+// invalidate moves the user to a new cache generation; the old entries expire on their own
+func (s *ChatwootProxyService) invalidate(ctx context.Context, userID uint) {
+	if s.redis == nil {
+		return
+	}
+	key := proxyGenerationKey(userID)
+	pipe := s.redis.TxPipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to invalidate Chatwoot proxy cache of user %d: %v", userID, err)
+	}
+}
+
+func proxyGenerationKey(userID uint) string {
+	return "chatwoot:proxy:user:" + strconv.FormatUint(uint64(userID), 10) + ":generation"
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckProxyPath(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		want   error
+	}{
+		{http.MethodGet, "accounts/3/conversations", nil},
+		{http.MethodGet, "accounts/3/conversations/12/messages", nil},
+		{http.MethodPost, "accounts/3/conversations/12/toggle_status", nil},
+		{http.MethodPut, "accounts/3/contacts/5", nil},
+		{http.MethodGet, "accounts/4/conversations", ErrProxyAccountMismatch},
+		{http.MethodDelete, "accounts/3/contacts/5", ErrProxyPathNotAllowed},
+		{http.MethodGet, "accounts/3/agents/../../../platform/api/v1/users", ErrProxyPathNotAllowed},
+		{http.MethodGet, "profile", ErrProxyPathNotAllowed},
+		{http.MethodPost, "accounts/3/inboxes", ErrProxyPathNotAllowed},
+	}
+	for _, tc := range cases {
+		if err := checkProxyPath(tc.method, tc.path, 3); err != tc.want {
+			t.Fatalf("%s %s: got %v, want %v", tc.method, tc.path, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/mailer"
+)
+
+// DunningReport summarizes a dunning run
+type DunningReport struct {
+	Transitions map[string]int // Subscriptions moved, by new status
+	Reminders   int            // Payment reminders sent
+	Failed      int            // Subscriptions that could not be moved or reminded
+}
+
+// DunningService expires trials, suspends and cancels unpaid subscriptions
+// and reminds their accounts to pay, by WhatsApp and e-mail
+type DunningService struct {
+	billing   *BillingService
+	repo      *repositories.BillingRepository
+	accounts  *repositories.AccountRepository
+	providers *ProviderService
+	mailer    mailer.Mailer
+	policy    DunningPolicy
+}
+
+// NewDunningService creates a new DunningService. A nil mailer skips e-mail reminders.
+func NewDunningService(billing *BillingService, repo *repositories.BillingRepository, accounts *repositories.AccountRepository, providers *ProviderService, m mailer.Mailer, policy DunningPolicy) *DunningService {
+	return &DunningService{
+		billing:   billing,
+		repo:      repo,
+		accounts:  accounts,
+		providers: providers,
+		mailer:    m,
+		policy:    policy,
+	}
+}
+
+// Run moves every subscription due to change status at now and sends the due reminders
+func (s *DunningService) Run(ctx context.Context, now time.Time) (*DunningReport, error) {
+	subs, err := s.repo.ListSubscriptionsByStatus(ctx,
+		models.SubscriptionTrial, models.SubscriptionActive, models.SubscriptionPastDue, models.SubscriptionSuspended)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	report := &DunningReport{Transitions: map[string]int{}}
+	for i := range subs {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		sub := &subs[i]
+		if err := s.process(ctx, sub, now, report); err != nil {
+			log.Printf("Dunning of subscription %s (account %d) failed: %v", sub.ID, sub.AccountID, err)
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// process applies the due transitions of a subscription, then its due reminder
+func (s *DunningService) process(ctx context.Context, sub *models.Subscription, now time.Time, report *DunningReport) error {
+	// A long overdue trial goes past due and suspended in the same run
+	changed := false
+	var cancelErr error
+	for {
+		to, at, ok := s.policy.Next(sub, now)
+		if !ok {
+			break
+		}
+		if to == models.SubscriptionCanceled {
+			// The subscription stays suspended, and is retried on the next
+			// run, until the gateway stops charging it
+			if cancelErr = s.cancelRemote(ctx, sub); cancelErr != nil {
+				break
+			}
+		}
+		if err := TransitionSubscription(sub, to, at); err != nil {
+			return err
+		}
+		report.Transitions[to]++
+		changed = true
+	}
+
+	notice := ""
+	switch {
+	case changed && sub.Status == models.SubscriptionSuspended:
+		notice = models.SubscriptionSuspended
+	case changed && sub.Status == models.SubscriptionCanceled:
+		notice = models.SubscriptionCanceled
+	case s.policy.ReminderDue(sub, now):
+		notice = models.SubscriptionPastDue
+	}
+
+	if notice != "" {
+		if err := s.notify(ctx, sub, notice); err != nil {
+			if !changed {
+				return err // The reminder is retried on the next run
+			}
+			log.Printf("Failed to notify account %d of its %s subscription: %v", sub.AccountID, notice, err)
+		} else if notice == models.SubscriptionPastDue {
+			sub.RemindersSent++
+			sub.LastReminderAt = &now
+			report.Reminders++
+			changed = true
+		}
+	}
+
+	if !changed {
+		return cancelErr
+	}
+	if err := s.billing.SaveSubscription(ctx, sub); err != nil {
+		return err
+	}
+	if sub.Status == models.SubscriptionCanceled {
+		// Canceled accounts fall back to the free limits
+		s.billing.applyEntitlements(ctx, sub)
+	}
+	return cancelErr
+}
+
+// cancelRemote cancels the subscription at its payment gateway, as
+// BillingService.CancelSubscription does
+func (s *DunningService) cancelRemote(ctx context.Context, sub *models.Subscription) error {
+	if sub.ProviderSubID == "" {
+		return nil
+	}
+	provider, err := s.billing.provider(sub.Provider)
+	if err != nil {
+		return err
+	}
+	if err := provider.CancelSubscription(ctx, sub.ProviderSubID); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// notify sends a dunning message through every channel the account has. It
+// fails only when every attempted channel failed.
+func (s *DunningService) notify(ctx context.Context, sub *models.Subscription, notice string) error {
+	account, err := s.accounts.FindByChatwootID(ctx, sub.AccountID)
+	if err != nil {
+		return err
+	}
+	subject, text := dunningMessage(account.Name, sub, notice)
+
+	var errs []error
+	sent := 0
+
+	if phone := sub.BillingPhone; phone != "" {
+		if err := s.sendWhatsApp(ctx, sub.AccountID, phone, text); err != nil {
+			errs = append(errs, fmt.Errorf("whatsapp: %w", err))
+		} else {
+			sent++
+		}
+	}
+
+	email := sub.BillingEmail
+	if email == "" {
+		email = account.SupportEmail
+	}
+	if s.mailer != nil && email != "" {
+		if err := s.mailer.Send(ctx, []string{email}, subject, text); err != nil {
+			errs = append(errs, fmt.Errorf("e-mail: %w", err))
+		} else {
+			sent++
+		}
+	}
+
+	if sent == 0 && len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Printf("Dunning notice to account %d partially failed: %v", sub.AccountID, err)
+	}
+	return nil
+}
+
+// sendWhatsApp sends a message through the first connected WhatsApp provider of the account
+func (s *DunningService) sendWhatsApp(ctx context.Context, accountID int, phone, text string) error {
+	connected, err := s.providers.ListProviders(ctx, map[string]interface{}{"account_id": accountID, "status": "connected"})
+	if err != nil {
+		return err
+	}
+	if len(connected) == 0 {
+		return fmt.Errorf("account %d has no connected WhatsApp provider", accountID)
+	}
+
+	_, driver, err := s.providers.Driver(ctx, accountID, connected[0].ID)
+	if err != nil {
+		return err
+	}
+	_, err = driver.SendText(ctx, phone, text)
+	return err
+}
+
+// dunningMessage returns the subject and text of a dunning notice
+func dunningMessage(accountName string, sub *models.Subscription, notice string) (string, string) {
+	var subject string
+	var b strings.Builder
+	fmt.Fprintf(&b, "Olá, %s!\n\n", accountName)
+
+	switch notice {
+	case models.SubscriptionSuspended:
+		subject = "WhatPro Hub: conta suspensa por falta de pagamento"
+		b.WriteString("Sua assinatura do WhatPro Hub foi suspensa por falta de pagamento. ")
+		b.WriteString("A conta continua acessível apenas para leitura até o pagamento ser confirmado.\n")
+	case models.SubscriptionCanceled:
+		subject = "WhatPro Hub: assinatura cancelada"
+		b.WriteString("Sua assinatura do WhatPro Hub foi cancelada após o período de suspensão sem pagamento.\n")
+	default:
+		subject = "WhatPro Hub: pagamento pendente"
+		b.WriteString("Não identificamos o pagamento da sua assinatura do WhatPro Hub. ")
+		b.WriteString("Regularize o pagamento para evitar a suspensão da conta.\n")
+	}
+
+	if sub.CheckoutURL != "" && notice != models.SubscriptionCanceled {
+		fmt.Fprintf(&b, "\nPague em: %s\n", sub.CheckoutURL)
+	}
+	return subject, b.String()
+}
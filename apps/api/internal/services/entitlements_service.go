@@ -1,60 +1,255 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrInvalidPlanFeatures is returned for plan features that do not map to entitlements
+	ErrInvalidPlanFeatures = errors.New("invalid plan features")
+	// ErrQuotaExceeded is wrapped by the QuotaError of an account that reached a limit
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrFeatureDisabled is returned when the plan of an account does not include a feature
+	ErrFeatureDisabled = errors.New("feature not included in the plan")
+)
+
+// Features that plans switch on or off
+const (
+	FeatureKanban    = "kanban"
+	FeatureAnalytics = "analytics"
+)
+
+// planFeatureFlags maps each feature to its entitlement flag
+var planFeatureFlags = map[string]func(*models.AccountEntitlements) bool{
+	FeatureKanban:    func(e *models.AccountEntitlements) bool { return e.KanbanEnabled },
+	FeatureAnalytics: func(e *models.AccountEntitlements) bool { return e.AnalyticsEnabled },
+}
+
+// planLimitFeatures maps the numeric plan features to the entitlement they set.
+// A negative limit is unlimited.
+var planLimitFeatures = map[string]func(*models.AccountEntitlements) *int{
+	"max_inboxes":          func(e *models.AccountEntitlements) *int { return &e.MaxInboxes },
+	"max_agents":           func(e *models.AccountEntitlements) *int { return &e.MaxAgents },
+	"max_teams":            func(e *models.AccountEntitlements) *int { return &e.MaxTeams },
+	"max_integrations":     func(e *models.AccountEntitlements) *int { return &e.MaxIntegrations },
+	"max_monthly_messages": func(e *models.AccountEntitlements) *int { return &e.MaxMonthlyMessages },
+}
+
+// planFlagFeatures maps the boolean plan features, and their short aliases, to the entitlement they set
+var planFlagFeatures = map[string]func(*models.AccountEntitlements) *bool{
+	"kanban_enabled":    func(e *models.AccountEntitlements) *bool { return &e.KanbanEnabled },
+	"kanban":            func(e *models.AccountEntitlements) *bool { return &e.KanbanEnabled },
+	"analytics_enabled": func(e *models.AccountEntitlements) *bool { return &e.AnalyticsEnabled },
+	"analytics":         func(e *models.AccountEntitlements) *bool { return &e.AnalyticsEnabled },
+	"reports":           func(e *models.AccountEntitlements) *bool { return &e.AnalyticsEnabled },
+}
+
+// quotaResources are the resources counted against an account's limits
+var quotaResources = []struct {
+	name  string // Resource type of CanCreateResource
+	label string
+	model interface{}
+	limit func(*models.AccountEntitlements) int
+}{
+	{"agent", "agents", &models.User{}, func(e *models.AccountEntitlements) int { return e.MaxAgents }},
+	{"team", "teams", &models.Team{}, func(e *models.AccountEntitlements) int { return e.MaxTeams }},
+	{"provider", "integrations", &models.Provider{}, func(e *models.AccountEntitlements) int { return e.MaxIntegrations }},
+	// Inboxes are created in Chatwoot; the synced ones are counted
+	{"inbox", "inboxes", &models.Inbox{}, func(e *models.AccountEntitlements) int { return e.MaxInboxes }},
+}
+
+// QuotaUsage is how much of a limited resource an account uses
+type QuotaUsage struct {
+	Resource string `json:"resource"`
+	Usage    int64  `json:"usage"`
+	Limit    int    `json:"limit"` // Negative is unlimited
+}
+
+// QuotaError reports the limit an account reached when creating a resource
+type QuotaError struct {
+	QuotaUsage
+	label string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: max %s reached", e.label)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// EntitlementsChange is the result of applying a plan to an account
+type EntitlementsChange struct {
+	Previous  models.AccountEntitlements `json:"previous"`
+	Current   models.AccountEntitlements `json:"current"`
+	Changed   bool                       `json:"changed"`
+	OverQuota []QuotaUsage               `json:"over_quota"` // Resources the account has more of than it may now create
+}
+
+// EntitlementsReport is an account's limits and how much of them it uses
+type EntitlementsReport struct {
+	Entitlements models.AccountEntitlements `json:"entitlements"`
+	Usage        []QuotaUsage               `json:"usage"`
+	OverQuota    []QuotaUsage               `json:"over_quota"`
+}
+
 type EntitlementsService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	audit *repositories.AuditRepository
 }
 
-func NewEntitlementsService(db *gorm.DB) *EntitlementsService {
-	return &EntitlementsService{db: db}
+// NewEntitlementsService creates a new EntitlementsService. Plan changes are audited when audit is set.
+func NewEntitlementsService(db *gorm.DB, audit *repositories.AuditRepository) *EntitlementsService {
+	return &EntitlementsService{db: db, audit: audit}
 }
 
-// CanCreateResource checks if the account has quota to create a resource
+// CanCreateResource checks if the account has quota to create a resource.
+// An account at its limit gets a *QuotaError with its usage.
 func (s *EntitlementsService) CanCreateResource(accountID int, resourceType string) error {
-	var limits models.AccountEntitlements
-	if err := s.db.First(&limits, "account_id = ?", accountID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Default limits if not found (Free plan fallback)
-			limits = models.AccountEntitlements{
-				MaxInboxes: 1,
-				MaxAgents: 2,
-				MaxTeams: 1,
-				MaxIntegrations: 1,
-			}
-		} else {
-			return err
+	limits, err := s.get(s.db, accountID)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range quotaResources {
+		if resource.name != resourceType {
+			continue
+		}
+		limit := resource.limit(limits)
+		if limit < 0 {
+			return nil
+		}
+		var currentCount int64
+		if err := s.db.Model(resource.model).Where("account_id = ?", accountID).Count(&currentCount).Error; err != nil {
+			return fmt.Errorf("failed to count %s: %w", resource.label, err)
+		}
+		if int(currentCount) >= limit {
+			return &QuotaError{QuotaUsage: QuotaUsage{Resource: resource.name, Usage: currentCount, Limit: limit}, label: resource.label}
 		}
 	}
 
-	var currentCount int64
+	return nil
+}
+
+// RequireFeature checks that the plan of an account includes a feature
+func (s *EntitlementsService) RequireFeature(ctx context.Context, accountID int, feature string) error {
+	enabled, ok := planFeatureFlags[feature]
+	if !ok {
+		return fmt.Errorf("unknown feature %q", feature)
+	}
+	limits, err := s.get(s.db.WithContext(ctx), accountID)
+	if err != nil {
+		return err
+	}
+	if !enabled(limits) {
+		return fmt.Errorf("%w: %s", ErrFeatureDisabled, feature)
+	}
+	return nil
+}
 
-	switch resourceType {
-	case "agent":
-		s.db.Model(&models.User{}).Where("account_id = ?", accountID).Count(&currentCount)
-		if int(currentCount) >= limits.MaxAgents {
-			return errors.New("quota exceeded: max agents reached")
+// Report returns the limits of an account, its usage and the resources over quota
+func (s *EntitlementsService) Report(ctx context.Context, accountID int) (*EntitlementsReport, error) {
+	db := s.db.WithContext(ctx)
+	limits, err := s.get(db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.usage(db, accountID, limits)
+	if err != nil {
+		return nil, err
+	}
+	return &EntitlementsReport{Entitlements: *limits, Usage: usage, OverQuota: overQuota(usage)}, nil
+}
+
+// ApplyPlan sets the entitlements of an account to the features of a plan, or
+// to the free limits when plan is nil, and audits the change. Resources the
+// account already has beyond the new limits are kept and reported.
+func (s *EntitlementsService) ApplyPlan(ctx context.Context, accountID int, plan *models.Plan) (*EntitlementsChange, error) {
+	var features models.JSON
+	planID := ""
+	if plan != nil {
+		features = plan.Features
+		planID = plan.ID.String()
+	}
+	next, err := PlanEntitlements(accountID, features)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	previous, err := s.get(db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	next.CreatedAt = previous.CreatedAt
+
+	change := &EntitlementsChange{Previous: *previous, Current: next, Changed: !sameEntitlements(*previous, next)}
+	if change.Changed {
+		// Select all columns so false flags and zero limits are not replaced by column defaults
+		if err := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "account_id"}}, UpdateAll: true}).
+			Select("*").Create(&change.Current).Error; err != nil {
+			return nil, fmt.Errorf("failed to save entitlements: %w", err)
 		}
-	case "team":
-		s.db.Model(&models.Team{}).Where("account_id = ?", accountID).Count(&currentCount)
-		if int(currentCount) >= limits.MaxTeams {
-			return errors.New("quota exceeded: max teams reached")
+	}
+
+	usage, err := s.usage(db, accountID, &change.Current)
+	if err != nil {
+		return nil, err
+	}
+	change.OverQuota = overQuota(usage)
+
+	if change.Changed && s.audit != nil {
+		newValues := entitlementsJSON(change.Current)
+		newValues["plan_id"] = planID
+		newValues["over_quota"] = change.OverQuota
+		entry := &models.AuditLog{
+			AccountID:    accountID,
+			Action:       string(AuditActionUpdate),
+			ResourceType: "entitlements",
+			ResourceID:   fmt.Sprintf("%d", accountID),
+			OldValues:    entitlementsJSON(change.Previous),
+			NewValues:    newValues,
 		}
-	case "provider":
-		s.db.Model(&models.Provider{}).Where("account_id = ?", accountID).Count(&currentCount)
-		if int(currentCount) >= limits.MaxIntegrations {
-			return errors.New("quota exceeded: max integrations reached")
+		if err := s.audit.Create(entry); err != nil {
+			log.Printf("Failed to audit entitlements of account %d: %v", accountID, err)
 		}
-	case "inbox":
-		// TODO: Check Chatwoot inboxes if synced, or rely on internal tracking
-		// For now simple pass or check synced inboxes count
 	}
+	return change, nil
+}
 
-	return nil
+// PlanEntitlements returns the entitlements granted by a plan's features.
+// Features a plan does not set keep their free limit.
+func PlanEntitlements(accountID int, features models.JSON) (models.AccountEntitlements, error) {
+	e := freeEntitlements(accountID)
+	for key, value := range features {
+		if field, ok := planLimitFeatures[key]; ok {
+			n, ok := featureInt(value)
+			if !ok {
+				return e, fmt.Errorf("%w: %s must be a whole number", ErrInvalidPlanFeatures, key)
+			}
+			*field(&e) = n
+			continue
+		}
+		if field, ok := planFlagFeatures[key]; ok {
+			flag, ok := value.(bool)
+			if !ok {
+				return e, fmt.Errorf("%w: %s must be true or false", ErrInvalidPlanFeatures, key)
+			}
+			*field(&e) = flag
+			continue
+		}
+		return e, fmt.Errorf("%w: unknown feature %q", ErrInvalidPlanFeatures, key)
+	}
+	return e, nil
 }
 
 // TrackActivity increments daily usage counters
@@ -62,3 +257,90 @@ func (s *EntitlementsService) TrackActivity(accountID int, metric string) {
 	// Simple fire-and-forget increment, can be optimized with redis buffer
 	// s.db.Exec("UPDATE usage_dailies SET ...")
 }
+
+// get returns the entitlements of an account, the free ones if it has none
+func (s *EntitlementsService) get(db *gorm.DB, accountID int) (*models.AccountEntitlements, error) {
+	var limits models.AccountEntitlements
+	if err := db.First(&limits, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			limits = freeEntitlements(accountID)
+			return &limits, nil
+		}
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// usage counts the limited resources of an account
+func (s *EntitlementsService) usage(db *gorm.DB, accountID int, limits *models.AccountEntitlements) ([]QuotaUsage, error) {
+	usage := make([]QuotaUsage, 0, len(quotaResources))
+	for _, resource := range quotaResources {
+		var count int64
+		if err := db.Model(resource.model).Where("account_id = ?", accountID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", resource.label, err)
+		}
+		usage = append(usage, QuotaUsage{Resource: resource.name, Usage: count, Limit: resource.limit(limits)})
+	}
+	return usage, nil
+}
+
+// overQuota returns the resources used beyond their limit
+func overQuota(usage []QuotaUsage) []QuotaUsage {
+	over := []QuotaUsage{}
+	for _, u := range usage {
+		if u.Limit >= 0 && u.Usage > int64(u.Limit) {
+			over = append(over, u)
+		}
+	}
+	return over
+}
+
+// freeEntitlements are the limits of accounts without a plan (Free plan
+// fallback). They match the column defaults of models.AccountEntitlements, so
+// an account synced from Chatwoot without an entitlements row keeps Kanban.
+func freeEntitlements(accountID int) models.AccountEntitlements {
+	return models.AccountEntitlements{
+		AccountID:          accountID,
+		MaxInboxes:         2,
+		MaxAgents:          5,
+		MaxTeams:           2,
+		MaxIntegrations:    1,
+		MaxMonthlyMessages: 1000,
+		KanbanEnabled:      true,
+		AnalyticsEnabled:   false,
+	}
+}
+
+func sameEntitlements(a, b models.AccountEntitlements) bool {
+	return a.MaxInboxes == b.MaxInboxes && a.MaxAgents == b.MaxAgents && a.MaxTeams == b.MaxTeams &&
+		a.MaxIntegrations == b.MaxIntegrations && a.MaxMonthlyMessages == b.MaxMonthlyMessages &&
+		a.KanbanEnabled == b.KanbanEnabled && a.AnalyticsEnabled == b.AnalyticsEnabled
+}
+
+func entitlementsJSON(e models.AccountEntitlements) models.JSON {
+	return models.JSON{
+		"max_inboxes":          e.MaxInboxes,
+		"max_agents":           e.MaxAgents,
+		"max_teams":            e.MaxTeams,
+		"max_integrations":     e.MaxIntegrations,
+		"max_monthly_messages": e.MaxMonthlyMessages,
+		"kanban_enabled":       e.KanbanEnabled,
+		"analytics_enabled":    e.AnalyticsEnabled,
+	}
+}
+
+// featureInt reads a whole number from a decoded JSON feature
+func featureInt(value interface{}) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), n == float64(int(n))
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestPlanEntitlements(t *testing.T) {
+	// Features decoded from JSONB hold numbers as float64
+	e, err := PlanEntitlements(7, models.JSON{"max_agents": float64(10), "max_inboxes": float64(-1), "kanban": true, "reports": true})
+	if err != nil {
+		t.Fatalf("plan entitlements: %v", err)
+	}
+	if e.AccountID != 7 || e.MaxAgents != 10 || e.MaxInboxes != -1 || !e.KanbanEnabled || !e.AnalyticsEnabled {
+		t.Fatalf("unexpected entitlements: %+v", e)
+	}
+	if e.MaxTeams != freeEntitlements(7).MaxTeams {
+		t.Fatalf("unset features should keep the free limit, got %d teams", e.MaxTeams)
+	}
+
+	for _, features := range []models.JSON{
+		{"max_agents": 2.5},
+		{"max_teams": "3"},
+		{"kanban_enabled": "yes"},
+		{"max_agent": float64(3)},
+	} {
+		if _, err := PlanEntitlements(7, features); !errors.Is(err, ErrInvalidPlanFeatures) {
+			t.Fatalf("%v should be rejected, got %v", features, err)
+		}
+	}
+}
+
+func TestOverQuota(t *testing.T) {
+	usage := []QuotaUsage{
+		{Resource: "agent", Usage: 5, Limit: 3},
+		{Resource: "team", Usage: 2, Limit: 2},
+		{Resource: "inbox", Usage: 40, Limit: -1},
+	}
+	over := overQuota(usage)
+	if len(over) != 1 || over[0].Resource != "agent" {
+		t.Fatalf("only agents are over quota, got %+v", over)
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	var err error = &QuotaError{QuotaUsage: QuotaUsage{Resource: "agent", Usage: 2, Limit: 2}, label: "agents"}
+	if !errors.Is(err, ErrQuotaExceeded) || err.Error() != "quota exceeded: max agents reached" {
+		t.Fatalf("unexpected quota error: %v", err)
+	}
+	var quota *QuotaError
+	if !errors.As(err, &quota) || quota.Usage != 2 || quota.Limit != 2 {
+		t.Fatalf("quota error should carry the usage and limit: %+v", quota)
+	}
+}
+
+func TestFreeEntitlementsMatchColumnDefaults(t *testing.T) {
+	// Accounts without an entitlements row must get what a new row would hold
+	free := freeEntitlements(7)
+	if free.AccountID != 7 || !free.KanbanEnabled {
+		t.Fatalf("an account without a row should keep Kanban: %+v", free)
+	}
+
+	value := reflect.ValueOf(free)
+	fields := value.Type()
+	for i := 0; i < fields.NumField(); i++ {
+		for _, setting := range strings.Split(fields.Field(i).Tag.Get("gorm"), ";") {
+			def, ok := strings.CutPrefix(setting, "default:")
+			if !ok {
+				continue
+			}
+			if got := fmt.Sprint(value.Field(i).Interface()); got != def {
+				t.Fatalf("%s falls back to %s, the column default is %s", fields.Field(i).Name, got, def)
+			}
+		}
+	}
+}
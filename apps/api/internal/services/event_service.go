@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/webhooks"
+)
+
+const (
+	// eventRetryBase is the delay before the first retry; it doubles on every attempt
+	eventRetryBase = 30 * time.Second
+	// eventRetryMax caps the backoff delay
+	eventRetryMax = time.Hour
+	// eventStaleAfter is how long an execution may sit in pending/processing before the sweeper re-enqueues it
+	eventStaleAfter = 10 * time.Minute
+)
+
+// EventQueue hands stored executions to the background worker
+type EventQueue interface {
+	EnqueueExecution(ctx context.Context, id uuid.UUID, delay time.Duration) error
+}
+
+// EventHandler processes one stored execution. Returning an error schedules a retry.
+type EventHandler func(ctx context.Context, exec *models.EventExecution) error
+
+// EventService stores inbound webhooks as EventExecutions and drives their processing
+type EventService struct {
+	repo     *repositories.GatewayRepository
+	queue    EventQueue
+	handlers map[string]EventHandler
+}
+
+// NewEventService creates a new EventService
+func NewEventService(repo *repositories.GatewayRepository, queue EventQueue) *EventService {
+	return &EventService{
+		repo:     repo,
+		queue:    queue,
+		handlers: make(map[string]EventHandler),
+	}
+}
+
+// Handle registers the handler for every event type of a source ("chatwoot", "provider", ...)
+func (s *EventService) Handle(source string, handler EventHandler) {
+	s.handlers[source] = handler
+}
+
+// Record stores an inbound webhook and enqueues it for processing.
+// The body must be a JSON object; it is kept verbatim as the execution payload.
+func (s *EventService) Record(ctx context.Context, eventType string, accountID int, providerID *uuid.UUID, body []byte) (*models.EventExecution, error) {
+	var payload models.JSON
+	if err := json.Unmarshal(body, &payload); err != nil || payload == nil {
+		return nil, webhooks.ErrInvalidPayload
+	}
+
+	exec := &models.EventExecution{
+		AccountID:  accountID,
+		ProviderID: providerID,
+		EventType:  eventType,
+		Payload:    payload,
+		Status:     models.EventStatusPending,
+		MaxRetries: 3,
+	}
+	if err := s.repo.CreateExecution(ctx, exec); err != nil {
+		return nil, fmt.Errorf("failed to store event: %w", err)
+	}
+
+	// The event is durable at this point; if enqueueing fails the sweeper picks it up
+	if err := s.queue.EnqueueExecution(ctx, exec.ID, 0); err != nil {
+		log.Printf("Failed to enqueue execution %s: %v", exec.ID, err)
+	}
+
+	return exec, nil
+}
+
+// Process runs the handler of a stored execution and records the outcome.
+// Handler failures are retried with exponential backoff and dead-lettered after MaxRetries;
+// only infrastructure errors are returned.
+func (s *EventService) Process(ctx context.Context, id uuid.UUID) error {
+	claimed, err := s.repo.ClaimExecution(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil // Already processed or being processed elsewhere
+	}
+
+	exec, err := s.repo.FindExecutionByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	handler, ok := s.handlers[eventSource(exec.EventType)]
+	if !ok {
+		return s.repo.UpdateExecutionStatus(ctx, id, models.EventStatusDead, "no handler for event type "+exec.EventType)
+	}
+
+	if handlerErr := handler(ctx, exec); handlerErr != nil {
+		return s.fail(ctx, exec, handlerErr)
+	}
+
+	return s.repo.UpdateExecutionStatus(ctx, id, models.EventStatusSuccess, "")
+}
+
+// fail schedules the next attempt or moves the execution to the dead-letter state
+func (s *EventService) fail(ctx context.Context, exec *models.EventExecution, handlerErr error) error {
+	if exec.Retries >= exec.MaxRetries {
+		log.Printf("Execution %s (%s) dead-lettered after %d retries: %v", exec.ID, exec.EventType, exec.Retries, handlerErr)
+		return s.repo.UpdateExecutionStatus(ctx, exec.ID, models.EventStatusDead, handlerErr.Error())
+	}
+
+	delay := retryBackoff(exec.Retries)
+	if err := s.repo.ScheduleExecutionRetry(ctx, exec.ID, time.Now().Add(delay), handlerErr.Error()); err != nil {
+		return err
+	}
+
+	if err := s.queue.EnqueueExecution(ctx, exec.ID, delay); err != nil {
+		log.Printf("Failed to enqueue retry of execution %s: %v", exec.ID, err)
+	}
+	return nil
+}
+
+// SweepPending re-enqueues executions whose retry is due or that got stuck
+func (s *EventService) SweepPending(ctx context.Context) (int, error) {
+	due, err := s.repo.GetPendingRetries(ctx, 500)
+	if err != nil {
+		return 0, err
+	}
+
+	stale, err := s.repo.GetStaleExecutions(ctx, time.Now().Add(-eventStaleAfter), 500)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, exec := range stale {
+		if exec.Status == models.EventStatusProcessing {
+			if err := s.repo.ReleaseExecution(ctx, exec.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	count := 0
+	for _, exec := range append(due, stale...) {
+		if err := s.queue.EnqueueExecution(ctx, exec.ID, 0); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ListExecutions returns the executions of an account with pagination
+func (s *EventService) ListExecutions(ctx context.Context, accountID int, filters map[string]interface{}, page, limit int) ([]models.EventExecution, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	return s.repo.ListExecutions(ctx, accountID, filters, limit, (page-1)*limit)
+}
+
+// GetExecution returns an execution with its payload
+func (s *EventService) GetExecution(ctx context.Context, accountID int, id uuid.UUID) (*models.EventExecution, error) {
+	return s.repo.FindExecutionForAccount(ctx, id, accountID)
+}
+
+var (
+	// ErrExecutionInProgress is returned when replaying an execution that has not finished
+	ErrExecutionInProgress = errors.New("execution is still being processed")
+	// ErrExecutionSucceeded is returned when replaying an execution that was processed.
+	// Handlers are not idempotent: a replay would post and send its messages again.
+	ErrExecutionSucceeded = errors.New("only failed executions can be replayed")
+)
+
+// Replay resets a failed (retry or dead) execution and processes it again
+func (s *EventService) Replay(ctx context.Context, accountID int, id uuid.UUID) (*models.EventExecution, error) {
+	exec, err := s.repo.FindExecutionForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := replayable(exec.Status); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ResetExecution(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.queue.EnqueueExecution(ctx, id, 0); err != nil {
+		return nil, fmt.Errorf("failed to enqueue replay: %w", err)
+	}
+
+	return s.repo.FindExecutionForAccount(ctx, id, accountID)
+}
+
+// replayable tells whether an execution in a status may be replayed
+func replayable(status string) error {
+	switch status {
+	case models.EventStatusRetry, models.EventStatusDead:
+		return nil
+	case models.EventStatusPending, models.EventStatusProcessing:
+		return ErrExecutionInProgress
+	}
+	return ErrExecutionSucceeded
+}
+
+// PayloadBytes returns the stored payload as JSON for handlers that parse raw webhooks
+func PayloadBytes(exec *models.EventExecution) ([]byte, error) {
+	return json.Marshal(exec.Payload)
+}
+
+// eventSource returns the source prefix of an event type ("chatwoot.message_created" -> "chatwoot")
+func eventSource(eventType string) string {
+	if i := strings.Index(eventType, "."); i >= 0 {
+		return eventType[:i]
+	}
+	return eventType
+}
+
+// retryBackoff returns the delay before the next attempt: 30s, 1m, 2m, 4m ... capped at 1h
+func retryBackoff(retries int) time.Duration {
+	delay := eventRetryBase
+	for i := 0; i < retries; i++ {
+		delay *= 2
+		if delay >= eventRetryMax {
+			return eventRetryMax
+		}
+	}
+	return delay
+}
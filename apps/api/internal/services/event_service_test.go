@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  time.Minute,
+		3:  4 * time.Minute,
+		20: time.Hour,
+	}
+	for retries, want := range cases {
+		if got := retryBackoff(retries); got != want {
+			t.Fatalf("retryBackoff(%d) = %s, want %s", retries, got, want)
+		}
+	}
+}
+
+func TestEventSource(t *testing.T) {
+	if got := eventSource("chatwoot.message_created"); got != "chatwoot" {
+		t.Fatalf("eventSource = %q, want chatwoot", got)
+	}
+	if got := eventSource("billing"); got != "billing" {
+		t.Fatalf("eventSource = %q, want billing", got)
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	cases := map[string]error{
+		models.EventStatusDead:       nil,
+		models.EventStatusRetry:      nil,
+		models.EventStatusPending:    ErrExecutionInProgress,
+		models.EventStatusProcessing: ErrExecutionInProgress,
+		models.EventStatusSuccess:    ErrExecutionSucceeded,
+	}
+	for status, want := range cases {
+		if got := replayable(status); !errors.Is(got, want) {
+			t.Fatalf("replayable(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -2,59 +2,453 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/providers"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/chatwoot"
+	"whatpro-hub/pkg/webhooks"
 )
 
 // GatewayService handles message routing and event processing
 type GatewayService struct {
-	repo         *repositories.GatewayRepository
-	providerRepo *repositories.ProviderRepository
-	accountRepo  *repositories.AccountRepository
-	// TODO: Add ChatwootClient here
+	repo            *repositories.GatewayRepository
+	providerRepo    *repositories.ProviderRepository
+	inboxRepo       *repositories.InboxRepository
+	accountRepo     *repositories.AccountRepository
+	providerService *ProviderService
+	chatwoot        *chatwoot.Client
 }
 
 // NewGatewayService creates a new GatewayService
-func NewGatewayService(repo *repositories.GatewayRepository, providerRepo *repositories.ProviderRepository, accountRepo *repositories.AccountRepository) *GatewayService {
+func NewGatewayService(repo *repositories.GatewayRepository, providerRepo *repositories.ProviderRepository, inboxRepo *repositories.InboxRepository, accountRepo *repositories.AccountRepository, providerService *ProviderService, chatwootClient *chatwoot.Client) *GatewayService {
 	return &GatewayService{
-		repo:         repo,
-		providerRepo: providerRepo,
-		accountRepo:  accountRepo,
+		repo:            repo,
+		providerRepo:    providerRepo,
+		inboxRepo:       inboxRepo,
+		accountRepo:     accountRepo,
+		providerService: providerService,
+		chatwoot:        chatwootClient,
 	}
 }
 
-// ProcessEvolutionWebhook handles incoming webhooks from Evolution API
-func (s *GatewayService) ProcessEvolutionWebhook(ctx context.Context, instanceToken string, payload models.JSON) error {
-	// 1. Log receipt (Idempotency key could be added here)
-	exec := &models.EventExecution{
-		EventType: "evolution.webhook",
-		Payload:   payload,
-		Status:    "pending",
-		StartedAt: nowPtr(),
+// ProcessProviderWebhook handles a stored webhook from any WhatsApp provider
+func (s *GatewayService) ProcessProviderWebhook(ctx context.Context, provider *models.Provider, body []byte) error {
+	// Parsing needs no credentials
+	driver, err := providers.ForProvider(provider, "")
+	if err != nil {
+		return err
+	}
+
+	events, err := driver.ParseWebhook(body)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		switch event.Kind {
+		case providers.EventMessage:
+			err = s.handleInboundMessage(ctx, provider, event.Message)
+		case providers.EventStatus:
+			err = s.handleStatusUpdate(ctx, provider, event.Status)
+		case providers.EventConnection:
+			err = s.providerRepo.UpdateHealthCheck(ctx, provider.ID, string(event.State))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyProviderWebhook checks the credentials of a webhook against the
+// provider's API key; a mismatch is providers.ErrInvalidWebhook
+func (s *GatewayService) VerifyProviderWebhook(ctx context.Context, provider *models.Provider, header http.Header, body []byte) error {
+	_, driver, err := s.providerService.Driver(ctx, provider.AccountID, provider.ID)
+	if err != nil {
+		return err
+	}
+	return driver.VerifyWebhook(header, body)
+}
+
+// ResolveProvider finds the provider addressed by a webhook URL.
+// instanceID is either the provider UUID or its instance name.
+func (s *GatewayService) ResolveProvider(ctx context.Context, instanceID string) (*models.Provider, error) {
+	if id, err := uuid.Parse(instanceID); err == nil {
+		return s.providerRepo.FindByID(ctx, id)
+	}
+	return s.providerRepo.FindByInstanceName(ctx, instanceID)
+}
+
+// handleInboundMessage posts an inbound WhatsApp message into Chatwoot
+func (s *GatewayService) handleInboundMessage(ctx context.Context, provider *models.Provider, msg *providers.InboundMessage) error {
+	if msg.ID == "" || msg.ChatID == "" || webhooks.IsGroupJID(msg.ChatID) || msg.Text == "" {
+		return nil
 	}
-	
-	if err := s.repo.CreateExecution(ctx, exec); err != nil {
-		return fmt.Errorf("failed to log execution: %w", err)
+
+	// Idempotency: providers retry deliveries and echo messages we sent ourselves
+	if _, err := s.repo.FindMappingByWAID(ctx, provider.ID, msg.ID); err == nil {
+		return nil
+	} else if !errors.Is(err, repositories.ErrMappingNotFound) {
+		return err
 	}
 
-	// 2. Identify Provider/Account by Instance Token (or Name)
-	// In Evolution, the instance name is often in the payload or URL
-	// For now assuming we find it via token or lookup
-	
-	// Mock processing logic for now
-	// In real impl, we specific switch case for event type (message, status, etc.)
-	
-	// 3. Mark success
-	if err := s.repo.UpdateExecutionStatus(ctx, exec.ID, "success", ""); err != nil {
+	inboxID, err := s.providerInboxID(ctx, provider)
+	if err != nil {
 		return err
 	}
+	if inboxID == 0 {
+		return fmt.Errorf("provider %s is not bound to a Chatwoot inbox", provider.ID)
+	}
+
+	phone := webhooks.PhoneFromJID(msg.ChatID)
+	name := msg.PushName
+	if name == "" || msg.FromMe {
+		name = phone
+	}
+
+	contact, sourceID, err := s.findOrCreateContact(ctx, provider.AccountID, inboxID, phone, name, msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve contact: %w", err)
+	}
+
+	conversationID, err := s.findOrCreateConversation(ctx, provider.AccountID, inboxID, contact.ID, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve conversation: %w", err)
+	}
+
+	// Messages sent from the phone itself show up as agent replies
+	messageType := "incoming"
+	if msg.FromMe {
+		messageType = "outgoing"
+	}
+
+	created, err := s.chatwoot.CreateMessage(ctx, provider.AccountID, conversationID, chatwoot.CreateMessageRequest{
+		Content:     msg.Text,
+		MessageType: messageType,
+		SourceID:    msg.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to post message to chatwoot: %w", err)
+	}
+
+	return s.repo.CreateMapping(ctx, &models.MessageMapping{
+		AccountID:              provider.AccountID,
+		ProviderID:             provider.ID,
+		ChatwootMessageID:      &created.ID,
+		ChatwootConversationID: &conversationID,
+		WAMessageID:            msg.ID,
+		WAConversationID:       msg.ChatID,
+		Direction:              "p2c",
+		Status:                 providers.StatusDelivered,
+	})
+}
+
+// handleStatusUpdate records delivery receipts on the message mapping
+func (s *GatewayService) handleStatusUpdate(ctx context.Context, provider *models.Provider, update *providers.StatusUpdate) error {
+	if update.MessageID == "" {
+		return nil
+	}
+
+	mapping, err := s.repo.FindMappingByWAID(ctx, provider.ID, update.MessageID)
+	if errors.Is(err, repositories.ErrMappingNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Receipts can arrive out of order; never downgrade read to delivered
+	if messageStatusRank(update.Status) <= messageStatusRank(mapping.Status) {
+		return nil
+	}
+
+	if err := s.repo.UpdateMappingStatus(ctx, provider.ID, update.MessageID, update.Status); err != nil {
+		return err
+	}
+
+	// Mirror receipts of agent replies back to Chatwoot
+	if mapping.Direction == "c2p" && mapping.ChatwootMessageID != nil && mapping.ChatwootConversationID != nil {
+		if err := s.chatwoot.UpdateMessageStatus(ctx, mapping.AccountID, *mapping.ChatwootConversationID, *mapping.ChatwootMessageID, update.Status, ""); err != nil {
+			log.Printf("Failed to mirror status of message %d to chatwoot: %v", *mapping.ChatwootMessageID, err)
+		}
+	}
 
 	return nil
 }
 
+// RelayChatwootMessage sends an agent reply from a provider-linked inbox to WhatsApp
+func (s *GatewayService) RelayChatwootMessage(ctx context.Context, accountID int, payload *webhooks.MessageCreatedPayload) error {
+	if payload.MessageType != webhooks.MessageTypeOutgoing || payload.Private {
+		return nil
+	}
+
+	// Messages carrying a source ID were posted by the gateway and are already on WhatsApp
+	if payload.SourceID != "" {
+		return nil
+	}
+
+	if payload.AccountID != 0 {
+		accountID = payload.AccountID
+	}
+
+	// Messages we posted ourselves (p2c echoes) must not bounce back to WhatsApp.
+	// A failed c2p mapping is reused so that retries resend the message.
+	mapping, err := s.repo.FindMappingByCWID(ctx, payload.ID)
+	if err == nil && !(mapping.Direction == "c2p" && mapping.Status == providers.StatusFailed) {
+		return nil
+	} else if err != nil && !errors.Is(err, repositories.ErrMappingNotFound) {
+		return err
+	}
+
+	provider, err := s.providerRepo.FindByChatwootInbox(ctx, accountID, payload.InboxID)
+	if errors.Is(err, repositories.ErrProviderNotFound) {
+		return nil // Inbox is not served by a WhatsApp provider
+	}
+	if err != nil {
+		return err
+	}
+
+	// Reply to the same chat the conversation came from, falling back to the contact phone
+	to := payload.Contact.PhoneNumber
+	if last, err := s.repo.FindLatestMappingByConversation(ctx, accountID, provider.ID, payload.ConversationID); err == nil {
+		to = last.WAConversationID
+	}
+	if to == "" {
+		return fmt.Errorf("conversation %d has no WhatsApp destination", payload.ConversationID)
+	}
+
+	_, driver, err := s.providerService.Driver(ctx, provider.AccountID, provider.ID)
+	if err != nil {
+		return err
+	}
+
+	retry := mapping != nil
+	if !retry {
+		mapping = &models.MessageMapping{
+			AccountID:              accountID,
+			ProviderID:             provider.ID,
+			ChatwootMessageID:      &payload.ID,
+			ChatwootConversationID: &payload.ConversationID,
+			Direction:              "c2p",
+		}
+	}
+	mapping.WAConversationID = to
+	mapping.Status = providers.StatusSent
+	mapping.ErrorMessage = ""
+
+	waMessageID, sendErr := sendChatwootMessage(ctx, driver, to, payload)
+	if sendErr != nil {
+		mapping.Status = providers.StatusFailed
+		mapping.ErrorMessage = sendErr.Error()
+		if err := s.chatwoot.UpdateMessageStatus(ctx, accountID, payload.ConversationID, payload.ID, providers.StatusFailed, sendErr.Error()); err != nil {
+			log.Printf("Failed to mark message %d as failed in chatwoot: %v", payload.ID, err)
+		}
+	}
+	mapping.WAMessageID = waMessageID
+
+	if retry {
+		err = s.repo.UpdateMapping(ctx, mapping)
+	} else {
+		err = s.repo.CreateMapping(ctx, mapping)
+	}
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// SendConversationText sends a text message to the WhatsApp chat of a Chatwoot conversation
+// through the provider that last carried it, and posts a copy into the conversation.
+func (s *GatewayService) SendConversationText(ctx context.Context, accountID, conversationID int, text string) error {
+	last, err := s.repo.FindLatestMappingByConversation(ctx, accountID, uuid.Nil, conversationID)
+	if errors.Is(err, repositories.ErrMappingNotFound) {
+		return fmt.Errorf("conversation %d has no WhatsApp destination", conversationID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, driver, err := s.providerService.Driver(ctx, accountID, last.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	waMessageID, err := driver.SendText(ctx, last.WAConversationID, text)
+	if err != nil {
+		return err
+	}
+
+	mapping := &models.MessageMapping{
+		AccountID:              accountID,
+		ProviderID:             last.ProviderID,
+		ChatwootConversationID: &conversationID,
+		WAMessageID:            waMessageID,
+		WAConversationID:       last.WAConversationID,
+		Direction:              "c2p",
+		Status:                 providers.StatusSent,
+	}
+	if err := s.repo.CreateMapping(ctx, mapping); err != nil {
+		return err
+	}
+
+	// The source ID keeps the relay from sending the copy a second time
+	created, err := s.chatwoot.CreateMessage(ctx, accountID, conversationID, chatwoot.CreateMessageRequest{
+		Content:     text,
+		MessageType: "outgoing",
+		SourceID:    waMessageID,
+	})
+	if err != nil {
+		log.Printf("Message %s sent but not posted to conversation %d: %v", waMessageID, conversationID, err)
+		return nil
+	}
+
+	mapping.ChatwootMessageID = &created.ID
+	return s.repo.UpdateMapping(ctx, mapping)
+}
+
+// sendChatwootMessage sends the content and attachments of a Chatwoot message.
+// The returned ID is the one of the last WhatsApp message sent.
+func sendChatwootMessage(ctx context.Context, driver providers.ProviderDriver, to string, payload *webhooks.MessageCreatedPayload) (string, error) {
+	if len(payload.Attachments) == 0 {
+		return driver.SendText(ctx, to, payload.Content)
+	}
+
+	var waMessageID string
+	for i, att := range payload.Attachments {
+		media := providers.Media{
+			Type:     attachmentMediaType(att.FileType),
+			URL:      att.DataURL,
+			FileName: att.FileName,
+		}
+		// The text goes out as the caption of the first attachment
+		if i == 0 {
+			media.Caption = payload.Content
+		}
+
+		id, err := driver.SendMedia(ctx, to, media)
+		if err != nil {
+			return waMessageID, err
+		}
+		waMessageID = id
+	}
+	return waMessageID, nil
+}
+
+// findOrCreateContact returns the Chatwoot contact for a phone number and its source ID in the inbox
+func (s *GatewayService) findOrCreateContact(ctx context.Context, accountID, inboxID int, phone, name, identifier string) (*chatwoot.Contact, string, error) {
+	contacts, err := s.chatwoot.SearchContacts(ctx, accountID, phone)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range contacts {
+		contact := &contacts[i]
+		if contact.PhoneNumber != phone && contact.Identifier != identifier {
+			continue
+		}
+		for _, ci := range contact.ContactInboxes {
+			if ci.Inbox.ID == inboxID {
+				return contact, ci.SourceID, nil
+			}
+		}
+
+		ci, err := s.chatwoot.CreateContactInbox(ctx, accountID, contact.ID, inboxID, "")
+		if err != nil {
+			return nil, "", err
+		}
+		return contact, ci.SourceID, nil
+	}
+
+	contact, ci, err := s.chatwoot.CreateContact(ctx, accountID, chatwoot.CreateContactRequest{
+		InboxID:     inboxID,
+		Name:        name,
+		PhoneNumber: phone,
+		Identifier:  identifier,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return contact, ci.SourceID, nil
+}
+
+// findOrCreateConversation reuses the contact's unresolved conversation in the inbox or opens a new one
+func (s *GatewayService) findOrCreateConversation(ctx context.Context, accountID, inboxID, contactID int, sourceID string) (int, error) {
+	conversations, err := s.chatwoot.ListContactConversations(ctx, accountID, contactID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, conv := range conversations {
+		if conv.InboxID == inboxID && conv.Status != "resolved" {
+			return conv.ID, nil
+		}
+	}
+
+	conv, err := s.chatwoot.CreateConversation(ctx, accountID, chatwoot.CreateConversationRequest{
+		SourceID:  sourceID,
+		InboxID:   inboxID,
+		ContactID: contactID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return conv.ID, nil
+}
+
+// providerInboxID returns the Chatwoot inbox a provider is bound to, falling
+// back to metadata.chatwoot_inbox_id for providers configured before the binding
+func (s *GatewayService) providerInboxID(ctx context.Context, provider *models.Provider) (int, error) {
+	inbox, err := s.inboxRepo.FindByProvider(ctx, provider.ID)
+	if err == nil {
+		return inbox.ChatwootID, nil
+	}
+	if !errors.Is(err, repositories.ErrInboxNotFound) {
+		return 0, err
+	}
+
+	switch v := provider.Metadata["chatwoot_inbox_id"].(type) {
+	case float64:
+		return int(v), nil
+	case string:
+		id, _ := strconv.Atoi(v)
+		return id, nil
+	}
+	return 0, nil
+}
+
+// attachmentMediaType maps Chatwoot file types to WhatsApp media types
+func attachmentMediaType(fileType string) string {
+	switch fileType {
+	case "image", "video", "audio":
+		return fileType
+	}
+	return "document"
+}
+
+// messageStatusRank orders mapping statuses so receipts only move forward
+func messageStatusRank(status string) int {
+	switch status {
+	case providers.StatusSent:
+		return 1
+	case providers.StatusDelivered:
+		return 2
+	case providers.StatusRead:
+		return 3
+	case providers.StatusFailed:
+		return 4
+	}
+	return 0
+}
+
 // Helper
 func nowPtr() *time.Time {
 	t := time.Now()
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+// ErrProviderAlreadyBound is returned when binding a provider that serves another inbox
+var ErrProviderAlreadyBound = errors.New("provider already serves another inbox")
+
+// legacyInboxKey is the provider metadata that named its inbox before inboxes were synced
+const legacyInboxKey = "chatwoot_inbox_id"
+
+// InboxService manages the synced Chatwoot inboxes and the provider serving each one
+type InboxService struct {
+	repo      *repositories.InboxRepository
+	providers *repositories.ProviderRepository
+}
+
+// NewInboxService creates a new InboxService
+func NewInboxService(repo *repositories.InboxRepository, providers *repositories.ProviderRepository) *InboxService {
+	return &InboxService{repo: repo, providers: providers}
+}
+
+// ListInboxes returns the inboxes of an account with their provider
+func (s *InboxService) ListInboxes(ctx context.Context, accountID int) ([]models.Inbox, error) {
+	return s.repo.FindAll(ctx, accountID)
+}
+
+// BindProvider makes a provider of the account serve an inbox, replacing the
+// provider that served it before, which is returned
+func (s *InboxService) BindProvider(ctx context.Context, accountID int, inboxID uint, providerID uuid.UUID) (*models.Inbox, *uuid.UUID, error) {
+	inbox, err := s.repo.FindByIDForAccount(ctx, inboxID, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := s.providers.FindByIDForAccount(ctx, providerID, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bound, err := s.repo.FindByProvider(ctx, providerID)
+	if err == nil && bound.ID != inbox.ID {
+		return nil, nil, ErrProviderAlreadyBound
+	}
+	if err != nil && !errors.Is(err, repositories.ErrInboxNotFound) {
+		return nil, nil, err
+	}
+
+	// The check above races with concurrent binds; the unique index settles them
+	if err := s.repo.SetProvider(ctx, inbox.ID, &providerID); err != nil {
+		if errors.Is(err, repositories.ErrProviderInUse) {
+			return nil, nil, ErrProviderAlreadyBound
+		}
+		return nil, nil, err
+	}
+	if err := s.clearLegacyInbox(ctx, provider); err != nil {
+		return nil, nil, err
+	}
+
+	previous := inbox.ProviderID
+	inbox.ProviderID = &providerID
+	inbox.Provider = provider
+	return inbox, previous, nil
+}
+
+// UnbindProvider stops routing an inbox through WhatsApp and returns the provider that served it
+func (s *InboxService) UnbindProvider(ctx context.Context, accountID int, inboxID uint) (*models.Inbox, *uuid.UUID, error) {
+	inbox, err := s.repo.FindByIDForAccount(ctx, inboxID, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inbox.ProviderID == nil {
+		return inbox, nil, nil
+	}
+
+	if err := s.repo.SetProvider(ctx, inbox.ID, nil); err != nil {
+		return nil, nil, err
+	}
+	provider, err := s.providers.FindByIDForAccount(ctx, *inbox.ProviderID, accountID)
+	if err == nil {
+		err = s.clearLegacyInbox(ctx, provider)
+	}
+	if err != nil && !errors.Is(err, repositories.ErrProviderNotFound) {
+		return nil, nil, err
+	}
+
+	previous := inbox.ProviderID
+	inbox.ProviderID = nil
+	return inbox, previous, nil
+}
+
+// clearLegacyInbox drops the inbox named in the provider metadata, so only the
+// binding routes the provider from now on
+func (s *InboxService) clearLegacyInbox(ctx context.Context, provider *models.Provider) error {
+	if _, ok := provider.Metadata[legacyInboxKey]; !ok {
+		return nil
+	}
+	delete(provider.Metadata, legacyInboxKey)
+	return s.providers.Update(ctx, provider)
+}
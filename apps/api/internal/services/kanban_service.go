@@ -2,21 +2,33 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/realtime"
 	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/webhooks"
 )
 
 // KanbanService handles kanban business logic
 type KanbanService struct {
-	repo *repositories.KanbanRepository
+	repo         *repositories.KanbanRepository
+	events       *EventService
+	hub          realtime.Publisher
+	entitlements *EntitlementsService
 }
 
-// NewKanbanService creates a new kanban service
-func NewKanbanService(repo *repositories.KanbanRepository) *KanbanService {
-	return &KanbanService{repo: repo}
+// NewKanbanService creates a new kanban service.
+// Stage transitions are recorded through events so the worker can run stage AutoActions;
+// card changes are pushed to connected clients through hub.
+// Boards are only created for accounts whose plan includes Kanban when entitlements is set.
+func NewKanbanService(repo *repositories.KanbanRepository, events *EventService, hub realtime.Publisher, entitlements *EntitlementsService) *KanbanService {
+	return &KanbanService{repo: repo, events: events, hub: hub, entitlements: entitlements}
 }
 
 // =========================================================================
@@ -25,6 +37,11 @@ func NewKanbanService(repo *repositories.KanbanRepository) *KanbanService {
 
 // CreateBoard creates a new board
 func (s *KanbanService) CreateBoard(ctx context.Context, board *models.Board) error {
+	if s.entitlements != nil {
+		if err := s.entitlements.RequireFeature(ctx, board.AccountID, FeatureKanban); err != nil {
+			return err
+		}
+	}
 	if board.Settings == nil {
 		board.Settings = models.JSON{}
 	}
@@ -83,7 +100,10 @@ func (s *KanbanService) CreateStage(ctx context.Context, accountID int, stage *m
 	}
 	// TODO: Calculate position (append to end) if not provided
 	if stage.AutoActions == nil {
-		stage.AutoActions = models.JSON{} // Empty list default
+		stage.AutoActions = models.StageActions{} // Empty list default
+	}
+	if err := ValidateStageActions(stage.AutoActions); err != nil {
+		return err
 	}
 	return s.repo.CreateStage(ctx, stage)
 }
@@ -105,6 +125,13 @@ func (s *KanbanService) UpdateStage(ctx context.Context, accountID int, id uuid.
 		slaInt := int(sla)
 		stage.SLAHours = &slaInt
 	}
+	if raw, ok := updates["auto_actions"]; ok {
+		actions, err := decodeStageActions(raw)
+		if err != nil {
+			return err
+		}
+		stage.AutoActions = actions
+	}
 
 	return s.repo.UpdateStage(ctx, stage)
 }
@@ -135,14 +162,24 @@ func (s *KanbanService) DeleteStage(ctx context.Context, accountID int, id uuid.
 
 // CreateCard creates a new card
 func (s *KanbanService) CreateCard(ctx context.Context, accountID int, card *models.Card) error {
-	if _, err := s.repo.GetStageForAccount(ctx, card.StageID, accountID); err != nil {
+	stage, err := s.repo.GetStageForAccount(ctx, card.StageID, accountID)
+	if err != nil {
 		return err
 	}
 	// Set defaults
 	if card.Priority == "" {
 		card.Priority = "medium"
 	}
-	return s.repo.CreateCard(ctx, card)
+	if err := s.repo.CreateCard(ctx, card); err != nil {
+		return err
+	}
+
+	if err := s.enterStage(ctx, accountID, card.ID, nil, card.StageID, nil); err != nil {
+		return err
+	}
+
+	s.publishCard(ctx, accountID, realtime.EventCardCreated, stage.BoardID, card, nil)
+	return nil
 }
 
 // GetCard returns a card by ID
@@ -151,23 +188,42 @@ func (s *KanbanService) GetCard(ctx context.Context, accountID int, id uuid.UUID
 }
 
 // MoveCard moves a card to a new stage or position
-func (s *KanbanService) MoveCard(ctx context.Context, accountID int, cardID uuid.UUID, targetStageID uuid.UUID, position int, userID *int) error {
+// Leaving a stage with incomplete required checklist items fails with a
+// *ChecklistIncompleteError unless override is set; the overridden items are returned.
+func (s *KanbanService) MoveCard(ctx context.Context, accountID int, cardID uuid.UUID, targetStageID uuid.UUID, position int, userID *int, override bool) ([]models.ChecklistItem, error) {
 	card, err := s.repo.GetCardForAccount(ctx, cardID, accountID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := s.repo.GetStageForAccount(ctx, targetStageID, accountID); err != nil {
-		return err
+	targetStage, err := s.repo.GetStageForAccount(ctx, targetStageID, accountID)
+	if err != nil {
+		return nil, err
 	}
 
 	originalStageID := card.StageID
+	stageChanged := originalStageID != targetStageID
+
+	var incomplete []models.ChecklistItem
+	if stageChanged {
+		incomplete, err = s.repo.ListIncompleteRequiredItems(ctx, card.ID, originalStageID)
+		if err != nil {
+			return nil, err
+		}
+		if len(incomplete) > 0 && !override {
+			return nil, &ChecklistIncompleteError{StageID: originalStageID, Items: incomplete}
+		}
+	}
 	
-	// Update card
+	// Update card; the SLA clock restarts in the new stage
 	card.StageID = targetStageID
 	card.Position = position
+	if stageChanged {
+		card.SLABreached = false
+		card.SLABreachedAt = nil
+	}
 
 	if err := s.repo.UpdateCard(ctx, card); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Log history
@@ -179,8 +235,25 @@ func (s *KanbanService) MoveCard(ctx context.Context, accountID int, cardID uuid
 		ToStageID:   &targetStageID,
 		CreatedAt:   time.Now(),
 	}
+	if len(incomplete) > 0 {
+		history.Metadata = models.JSON{
+			"checklist_override": true,
+			"incomplete_items":   checklistItemIDs(incomplete),
+		}
+	}
 	
-	return s.repo.LogCardHistory(ctx, history)
+	if err := s.repo.LogCardHistory(ctx, history); err != nil {
+		return nil, err
+	}
+
+	if stageChanged {
+		if err := s.enterStage(ctx, accountID, card.ID, &originalStageID, targetStageID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.publishCard(ctx, accountID, realtime.EventCardMoved, targetStage.BoardID, card, &originalStageID)
+	return incomplete, nil
 }
 
 // UpdateCard updates a card details
@@ -206,7 +279,12 @@ func (s *KanbanService) UpdateCard(ctx context.Context, accountID int, id uuid.U
 		}
 	}
 
-	return s.repo.UpdateCard(ctx, card)
+	if err := s.repo.UpdateCard(ctx, card); err != nil {
+		return err
+	}
+
+	s.publishCardUpdate(ctx, accountID, card)
+	return nil
 }
 
 // DeleteCard deletes a card
@@ -226,11 +304,112 @@ func (s *KanbanService) GetCardDetails(ctx context.Context, accountID int, id uu
 	return s.repo.GetCardWithDetailsForAccount(ctx, id, accountID)
 }
 
-// ToggleChecklistItem toggles the completion status of an item
-func (s *KanbanService) ToggleChecklistItem(ctx context.Context, itemID uuid.UUID, completed bool) error {
-	return s.repo.UpdateChecklist(ctx, itemID, map[string]interface{}{
+// ToggleChecklistItem sets the completion status of an item of a card
+func (s *KanbanService) ToggleChecklistItem(ctx context.Context, accountID int, cardID, itemID uuid.UUID, completed bool) (*models.ChecklistItem, error) {
+	if _, err := s.repo.GetCardForAccount(ctx, cardID, accountID); err != nil {
+		return nil, err
+	}
+
+	item, err := s.repo.GetChecklistItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.CardID == nil || *item.CardID != cardID {
+		return nil, repositories.ErrChecklistItemNotFound
+	}
+
+	if err := s.repo.UpdateChecklist(ctx, itemID, map[string]interface{}{
 		"is_completed": completed,
-	})
+	}); err != nil {
+		return nil, err
+	}
+	item.IsCompleted = completed
+	return item, nil
+}
+
+// ChecklistIncompleteError is returned when a card leaves a stage with
+// required checklist items still open
+type ChecklistIncompleteError struct {
+	StageID uuid.UUID
+	Items   []models.ChecklistItem
+}
+
+func (e *ChecklistIncompleteError) Error() string {
+	return fmt.Sprintf("%d required checklist items are incomplete", len(e.Items))
+}
+
+// ListStageChecklist returns the checklist template of a stage
+func (s *KanbanService) ListStageChecklist(ctx context.Context, accountID int, stageID uuid.UUID) ([]models.ChecklistItem, error) {
+	if _, err := s.repo.GetStageForAccount(ctx, stageID, accountID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListChecklistTemplate(ctx, stageID)
+}
+
+// CreateStageChecklistItem adds an item to the checklist template of a stage
+func (s *KanbanService) CreateStageChecklistItem(ctx context.Context, accountID int, stageID uuid.UUID, item *models.ChecklistItem) error {
+	if _, err := s.repo.GetStageForAccount(ctx, stageID, accountID); err != nil {
+		return err
+	}
+	item.StageID = &stageID
+	item.CardID = nil
+	item.IsCompleted = false
+	return s.repo.AddChecklistItem(ctx, item)
+}
+
+// UpdateStageChecklistItem updates an item of the checklist template of a stage.
+// Cards that already copied the item keep their instance.
+func (s *KanbanService) UpdateStageChecklistItem(ctx context.Context, accountID int, stageID, itemID uuid.UUID, updates map[string]interface{}) (*models.ChecklistItem, error) {
+	item, err := s.getStageTemplateItem(ctx, accountID, stageID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if text, ok := updates["text"].(string); ok {
+		item.Text = text
+		fields["text"] = text
+	}
+	if required, ok := updates["is_required"].(bool); ok {
+		item.IsRequired = required
+		fields["is_required"] = required
+	}
+	if position, ok := updates["position"].(float64); ok { // JSON numbers are float64
+		item.Position = int(position)
+		fields["position"] = int(position)
+	}
+	if len(fields) == 0 {
+		return item, nil
+	}
+
+	if err := s.repo.UpdateChecklist(ctx, itemID, fields); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// DeleteStageChecklistItem removes an item from the checklist template of a stage
+func (s *KanbanService) DeleteStageChecklistItem(ctx context.Context, accountID int, stageID, itemID uuid.UUID) error {
+	if _, err := s.getStageTemplateItem(ctx, accountID, stageID, itemID); err != nil {
+		return err
+	}
+	return s.repo.DeleteChecklistItem(ctx, itemID)
+}
+
+// getStageTemplateItem returns a template item checking that it belongs to the stage
+func (s *KanbanService) getStageTemplateItem(ctx context.Context, accountID int, stageID, itemID uuid.UUID) (*models.ChecklistItem, error) {
+	if _, err := s.repo.GetStageForAccount(ctx, stageID, accountID); err != nil {
+		return nil, err
+	}
+
+	item, err := s.repo.GetChecklistItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.CardID != nil || item.StageID == nil || *item.StageID != stageID {
+		return nil, repositories.ErrChecklistItemNotFound
+	}
+	return item, nil
 }
 
 // SetCardContext sets the B2B company context for a card
@@ -252,3 +431,347 @@ func (s *KanbanService) ListCardsByStage(ctx context.Context, accountID int, sta
 	}
 	return s.repo.ListCardsByStage(ctx, stageID)
 }
+
+// =========================================================================
+// CHATWOOT SYNC SERVICES
+// =========================================================================
+
+// lastMessagePreviewLength caps the message preview stored on a card
+const lastMessagePreviewLength = 255
+
+// SyncConversationCreated creates a card for a new Chatwoot conversation in the
+// first stage of the account's default board. It is a no-op when the account has
+// no default board or the conversation already has a card.
+func (s *KanbanService) SyncConversationCreated(ctx context.Context, accountID int, payload *webhooks.ConversationCreatedPayload) (*models.Card, error) {
+	existing, err := s.findConversationCard(ctx, accountID, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil // Webhook retried or delivered twice
+	}
+
+	board, err := s.repo.GetDefaultBoard(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrBoardNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(board.Stages) == 0 {
+		return nil, nil
+	}
+	stage := board.Stages[0]
+
+	position, err := s.repo.NextCardPosition(ctx, stage.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &models.Card{
+		StageID:                stage.ID,
+		ChatwootConversationID: payload.ID,
+		Title:                  payload.Contact.Name,
+		ContactName:            payload.Contact.Name,
+		ContactAvatarURL:       payload.Contact.Avatar,
+		Priority:               "medium",
+		Position:               position,
+		CustomAttributes:       models.JSON{},
+	}
+	if card.Title == "" {
+		card.Title = fmt.Sprintf("Conversa #%d", payload.ID)
+	}
+	if payload.ContactID > 0 {
+		contactID := payload.ContactID
+		card.ChatwootContactID = &contactID
+	}
+	if payload.AssigneeID > 0 {
+		assigneeID := payload.AssigneeID
+		card.AssigneeID = &assigneeID
+	}
+	if n := len(payload.Messages); n > 0 {
+		last := payload.Messages[n-1]
+		card.LastMessage = previewText(last.Content)
+		if !last.CreatedAt.IsZero() {
+			card.LastMessageAt = &last.CreatedAt
+		}
+	}
+
+	if err := s.repo.CreateCard(ctx, card); err != nil {
+		return nil, err
+	}
+
+	history := &models.CardHistory{
+		CardID:    card.ID,
+		Action:    "created",
+		ToStageID: &stage.ID,
+		Metadata: models.JSON{
+			"source":          "chatwoot",
+			"conversation_id": payload.ID,
+		},
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.LogCardHistory(ctx, history); err != nil {
+		return nil, err
+	}
+
+	if err := s.enterStage(ctx, accountID, card.ID, nil, stage.ID, nil); err != nil {
+		return nil, err
+	}
+
+	s.publishCard(ctx, accountID, realtime.EventCardCreated, board.ID, card, nil)
+	return card, nil
+}
+
+// SyncMessageCreated updates the message preview of the conversation's card.
+// Private notes and activity messages are ignored.
+func (s *KanbanService) SyncMessageCreated(ctx context.Context, accountID int, payload *webhooks.MessageCreatedPayload) error {
+	if payload.Private || payload.MessageType == webhooks.MessageTypeActivity {
+		return nil
+	}
+
+	card, err := s.findConversationCard(ctx, accountID, payload.ConversationID)
+	if err != nil || card == nil {
+		return err
+	}
+
+	content := payload.Content
+	if content == "" && len(payload.Attachments) > 0 {
+		content = "[anexo]"
+	}
+
+	sentAt := payload.CreatedAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+	if card.LastMessageAt != nil && card.LastMessageAt.After(sentAt) {
+		return nil // Out of order delivery; keep the newer preview
+	}
+
+	card.LastMessage = previewText(content)
+	card.LastMessageAt = &sentAt
+	if err := s.repo.UpdateCardFields(ctx, card.ID, map[string]interface{}{
+		"last_message":    card.LastMessage,
+		"last_message_at": sentAt,
+	}); err != nil {
+		return err
+	}
+
+	s.publishCardUpdate(ctx, accountID, card)
+	return nil
+}
+
+// SyncConversationStatus moves the conversation's card to the stage configured
+// for the new status in the board settings, e.g.
+// {"status_stages": {"resolved": "<stage uuid>"}}
+func (s *KanbanService) SyncConversationStatus(ctx context.Context, accountID, conversationID int, status string) error {
+	card, err := s.findConversationCard(ctx, accountID, conversationID)
+	if err != nil || card == nil {
+		return err
+	}
+
+	stage, err := s.repo.GetStageForAccount(ctx, card.StageID, accountID)
+	if err != nil {
+		return err
+	}
+	board, err := s.repo.GetBoardForAccount(ctx, stage.BoardID, accountID)
+	if err != nil {
+		return err
+	}
+
+	statusStages, _ := board.Settings["status_stages"].(map[string]interface{})
+	target, _ := statusStages[status].(string)
+	targetID, err := uuid.Parse(target)
+	if err != nil || targetID == card.StageID {
+		return nil // Status not mapped or card already there
+	}
+
+	targetStage, err := s.repo.GetStageForAccount(ctx, targetID, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrStageNotFound) {
+			return nil // Stale mapping; the stage was removed
+		}
+		return err
+	}
+	if targetStage.BoardID != board.ID {
+		return nil
+	}
+
+	// Required checklist items hold the card as they do for MoveCard; the
+	// blocked move is kept in the card history instead
+	fromStageID := card.StageID
+	incomplete, err := s.repo.ListIncompleteRequiredItems(ctx, card.ID, fromStageID)
+	if err != nil {
+		return err
+	}
+	if len(incomplete) > 0 {
+		return s.repo.LogCardHistory(ctx, &models.CardHistory{
+			CardID:      card.ID,
+			Action:      "move_blocked",
+			FromStageID: &fromStageID,
+			ToStageID:   &targetID,
+			Metadata: models.JSON{
+				"source":           "chatwoot",
+				"conversation_id":  conversationID,
+				"status":           status,
+				"incomplete_items": checklistItemIDs(incomplete),
+			},
+			CreatedAt: time.Now(),
+		})
+	}
+
+	position, err := s.repo.NextCardPosition(ctx, targetID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateCardFields(ctx, card.ID, map[string]interface{}{
+		"stage_id":        targetID,
+		"position":        position,
+		"sla_breached":    false,
+		"sla_breached_at": nil,
+	}); err != nil {
+		return err
+	}
+
+	history := &models.CardHistory{
+		CardID:      card.ID,
+		Action:      "moved",
+		FromStageID: &fromStageID,
+		ToStageID:   &targetID,
+		Metadata: models.JSON{
+			"source":          "chatwoot",
+			"conversation_id": conversationID,
+			"status":          status,
+		},
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.LogCardHistory(ctx, history); err != nil {
+		return err
+	}
+
+	if err := s.enterStage(ctx, accountID, card.ID, &fromStageID, targetID, nil); err != nil {
+		return err
+	}
+
+	card.StageID = targetID
+	card.Position = position
+	card.SLABreached = false
+	card.SLABreachedAt = nil
+	s.publishCard(ctx, accountID, realtime.EventCardMoved, board.ID, card, &fromStageID)
+	return nil
+}
+
+// enterStage copies the checklist template of the stage onto a card that just
+// entered it and queues the stage AutoActions
+func (s *KanbanService) enterStage(ctx context.Context, accountID int, cardID uuid.UUID, from *uuid.UUID, to uuid.UUID, userID *int) error {
+	if _, err := s.repo.CopyChecklistTemplate(ctx, cardID, to); err != nil {
+		return err
+	}
+
+	s.recordTransition(ctx, accountID, cardID, from, to, userID)
+	return nil
+}
+
+// recordTransition queues the stage AutoActions for a card that entered a stage.
+// The card move itself has already succeeded, so failures are only logged.
+func (s *KanbanService) recordTransition(ctx context.Context, accountID int, cardID uuid.UUID, from *uuid.UUID, to uuid.UUID, userID *int) {
+	if s.events == nil {
+		return
+	}
+
+	body, err := json.Marshal(StageTransition{
+		CardID:      cardID,
+		FromStageID: from,
+		ToStageID:   to,
+		UserID:      userID,
+	})
+	if err == nil {
+		_, err = s.events.Record(ctx, EventStageTransition, accountID, nil, body)
+	}
+	if err != nil {
+		log.Printf("Failed to record stage transition of card %s: %v", cardID, err)
+	}
+}
+
+// CardEvent is the payload of the kanban card events pushed to connected clients.
+// FromStageID is set on moves.
+type CardEvent struct {
+	BoardID     uuid.UUID    `json:"board_id"`
+	FromStageID *uuid.UUID   `json:"from_stage_id,omitempty"`
+	Card        *models.Card `json:"card"`
+}
+
+// publishCard pushes a card change to the connected clients of the account
+func (s *KanbanService) publishCard(ctx context.Context, accountID int, eventType string, boardID uuid.UUID, card *models.Card, from *uuid.UUID) {
+	if s.hub == nil {
+		return
+	}
+	s.hub.Publish(ctx, realtime.NewEvent(eventType, accountID, CardEvent{
+		BoardID:     boardID,
+		FromStageID: from,
+		Card:        card,
+	}))
+}
+
+// publishCardUpdate pushes a card update, looking up the board of its stage
+func (s *KanbanService) publishCardUpdate(ctx context.Context, accountID int, card *models.Card) {
+	if s.hub == nil {
+		return
+	}
+	stage, err := s.repo.GetStageForAccount(ctx, card.StageID, accountID)
+	if err != nil {
+		log.Printf("Failed to publish update of card %s: %v", card.ID, err)
+		return
+	}
+	s.publishCard(ctx, accountID, realtime.EventCardUpdated, stage.BoardID, card, nil)
+}
+
+// decodeStageActions converts the auto_actions of an update request and validates them
+func decodeStageActions(raw interface{}) (models.StageActions, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions models.StageActions
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAutoAction, err)
+	}
+	if actions == nil {
+		actions = models.StageActions{}
+	}
+	return actions, ValidateStageActions(actions)
+}
+
+// findConversationCard returns the card of a conversation, or nil when the
+// conversation has no card in this account
+func (s *KanbanService) findConversationCard(ctx context.Context, accountID, conversationID int) (*models.Card, error) {
+	// Conversation IDs come from the webhook; only the account's boards are searched
+	card, err := s.repo.FindCardByConversationForAccount(ctx, conversationID, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCardNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return card, nil
+}
+
+// checklistItemIDs returns the IDs of checklist items for card history metadata
+func checklistItemIDs(items []models.ChecklistItem) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID.String()
+	}
+	return ids
+}
+
+// previewText truncates a message to the card preview length without splitting runes
+func previewText(content string) string {
+	runes := []rune(content)
+	if len(runes) <= lastMessagePreviewLength {
+		return content
+	}
+	return string(runes[:lastMessagePreviewLength-3]) + "..."
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -9,3 +10,18 @@ func TestKanbanService_Structure(t *testing.T) {
 	// We skip actual logic tests because we haven't set up the mocks for repositories yet.
 	t.Skip("Skipping unit tests requiring DB mocks")
 }
+
+func TestPreviewText(t *testing.T) {
+	if got := previewText("olá"); got != "olá" {
+		t.Fatalf("previewText kept short text as %q", got)
+	}
+
+	long := strings.Repeat("ç", lastMessagePreviewLength+10)
+	got := []rune(previewText(long))
+	if len(got) != lastMessagePreviewLength {
+		t.Fatalf("preview has %d runes, want %d", len(got), lastMessagePreviewLength)
+	}
+	if string(got[len(got)-3:]) != "..." {
+		t.Fatalf("preview should end with an ellipsis")
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+// mercadoPagoPageSize is the page size used on the Mercado Pago search endpoints
+const mercadoPagoPageSize = 50
+
+// MercadoPagoProvider bills accounts through Mercado Pago subscriptions
+// (preapprovals). Mercado Pago charges them on credit card only.
+type MercadoPagoProvider struct {
+	AccessToken   string
+	WebhookSecret string // Signs the x-signature header of webhooks
+	ReturnURL     string // Where the payer goes back after the checkout
+	URL           string
+	HTTPClient    *http.Client
+}
+
+// NewMercadoPagoProvider creates a Mercado Pago provider
+func NewMercadoPagoProvider(accessToken, webhookSecret, returnURL string) *MercadoPagoProvider {
+	return &MercadoPagoProvider{
+		AccessToken:   accessToken,
+		WebhookSecret: webhookSecret,
+		ReturnURL:     returnURL,
+		URL:           "https://api.mercadopago.com",
+		HTTPClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Name identifies Mercado Pago in subscriptions, plans and webhook routes
+func (p *MercadoPagoProvider) Name() string {
+	return models.ProviderMercadoPago
+}
+
+// mercadoPagoAuthorizedPayment is a charge of a Mercado Pago subscription
+type mercadoPagoAuthorizedPayment struct {
+	ID                int64   `json:"id"`
+	PreapprovalID     string  `json:"preapproval_id"`
+	Status            string  `json:"status"` // scheduled, processed, recycling, cancelled
+	TransactionAmount float64 `json:"transaction_amount"`
+	CurrencyID        string  `json:"currency_id"`
+	DebitDate         string  `json:"debit_date"`
+	Payment           *struct {
+		ID     int64  `json:"id"`
+		Status string `json:"status"` // approved, rejected, refunded, charged_back...
+	} `json:"payment"`
+}
+
+// CreateCustomer returns the payer e-mail: Mercado Pago subscriptions identify payers by e-mail
+func (p *MercadoPagoProvider) CreateCustomer(ctx context.Context, customer PaymentCustomer) (string, error) {
+	if customer.Email == "" {
+		return "", fmt.Errorf("mercado pago requires the payer e-mail")
+	}
+	return customer.Email, nil
+}
+
+// CreateSubscription creates a pending monthly subscription; the payer
+// authorizes it on the returned checkout URL
+func (p *MercadoPagoProvider) CreateSubscription(ctx context.Context, req SubscriptionRequest) (*ProviderSubscription, error) {
+	if req.PaymentMethod != models.PaymentMethodCreditCard {
+		return nil, ErrInvalidPaymentMethod
+	}
+	currency := req.Plan.Currency
+	if currency == "" {
+		currency = "BRL"
+	}
+
+	body := map[string]interface{}{
+		"reason":             req.Plan.Name,
+		"external_reference": asaasReference(req.AccountID),
+		"payer_email":        req.CustomerID,
+		"back_url":           p.ReturnURL,
+		"status":             "pending",
+		"auto_recurring": map[string]interface{}{
+			"frequency":          1,
+			"frequency_type":     "months",
+			"start_date":         req.FirstDueDate.UTC().Format("2006-01-02T15:04:05.000Z"),
+			"transaction_amount": req.Plan.Price,
+			"currency_id":        currency,
+		},
+	}
+
+	var created struct {
+		ID        string `json:"id"`
+		InitPoint string `json:"init_point"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/preapproval", body, &created); err != nil {
+		return nil, err
+	}
+	return &ProviderSubscription{ID: created.ID, CheckoutURL: created.InitPoint}, nil
+}
+
+// CancelSubscription cancels a subscription
+func (p *MercadoPagoProvider) CancelSubscription(ctx context.Context, subID string) error {
+	return p.do(ctx, http.MethodPut, "/preapproval/"+url.PathEscape(subID), map[string]string{"status": "cancelled"}, nil)
+}
+
+// ChangeSubscriptionPlan charges the price of another plan from the next charge on
+func (p *MercadoPagoProvider) ChangeSubscriptionPlan(ctx context.Context, subID string, plan *models.Plan) error {
+	currency := plan.Currency
+	if currency == "" {
+		currency = "BRL"
+	}
+	body := map[string]interface{}{
+		"reason": plan.Name,
+		"auto_recurring": map[string]interface{}{
+			"transaction_amount": plan.Price,
+			"currency_id":        currency,
+		},
+	}
+	return p.do(ctx, http.MethodPut, "/preapproval/"+url.PathEscape(subID), body, nil)
+}
+
+// ListPayments returns every charge of a subscription
+func (p *MercadoPagoProvider) ListPayments(ctx context.Context, subID string) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	for offset := 0; ; offset += mercadoPagoPageSize {
+		query := url.Values{
+			"preapproval_id": {subID},
+			"offset":         {strconv.Itoa(offset)},
+			"limit":          {strconv.Itoa(mercadoPagoPageSize)},
+		}
+
+		var page struct {
+			Paging struct {
+				Total int `json:"total"`
+			} `json:"paging"`
+			Results []mercadoPagoAuthorizedPayment `json:"results"`
+		}
+		if err := p.do(ctx, http.MethodGet, "/authorized_payments/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, payment := range page.Results {
+			transactions = append(transactions, *mercadoPagoTransaction(payment))
+		}
+		if len(page.Results) == 0 || offset+len(page.Results) >= page.Paging.Total {
+			return transactions, nil
+		}
+	}
+}
+
+// VerifyWebhook checks the x-signature header: an HMAC-SHA256 of the
+// notified ID, the x-request-id header and the signature timestamp
+func (p *MercadoPagoProvider) VerifyWebhook(header http.Header, payload []byte) error {
+	if p.WebhookSecret == "" {
+		return ErrInvalidWebhook
+	}
+
+	var ts, signature string
+	for _, part := range strings.Split(header.Get("x-signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "ts":
+			ts = value
+		case "v1":
+			signature = value
+		}
+	}
+	if ts == "" || signature == "" {
+		return ErrInvalidWebhook
+	}
+
+	var notification struct {
+		Data struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return ErrInvalidWebhook
+	}
+	id := strings.ToLower(strings.Trim(string(notification.Data.ID), `"`))
+
+	manifest := fmt.Sprintf("id:%s;request-id:%s;ts:%s;", id, header.Get("x-request-id"), ts)
+	mac := hmac.New(sha256.New, []byte(p.WebhookSecret))
+	mac.Write([]byte(manifest))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return ErrInvalidWebhook
+	}
+	return nil
+}
+
+// ParseWebhook handles the charges of subscriptions. Notifications carry only
+// the charge ID, so the charge is fetched from the API.
+func (p *MercadoPagoProvider) ParseWebhook(ctx context.Context, payload []byte) (*PaymentEvent, error) {
+	var notification struct {
+		Type   string `json:"type"`
+		Action string `json:"action"`
+		Data   struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return nil, fmt.Errorf("invalid Mercado Pago webhook: %w", err)
+	}
+	if notification.Type != "subscription_authorized_payment" {
+		return nil, nil
+	}
+	id := strings.Trim(string(notification.Data.ID), `"`)
+	if id == "" {
+		return nil, fmt.Errorf("mercado pago %s webhook without ID", notification.Type)
+	}
+
+	var payment mercadoPagoAuthorizedPayment
+	if err := p.do(ctx, http.MethodGet, "/authorized_payments/"+url.PathEscape(id), nil, &payment); err != nil {
+		return nil, err
+	}
+
+	event := notification.Type
+	if notification.Action != "" {
+		event += "." + notification.Action
+	}
+	return &PaymentEvent{
+		Event:          event,
+		SubscriptionID: payment.PreapprovalID,
+		Transaction:    mercadoPagoTransaction(payment),
+	}, nil
+}
+
+// do performs a request against the Mercado Pago API and decodes the response into out
+func (p *MercadoPagoProvider) do(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.URL+endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure) == nil && failure.Message != "" {
+			return fmt.Errorf("mercado pago %s %s: status %d: %s", method, endpoint, resp.StatusCode, failure.Message)
+		}
+		return fmt.Errorf("mercado pago %s %s: status %d", method, endpoint, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// mercadoPagoTransaction converts a Mercado Pago subscription charge
+func mercadoPagoTransaction(payment mercadoPagoAuthorizedPayment) *models.Transaction {
+	tx := &models.Transaction{
+		Amount:        payment.TransactionAmount,
+		Currency:      payment.CurrencyID,
+		Status:        models.TransactionPending,
+		ProviderID:    strconv.FormatInt(payment.ID, 10),
+		PaymentMethod: models.PaymentMethodCreditCard,
+	}
+
+	paymentStatus := ""
+	if payment.Payment != nil {
+		paymentStatus = payment.Payment.Status
+	}
+	switch {
+	case paymentStatus == "approved":
+		tx.Status = models.TransactionPaid
+		if paidAt, err := time.Parse(time.RFC3339, payment.DebitDate); err == nil {
+			tx.PaidAt = &paidAt
+		}
+	case paymentStatus == "refunded" || paymentStatus == "charged_back":
+		tx.Status = models.TransactionRefunded
+	case payment.Status == "cancelled":
+		tx.Status = models.TransactionCanceled
+	case paymentStatus == "rejected" || payment.Status == "recycling":
+		tx.Status = models.TransactionFailed
+	}
+	return tx
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestMercadoPagoSubscription(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/preapproval", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		recurring, _ := body["auto_recurring"].(map[string]interface{})
+		if body["payer_email"] != "ana@acme.com" || body["external_reference"] != "account:7" || recurring["transaction_amount"] != 99.9 || recurring["currency_id"] != "BRL" {
+			t.Errorf("unexpected preapproval: %v", body)
+		}
+		w.Write([]byte(`{"id":"pre_1","init_point":"https://mercadopago.com/checkout/pre_1"}`))
+	})
+	mux.HandleFunc("/authorized_payments/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("preapproval_id") != "pre_1" {
+			t.Errorf("unexpected payments query: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"paging":{"total":2},"results":[
+			{"id":11,"preapproval_id":"pre_1","status":"processed","transaction_amount":99.9,"currency_id":"BRL","debit_date":"2025-02-10T10:00:00Z","payment":{"id":1,"status":"approved"}},
+			{"id":12,"preapproval_id":"pre_1","status":"recycling","transaction_amount":99.9,"currency_id":"BRL","payment":{"id":2,"status":"rejected"}}]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewMercadoPagoProvider("token", "", "https://app.example.com/billing")
+	p.URL = srv.URL
+	ctx := context.Background()
+
+	customerID, err := p.CreateCustomer(ctx, PaymentCustomer{AccountID: 7, Email: "ana@acme.com"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	sub, err := p.CreateSubscription(ctx, SubscriptionRequest{
+		CustomerID:    customerID,
+		AccountID:     7,
+		Plan:          &models.Plan{Name: "Pro", Price: 99.9},
+		PaymentMethod: models.PaymentMethodCreditCard,
+		FirstDueDate:  time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil || sub.ID != "pre_1" || sub.CheckoutURL != "https://mercadopago.com/checkout/pre_1" {
+		t.Fatalf("create subscription: %+v, %v", sub, err)
+	}
+
+	if _, err := p.CreateSubscription(ctx, SubscriptionRequest{Plan: &models.Plan{}, PaymentMethod: models.PaymentMethodPix}); err != ErrInvalidPaymentMethod {
+		t.Fatalf("pix should be rejected, got %v", err)
+	}
+
+	payments, err := p.ListPayments(ctx, "pre_1")
+	if err != nil {
+		t.Fatalf("list payments: %v", err)
+	}
+	if len(payments) != 2 || payments[0].Status != models.TransactionPaid || payments[0].PaidAt == nil || payments[0].ProviderID != "11" ||
+		payments[1].Status != models.TransactionFailed {
+		t.Fatalf("unexpected payments: %+v", payments)
+	}
+}
+
+func TestMercadoPagoWebhook(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorized_payments/11", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":11,"preapproval_id":"pre_1","status":"processed","transaction_amount":49.9,"currency_id":"BRL","payment":{"id":1,"status":"approved"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewMercadoPagoProvider("token", "secret", "")
+	p.URL = srv.URL
+
+	payload := []byte(`{"type":"subscription_authorized_payment","action":"created","data":{"id":"11"}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("id:11;request-id:req-1;ts:1700000000;"))
+
+	header := http.Header{}
+	header.Set("x-request-id", "req-1")
+	header.Set("x-signature", "ts=1700000000,v1="+hex.EncodeToString(mac.Sum(nil)))
+	if err := p.VerifyWebhook(header, payload); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	header.Set("x-request-id", "req-2")
+	if err := p.VerifyWebhook(header, payload); err != ErrInvalidWebhook {
+		t.Fatalf("tampered request should be rejected, got %v", err)
+	}
+
+	ctx := context.Background()
+	event, err := p.ParseWebhook(ctx, payload)
+	if err != nil {
+		t.Fatalf("parse webhook: %v", err)
+	}
+	if event.SubscriptionID != "pre_1" || event.Transaction.Status != models.TransactionPaid || event.Transaction.Amount != 49.9 {
+		t.Fatalf("unexpected event: %+v %+v", event, event.Transaction)
+	}
+
+	event, err = p.ParseWebhook(ctx, []byte(`{"type":"payment","data":{"id":"99"}}`))
+	if err != nil || event != nil {
+		t.Fatalf("other notifications should be ignored: %+v, %v", event, err)
+	}
+}
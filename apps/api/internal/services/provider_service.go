@@ -10,26 +10,30 @@ import (
 
 	"github.com/google/uuid"
 	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/providers"
 	"whatpro-hub/internal/repositories"
 	"whatpro-hub/pkg/crypto"
 )
 
 // ProviderService handles provider business logic
 type ProviderService struct {
-	repo      *repositories.ProviderRepository
-	encryptor *crypto.Encryptor
+	repo         *repositories.ProviderRepository
+	encryptor    *crypto.Encryptor
+	entitlements *EntitlementsService
 }
 
-// NewProviderService creates a new provider service
-func NewProviderService(repo *repositories.ProviderRepository, encryptionKey string) (*ProviderService, error) {
+// NewProviderService creates a new provider service; providers count against
+// MaxIntegrations when entitlements is set
+func NewProviderService(repo *repositories.ProviderRepository, encryptionKey string, entitlements *EntitlementsService) (*ProviderService, error) {
 	encryptor, err := crypto.NewEncryptor(encryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize encryptor: %w", err)
 	}
 
 	return &ProviderService{
-		repo:      repo,
-		encryptor: encryptor,
+		repo:         repo,
+		encryptor:    encryptor,
+		entitlements: entitlements,
 	}, nil
 }
 
@@ -82,6 +86,12 @@ func (s *ProviderService) GetProviderWithKey(ctx context.Context, accountID int,
 
 // CreateProvider creates a new provider with encrypted API key
 func (s *ProviderService) CreateProvider(ctx context.Context, provider *models.Provider, apiKey string) error {
+	if s.entitlements != nil {
+		if err := s.entitlements.CanCreateResource(provider.AccountID, "provider"); err != nil {
+			return err
+		}
+	}
+
 	// Encrypt API key
 	encryptedKey, err := s.encryptor.Encrypt(apiKey)
 	if err != nil {
@@ -138,28 +148,52 @@ func (s *ProviderService) DeleteProvider(ctx context.Context, accountID int, id
 	return s.repo.DeleteForAccount(ctx, id, accountID)
 }
 
+// Driver returns a provider together with its driver, authenticated with the decrypted API key
+func (s *ProviderService) Driver(ctx context.Context, accountID int, id uuid.UUID) (*models.Provider, providers.ProviderDriver, error) {
+	provider, apiKey, err := s.GetProviderWithKey(ctx, accountID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	driver, err := providers.ForProvider(provider, apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return provider, driver, nil
+}
+
 // CheckProviderHealth performs health check on a provider
 func (s *ProviderService) CheckProviderHealth(ctx context.Context, accountID int, id uuid.UUID) (bool, error) {
-	provider, apiKey, err := s.GetProviderWithKey(ctx, accountID, id)
+	provider, driver, err := s.Driver(ctx, accountID, id)
 	if err != nil {
 		return false, err
 	}
 
-	// Determine health check URL
-	healthURL := provider.HealthCheckURL
-	if healthURL == "" {
-		// Default health check endpoints by provider type
-		switch provider.Type {
-		case "evolution":
-			healthURL = provider.BaseURL + "/instance/connectionState/" + provider.InstanceName
-		case "uazapi":
-			healthURL = provider.BaseURL + "/instance/status"
-		default:
-			healthURL = provider.BaseURL + "/health"
-		}
+	// A custom health check URL overrides the driver's connection state
+	if provider.HealthCheckURL != "" {
+		return s.checkHealthURL(ctx, id, provider.HealthCheckURL)
 	}
 
-	// Perform HTTP request
+	state, err := driver.ConnectionState(ctx)
+	if err != nil {
+		log.Printf("Health check failed for provider %s: %v", id, err)
+		s.repo.UpdateHealthCheck(ctx, id, string(providers.StateDisconnected))
+		return false, nil
+	}
+
+	if state == providers.StateUnknown {
+		// Keep the stored status rather than guessing
+		log.Printf("Provider %s reported an unknown connection state", id)
+		return provider.Status == string(providers.StateConnected), nil
+	}
+
+	s.repo.UpdateHealthCheck(ctx, id, string(state))
+	return state == providers.StateConnected, nil
+}
+
+// checkHealthURL treats any 200 from a custom URL as connected
+func (s *ProviderService) checkHealthURL(ctx context.Context, id uuid.UUID, healthURL string) (bool, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -171,10 +205,6 @@ func (s *ProviderService) CheckProviderHealth(ctx context.Context, accountID int
 		return false, err
 	}
 
-	// Add API key to headers
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Health check failed for provider %s: %v", id, err)
@@ -192,6 +222,46 @@ func (s *ProviderService) CheckProviderHealth(ctx context.Context, accountID int
 	s.repo.UpdateHealthCheck(ctx, id, "disconnected")
 	return false, nil
 }
+
+// GetQRCode starts pairing a provider instance and returns its QR code
+func (s *ProviderService) GetQRCode(ctx context.Context, accountID int, id uuid.UUID) (*providers.QRCode, error) {
+	_, driver, err := s.Driver(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := driver.QRCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.repo.UpdateHealthCheck(ctx, id, string(providers.StateConnecting))
+	return qr, nil
+}
+
+// LogoutProvider disconnects the WhatsApp session of a provider instance
+func (s *ProviderService) LogoutProvider(ctx context.Context, accountID int, id uuid.UUID) error {
+	_, driver, err := s.Driver(ctx, accountID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := driver.Logout(ctx); err != nil {
+		return err
+	}
+
+	return s.repo.UpdateHealthCheck(ctx, id, string(providers.StateDisconnected))
+}
+
+// RestartProvider restarts a provider instance
+func (s *ProviderService) RestartProvider(ctx context.Context, accountID int, id uuid.UUID) error {
+	_, driver, err := s.Driver(ctx, accountID, id)
+	if err != nil {
+		return err
+	}
+
+	return driver.Restart(ctx)
+}
 
 // CheckAllProvidersHealth runs health check on all active providers
 func (s *ProviderService) CheckAllProvidersHealth(ctx context.Context) error {
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/archive"
+)
+
+const (
+	// retentionBatchSize is how many rows retention reads or deletes per query
+	retentionBatchSize = 1000
+	// restoreBatchSize is how many archived rows a restore inserts per query
+	restoreBatchSize = 500
+	// AuditActionArchive records that expired rows were moved to an archive
+	AuditActionArchive AuditAction = "archive"
+)
+
+var (
+	ErrInvalidRetention = errors.New("invalid retention policy")
+	ErrArchiveDisabled  = errors.New("archive path is not configured")
+	ErrUnknownTable     = errors.New("table has no retention")
+)
+
+// RetentionPolicy is stored in Account.Settings["retention"]. Days of 0 keep rows forever.
+type RetentionPolicy struct {
+	AuditLogsDays       int `json:"audit_logs_days"`
+	ChatAuditDays       int `json:"chat_audit_days"`
+	EventExecutionsDays int `json:"event_executions_days"` // Only finished (success or dead) executions expire
+}
+
+// retentionTable describes a table retention archives
+type retentionTable struct {
+	name   string
+	filter string
+	days   func(RetentionPolicy) int
+}
+
+var retentionTables = []retentionTable{
+	{name: "audit_logs", days: func(p RetentionPolicy) int { return p.AuditLogsDays }},
+	{name: "internal_chat_audit", days: func(p RetentionPolicy) int { return p.ChatAuditDays }},
+	{
+		name:   "event_executions",
+		filter: "status IN ('success', 'dead')",
+		days:   func(p RetentionPolicy) int { return p.EventExecutionsDays },
+	},
+}
+
+// ParseRetentionPolicy reads the retention policy of account settings
+func ParseRetentionPolicy(settings models.JSON) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	raw, ok := settings["retention"]
+	if !ok || raw == nil {
+		return policy, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return policy, ErrInvalidRetention
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return policy, fmt.Errorf("%w: %v", ErrInvalidRetention, err)
+	}
+	if policy.AuditLogsDays < 0 || policy.ChatAuditDays < 0 || policy.EventExecutionsDays < 0 {
+		return policy, fmt.Errorf("%w: days cannot be negative", ErrInvalidRetention)
+	}
+	return policy, nil
+}
+
+// RetentionService archives expired audit and event rows and restores archives
+type RetentionService struct {
+	repo     *repositories.RetentionRepository
+	accounts *repositories.AccountRepository
+	audit    *repositories.AuditRepository
+	store    archive.Store
+	now      func() time.Time
+}
+
+// NewRetentionService creates a new RetentionService. store may be nil, which
+// disables archival: rows are never deleted without an archive.
+func NewRetentionService(repo *repositories.RetentionRepository, accounts *repositories.AccountRepository, audit *repositories.AuditRepository, store archive.Store) *RetentionService {
+	return &RetentionService{repo: repo, accounts: accounts, audit: audit, store: store, now: time.Now}
+}
+
+// GetPolicy returns the retention policy of an account, by Chatwoot account ID
+func (s *RetentionService) GetPolicy(ctx context.Context, accountID int) (RetentionPolicy, error) {
+	account, err := s.accounts.FindByChatwootID(ctx, accountID)
+	if err != nil {
+		return RetentionPolicy{}, err
+	}
+	return ParseRetentionPolicy(account.Settings)
+}
+
+// SetPolicy stores the retention policy in the account settings, keeping the other settings
+func (s *RetentionService) SetPolicy(ctx context.Context, accountID int, policy RetentionPolicy) error {
+	if policy.AuditLogsDays < 0 || policy.ChatAuditDays < 0 || policy.EventExecutionsDays < 0 {
+		return fmt.Errorf("%w: days cannot be negative", ErrInvalidRetention)
+	}
+
+	account, err := s.accounts.FindByChatwootID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	settings := account.Settings
+	if settings == nil {
+		settings = models.JSON{}
+	}
+	settings["retention"] = map[string]interface{}{
+		"audit_logs_days":       policy.AuditLogsDays,
+		"chat_audit_days":       policy.ChatAuditDays,
+		"event_executions_days": policy.EventExecutionsDays,
+	}
+	return s.accounts.UpdateSettings(ctx, account.ID, settings)
+}
+
+// ArchiveResult describes one archive written by a retention run
+type ArchiveResult struct {
+	AccountID int    `json:"account_id"`
+	Table     string `json:"table"`
+	Key       string `json:"key"`
+	Rows      int64  `json:"rows"`
+}
+
+// Run archives and deletes the expired rows of every account with a retention policy
+func (s *RetentionService) Run(ctx context.Context) ([]ArchiveResult, error) {
+	if s.store == nil {
+		return nil, ErrArchiveDisabled
+	}
+
+	accounts, err := s.repo.AccountsWithRetention(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ArchiveResult
+	var failed []string
+	for _, account := range accounts {
+		policy, err := ParseRetentionPolicy(account.Settings)
+		if err != nil {
+			log.Printf("[RETENTION] Skipping account %d: %v", account.ChatwootID, err)
+			continue
+		}
+		for _, table := range retentionTables {
+			days := table.days(policy)
+			if days == 0 {
+				continue
+			}
+			cutoff := s.now().AddDate(0, 0, -days)
+			// Tenant rows are keyed by the Chatwoot account ID
+			result, err := s.archiveTable(ctx, account.ChatwootID, table, cutoff)
+			if err != nil {
+				// One failing account must not hold back the others
+				failed = append(failed, fmt.Sprintf("account %d %s: %v", account.ChatwootID, table.name, err))
+				continue
+			}
+			if result != nil {
+				results = append(results, *result)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("retention failed for %s", strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// archiveTable writes the expired rows of an account to one compressed NDJSON
+// archive, stores it, and only then deletes the rows in batches
+func (s *RetentionService) archiveTable(ctx context.Context, accountID int, table retentionTable, cutoff time.Time) (*ArchiveResult, error) {
+	query := repositories.ArchiveQuery{Table: table.name, Filter: table.filter, AccountID: accountID, Cutoff: cutoff}
+
+	file, err := os.CreateTemp("", "archive-*.ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	var first, last repositories.ArchiveRow
+	var count int64
+	for {
+		rows, err := s.repo.FindExpired(ctx, query, retentionBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if _, err := io.WriteString(gz, row.Doc+"\n"); err != nil {
+				return nil, err
+			}
+		}
+		if len(rows) > 0 {
+			if count == 0 {
+				first = rows[0]
+			}
+			last = rows[len(rows)-1]
+			count += int64(len(rows))
+			query.After = &last
+		}
+		if len(rows) < retentionBatchSize {
+			break
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/account-%d/%s_%s.ndjson.gz", table.name, accountID,
+		first.CreatedAt.UTC().Format("20060102T150405Z"), last.CreatedAt.UTC().Format("20060102T150405Z"))
+	if err := s.store.Put(ctx, key, file, size); err != nil {
+		return nil, fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	// The archive is safe; delete exactly the rows it holds
+	query.After = nil
+	query.Through = &last
+	if table.name == "audit_logs" {
+		if err := s.repo.MarkAuditArchived(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		deleted, err := s.repo.DeleteArchived(ctx, query, retentionBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if deleted < retentionBatchSize {
+			break
+		}
+	}
+
+	entry := &models.AuditLog{
+		AccountID:    accountID,
+		Action:       string(AuditActionArchive),
+		ResourceType: table.name,
+		ResourceID:   key,
+		NewValues: models.JSON{
+			"rows":   count,
+			"from":   first.CreatedAt.UTC(),
+			"to":     last.CreatedAt.UTC(),
+			"cutoff": cutoff.UTC(),
+		},
+	}
+	if err := s.audit.Create(entry); err != nil {
+		log.Printf("[RETENTION] Failed to audit archive %s: %v", key, err)
+	}
+
+	return &ArchiveResult{AccountID: accountID, Table: table.name, Key: key, Rows: count}, nil
+}
+
+// Restore loads an archive into <table>_restored for investigation; live
+// tables are left untouched. table may be empty to take it from the key.
+// It returns the restored table and how many rows were new.
+func (s *RetentionService) Restore(ctx context.Context, key, table string) (string, int64, error) {
+	if s.store == nil {
+		return "", 0, ErrArchiveDisabled
+	}
+	if table == "" {
+		table, _, _ = strings.Cut(key, "/")
+	}
+	if !isRetentionTable(table) {
+		return "", 0, fmt.Errorf("%w: %q", ErrUnknownTable, table)
+	}
+
+	body, err := s.store.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return "", 0, err
+	}
+	defer gz.Close()
+
+	reader := bufio.NewReader(gz)
+	var restored int64
+	batch := make([]string, 0, restoreBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := s.repo.RestoreRows(ctx, table, batch)
+		restored += n
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if doc := strings.TrimSpace(line); doc != "" {
+			batch = append(batch, doc)
+			if len(batch) == restoreBatchSize {
+				if err := flush(); err != nil {
+					return "", restored, err
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", restored, err
+		}
+	}
+	if err := flush(); err != nil {
+		return "", restored, err
+	}
+	return table + "_restored", restored, nil
+}
+
+func isRetentionTable(name string) bool {
+	for _, table := range retentionTables {
+		if table.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	policy, err := ParseRetentionPolicy(models.JSON{
+		"retention": map[string]interface{}{"audit_logs_days": float64(365), "event_executions_days": float64(30)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.AuditLogsDays != 365 || policy.ChatAuditDays != 0 || policy.EventExecutionsDays != 30 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	if policy, err := ParseRetentionPolicy(models.JSON{}); err != nil || policy != (RetentionPolicy{}) {
+		t.Fatalf("missing policy should keep everything, got %+v, %v", policy, err)
+	}
+
+	invalid := []interface{}{
+		map[string]interface{}{"audit_logs_days": float64(-1)},
+		map[string]interface{}{"audit_logs_days": 1.5},
+		map[string]interface{}{"audit_log_days": float64(30)},
+		"30 days",
+	}
+	for _, retention := range invalid {
+		if _, err := ParseRetentionPolicy(models.JSON{"retention": retention}); !errors.Is(err, ErrInvalidRetention) {
+			t.Fatalf("%v should fail with ErrInvalidRetention, got %v", retention, err)
+		}
+	}
+}
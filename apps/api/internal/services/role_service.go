@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermBoardsManage      = "boards.manage"      // Create, edit and delete boards and stages
+	PermStagesConfigure   = "stages.configure"   // Reorder stages and edit their checklists
+	PermCardsDelete       = "cards.delete"       // Delete cards
+	PermChecklistOverride = "checklist.override" // Move cards past an incomplete checklist
+	PermReportsView       = "reports.view"       // View SLA reports
+	PermProvidersManage   = "providers.manage"   // Connect, edit and restart providers
+	PermTeamsManage       = "teams.manage"       // Create and edit teams and their members
+	PermUsersManage       = "users.manage"       // Create, edit and log out users
+	PermEventsManage      = "events.manage"      // Inspect and replay webhook events
+	PermChatModerate      = "chat.moderate"      // Delete any message of the account's chat
+	PermAuditView         = "audit.view"         // Search and export the audit timeline
+)
+
+// AllPermissions lists every permission a custom role can grant
+var AllPermissions = []string{
+	PermBoardsManage,
+	PermStagesConfigure,
+	PermCardsDelete,
+	PermChecklistOverride,
+	PermReportsView,
+	PermProvidersManage,
+	PermTeamsManage,
+	PermUsersManage,
+	PermEventsManage,
+	PermChatModerate,
+	PermAuditView,
+}
+
+// BuiltinPermissions are the permissions of the built-in roles. admin and
+// super_admin hold every permission; agent holds none.
+var BuiltinPermissions = map[string][]string{
+	"supervisor": {PermStagesConfigure, PermChecklistOverride, PermReportsView, PermChatModerate},
+	"agent":      {},
+}
+
+// permissionCacheTTL bounds how long a user's custom permissions are cached
+const permissionCacheTTL = 10 * time.Minute
+
+var (
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrRoleNameTaken     = errors.New("a role with this name already exists")
+)
+
+// RoleService manages custom roles and resolves permissions
+type RoleService struct {
+	repo  *repositories.RoleRepository
+	redis *redis.Client
+}
+
+// NewRoleService creates a new RoleService. rdb may be nil to disable caching.
+func NewRoleService(repo *repositories.RoleRepository, rdb *redis.Client) *RoleService {
+	return &RoleService{repo: repo, redis: rdb}
+}
+
+// RoleRequest represents a custom role creation or update request
+type RoleRequest struct {
+	Name        string   `json:"name" validate:"required,max=100"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// List returns the custom roles of an account
+func (s *RoleService) List(ctx context.Context, accountID int) ([]models.CustomRole, error) {
+	return s.repo.ListByAccount(ctx, accountID)
+}
+
+// Get returns a custom role of an account
+func (s *RoleService) Get(ctx context.Context, accountID int, id uint) (*models.CustomRole, error) {
+	return s.repo.GetForAccount(ctx, id, accountID)
+}
+
+// Create creates a custom role
+func (s *RoleService) Create(ctx context.Context, accountID int, req RoleRequest) (*models.CustomRole, error) {
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(ctx, accountID, req.Name, 0); err != nil {
+		return nil, err
+	}
+
+	role := &models.CustomRole{
+		AccountID:   accountID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Permissions: models.StringArray(permissions),
+	}
+	if err := s.repo.Create(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Update replaces the name, description and permissions of a custom role
+func (s *RoleService) Update(ctx context.Context, accountID int, id uint, req RoleRequest) (*models.CustomRole, error) {
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.repo.GetForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(ctx, accountID, req.Name, id); err != nil {
+		return nil, err
+	}
+
+	role.Name = strings.TrimSpace(req.Name)
+	role.Description = req.Description
+	role.Permissions = models.StringArray(permissions)
+	if err := s.repo.Update(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.invalidateRole(ctx, role.ID)
+	return role, nil
+}
+
+// Delete removes a custom role; its users keep only their built-in role
+func (s *RoleService) Delete(ctx context.Context, accountID int, id uint) (*models.CustomRole, error) {
+	role, err := s.repo.GetForAccount(ctx, id, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the users first: Delete unassigns them
+	userIDs, err := s.repo.UserIDs(ctx, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Delete(ctx, role.ID); err != nil {
+		return nil, err
+	}
+
+	s.invalidateUsers(ctx, userIDs...)
+	return role, nil
+}
+
+// AssignToUser sets the custom role of a user; nil removes it
+func (s *RoleService) AssignToUser(ctx context.Context, accountID, userID int, roleID *uint) error {
+	if roleID != nil {
+		if _, err := s.repo.GetForAccount(ctx, *roleID, accountID); err != nil {
+			return err
+		}
+	}
+	if err := s.repo.AssignToUser(ctx, accountID, userID, roleID); err != nil {
+		return err
+	}
+
+	s.invalidateUsers(ctx, userID)
+	return nil
+}
+
+// HasPermission reports whether a user holds a permission through their
+// built-in role or their custom role
+func (s *RoleService) HasPermission(ctx context.Context, accountID, userID int, builtinRole, permission string) (bool, error) {
+	if builtinRole == "admin" || builtinRole == "super_admin" {
+		return true, nil
+	}
+	for _, granted := range BuiltinPermissions[builtinRole] {
+		if granted == permission {
+			return true, nil
+		}
+	}
+
+	custom, err := s.customPermissions(ctx, accountID, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, granted := range custom {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// customPermissions returns the permissions of the user's custom role, cached in Redis
+func (s *RoleService) customPermissions(ctx context.Context, accountID, userID int) ([]string, error) {
+	key := permissionCacheKey(userID)
+	if s.redis != nil {
+		cached, err := s.redis.Get(ctx, key).Result()
+		if err == nil {
+			return splitPermissions(cached), nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Permission cache unavailable: %v", err)
+		}
+	}
+
+	role, err := s.repo.FindForUser(ctx, accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []string
+	if role != nil {
+		permissions = role.Permissions
+	}
+
+	if s.redis != nil {
+		if err := s.redis.Set(ctx, key, strings.Join(permissions, ","), permissionCacheTTL).Err(); err != nil {
+			log.Printf("Failed to cache permissions of user %d: %v", userID, err)
+		}
+	}
+	return permissions, nil
+}
+
+// invalidateRole drops the cached permissions of every user of a role
+func (s *RoleService) invalidateRole(ctx context.Context, roleID uint) {
+	if s.redis == nil {
+		return
+	}
+	userIDs, err := s.repo.UserIDs(ctx, roleID)
+	if err != nil {
+		log.Printf("Failed to list users of role %d for cache invalidation: %v", roleID, err)
+		return
+	}
+	s.invalidateUsers(ctx, userIDs...)
+}
+
+func (s *RoleService) invalidateUsers(ctx context.Context, userIDs ...int) {
+	if s.redis == nil || len(userIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = permissionCacheKey(id)
+	}
+	if err := s.redis.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to invalidate cached permissions: %v", err)
+	}
+}
+
+func (s *RoleService) checkName(ctx context.Context, accountID int, name string, exceptID uint) error {
+	taken, err := s.repo.NameTaken(ctx, accountID, strings.TrimSpace(name), exceptID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrRoleNameTaken
+	}
+	return nil
+}
+
+func permissionCacheKey(userID int) string {
+	return "permissions:user:" + strconv.Itoa(userID)
+}
+
+func splitPermissions(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// normalizePermissions validates, deduplicates and sorts permissions
+func normalizePermissions(permissions []string) ([]string, error) {
+	known := make(map[string]bool, len(AllPermissions))
+	for _, permission := range AllPermissions {
+		known[permission] = true
+	}
+
+	seen := make(map[string]bool, len(permissions))
+	result := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if !known[permission] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPermission, permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			result = append(result, permission)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
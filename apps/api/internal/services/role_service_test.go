@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePermissions(t *testing.T) {
+	permissions, err := normalizePermissions([]string{PermCardsDelete, PermBoardsManage, " cards.delete"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(permissions, ",") != "boards.manage,cards.delete" {
+		t.Fatalf("unexpected permissions %v", permissions)
+	}
+
+	if _, err := normalizePermissions([]string{"providers.delete"}); !errors.Is(err, ErrInvalidPermission) {
+		t.Fatalf("unknown permission should fail with ErrInvalidPermission, got %v", err)
+	}
+}
+
+func TestBuiltinRolePermissions(t *testing.T) {
+	roles := NewRoleService(nil, nil) // Built-in grants never reach the repository
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		role       string
+		permission string
+	}{
+		{"super_admin", PermProvidersManage},
+		{"admin", PermCardsDelete},
+		{"supervisor", PermReportsView},
+		{"supervisor", PermChecklistOverride},
+	} {
+		allowed, err := roles.HasPermission(ctx, 1, 10, tc.role, tc.permission)
+		if err != nil || !allowed {
+			t.Fatalf("%s should hold %s (err %v)", tc.role, tc.permission, err)
+		}
+	}
+
+	for role, permissions := range BuiltinPermissions {
+		if _, err := normalizePermissions(permissions); err != nil {
+			t.Fatalf("built-in role %s grants an unknown permission: %v", role, err)
+		}
+	}
+}
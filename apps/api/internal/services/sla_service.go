@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+)
+
+// slaCheckBatch caps how many breached cards a single check handles
+const slaCheckBatch = 500
+
+// SLAService flags cards that exceed the SLA of their stage and escalates them
+type SLAService struct {
+	kanbanRepo *repositories.KanbanRepository
+	userRepo   repositories.UserRepository
+	chat       *ChatService
+}
+
+// NewSLAService creates a new SLAService
+func NewSLAService(kanbanRepo *repositories.KanbanRepository, userRepo repositories.UserRepository, chat *ChatService) *SLAService {
+	return &SLAService{
+		kanbanRepo: kanbanRepo,
+		userRepo:   userRepo,
+		chat:       chat,
+	}
+}
+
+// CheckBreaches flags the cards sitting in a stage longer than its SLAHours,
+// records the breach in the card history and notifies the assignee and the
+// supervisors of the account. It returns the number of newly breached cards.
+func (s *SLAService) CheckBreaches(ctx context.Context) (int, error) {
+	now := time.Now()
+	breaches, err := s.kanbanRepo.FindSLABreaches(ctx, now, slaCheckBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, breach := range breaches {
+		marked, err := s.kanbanRepo.MarkCardSLABreached(ctx, breach.CardID, now)
+		if err != nil {
+			return count, err
+		}
+		if !marked {
+			continue
+		}
+		count++
+
+		metadata := models.JSON{
+			"board_id":   breach.BoardID,
+			"stage_id":   breach.StageID,
+			"sla_hours":  breach.SLAHours,
+			"entered_at": breach.EnteredAt,
+		}
+		if breach.AssigneeID != nil {
+			metadata["assignee_id"] = fmt.Sprint(*breach.AssigneeID)
+		}
+		stageID := breach.StageID
+		history := &models.CardHistory{
+			CardID:    breach.CardID,
+			Action:    "sla_breached",
+			ToStageID: &stageID,
+			Metadata:  metadata,
+			CreatedAt: now,
+		}
+		if err := s.kanbanRepo.LogCardHistory(ctx, history); err != nil {
+			return count, err
+		}
+
+		// The breach is recorded; a failed notification must not block the others
+		if err := s.escalate(ctx, breach); err != nil {
+			log.Printf("Failed to escalate SLA breach of card %s: %v", breach.CardID, err)
+		}
+	}
+	return count, nil
+}
+
+// escalate posts a message mentioning the assignee and the supervisors into the
+// board's SLA room (settings.sla_room_id), or into a DM between the first
+// supervisor and the assignee when the board has no SLA room
+func (s *SLAService) escalate(ctx context.Context, breach repositories.SLABreach) error {
+	board, err := s.kanbanRepo.GetBoard(ctx, breach.BoardID)
+	if err != nil {
+		return err
+	}
+
+	users, err := s.userRepo.FindAll(ctx, map[string]interface{}{"account_id": breach.AccountID})
+	if err != nil {
+		return err
+	}
+
+	var assignee *models.User
+	var supervisors []models.User
+	for i, user := range users {
+		if breach.AssigneeID != nil && user.ChatwootID == *breach.AssigneeID {
+			assignee = &users[i]
+		}
+		if user.WhatproRole == "supervisor" {
+			supervisors = append(supervisors, user)
+		}
+	}
+
+	var mentions []string
+	if assignee != nil {
+		if token := mentionToken(*assignee); token != "" {
+			mentions = append(mentions, token)
+		}
+	}
+	for _, supervisor := range supervisors {
+		if token := mentionToken(supervisor); token != "" {
+			mentions = append(mentions, token)
+		}
+	}
+	if len(mentions) == 0 {
+		return nil // Nobody to notify
+	}
+
+	content := fmt.Sprintf("⚠️ SLA estourado: o card \"%s\" está na etapa \"%s\" há mais de %dh. %s",
+		breach.Title, breach.StageName, breach.SLAHours, strings.Join(mentions, " "))
+
+	if roomID, ok := board.Settings["sla_room_id"].(string); ok {
+		id, err := uuid.Parse(roomID)
+		if err != nil {
+			return fmt.Errorf("invalid sla_room_id on board %s: %w", board.ID, err)
+		}
+		_, err = s.chat.PostSystemMessage(ctx, breach.AccountID, id, 0, content)
+		return err
+	}
+
+	if assignee == nil || len(supervisors) == 0 {
+		return nil // A DM needs both sides
+	}
+	supervisorID := int(supervisors[0].ID)
+	room, err := s.chat.CreateRoom(ctx, breach.AccountID, supervisorID, CreateRoomRequest{
+		Type:      models.ChatRoomTypeDM,
+		MemberIDs: []int{int(assignee.ID)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.chat.PostSystemMessage(ctx, breach.AccountID, room.ID, supervisorID, content)
+	return err
+}
+
+// mentionSafe matches the mention tokens the chat recognizes
+var mentionSafe = regexp.MustCompile(`^[\w.\-]+$`)
+
+// mentionToken returns the @token that resolves to a user in chat mentions:
+// the email prefix, or the name without spaces. It is empty when neither can be mentioned.
+func mentionToken(user models.User) string {
+	if prefix := strings.Split(user.Email, "@")[0]; prefix != "" && mentionSafe.MatchString(prefix) {
+		return "@" + prefix
+	}
+	if name := strings.ReplaceAll(user.Name, " ", ""); name != "" && mentionSafe.MatchString(name) {
+		return "@" + name
+	}
+	return ""
+}
+
+// SLAStageReport is the SLA summary of a stage
+type SLAStageReport struct {
+	StageID      uuid.UUID `json:"stage_id"`
+	Name         string    `json:"name"`
+	SLAHours     *int      `json:"sla_hours"`
+	OpenBreaches int64     `json:"open_breaches"` // Cards currently flagged in the stage
+	Breaches     int64     `json:"breaches"`      // Breaches recorded in the period
+}
+
+// SLAAgentReport is the SLA summary of an agent (Chatwoot user ID)
+type SLAAgentReport struct {
+	AssigneeID *int  `json:"assignee_id"`
+	Breaches   int64 `json:"breaches"`
+}
+
+// SLAReport summarizes the SLA breaches of a board
+type SLAReport struct {
+	BoardID       uuid.UUID        `json:"board_id"`
+	Since         time.Time        `json:"since"`
+	TotalBreaches int64            `json:"total_breaches"`
+	Stages        []SLAStageReport `json:"stages"`
+	Agents        []SLAAgentReport `json:"agents"`
+}
+
+// GetBoardReport returns breach counts per stage and per agent since a date
+func (s *SLAService) GetBoardReport(ctx context.Context, accountID int, boardID uuid.UUID, since time.Time) (*SLAReport, error) {
+	board, err := s.kanbanRepo.GetBoardForAccount(ctx, boardID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	byStage, err := s.kanbanRepo.CountSLABreaches(ctx, board.ID, since, "stage_id")
+	if err != nil {
+		return nil, err
+	}
+	byAgent, err := s.kanbanRepo.CountSLABreaches(ctx, board.ID, since, "assignee_id")
+	if err != nil {
+		return nil, err
+	}
+	open, err := s.kanbanRepo.CountOpenSLABreaches(ctx, board.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stageBreaches := make(map[string]int64, len(byStage))
+	for _, c := range byStage {
+		stageBreaches[c.Key] = c.Breaches
+	}
+	openBreaches := make(map[string]int64, len(open))
+	for _, c := range open {
+		openBreaches[c.Key] = c.Breaches
+	}
+
+	report := &SLAReport{
+		BoardID: board.ID,
+		Since:   since,
+		Stages:  make([]SLAStageReport, 0, len(board.Stages)),
+		Agents:  make([]SLAAgentReport, 0, len(byAgent)),
+	}
+	for _, stage := range board.Stages {
+		key := stage.ID.String()
+		report.Stages = append(report.Stages, SLAStageReport{
+			StageID:      stage.ID,
+			Name:         stage.Name,
+			SLAHours:     stage.SLAHours,
+			OpenBreaches: openBreaches[key],
+			Breaches:     stageBreaches[key],
+		})
+		report.TotalBreaches += stageBreaches[key]
+	}
+	for _, c := range byAgent {
+		agent := SLAAgentReport{Breaches: c.Breaches}
+		var id int
+		if _, err := fmt.Sscan(c.Key, &id); err == nil {
+			agent.AssigneeID = &id
+		}
+		report.Agents = append(report.Agents, agent)
+	}
+
+	return report, nil
+}
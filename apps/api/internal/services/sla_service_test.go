@@ -0,0 +1,23 @@
+package services
+
+import (
+	"testing"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestMentionToken(t *testing.T) {
+	cases := []struct {
+		user models.User
+		want string
+	}{
+		{models.User{Name: "Maria Souza", Email: "maria.souza@empresa.com"}, "@maria.souza"},
+		{models.User{Name: "Ana Paula", Email: "ana+sla@empresa.com"}, "@AnaPaula"},
+		{models.User{Name: "João", Email: "joão@empresa.com"}, ""},
+	}
+	for _, tc := range cases {
+		if got := mentionToken(tc.user); got != tc.want {
+			t.Fatalf("mentionToken(%q) = %q, want %q", tc.user.Email, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+// stripeWebhookTolerance is how old a signed Stripe webhook may be
+const stripeWebhookTolerance = 5 * time.Minute
+
+// stripePageSize is the largest page the Stripe list endpoints return
+const stripePageSize = 100
+
+// StripeProvider bills accounts through Stripe subscriptions. Plans are
+// charged with the recurring price set in Plan.StripePriceID.
+type StripeProvider struct {
+	SecretKey     string
+	WebhookSecret string // Signs the Stripe-Signature header of webhooks
+	URL           string
+	HTTPClient    *http.Client
+
+	now func() time.Time
+}
+
+// NewStripeProvider creates a Stripe provider
+func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		URL:           "https://api.stripe.com",
+		HTTPClient:    &http.Client{Timeout: 15 * time.Second},
+		now:           time.Now,
+	}
+}
+
+// Name identifies Stripe in subscriptions, plans and webhook routes
+func (p *StripeProvider) Name() string {
+	return models.ProviderStripe
+}
+
+// stripeInvoice is an invoice of the Stripe API
+type stripeInvoice struct {
+	ID                string `json:"id"`
+	Subscription      string `json:"subscription"`
+	Status            string `json:"status"` // draft, open, paid, uncollectible, void
+	AmountDue         int64  `json:"amount_due"`
+	AmountPaid        int64  `json:"amount_paid"`
+	Currency          string `json:"currency"`
+	AttemptCount      int    `json:"attempt_count"`
+	HostedInvoiceURL  string `json:"hosted_invoice_url"`
+	CollectionMethod  string `json:"collection_method"`
+	StatusTransitions struct {
+		PaidAt int64 `json:"paid_at"`
+	} `json:"status_transitions"`
+	Parent *struct {
+		SubscriptionDetails *struct {
+			Subscription string `json:"subscription"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+}
+
+// subscriptionID returns the subscription of the invoice in both the old and
+// the current (parent.subscription_details) API versions
+func (i stripeInvoice) subscriptionID() string {
+	if i.Subscription != "" {
+		return i.Subscription
+	}
+	if i.Parent != nil && i.Parent.SubscriptionDetails != nil {
+		return i.Parent.SubscriptionDetails.Subscription
+	}
+	return ""
+}
+
+// CreateCustomer returns the Stripe customer of an account, creating it on first use
+func (p *StripeProvider) CreateCustomer(ctx context.Context, customer PaymentCustomer) (string, error) {
+	accountID := strconv.Itoa(customer.AccountID)
+
+	var existing struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	query := url.Values{"query": {fmt.Sprintf("metadata['account_id']:'%s'", accountID)}}
+	if err := p.do(ctx, http.MethodGet, "/v1/customers/search?"+query.Encode(), nil, &existing); err != nil {
+		return "", err
+	}
+	if len(existing.Data) > 0 {
+		return existing.Data[0].ID, nil
+	}
+
+	form := url.Values{
+		"name":                 {customer.Name},
+		"metadata[account_id]": {accountID},
+	}
+	if customer.Email != "" {
+		form.Set("email", customer.Email)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/customers", form, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// CreateSubscription subscribes the customer to the plan price. Card
+// subscriptions start incomplete until the first invoice is paid; boleto
+// subscriptions send invoices due in three days. Stripe has no Pix for
+// recurring charges.
+func (p *StripeProvider) CreateSubscription(ctx context.Context, req SubscriptionRequest) (*ProviderSubscription, error) {
+	if req.Plan.StripePriceID == "" {
+		return nil, fmt.Errorf("plan %s has no Stripe price: %w", req.Plan.Name, ErrProviderUnavailable)
+	}
+
+	form := url.Values{
+		"customer":             {req.CustomerID},
+		"items[0][price]":      {req.Plan.StripePriceID},
+		"metadata[account_id]": {strconv.Itoa(req.AccountID)},
+		"expand[]":             {"latest_invoice"},
+	}
+	switch req.PaymentMethod {
+	case models.PaymentMethodCreditCard:
+		form.Set("payment_behavior", "default_incomplete")
+		form.Set("payment_settings[payment_method_types][0]", "card")
+	case models.PaymentMethodBoleto:
+		form.Set("collection_method", "send_invoice")
+		form.Set("days_until_due", "3")
+		form.Set("payment_settings[payment_method_types][0]", "boleto")
+	default:
+		return nil, ErrInvalidPaymentMethod
+	}
+	if !req.FirstDueDate.IsZero() && req.FirstDueDate.After(time.Now()) {
+		form.Set("billing_cycle_anchor", strconv.FormatInt(req.FirstDueDate.Unix(), 10))
+		form.Set("proration_behavior", "none")
+	}
+
+	var created struct {
+		ID            string         `json:"id"`
+		LatestInvoice *stripeInvoice `json:"latest_invoice"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/subscriptions", form, &created); err != nil {
+		return nil, err
+	}
+
+	sub := &ProviderSubscription{ID: created.ID}
+	if created.LatestInvoice != nil {
+		sub.CheckoutURL = created.LatestInvoice.HostedInvoiceURL
+	}
+	return sub, nil
+}
+
+// CancelSubscription cancels a subscription immediately
+func (p *StripeProvider) CancelSubscription(ctx context.Context, subID string) error {
+	return p.do(ctx, http.MethodDelete, "/v1/subscriptions/"+url.PathEscape(subID), nil, nil)
+}
+
+// ChangeSubscriptionPlan swaps the price of a subscription's item for the
+// plan's; the rest of the current period is prorated on the next invoice
+func (p *StripeProvider) ChangeSubscriptionPlan(ctx context.Context, subID string, plan *models.Plan) error {
+	if plan.StripePriceID == "" {
+		return fmt.Errorf("plan %s has no Stripe price: %w", plan.Name, ErrProviderUnavailable)
+	}
+
+	var current struct {
+		Items struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"items"`
+	}
+	endpoint := "/v1/subscriptions/" + url.PathEscape(subID)
+	if err := p.do(ctx, http.MethodGet, endpoint, nil, &current); err != nil {
+		return err
+	}
+	if len(current.Items.Data) == 0 {
+		return fmt.Errorf("stripe subscription %s has no items", subID)
+	}
+
+	form := url.Values{
+		"items[0][id]":       {current.Items.Data[0].ID},
+		"items[0][price]":    {plan.StripePriceID},
+		"proration_behavior": {"create_prorations"},
+	}
+	return p.do(ctx, http.MethodPost, endpoint, form, nil)
+}
+
+// ListPayments returns every invoice of a subscription
+func (p *StripeProvider) ListPayments(ctx context.Context, subID string) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	startingAfter := ""
+	for {
+		query := url.Values{
+			"subscription": {subID},
+			"limit":        {strconv.Itoa(stripePageSize)},
+		}
+		if startingAfter != "" {
+			query.Set("starting_after", startingAfter)
+		}
+
+		var page struct {
+			HasMore bool            `json:"has_more"`
+			Data    []stripeInvoice `json:"data"`
+		}
+		if err := p.do(ctx, http.MethodGet, "/v1/invoices?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, invoice := range page.Data {
+			transactions = append(transactions, *stripeTransaction(invoice, ""))
+		}
+		if !page.HasMore || len(page.Data) == 0 {
+			return transactions, nil
+		}
+		startingAfter = page.Data[len(page.Data)-1].ID
+	}
+}
+
+// VerifyWebhook checks the Stripe-Signature header: an HMAC-SHA256 of the
+// timestamp and the payload, rejected once older than the tolerance
+func (p *StripeProvider) VerifyWebhook(header http.Header, payload []byte) error {
+	if p.WebhookSecret == "" {
+		return ErrInvalidWebhook
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidWebhook
+	}
+	if age := p.now().Sub(time.Unix(ts, 0)); age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return ErrInvalidWebhook
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := []byte(hex.EncodeToString(mac.Sum(nil)))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+	return ErrInvalidWebhook
+}
+
+// ParseWebhook parses the invoice events of subscriptions; other events are ignored
+func (p *StripeProvider) ParseWebhook(ctx context.Context, payload []byte) (*PaymentEvent, error) {
+	var webhook struct {
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, fmt.Errorf("invalid Stripe webhook: %w", err)
+	}
+	if _, ok := stripeInvoiceEvents[webhook.Type]; !ok {
+		return nil, nil
+	}
+
+	var invoice stripeInvoice
+	if err := json.Unmarshal(webhook.Data.Object, &invoice); err != nil || invoice.ID == "" {
+		return nil, fmt.Errorf("stripe %s webhook without invoice", webhook.Type)
+	}
+	if invoice.subscriptionID() == "" {
+		// One-off invoices are not subscription payments
+		return nil, nil
+	}
+
+	return &PaymentEvent{
+		Event:          webhook.Type,
+		SubscriptionID: invoice.subscriptionID(),
+		Transaction:    stripeTransaction(invoice, webhook.Type),
+	}, nil
+}
+
+// do performs a form-encoded request against the Stripe API and decodes the response into out
+func (p *StripeProvider) do(ctx context.Context, method, endpoint string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.URL+endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.SecretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure) == nil && failure.Error.Message != "" {
+			return fmt.Errorf("stripe %s %s: status %d: %s", method, endpoint, resp.StatusCode, failure.Error.Message)
+		}
+		return fmt.Errorf("stripe %s %s: status %d", method, endpoint, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// stripeInvoiceEvents maps the handled invoice events to the transaction
+// status they imply; an empty status follows the invoice itself
+var stripeInvoiceEvents = map[string]string{
+	"invoice.created":              "",
+	"invoice.finalized":            "",
+	"invoice.paid":                 models.TransactionPaid,
+	"invoice.payment_succeeded":    models.TransactionPaid,
+	"invoice.payment_failed":       models.TransactionFailed,
+	"invoice.marked_uncollectible": models.TransactionFailed,
+	"invoice.voided":               models.TransactionCanceled,
+}
+
+// stripeTransaction converts a Stripe invoice. The event, when set, takes
+// precedence over the invoice status.
+func stripeTransaction(invoice stripeInvoice, event string) *models.Transaction {
+	amount := invoice.AmountDue
+	if invoice.AmountPaid > 0 {
+		amount = invoice.AmountPaid
+	}
+	tx := &models.Transaction{
+		Amount:        float64(amount) / 100,
+		Currency:      strings.ToUpper(invoice.Currency),
+		Status:        stripeStatus(invoice),
+		ProviderID:    invoice.ID,
+		InvoiceURL:    invoice.HostedInvoiceURL,
+		PaymentMethod: models.PaymentMethodCreditCard,
+	}
+	if invoice.CollectionMethod == "send_invoice" {
+		tx.PaymentMethod = models.PaymentMethodBoleto
+	}
+	if status := stripeInvoiceEvents[event]; status != "" {
+		tx.Status = status
+	}
+
+	if tx.Status == models.TransactionPaid {
+		paidAt := time.Now()
+		if invoice.StatusTransitions.PaidAt > 0 {
+			paidAt = time.Unix(invoice.StatusTransitions.PaidAt, 0)
+		}
+		tx.PaidAt = &paidAt
+	}
+	return tx
+}
+
+// stripeStatus maps the status of a Stripe invoice to a transaction status
+func stripeStatus(invoice stripeInvoice) string {
+	switch invoice.Status {
+	case "paid":
+		return models.TransactionPaid
+	case "void":
+		return models.TransactionCanceled
+	case "uncollectible":
+		return models.TransactionFailed
+	case "open":
+		if invoice.AttemptCount > 0 {
+			return models.TransactionFailed
+		}
+	}
+	return models.TransactionPending
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestStripeSubscriptionLifecycle(t *testing.T) {
+	calls := map[string]bool{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/customers/search", func(w http.ResponseWriter, r *http.Request) {
+		calls["customers.search"] = true
+		if r.URL.Query().Get("query") != "metadata['account_id']:'7'" {
+			t.Errorf("unexpected customer query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"data":[]}`))
+	})
+	mux.HandleFunc("/v1/customers", func(w http.ResponseWriter, r *http.Request) {
+		calls["customers.create"] = true
+		r.ParseForm()
+		if r.PostForm.Get("metadata[account_id]") != "7" {
+			t.Errorf("unexpected customer: %v", r.PostForm)
+		}
+		w.Write([]byte(`{"id":"cus_1"}`))
+	})
+	mux.HandleFunc("/v1/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		calls["subscriptions.create"] = true
+		r.ParseForm()
+		if r.Header.Get("Authorization") != "Bearer sk_test" || r.PostForm.Get("customer") != "cus_1" ||
+			r.PostForm.Get("items[0][price]") != "price_pro" || r.PostForm.Get("collection_method") != "send_invoice" {
+			t.Errorf("unexpected subscription: %v", r.PostForm)
+		}
+		w.Write([]byte(`{"id":"sub_1","latest_invoice":{"id":"in_1","hosted_invoice_url":"https://invoice.stripe.com/i/in_1"}}`))
+	})
+	mux.HandleFunc("/v1/subscriptions/sub_1", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			calls["subscriptions.delete"] = true
+		case http.MethodPost:
+			calls["subscriptions.update"] = true
+			r.ParseForm()
+			if r.PostForm.Get("items[0][id]") != "si_1" || r.PostForm.Get("items[0][price]") != "price_max" {
+				t.Errorf("unexpected plan change: %v", r.PostForm)
+			}
+		}
+		w.Write([]byte(`{"id":"sub_1","status":"active","items":{"data":[{"id":"si_1","price":{"id":"price_pro"}}]}}`))
+	})
+	mux.HandleFunc("/v1/invoices", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("starting_after") == "" {
+			fmt.Fprint(w, `{"has_more":true,"data":[{"id":"in_1","status":"paid","amount_paid":9990,"currency":"brl","status_transitions":{"paid_at":1739181600}}]}`)
+			return
+		}
+		if r.URL.Query().Get("starting_after") != "in_1" {
+			t.Errorf("unexpected cursor: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"has_more":false,"data":[{"id":"in_2","status":"open","attempt_count":2,"amount_due":9990,"currency":"brl"}]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewStripeProvider("sk_test", "")
+	p.URL = srv.URL
+	ctx := context.Background()
+
+	customerID, err := p.CreateCustomer(ctx, PaymentCustomer{AccountID: 7, Name: "Acme"})
+	if err != nil || customerID != "cus_1" {
+		t.Fatalf("create customer: %q, %v", customerID, err)
+	}
+
+	plan := &models.Plan{Name: "Pro", Price: 99.9, StripePriceID: "price_pro"}
+	sub, err := p.CreateSubscription(ctx, SubscriptionRequest{CustomerID: customerID, AccountID: 7, Plan: plan, PaymentMethod: models.PaymentMethodBoleto})
+	if err != nil || sub.ID != "sub_1" || sub.CheckoutURL != "https://invoice.stripe.com/i/in_1" {
+		t.Fatalf("create subscription: %+v, %v", sub, err)
+	}
+	if _, err := p.CreateSubscription(ctx, SubscriptionRequest{Plan: plan, PaymentMethod: models.PaymentMethodPix}); err != ErrInvalidPaymentMethod {
+		t.Fatalf("pix should be rejected, got %v", err)
+	}
+
+	payments, err := p.ListPayments(ctx, "sub_1")
+	if err != nil {
+		t.Fatalf("list payments: %v", err)
+	}
+	if len(payments) != 2 || payments[0].Status != models.TransactionPaid || payments[0].Amount != 99.9 || payments[0].Currency != "BRL" ||
+		payments[1].Status != models.TransactionFailed {
+		t.Fatalf("unexpected payments: %+v", payments)
+	}
+
+	if err := p.ChangeSubscriptionPlan(ctx, "sub_1", &models.Plan{Name: "Max", StripePriceID: "price_max"}); err != nil {
+		t.Fatalf("change plan: %v", err)
+	}
+
+	if err := p.CancelSubscription(ctx, "sub_1"); err != nil {
+		t.Fatalf("cancel subscription: %v", err)
+	}
+	for _, call := range []string{"customers.search", "customers.create", "subscriptions.create", "subscriptions.update", "subscriptions.delete"} {
+		if !calls[call] {
+			t.Fatalf("%s was not called", call)
+		}
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := NewStripeProvider("sk_test", "whsec")
+	p.now = func() time.Time { return now }
+
+	payload := []byte(`{"type":"invoice.payment_failed","data":{"object":{"id":"in_3","status":"open","amount_due":4990,"currency":"brl","parent":{"subscription_details":{"subscription":"sub_1"}}}}}`)
+	sign := func(ts int64) string {
+		mac := hmac.New(sha256.New, []byte("whsec"))
+		fmt.Fprintf(mac, "%d.%s", ts, payload)
+		return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", sign(now.Unix()))
+	if err := p.VerifyWebhook(header, payload); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	header.Set("Stripe-Signature", sign(now.Add(-10*time.Minute).Unix()))
+	if err := p.VerifyWebhook(header, payload); err != ErrInvalidWebhook {
+		t.Fatalf("stale signature should be rejected, got %v", err)
+	}
+
+	ctx := context.Background()
+	event, err := p.ParseWebhook(ctx, payload)
+	if err != nil {
+		t.Fatalf("parse webhook: %v", err)
+	}
+	if event.SubscriptionID != "sub_1" || event.Transaction.Status != models.TransactionFailed || event.Transaction.Amount != 49.9 {
+		t.Fatalf("unexpected event: %+v %+v", event, event.Transaction)
+	}
+
+	event, err = p.ParseWebhook(ctx, []byte(`{"type":"customer.created","data":{"object":{"id":"cus_1"}}}`))
+	if err != nil || event != nil {
+		t.Fatalf("other events should be ignored: %+v, %v", event, err)
+	}
+}
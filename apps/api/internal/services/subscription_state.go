@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"whatpro-hub/internal/config"
+	"whatpro-hub/internal/models"
+)
+
+// ErrInvalidTransition is returned when a subscription cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid subscription status transition")
+
+// subscriptionTransitions lists the statuses each status may move to. A paid
+// charge brings any live subscription back to active; canceled is final.
+var subscriptionTransitions = map[string][]string{
+	models.SubscriptionPending:   {models.SubscriptionActive, models.SubscriptionPastDue, models.SubscriptionCanceled},
+	models.SubscriptionTrial:     {models.SubscriptionActive, models.SubscriptionPastDue, models.SubscriptionCanceled},
+	models.SubscriptionActive:    {models.SubscriptionPastDue, models.SubscriptionCanceled},
+	models.SubscriptionPastDue:   {models.SubscriptionActive, models.SubscriptionSuspended, models.SubscriptionCanceled},
+	models.SubscriptionSuspended: {models.SubscriptionActive, models.SubscriptionCanceled},
+	models.SubscriptionCanceled:  {},
+}
+
+// TransitionSubscription moves a subscription to a new status at the given
+// time and keeps its dunning fields in step. Moving to the current status is a no-op.
+func TransitionSubscription(sub *models.Subscription, to string, at time.Time) error {
+	if sub.Status == to {
+		return nil
+	}
+
+	allowed := false
+	for _, status := range subscriptionTransitions[sub.Status] {
+		if status == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, sub.Status, to)
+	}
+
+	switch to {
+	case models.SubscriptionActive:
+		sub.PastDueSince = nil
+		sub.SuspendedAt = nil
+		sub.RemindersSent = 0
+		sub.LastReminderAt = nil
+	case models.SubscriptionPastDue:
+		sub.PastDueSince = &at
+		sub.RemindersSent = 0
+		sub.LastReminderAt = nil
+	case models.SubscriptionSuspended:
+		sub.SuspendedAt = &at
+	case models.SubscriptionCanceled:
+		sub.CanceledAt = &at
+	}
+	sub.Status = to
+	return nil
+}
+
+// DunningPolicy decides when unpaid subscriptions are suspended, canceled and reminded
+type DunningPolicy struct {
+	GracePeriod  time.Duration   // From past due to suspended
+	CancelAfter  time.Duration   // From suspended to canceled; 0 never cancels
+	ReminderDays []time.Duration // Offsets from the due date at which reminders are sent
+}
+
+// NewDunningPolicy returns the dunning policy configured by BILLING_* variables
+func NewDunningPolicy(cfg *config.Config) DunningPolicy {
+	policy := DunningPolicy{
+		GracePeriod: time.Duration(cfg.BillingGraceDays) * 24 * time.Hour,
+		CancelAfter: time.Duration(cfg.BillingCancelAfterDays) * 24 * time.Hour,
+	}
+	for _, days := range cfg.BillingReminderDays {
+		policy.ReminderDays = append(policy.ReminderDays, time.Duration(days)*24*time.Hour)
+	}
+	return policy
+}
+
+// Next returns the status a subscription is due to move to at now, and when
+// the move took effect. Trials end at TrialEndsAt and unpaid periods at
+// CurrentPeriodEnd; both go past due and then through the grace period.
+func (p DunningPolicy) Next(sub *models.Subscription, now time.Time) (string, time.Time, bool) {
+	switch sub.Status {
+	case models.SubscriptionTrial:
+		if sub.TrialEndsAt != nil && !now.Before(*sub.TrialEndsAt) {
+			return models.SubscriptionPastDue, *sub.TrialEndsAt, true
+		}
+	case models.SubscriptionActive:
+		if !sub.CurrentPeriodEnd.IsZero() && !now.Before(sub.CurrentPeriodEnd) {
+			return models.SubscriptionPastDue, sub.CurrentPeriodEnd, true
+		}
+	case models.SubscriptionPastDue:
+		if sub.PastDueSince != nil {
+			if at := sub.PastDueSince.Add(p.GracePeriod); !now.Before(at) {
+				return models.SubscriptionSuspended, at, true
+			}
+		}
+	case models.SubscriptionSuspended:
+		if p.CancelAfter > 0 && sub.SuspendedAt != nil {
+			if at := sub.SuspendedAt.Add(p.CancelAfter); !now.Before(at) {
+				return models.SubscriptionCanceled, at, true
+			}
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// ReminderDue tells whether the next payment reminder of a past due subscription is due at now
+func (p DunningPolicy) ReminderDue(sub *models.Subscription, now time.Time) bool {
+	if sub.Status != models.SubscriptionPastDue || sub.PastDueSince == nil || sub.RemindersSent >= len(p.ReminderDays) {
+		return false
+	}
+	return !now.Before(sub.PastDueSince.Add(p.ReminderDays[sub.RemindersSent]))
+}
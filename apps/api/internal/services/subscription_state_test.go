@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"whatpro-hub/internal/models"
+)
+
+func TestTransitionSubscription(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	sub := &models.Subscription{Status: models.SubscriptionActive, RemindersSent: 2}
+
+	if err := TransitionSubscription(sub, models.SubscriptionPastDue, now); err != nil {
+		t.Fatalf("active to past_due: %v", err)
+	}
+	if sub.PastDueSince == nil || !sub.PastDueSince.Equal(now) || sub.RemindersSent != 0 {
+		t.Fatalf("past_due fields not set: %+v", sub)
+	}
+	if err := TransitionSubscription(sub, models.SubscriptionSuspended, now); err != nil || sub.SuspendedAt == nil {
+		t.Fatalf("past_due to suspended: %+v, %v", sub, err)
+	}
+	if err := TransitionSubscription(sub, models.SubscriptionActive, now); err != nil {
+		t.Fatalf("suspended to active: %v", err)
+	}
+	if sub.PastDueSince != nil || sub.SuspendedAt != nil {
+		t.Fatalf("payment should clear the dunning fields: %+v", sub)
+	}
+
+	if err := TransitionSubscription(sub, models.SubscriptionSuspended, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("active cannot be suspended without going past due, got %v", err)
+	}
+	if err := TransitionSubscription(sub, models.SubscriptionCanceled, now); err != nil || sub.CanceledAt == nil {
+		t.Fatalf("active to canceled: %+v, %v", sub, err)
+	}
+	if err := TransitionSubscription(sub, models.SubscriptionActive, now); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("canceled is final, got %v", err)
+	}
+}
+
+func TestDunningPolicy(t *testing.T) {
+	day := 24 * time.Hour
+	policy := DunningPolicy{GracePeriod: 7 * day, CancelAfter: 30 * day, ReminderDays: []time.Duration{0, 3 * day}}
+	trialEnd := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	sub := &models.Subscription{Status: models.SubscriptionTrial, TrialEndsAt: &trialEnd}
+
+	if _, _, ok := policy.Next(sub, trialEnd.Add(-time.Hour)); ok {
+		t.Fatalf("trial should run until TrialEndsAt")
+	}
+
+	// Ten days after the trial the subscription went past due and then suspended
+	now := trialEnd.Add(10 * day)
+	for {
+		to, at, ok := policy.Next(sub, now)
+		if !ok {
+			break
+		}
+		if err := TransitionSubscription(sub, to, at); err != nil {
+			t.Fatalf("transition to %s: %v", to, err)
+		}
+	}
+	if sub.Status != models.SubscriptionSuspended || !sub.PastDueSince.Equal(trialEnd) || !sub.SuspendedAt.Equal(trialEnd.Add(7*day)) {
+		t.Fatalf("unexpected subscription: %s %v %v", sub.Status, sub.PastDueSince, sub.SuspendedAt)
+	}
+
+	if to, _, ok := policy.Next(sub, trialEnd.Add(37*day)); !ok || to != models.SubscriptionCanceled {
+		t.Fatalf("suspended subscriptions should be canceled after CancelAfter, got %q %v", to, ok)
+	}
+
+	pastDue := &models.Subscription{Status: models.SubscriptionPastDue, PastDueSince: &trialEnd}
+	if !policy.ReminderDue(pastDue, trialEnd) {
+		t.Fatalf("first reminder is due on the due date")
+	}
+	pastDue.RemindersSent = 1
+	if policy.ReminderDue(pastDue, trialEnd.Add(2*day)) || !policy.ReminderDue(pastDue, trialEnd.Add(3*day)) {
+		t.Fatalf("second reminder is due three days later")
+	}
+	pastDue.RemindersSent = 2
+	if policy.ReminderDue(pastDue, trialEnd.Add(6*day)) {
+		t.Fatalf("no reminders past the schedule")
+	}
+}
@@ -0,0 +1,604 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/repositories"
+	"whatpro-hub/pkg/chatwoot"
+)
+
+// Sync triggers
+const (
+	SyncTriggerSchedule = "schedule"
+	SyncTriggerManual   = "manual"
+)
+
+// maxSyncReports caps how many reports are listed at once
+const maxSyncReports = 100
+
+// ErrSyncInProgress is returned when a sync of the account is already queued
+var ErrSyncInProgress = errors.New("a sync of this account is already queued")
+
+// SyncQueue hands account syncs to the background worker
+type SyncQueue interface {
+	EnqueueSync(ctx context.Context, accountID int) error
+}
+
+// SyncCounts tallies the changes a sync made to one kind of entity
+type SyncCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Skipped   int `json:"skipped,omitempty"`    // Agents linked to another account
+	OverQuota int `json:"over_quota,omitempty"` // Not mirrored because the account reached its plan limit
+}
+
+// SyncService mirrors the users, teams, team memberships, inboxes and labels
+// of Chatwoot accounts. Chatwoot is the source of truth: rows are created or
+// updated from it, and rows of entities gone upstream are soft-deleted.
+type SyncService struct {
+	repo         *repositories.SyncRepository
+	accounts     *repositories.AccountRepository
+	sessions     repositories.SessionRepository
+	entitlements *EntitlementsService
+	chatwoot     *chatwoot.Client
+	queue        SyncQueue
+	now          func() time.Time
+}
+
+// NewSyncService creates a new SyncService
+func NewSyncService(repo *repositories.SyncRepository, accounts *repositories.AccountRepository, sessions repositories.SessionRepository, entitlements *EntitlementsService, client *chatwoot.Client, queue SyncQueue) *SyncService {
+	return &SyncService{
+		repo:         repo,
+		accounts:     accounts,
+		sessions:     sessions,
+		entitlements: entitlements,
+		chatwoot:     client,
+		queue:        queue,
+		now:          time.Now,
+	}
+}
+
+// Enqueue queues a sync of an account, by Chatwoot account ID
+func (s *SyncService) Enqueue(ctx context.Context, accountID int) error {
+	if _, err := s.accounts.FindByChatwootID(ctx, accountID); err != nil {
+		return err
+	}
+	return s.queue.EnqueueSync(ctx, accountID)
+}
+
+// ListReports returns the latest sync reports of an account
+func (s *SyncService) ListReports(ctx context.Context, accountID, limit int) ([]models.SyncReport, error) {
+	if limit < 1 || limit > maxSyncReports {
+		limit = maxSyncReports
+	}
+	return s.repo.ListReports(ctx, accountID, limit)
+}
+
+// GetReport returns a sync report of an account
+func (s *SyncService) GetReport(ctx context.Context, accountID int, id uuid.UUID) (*models.SyncReport, error) {
+	return s.repo.FindReport(ctx, accountID, id)
+}
+
+// SyncAll syncs every active account and returns their reports
+func (s *SyncService) SyncAll(ctx context.Context, trigger string) ([]models.SyncReport, error) {
+	accounts, err := s.accounts.FindAll(ctx, map[string]interface{}{"status": "active"})
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []models.SyncReport
+	for _, account := range accounts {
+		if account.ChatwootID == 0 {
+			continue
+		}
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+		report, err := s.SyncAccount(ctx, account.ChatwootID, trigger)
+		if err != nil {
+			return reports, fmt.Errorf("account %d: %w", account.ChatwootID, err)
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// SyncAccount syncs one account, by Chatwoot account ID, and stores its report.
+// Failures to fetch or write an entity are recorded in the report; an error is
+// only returned when the report itself cannot be stored.
+func (s *SyncService) SyncAccount(ctx context.Context, accountID int, trigger string) (*models.SyncReport, error) {
+	run := &syncRun{accountID: accountID, counts: map[string]*SyncCounts{}}
+	startedAt := s.now()
+
+	// The list calls fail on error responses instead of returning nothing, so
+	// a Chatwoot outage cannot remove every mirrored row
+	var users map[int]uint
+	if agents, err := s.chatwoot.ListAgents(ctx, accountID); err != nil {
+		run.fail("users: %v", err)
+	} else {
+		users = s.syncUsers(ctx, run, agents)
+	}
+
+	if teams, err := s.chatwoot.ListTeams(ctx, accountID); err != nil {
+		run.fail("teams: %v", err)
+	} else {
+		synced := s.syncTeams(ctx, run, teams)
+		// Without the agents, members cannot be matched to users
+		if users != nil && synced != nil {
+			s.syncTeamMembers(ctx, run, synced, users)
+		}
+	}
+
+	if inboxes, err := s.chatwoot.ListInboxes(ctx, accountID); err != nil {
+		run.fail("inboxes: %v", err)
+	} else {
+		s.syncInboxes(ctx, run, inboxes)
+	}
+
+	if labels, err := s.chatwoot.ListLabels(ctx, accountID); err != nil {
+		run.fail("labels: %v", err)
+	} else {
+		s.syncLabels(ctx, run, labels)
+	}
+
+	report := &models.SyncReport{
+		AccountID:  accountID,
+		Trigger:    trigger,
+		Status:     run.status(),
+		Counts:     run.countsJSON(),
+		Errors:     models.StringArray(run.errors),
+		OverQuota:  run.overQuota(),
+		StartedAt:  startedAt,
+		FinishedAt: s.now(),
+	}
+	if report.Errors == nil {
+		report.Errors = models.StringArray{}
+	}
+	if err := s.repo.CreateReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[SYNC] Account %d synced (%s): %v", accountID, report.Status, report.Counts)
+	if report.OverQuota {
+		log.Printf("[SYNC] Account %d is over its plan limits; the entities over them were not mirrored", accountID)
+	}
+	return report, nil
+}
+
+// syncUsers mirrors the agents of the account and returns the local user ID of each agent
+func (s *SyncService) syncUsers(ctx context.Context, run *syncRun, agents []chatwoot.User) map[int]uint {
+	var existing []models.User
+	if err := s.repo.FindMirrored(ctx, run.accountID, &existing); err != nil {
+		run.fail("users: %v", err)
+		return nil
+	}
+	counts := run.count("users")
+	byChatwootID := make(map[int]*models.User, len(existing))
+	for i := range existing {
+		byChatwootID[existing[i].ChatwootID] = &existing[i]
+	}
+
+	// A user belongs to one account. Agents of several Chatwoot accounts stay
+	// with the account they were first seen in, unless they were removed there.
+	var unknown []int
+	for _, agent := range agents {
+		if byChatwootID[agent.ID] == nil {
+			unknown = append(unknown, agent.ID)
+		}
+	}
+	elsewhere, err := s.repo.FindUsersByChatwootIDs(ctx, unknown)
+	if err != nil {
+		run.fail("users: %v", err)
+		return nil
+	}
+	linked := make(map[int]bool)
+	for i := range elsewhere {
+		if elsewhere[i].DeletedAt.Valid {
+			byChatwootID[elsewhere[i].ChatwootID] = &elsewhere[i]
+		} else {
+			linked[elsewhere[i].ChatwootID] = true
+		}
+	}
+
+	users := make(map[int]uint, len(agents))
+	seen := make(map[int]bool, len(agents))
+	for _, agent := range agents {
+		seen[agent.ID] = true
+		if linked[agent.ID] {
+			counts.Skipped++
+			continue
+		}
+
+		user := byChatwootID[agent.ID]
+		// Agents count against MaxAgents: the ones over it are not mirrored, so they cannot sign in
+		if (user == nil || user.DeletedAt.Valid || user.AccountID != run.accountID) && s.quotaReached(run, "agent", counts, agent.ID) {
+			continue
+		}
+		if user == nil {
+			user = &models.User{
+				ChatwootID:  agent.ID,
+				AccountID:   run.accountID,
+				WhatproRole: WhatproRoleFor(agent.Role),
+			}
+			applyUser(user, agent)
+			if err := s.repo.Create(ctx, user); err != nil {
+				run.fail("user %d: %v", agent.ID, err)
+				continue
+			}
+			users[agent.ID] = user.ID
+			counts.Created++
+			continue
+		}
+
+		// Kept even when the update fails, so the agent keeps their memberships
+		users[agent.ID] = user.ID
+		if applyUser(user, agent) || user.DeletedAt.Valid || user.AccountID != run.accountID {
+			user.AccountID = run.accountID
+			user.DeletedAt = gorm.DeletedAt{}
+			if err := s.repo.Save(ctx, user); err != nil {
+				run.fail("user %d: %v", agent.ID, err)
+				continue
+			}
+			counts.Updated++
+		}
+	}
+
+	for _, user := range existing {
+		if seen[user.ChatwootID] || user.DeletedAt.Valid {
+			continue
+		}
+		if err := s.repo.Remove(ctx, &models.User{}, user.ID); err != nil {
+			run.fail("user %d: %v", user.ChatwootID, err)
+			continue
+		}
+		// Removed agents lose access right away
+		if err := s.sessions.RevokeAllForUser(int(user.ID)); err != nil {
+			run.fail("user %d: failed to revoke sessions: %v", user.ChatwootID, err)
+		}
+		counts.Removed++
+	}
+
+	return users
+}
+
+// syncTeams mirrors the teams of the account and returns the local ID of each team
+func (s *SyncService) syncTeams(ctx context.Context, run *syncRun, teams []chatwoot.Team) map[int]uint {
+	var existing []models.Team
+	if err := s.repo.FindMirrored(ctx, run.accountID, &existing); err != nil {
+		run.fail("teams: %v", err)
+		return nil
+	}
+	counts := run.count("teams")
+	byChatwootID := make(map[int]*models.Team, len(existing))
+	for i := range existing {
+		byChatwootID[existing[i].ChatwootID] = &existing[i]
+	}
+
+	synced := make(map[int]uint, len(teams))
+	seen := make(map[int]bool, len(teams))
+	for _, cw := range teams {
+		seen[cw.ID] = true
+		team := byChatwootID[cw.ID]
+		if (team == nil || team.DeletedAt.Valid) && s.quotaReached(run, "team", counts, cw.ID) {
+			continue
+		}
+		if team == nil {
+			team = &models.Team{ChatwootID: cw.ID, AccountID: run.accountID}
+			applyTeam(team, cw)
+			if err := s.repo.Create(ctx, team); err != nil {
+				run.fail("team %d: %v", cw.ID, err)
+				continue
+			}
+			synced[cw.ID] = team.ID
+			counts.Created++
+			continue
+		}
+
+		synced[cw.ID] = team.ID
+		if applyTeam(team, cw) || team.DeletedAt.Valid {
+			team.DeletedAt = gorm.DeletedAt{}
+			if err := s.repo.Save(ctx, team); err != nil {
+				run.fail("team %d: %v", cw.ID, err)
+				continue
+			}
+			counts.Updated++
+		}
+	}
+
+	for _, team := range existing {
+		if seen[team.ChatwootID] || team.DeletedAt.Valid {
+			continue
+		}
+		if err := s.repo.Remove(ctx, &models.Team{}, team.ID); err != nil {
+			run.fail("team %d: %v", team.ChatwootID, err)
+			continue
+		}
+		counts.Removed++
+	}
+
+	return synced
+}
+
+// syncTeamMembers mirrors the members of the synced teams. Memberships are
+// plain links, so the ones gone upstream are deleted.
+func (s *SyncService) syncTeamMembers(ctx context.Context, run *syncRun, teams map[int]uint, users map[int]uint) {
+	teamIDs := make([]uint, 0, len(teams))
+	for _, id := range teams {
+		teamIDs = append(teamIDs, id)
+	}
+	existing, err := s.repo.FindTeamMembers(ctx, teamIDs)
+	if err != nil {
+		run.fail("team members: %v", err)
+		return
+	}
+	counts := run.count("team_members")
+	current := make(map[uint]map[uint]uint, len(teams)) // team -> user -> membership
+	for _, m := range existing {
+		if current[m.TeamID] == nil {
+			current[m.TeamID] = make(map[uint]uint)
+		}
+		current[m.TeamID][m.UserID] = m.ID
+	}
+
+	for chatwootTeamID, teamID := range teams {
+		members, err := s.chatwoot.ListTeamMembers(ctx, run.accountID, chatwootTeamID)
+		if err != nil {
+			run.fail("team %d members: %v", chatwootTeamID, err)
+			continue
+		}
+
+		wanted := make(map[uint]bool, len(members))
+		for _, member := range members {
+			userID, ok := users[member.ID]
+			if !ok {
+				continue
+			}
+			wanted[userID] = true
+			if _, ok := current[teamID][userID]; ok {
+				continue
+			}
+			if err := s.repo.AddTeamMember(ctx, teamID, userID); err != nil {
+				run.fail("team %d member %d: %v", chatwootTeamID, member.ID, err)
+				continue
+			}
+			counts.Created++
+		}
+
+		for userID, membershipID := range current[teamID] {
+			if wanted[userID] {
+				continue
+			}
+			if err := s.repo.RemoveTeamMember(ctx, membershipID); err != nil {
+				run.fail("team %d membership %d: %v", chatwootTeamID, membershipID, err)
+				continue
+			}
+			counts.Removed++
+		}
+	}
+}
+
+// syncInboxes mirrors the inboxes of the account
+func (s *SyncService) syncInboxes(ctx context.Context, run *syncRun, inboxes []chatwoot.Inbox) {
+	var existing []models.Inbox
+	if err := s.repo.FindMirrored(ctx, run.accountID, &existing); err != nil {
+		run.fail("inboxes: %v", err)
+		return
+	}
+	counts := run.count("inboxes")
+	byChatwootID := make(map[int]*models.Inbox, len(existing))
+	for i := range existing {
+		byChatwootID[existing[i].ChatwootID] = &existing[i]
+	}
+
+	seen := make(map[int]bool, len(inboxes))
+	for _, cw := range inboxes {
+		seen[cw.ID] = true
+		inbox := byChatwootID[cw.ID]
+		// Inboxes count against MaxInboxes: the ones over it are not mirrored, so no provider can serve them
+		if (inbox == nil || inbox.DeletedAt.Valid) && s.quotaReached(run, "inbox", counts, cw.ID) {
+			continue
+		}
+		if inbox == nil {
+			inbox = &models.Inbox{ChatwootID: cw.ID, AccountID: run.accountID}
+			applyInbox(inbox, cw)
+			if err := s.repo.Create(ctx, inbox); err != nil {
+				run.fail("inbox %d: %v", cw.ID, err)
+				continue
+			}
+			counts.Created++
+		} else if applyInbox(inbox, cw) || inbox.DeletedAt.Valid {
+			inbox.DeletedAt = gorm.DeletedAt{}
+			if err := s.repo.Save(ctx, inbox); err != nil {
+				run.fail("inbox %d: %v", cw.ID, err)
+				continue
+			}
+			counts.Updated++
+		}
+	}
+
+	for _, inbox := range existing {
+		if seen[inbox.ChatwootID] || inbox.DeletedAt.Valid {
+			continue
+		}
+		if err := s.repo.RemoveInbox(ctx, inbox.ID); err != nil {
+			run.fail("inbox %d: %v", inbox.ChatwootID, err)
+			continue
+		}
+		counts.Removed++
+	}
+}
+
+// syncLabels mirrors the labels of the account
+func (s *SyncService) syncLabels(ctx context.Context, run *syncRun, labels []chatwoot.Label) {
+	var existing []models.Label
+	if err := s.repo.FindMirrored(ctx, run.accountID, &existing); err != nil {
+		run.fail("labels: %v", err)
+		return
+	}
+	counts := run.count("labels")
+	byChatwootID := make(map[int]*models.Label, len(existing))
+	for i := range existing {
+		byChatwootID[existing[i].ChatwootID] = &existing[i]
+	}
+
+	seen := make(map[int]bool, len(labels))
+	for _, cw := range labels {
+		seen[cw.ID] = true
+		label := byChatwootID[cw.ID]
+		if label == nil {
+			label = &models.Label{ChatwootID: cw.ID, AccountID: run.accountID}
+			applyLabel(label, cw)
+			if err := s.repo.Create(ctx, label); err != nil {
+				run.fail("label %d: %v", cw.ID, err)
+				continue
+			}
+			counts.Created++
+		} else if applyLabel(label, cw) || label.DeletedAt.Valid {
+			label.DeletedAt = gorm.DeletedAt{}
+			if err := s.repo.Save(ctx, label); err != nil {
+				run.fail("label %d: %v", cw.ID, err)
+				continue
+			}
+			counts.Updated++
+		}
+	}
+
+	for _, label := range existing {
+		if seen[label.ChatwootID] || label.DeletedAt.Valid {
+			continue
+		}
+		if err := s.repo.Remove(ctx, &models.Label{}, label.ID); err != nil {
+			run.fail("label %d: %v", label.ChatwootID, err)
+			continue
+		}
+		counts.Removed++
+	}
+}
+
+// WhatproRoleFor maps a Chatwoot role to the WhatPro role given to new users
+func WhatproRoleFor(chatwootRole string) string {
+	if chatwootRole == "administrator" {
+		return "admin"
+	}
+	return "agent"
+}
+
+// applyUser copies the Chatwoot fields of an agent and reports whether any
+// changed. The WhatPro role is managed locally and never overwritten.
+func applyUser(user *models.User, agent chatwoot.User) bool {
+	changed := user.Email != agent.Email || user.Name != agent.Name || user.AvatarURL != agent.AvatarURL ||
+		user.ChatwootRole != agent.Role || user.AvailabilityStatus != agent.AvailabilityStatus
+	user.Email = agent.Email
+	user.Name = agent.Name
+	user.AvatarURL = agent.AvatarURL
+	user.ChatwootRole = agent.Role
+	user.AvailabilityStatus = agent.AvailabilityStatus
+	return changed
+}
+
+// applyTeam copies the Chatwoot fields of a team and reports whether any changed
+func applyTeam(team *models.Team, cw chatwoot.Team) bool {
+	changed := team.Name != cw.Name || team.Description != cw.Description || team.AllowAutoAssign != cw.AllowAutoAssign
+	team.Name = cw.Name
+	team.Description = cw.Description
+	team.AllowAutoAssign = cw.AllowAutoAssign
+	return changed
+}
+
+// applyInbox copies the Chatwoot fields of an inbox and reports whether any changed
+func applyInbox(inbox *models.Inbox, cw chatwoot.Inbox) bool {
+	changed := inbox.Name != cw.Name || inbox.ChannelType != cw.ChannelType || inbox.EnableAutoAssign != cw.EnableAutoAssign
+	inbox.Name = cw.Name
+	inbox.ChannelType = cw.ChannelType
+	inbox.EnableAutoAssign = cw.EnableAutoAssign
+	return changed
+}
+
+// applyLabel copies the Chatwoot fields of a label and reports whether any changed
+func applyLabel(label *models.Label, cw chatwoot.Label) bool {
+	changed := label.Title != cw.Title || label.Description != cw.Description || label.Color != cw.Color ||
+		label.ShowOnSidebar != cw.ShowOnSidebar
+	label.Title = cw.Title
+	label.Description = cw.Description
+	label.Color = cw.Color
+	label.ShowOnSidebar = cw.ShowOnSidebar
+	return changed
+}
+
+// syncRun collects the counts and errors of one account sync
+type syncRun struct {
+	accountID int
+	counts    map[string]*SyncCounts
+	errors    []string
+}
+
+// count returns the counts of an entity, marking it as synced
+func (r *syncRun) count(entity string) *SyncCounts {
+	if r.counts[entity] == nil {
+		r.counts[entity] = &SyncCounts{}
+	}
+	return r.counts[entity]
+}
+
+// quotaReached tells whether the account reached its limit of a resource, in
+// which case the Chatwoot entity is counted as over quota instead of mirrored
+func (s *SyncService) quotaReached(run *syncRun, resource string, counts *SyncCounts, chatwootID int) bool {
+	err := s.entitlements.CanCreateResource(run.accountID, resource)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrQuotaExceeded):
+		counts.OverQuota++
+	default:
+		run.fail("%s %d: %v", resource, chatwootID, err)
+	}
+	return true
+}
+
+// overQuota tells whether any entity was left out for the plan limits
+func (r *syncRun) overQuota() bool {
+	for _, c := range r.counts {
+		if c.OverQuota > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *syncRun) fail(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// status is failed when no entity could be synced at all
+func (r *syncRun) status() string {
+	switch {
+	case len(r.errors) == 0:
+		return models.SyncStatusSuccess
+	case len(r.counts) == 0:
+		return models.SyncStatusFailed
+	default:
+		return models.SyncStatusPartial
+	}
+}
+
+func (r *syncRun) countsJSON() models.JSON {
+	counts := models.JSON{}
+	for entity, c := range r.counts {
+		counts[entity] = map[string]interface{}{
+			"created":    c.Created,
+			"updated":    c.Updated,
+			"removed":    c.Removed,
+			"skipped":    c.Skipped,
+			"over_quota": c.OverQuota,
+		}
+	}
+	return counts
+}
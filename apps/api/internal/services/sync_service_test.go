@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+
+	"whatpro-hub/internal/models"
+	"whatpro-hub/pkg/chatwoot"
+)
+
+func TestApplyUserKeepsWhatproRole(t *testing.T) {
+	user := &models.User{Name: "Ana", Email: "ana@example.com", ChatwootRole: "agent", WhatproRole: "supervisor"}
+	agent := chatwoot.User{ID: 7, Name: "Ana", Email: "ana@example.com", Role: "agent"}
+
+	if applyUser(user, agent) {
+		t.Fatalf("unchanged agent should not be reported as changed")
+	}
+
+	agent.Role = "administrator"
+	if !applyUser(user, agent) {
+		t.Fatalf("role change should be reported")
+	}
+	if user.ChatwootRole != "administrator" || user.WhatproRole != "supervisor" {
+		t.Fatalf("unexpected roles: chatwoot %q, whatpro %q", user.ChatwootRole, user.WhatproRole)
+	}
+}
+
+func TestSyncRunStatus(t *testing.T) {
+	run := &syncRun{counts: map[string]*SyncCounts{}}
+	run.fail("users: status 500")
+	if status := run.status(); status != models.SyncStatusFailed {
+		t.Fatalf("run with no synced entity should fail, got %s", status)
+	}
+
+	run.count("labels").Created++
+	if status := run.status(); status != models.SyncStatusPartial {
+		t.Fatalf("run with errors and synced entities should be partial, got %s", status)
+	}
+
+	ok := &syncRun{counts: map[string]*SyncCounts{}}
+	ok.count("teams").Removed++
+	if status := ok.status(); status != models.SyncStatusSuccess {
+		t.Fatalf("run without errors should succeed, got %s", status)
+	}
+	counts := ok.countsJSON()["teams"].(map[string]interface{})
+	if counts["removed"] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+
+	if ok.overQuota() {
+		t.Fatalf("run without over quota entities reported over quota")
+	}
+	ok.count("inboxes").OverQuota++
+	if !ok.overQuota() || ok.status() != models.SyncStatusSuccess {
+		t.Fatalf("entities over quota are reported, not failed: %s", ok.status())
+	}
+}
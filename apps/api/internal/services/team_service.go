@@ -8,12 +8,14 @@ import (
 )
 
 type TeamService struct {
-	repo     *repositories.TeamRepository
-	userRepo repositories.UserRepository
+	repo         *repositories.TeamRepository
+	userRepo     repositories.UserRepository
+	entitlements *EntitlementsService
 }
 
-func NewTeamService(repo *repositories.TeamRepository, userRepo repositories.UserRepository) *TeamService {
-	return &TeamService{repo: repo, userRepo: userRepo}
+// NewTeamService creates a new TeamService; teams count against MaxTeams when entitlements is set
+func NewTeamService(repo *repositories.TeamRepository, userRepo repositories.UserRepository, entitlements *EntitlementsService) *TeamService {
+	return &TeamService{repo: repo, userRepo: userRepo, entitlements: entitlements}
 }
 
 func (s *TeamService) ListTeams(ctx context.Context, filters map[string]interface{}) ([]models.Team, error) {
@@ -26,6 +28,11 @@ func (s *TeamService) GetTeam(ctx context.Context, accountID int, id uint) (*mod
 
 func (s *TeamService) CreateTeam(ctx context.Context, team *models.Team) error {
 	// Add business logic here if needed (e.g., duplicate name check in account)
+	if s.entitlements != nil {
+		if err := s.entitlements.CanCreateResource(team.AccountID, "team"); err != nil {
+			return err
+		}
+	}
 	return s.repo.Create(ctx, team)
 }
 
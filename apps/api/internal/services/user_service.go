@@ -8,11 +8,13 @@ import (
 )
 
 type UserService struct {
-	repo repositories.UserRepository
+	repo         repositories.UserRepository
+	entitlements *EntitlementsService
 }
 
-func NewUserService(repo repositories.UserRepository) *UserService {
-	return &UserService{repo: repo}
+// NewUserService creates a new UserService; users count against MaxAgents when entitlements is set
+func NewUserService(repo repositories.UserRepository, entitlements *EntitlementsService) *UserService {
+	return &UserService{repo: repo, entitlements: entitlements}
 }
 
 func (s *UserService) ListUsers(ctx context.Context, filters map[string]interface{}) ([]models.User, error) {
@@ -28,6 +30,11 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
 	if user.AvailabilityStatus == "" {
 		user.AvailabilityStatus = "online"
 	}
+	if s.entitlements != nil {
+		if err := s.entitlements.CanCreateResource(user.AccountID, "agent"); err != nil {
+			return err
+		}
+	}
 	// TODO: Implement Chatwoot user sync logic here if creating local user implies Chatwoot user creation
 	return s.repo.Create(ctx, user)
 }
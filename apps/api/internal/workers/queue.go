@@ -0,0 +1,72 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+
+	"whatpro-hub/internal/services"
+)
+
+// Queue enqueues background tasks from the API and worker processes
+type Queue struct {
+	client *asynq.Client
+}
+
+// NewQueue creates a Queue connected to the Redis instance at redisURL
+func NewQueue(redisURL string) (*Queue, error) {
+	opt, err := asynq.ParseRedisURI(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	return &Queue{client: asynq.NewClient(opt)}, nil
+}
+
+// EnqueueExecution schedules a stored EventExecution for processing.
+// Retries are driven by the execution record, so the task itself is retried
+// by Asynq only for infrastructure failures.
+func (q *Queue) EnqueueExecution(ctx context.Context, id uuid.UUID, delay time.Duration) error {
+	payload, err := json.Marshal(WebhookPayload{ExecutionID: id})
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeWebhookProcess, payload)
+	_, err = q.client.EnqueueContext(ctx, task,
+		asynq.Queue("webhooks"),
+		asynq.MaxRetry(3),
+		asynq.ProcessIn(delay),
+	)
+	return err
+}
+
+// EnqueueSync schedules a Chatwoot sync of one account. While one is queued
+// or running, another is refused with services.ErrSyncInProgress.
+func (q *Queue) EnqueueSync(ctx context.Context, accountID int) error {
+	payload, err := json.Marshal(SyncPayload{AccountID: accountID})
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeSyncUsers, payload)
+	_, err = q.client.EnqueueContext(ctx, task,
+		asynq.Queue("default"),
+		asynq.MaxRetry(0), // The scheduled sync catches up
+		asynq.Unique(15*time.Minute),
+	)
+	if errors.Is(err, asynq.ErrDuplicateTask) {
+		return services.ErrSyncInProgress
+	}
+	return err
+}
+
+// Close closes the connection to Redis
+func (q *Queue) Close() error {
+	return q.client.Close()
+}
@@ -3,6 +3,7 @@ package workers
 
 import (
 	"log"
+	"time"
 
 	"github.com/hibiken/asynq"
 )
@@ -46,6 +47,18 @@ func (s *Scheduler) Start() error {
 	}
 	s.logger.Println("[Scheduler] ✓ Registered: Account Sync (every 5 min)")
 
+	// Sync users, teams, inboxes and labels every 15 minutes
+	_, err = s.scheduler.Register(
+		"*/15 * * * *", // every 15 minutes
+		asynq.NewTask(TypeSyncUsers, nil),
+		asynq.Queue("default"),
+		asynq.Timeout(10*time.Minute),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: User/Team Sync (every 15 min)")
+
 	// Provider health check every minute
 	_, err = s.scheduler.Register(
 		"* * * * *", // every minute
@@ -57,6 +70,63 @@ func (s *Scheduler) Start() error {
 	}
 	s.logger.Println("[Scheduler] ✓ Registered: Provider Health Check (every 1 min)")
 
+	// Re-enqueue due webhook retries and stuck executions every minute
+	_, err = s.scheduler.Register(
+		"* * * * *", // every minute
+		asynq.NewTask(TypeWebhookSweep, nil),
+		asynq.Queue("webhooks"),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: Webhook Retry Sweep (every 1 min)")
+
+	// Stage SLA check every 5 minutes
+	_, err = s.scheduler.Register(
+		"*/5 * * * *", // every 5 minutes
+		asynq.NewTask(TypeSLACheck, nil),
+		asynq.Queue("default"),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: Stage SLA Check (every 5 min)")
+
+	// Audit hash chain verification every night
+	_, err = s.scheduler.Register(
+		"0 3 * * *", // daily at 03:00
+		asynq.NewTask(TypeAuditVerify, nil),
+		asynq.Queue("default"),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: Audit Chain Verification (daily)")
+
+	// Archive rows past their retention every night, before the chain is verified again
+	_, err = s.scheduler.Register(
+		"30 2 * * *", // daily at 02:30
+		asynq.NewTask(TypeRetention, nil),
+		asynq.Queue("default"),
+		asynq.Timeout(4*time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: Retention Archival (daily)")
+
+	// Subscription dunning: trial expiry, grace period, suspension and reminders
+	_, err = s.scheduler.Register(
+		"15 * * * *", // hourly at :15
+		asynq.NewTask(TypeBillingDunning, nil),
+		asynq.Queue("default"),
+		asynq.Timeout(30*time.Minute),
+	)
+	if err != nil {
+		return err
+	}
+	s.logger.Println("[Scheduler] ✓ Registered: Billing Dunning (hourly)")
+
 	s.logger.Println("[Scheduler] Starting scheduler...")
 	if err := s.scheduler.Start(); err != nil {
 		return err
@@ -72,10 +142,3 @@ func (s *Scheduler) Stop() {
 	s.scheduler.Shutdown()
 	s.client.Close()
 }
-
-// EnqueueWebhook enqueues a webhook for async processing
-func (s *Scheduler) EnqueueWebhook(event string, payload []byte) error {
-	task := asynq.NewTask(TypeWebhookProcess, payload)
-	_, err := s.client.Enqueue(task, asynq.Queue("webhooks"), asynq.MaxRetry(3))
-	return err
-}
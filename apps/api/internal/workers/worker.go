@@ -4,18 +4,25 @@ package workers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
 	"whatpro-hub/internal/config"
+	"whatpro-hub/internal/models"
+	"whatpro-hub/internal/realtime"
 	"whatpro-hub/internal/repositories"
 	"whatpro-hub/internal/services"
+	"whatpro-hub/pkg/chatwoot"
+	"whatpro-hub/pkg/webhooks"
 )
 
 // Task types
@@ -24,16 +31,31 @@ const (
 	TypeSyncUsers      = "sync:users"
 	TypeProviderHealth = "provider:health_check"
 	TypeWebhookProcess = "webhook:process"
+	TypeWebhookSweep   = "webhook:sweep"
+	TypeSLACheck       = "kanban:sla_check"
+	TypeAuditVerify    = "audit:verify_chain"
+	TypeRetention      = "retention:archive"
+	TypeBillingDunning = "billing:dunning"
 )
 
 // Worker holds dependencies for background jobs
 type Worker struct {
-	DB              *gorm.DB
-	Redis           *redis.Client
-	Config          *config.Config
-	AccountService  *services.AccountService
-	ProviderService *services.ProviderService
-	Logger          *log.Logger
+	DB                *gorm.DB
+	Redis             *redis.Client
+	Config            *config.Config
+	AccountService    *services.AccountService
+	ProviderService   *services.ProviderService
+	GatewayService    *services.GatewayService
+	KanbanService     *services.KanbanService
+	AutomationService *services.AutomationService
+	SLAService        *services.SLAService
+	BillingService    *services.BillingService
+	DunningService    *services.DunningService
+	EventService      *services.EventService
+	AuditService      *services.AuditService
+	RetentionService  *services.RetentionService
+	SyncService       *services.SyncService
+	Logger            *log.Logger
 }
 
 // NewWorker creates a new Worker instance
@@ -44,28 +66,90 @@ func NewWorker(db *gorm.DB, rdb *redis.Client, cfg *config.Config) (*Worker, err
 
 	// Initialize services
 	accountService := services.NewAccountService(accountRepo, cfg.ChatwootURL, cfg.ChatwootAPIKey)
+	auditRepo := repositories.NewAuditRepository(db)
+	// Plan features become account entitlements when subscriptions change
+	entitlementsService := services.NewEntitlementsService(db, auditRepo)
 
 	encryptionKey := getEnvWorker("ENCRYPTION_KEY", "12345678901234567890123456789012")
-	providerService, err := services.NewProviderService(providerRepo, encryptionKey)
+	providerService, err := services.NewProviderService(providerRepo, encryptionKey, entitlementsService)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init provider service: %w", err)
 	}
 
-	return &Worker{
-		DB:              db,
-		Redis:           rdb,
-		Config:          cfg,
-		AccountService:  accountService,
-		ProviderService: providerService,
-		Logger:          log.Default(),
-	}, nil
+	gatewayRepo := repositories.NewGatewayRepository(db)
+	chatwootClient := chatwoot.New(cfg.ChatwootURL, cfg.ChatwootAPIKey)
+	gatewayService := services.NewGatewayService(gatewayRepo, providerRepo, repositories.NewInboxRepository(db), accountRepo, providerService, chatwootClient)
+	billingRepo := repositories.NewBillingRepository(db)
+	billingService := services.NewBillingService(billingRepo, repositories.NewUserRepository(db), accountRepo, entitlementsService, rdb, cfg.BillingProvider, services.NewPaymentProviders(cfg)...)
+	// Unpaid accounts are reminded through their own WhatsApp providers and by e-mail
+	dunningService := services.NewDunningService(billingService, billingRepo, accountRepo, providerService, cfg.Mailer(), services.NewDunningPolicy(cfg))
+
+	queue, err := NewQueue(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init queue: %w", err)
+	}
+	eventService := services.NewEventService(gatewayRepo, queue)
+
+	// Card changes and chat messages made by jobs reach the API replicas through Redis
+	hub := realtime.NewHub(rdb)
+
+	kanbanRepo := repositories.NewKanbanRepository(db)
+	kanbanService := services.NewKanbanService(kanbanRepo, eventService, hub, entitlementsService)
+	userRepo := repositories.NewUserRepository(db)
+	chatService := services.NewChatService(repositories.NewChatRepository(db), repositories.NewAuditRepository(db), userRepo, chatwootClient, hub)
+	automationService := services.NewAutomationService(kanbanRepo, gatewayService, chatService, chatwootClient)
+	slaService := services.NewSLAService(kanbanRepo, userRepo, chatService)
+	auditService := services.NewAuditService(auditRepo, nil)
+
+	// Expired rows are archived to ARCHIVE_PATH before they are deleted
+	archiveStore, err := cfg.ArchiveStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init archive store: %w", err)
+	}
+	retentionService := services.NewRetentionService(repositories.NewRetentionRepository(db), accountRepo, auditRepo, archiveStore)
+
+	// Users, teams, inboxes and labels are mirrored from Chatwoot
+	syncService := services.NewSyncService(repositories.NewSyncRepository(db), accountRepo, repositories.NewSessionRepository(db), entitlementsService, chatwootClient, queue)
+
+	w := &Worker{
+		DB:                db,
+		Redis:             rdb,
+		Config:            cfg,
+		AccountService:    accountService,
+		ProviderService:   providerService,
+		GatewayService:    gatewayService,
+		KanbanService:     kanbanService,
+		AutomationService: automationService,
+		SLAService:        slaService,
+		BillingService:    billingService,
+		DunningService:    dunningService,
+		EventService:      eventService,
+		AuditService:      auditService,
+		RetentionService:  retentionService,
+		SyncService:       syncService,
+		Logger:            log.Default(),
+	}
+
+	// Stored webhooks are dispatched by the source prefix of their event type
+	eventService.Handle("chatwoot", w.processChatwootEvent)
+	eventService.Handle("provider", w.processProviderEvent)
+	eventService.Handle("billing", w.processBillingEvent)
+	eventService.Handle("kanban", w.processKanbanEvent)
+
+	return w, nil
 }
 
 // RegisterHandlers registers all task handlers with Asynq server
 func (w *Worker) RegisterHandlers(mux *asynq.ServeMux) {
 	mux.HandleFunc(TypeSyncAccounts, w.HandleSyncAccounts)
+	mux.HandleFunc(TypeSyncUsers, w.HandleSyncUsers)
 	mux.HandleFunc(TypeProviderHealth, w.HandleProviderHealth)
 	mux.HandleFunc(TypeWebhookProcess, w.HandleWebhookProcess)
+	mux.HandleFunc(TypeWebhookSweep, w.HandleWebhookSweep)
+	mux.HandleFunc(TypeSLACheck, w.HandleSLACheck)
+	mux.HandleFunc(TypeAuditVerify, w.HandleAuditVerify)
+	mux.HandleFunc(TypeRetention, w.HandleRetention)
+	mux.HandleFunc(TypeBillingDunning, w.HandleBillingDunning)
 }
 
 // HandleSyncAccounts syncs accounts from Chatwoot
@@ -86,6 +170,52 @@ func (w *Worker) HandleSyncAccounts(ctx context.Context, t *asynq.Task) error {
 	return nil
 }
 
+// SyncPayload is the payload of sync tasks. AccountID is the Chatwoot account
+// to sync; the scheduled task has none and syncs every active account.
+type SyncPayload struct {
+	AccountID int `json:"account_id,omitempty"`
+}
+
+// HandleSyncUsers syncs the users, teams, inboxes and labels of Chatwoot accounts
+func (w *Worker) HandleSyncUsers(ctx context.Context, t *asynq.Task) error {
+	var payload SyncPayload
+	if len(t.Payload()) > 0 {
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			return fmt.Errorf("invalid sync payload: %w: %v", asynq.SkipRetry, err)
+		}
+	}
+
+	if payload.AccountID != 0 {
+		report, err := w.SyncService.SyncAccount(ctx, payload.AccountID, services.SyncTriggerManual)
+		if err != nil {
+			return fmt.Errorf("sync of account %d failed: %w", payload.AccountID, err)
+		}
+		w.Logger.Printf("[Worker] Account %d sync finished: %s (report %s)", payload.AccountID, report.Status, report.ID)
+		return nil
+	}
+
+	reports, err := w.SyncService.SyncAll(ctx, services.SyncTriggerSchedule)
+	if err != nil {
+		return fmt.Errorf("user sync failed: %w", err)
+	}
+
+	failed := 0
+	var overQuota []int
+	for _, report := range reports {
+		if report.Status != models.SyncStatusSuccess {
+			failed++
+		}
+		if report.OverQuota {
+			overQuota = append(overQuota, report.AccountID)
+		}
+	}
+	w.Logger.Printf("[Worker] User sync completed: %d accounts, %d with errors", len(reports), failed)
+	if len(overQuota) > 0 {
+		w.Logger.Printf("[Worker] Accounts over their plan limits, not fully mirrored: %v", overQuota)
+	}
+	return nil
+}
+
 // HandleProviderHealth checks health of all providers
 func (w *Worker) HandleProviderHealth(ctx context.Context, t *asynq.Task) error {
 	w.Logger.Printf("[Worker] Starting provider health checks...")
@@ -119,30 +249,204 @@ func (w *Worker) HandleProviderHealth(ctx context.Context, t *asynq.Task) error
 	return nil
 }
 
+// HandleSLACheck flags cards that exceeded the SLA of their stage
+func (w *Worker) HandleSLACheck(ctx context.Context, t *asynq.Task) error {
+	count, err := w.SLAService.CheckBreaches(ctx)
+	if err != nil {
+		return fmt.Errorf("sla check failed: %w", err)
+	}
+
+	if count > 0 {
+		w.Logger.Printf("[Worker] %d cards breached their stage SLA", count)
+	}
+	return nil
+}
+
+// HandleAuditVerify walks the audit hash chain of every account and reports breaks
+func (w *Worker) HandleAuditVerify(ctx context.Context, t *asynq.Task) error {
+	accountIDs, err := w.AuditService.ChainedAccounts()
+	if err != nil {
+		return fmt.Errorf("failed to list audited accounts: %w", err)
+	}
+
+	broken := 0
+	for _, accountID := range accountIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		report, err := w.AuditService.VerifyChain(accountID)
+		if err != nil {
+			w.Logger.Printf("[Worker] Failed to verify audit chain of account %d: %v", accountID, err)
+			continue
+		}
+		if report.Valid {
+			continue
+		}
+		broken++
+		for _, b := range report.Breaks {
+			w.Logger.Printf("[Worker] AUDIT CHAIN BROKEN: account %d, entry %d: %s", accountID, b.Sequence, b.Reason)
+		}
+	}
+
+	w.Logger.Printf("[Worker] Audit chain verification completed: %d accounts, %d broken", len(accountIDs), broken)
+	return nil
+}
+
+// HandleRetention archives and deletes the rows past the retention of each account
+func (w *Worker) HandleRetention(ctx context.Context, t *asynq.Task) error {
+	results, err := w.RetentionService.Run(ctx)
+	if errors.Is(err, services.ErrArchiveDisabled) {
+		w.Logger.Printf("[Worker] Retention skipped: ARCHIVE_PATH is not set")
+		return nil
+	}
+
+	for _, r := range results {
+		w.Logger.Printf("[Worker] Archived %d %s rows of account %d to %s", r.Rows, r.Table, r.AccountID, r.Key)
+	}
+	if err != nil {
+		return fmt.Errorf("retention failed: %w", err)
+	}
+	return nil
+}
+
+// HandleBillingDunning expires trials, suspends unpaid accounts and sends payment reminders
+func (w *Worker) HandleBillingDunning(ctx context.Context, t *asynq.Task) error {
+	report, err := w.DunningService.Run(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("dunning failed: %w", err)
+	}
+
+	for status, count := range report.Transitions {
+		w.Logger.Printf("[Worker] %d subscriptions moved to %s", count, status)
+	}
+	if report.Reminders > 0 || report.Failed > 0 {
+		w.Logger.Printf("[Worker] Dunning completed: %d reminders sent, %d failed", report.Reminders, report.Failed)
+	}
+	return nil
+}
+
 // WebhookPayload is the payload for webhook processing tasks
 type WebhookPayload struct {
-	Event   string          `json:"event"`
-	Payload json.RawMessage `json:"payload"`
+	ExecutionID uuid.UUID `json:"execution_id"`
 }
 
-// HandleWebhookProcess processes Chatwoot webhooks asynchronously
+// HandleWebhookProcess processes a stored webhook (EventExecution)
 func (w *Worker) HandleWebhookProcess(ctx context.Context, t *asynq.Task) error {
-	w.Logger.Printf("[Worker] Processing webhook...")
-
 	var payload WebhookPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return fmt.Errorf("invalid webhook payload: %w", err)
+		return fmt.Errorf("invalid webhook payload: %w: %v", asynq.SkipRetry, err)
+	}
+
+	return w.EventService.Process(ctx, payload.ExecutionID)
+}
+
+// HandleWebhookSweep re-enqueues due retries and executions that got stuck
+func (w *Worker) HandleWebhookSweep(ctx context.Context, t *asynq.Task) error {
+	count, err := w.EventService.SweepPending(ctx)
+	if err != nil {
+		return fmt.Errorf("webhook sweep failed: %w", err)
 	}
 
-	w.Logger.Printf("[Worker] Processing webhook event: %s", payload.Event)
+	if count > 0 {
+		w.Logger.Printf("[Worker] Re-enqueued %d webhook executions", count)
+	}
+	return nil
+}
+
+// processChatwootEvent routes a stored Chatwoot webhook
+func (w *Worker) processChatwootEvent(ctx context.Context, exec *models.EventExecution) error {
+	body, err := services.PayloadBytes(exec)
+	if err != nil {
+		return err
+	}
+
+	webhook, err := webhooks.ParseWebhook(body)
+	if err != nil {
+		return err
+	}
+
+	w.Logger.Printf("[Worker] Processing Chatwoot event: %s (account %d)", webhook.Event, webhook.AccountID)
+
+	switch webhook.Event {
+	case "conversation_created":
+		payload, err := webhooks.ParseConversationCreated(webhook.Data)
+		if err != nil {
+			return err
+		}
+		card, err := w.KanbanService.SyncConversationCreated(ctx, webhook.AccountID, payload)
+		if err != nil {
+			return err
+		}
+		if card != nil {
+			w.Logger.Printf("[Worker] Card %s tracks conversation #%d", card.ID, payload.ID)
+		}
+
+	case "conversation_status_changed":
+		payload, err := webhooks.ParseConversationStatusChanged(webhook.Data)
+		if err != nil {
+			return err
+		}
+		return w.KanbanService.SyncConversationStatus(ctx, webhook.AccountID, payload.ID, payload.Status)
 
-	// TODO: Process webhook based on event type
-	// - conversation_created: Create Kanban card
-	// - message_created: Update card preview
+	case "message_created":
+		payload, err := webhooks.ParseMessageCreated(webhook.Data)
+		if err != nil {
+			return err
+		}
+		if err := w.GatewayService.RelayChatwootMessage(ctx, webhook.AccountID, payload); err != nil {
+			return err
+		}
+		return w.KanbanService.SyncMessageCreated(ctx, webhook.AccountID, payload)
+	}
 
 	return nil
 }
 
+// processProviderEvent routes a stored WhatsApp provider webhook
+func (w *Worker) processProviderEvent(ctx context.Context, exec *models.EventExecution) error {
+	if exec.ProviderID == nil {
+		return fmt.Errorf("execution %s has no provider", exec.ID)
+	}
+
+	provider, err := w.GatewayService.ResolveProvider(ctx, exec.ProviderID.String())
+	if err != nil {
+		return err
+	}
+
+	body, err := services.PayloadBytes(exec)
+	if err != nil {
+		return err
+	}
+
+	return w.GatewayService.ProcessProviderWebhook(ctx, provider, body)
+}
+
+// processKanbanEvent runs the stage AutoActions of a card transition
+func (w *Worker) processKanbanEvent(ctx context.Context, exec *models.EventExecution) error {
+	body, err := services.PayloadBytes(exec)
+	if err != nil {
+		return err
+	}
+
+	var transition services.StageTransition
+	if err := json.Unmarshal(body, &transition); err != nil {
+		return fmt.Errorf("invalid stage transition: %w", err)
+	}
+
+	return w.AutomationService.RunTransition(ctx, exec.AccountID, &transition)
+}
+
+// processBillingEvent routes a stored payment provider webhook
+func (w *Worker) processBillingEvent(ctx context.Context, exec *models.EventExecution) error {
+	body, err := services.PayloadBytes(exec)
+	if err != nil {
+		return err
+	}
+
+	provider := strings.TrimPrefix(exec.EventType, "billing.")
+	return w.BillingService.ProcessWebhook(ctx, provider, body)
+}
+
 // getEnvWorker helper function
 func getEnvWorker(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -0,0 +1,115 @@
+// Package archive stores archive files on a local directory or an S3-compatible bucket
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when an archive does not exist
+var ErrNotFound = errors.New("archive not found")
+
+// Store reads and writes archive files by key, e.g. "audit_logs/account-1/file.ndjson.gz"
+type Store interface {
+	// Put writes size bytes of body under key, replacing any existing archive
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error
+	// Get opens the archive stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// S3Options configures access to an S3-compatible bucket
+type S3Options struct {
+	Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or a MinIO URL
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// NewStore creates the store for path: "s3://bucket/prefix" for a bucket,
+// anything else is a local directory. An empty path returns a nil store.
+func NewStore(path string, s3 S3Options) (Store, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "s3://") {
+		return &LocalStore{Root: path}, nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive path %q", path)
+	}
+	if s3.AccessKey == "" || s3.SecretKey == "" {
+		return nil, errors.New("S3 archive path requires an access key and a secret key")
+	}
+	if s3.Region == "" {
+		s3.Region = "us-east-1"
+	}
+	if s3.Endpoint == "" {
+		s3.Endpoint = "https://s3." + s3.Region + ".amazonaws.com"
+	}
+	return NewS3Store(s3, u.Host, strings.Trim(u.Path, "/")), nil
+}
+
+// LocalStore keeps archives under a directory
+type LocalStore struct {
+	Root string
+}
+
+// Put writes the archive to a temporary file and renames it into place
+func (s *LocalStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.CopyN(tmp, body, size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens an archive of the directory
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// path resolves a key inside the root, rejecting keys that escape it
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid archive key %q", key)
+	}
+	return filepath.Join(s.Root, clean), nil
+}
@@ -2,18 +2,30 @@
 package chatwoot
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// maxRetryWait caps the wait between two attempts, Retry-After included
+const maxRetryWait = 30 * time.Second
+
 // Client is the Chatwoot API client
 type Client struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
+
+	// MaxRetries is the number of times a request is retried on 429 and 5xx
+	// responses; RetryWait is the first wait, doubled on each retry unless the
+	// response sets Retry-After
+	MaxRetries int
+	RetryWait  time.Duration
 }
 
 // New creates a new Chatwoot client
@@ -24,9 +36,23 @@ func New(baseURL, apiKey string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		MaxRetries: 3,
+		RetryWait:  500 * time.Millisecond,
 	}
 }
 
+// APIError is returned when Chatwoot answers with a non-2xx status
+type APIError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("chatwoot %s %s: status %d: %s", e.Method, e.Endpoint, e.StatusCode, e.Body)
+}
+
 // User represents a Chatwoot user
 type User struct {
 	ID                 int    `json:"id"`
@@ -78,173 +104,185 @@ type Label struct {
 }
 
 // ValidateToken validates the API token and returns user info
-func (c *Client) ValidateToken() (*User, error) {
-	resp, err := c.doRequest("GET", "/api/v1/profile", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("invalid token: status %d", resp.StatusCode)
-	}
-
+func (c *Client) ValidateToken(ctx context.Context) (*User, error) {
 	var user User
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/profile", nil, &user); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
-
 	return &user, nil
 }
 
 // ListAccounts returns all accounts the user has access to
-func (c *Client) ListAccounts() ([]Account, error) {
-	resp, err := c.doRequest("GET", "/api/v1/accounts", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+func (c *Client) ListAccounts(ctx context.Context) ([]Account, error) {
 	var accounts []Account
-	if err := json.NewDecoder(resp.Body).Decode(&accounts); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/accounts", nil, &accounts); err != nil {
+		return nil, err
 	}
-
 	return accounts, nil
 }
 
 // GetAccount returns a specific account
-func (c *Client) GetAccount(accountID int) (*Account, error) {
+func (c *Client) GetAccount(ctx context.Context, accountID int) (*Account, error) {
 	endpoint := fmt.Sprintf("/api/v1/accounts/%d", accountID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
 
 	var account Account
-	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &account); err != nil {
+		return nil, err
 	}
-
 	return &account, nil
 }
 
 // ListTeams returns all teams for an account
-func (c *Client) ListTeams(accountID int) ([]Team, error) {
+func (c *Client) ListTeams(ctx context.Context, accountID int) ([]Team, error) {
 	endpoint := fmt.Sprintf("/api/v1/accounts/%d/teams", accountID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
 
 	var teams []Team
-	if err := json.NewDecoder(resp.Body).Decode(&teams); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &teams); err != nil {
+		return nil, err
 	}
-
 	return teams, nil
 }
 
 // ListAgents returns all agents for an account
-func (c *Client) ListAgents(accountID int) ([]User, error) {
+func (c *Client) ListAgents(ctx context.Context, accountID int) ([]User, error) {
 	endpoint := fmt.Sprintf("/api/v1/accounts/%d/agents", accountID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
 
 	var agents []User
-	if err := json.NewDecoder(resp.Body).Decode(&agents); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &agents); err != nil {
+		return nil, err
 	}
-
 	return agents, nil
 }
 
-// ListInboxes returns all inboxes for an account
-func (c *Client) ListInboxes(accountID int) ([]Inbox, error) {
-	endpoint := fmt.Sprintf("/api/v1/accounts/%d/inboxes", accountID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
+// ListTeamMembers returns the agents of a team
+func (c *Client) ListTeamMembers(ctx context.Context, accountID, teamID int) ([]User, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/teams/%d/team_members", accountID, teamID)
+
+	var members []User
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &members); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return members, nil
+}
+
+// ListInboxes returns all inboxes for an account
+func (c *Client) ListInboxes(ctx context.Context, accountID int) ([]Inbox, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/inboxes", accountID)
 
 	var response struct {
 		Payload []Inbox `json:"payload"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
 	}
-
 	return response.Payload, nil
 }
 
 // ListLabels returns all labels for an account
-func (c *Client) ListLabels(accountID int) ([]Label, error) {
+func (c *Client) ListLabels(ctx context.Context, accountID int) ([]Label, error) {
 	endpoint := fmt.Sprintf("/api/v1/accounts/%d/labels", accountID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
 
 	var response struct {
 		Payload []Label `json:"payload"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
 	}
-
 	return response.Payload, nil
 }
 
-// GetConversation returns a conversation payload
-func (c *Client) GetConversation(accountID, conversationID int) (map[string]interface{}, error) {
-	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d", accountID, conversationID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var payload map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// doJSON performs a JSON request and decodes the response into out
+func (c *Client) doJSON(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = data
 	}
-	return payload, nil
+	return c.do(ctx, method, endpoint, "application/json", body, out)
 }
 
-// GetConversationMessages returns conversation messages payload
-func (c *Client) GetConversationMessages(accountID, conversationID int) (map[string]interface{}, error) {
-	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/messages", accountID, conversationID)
-	resp, err := c.doRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
+// do performs a request, retrying it with backoff on 429 and 5xx responses,
+// and decodes the response into out. The body is a byte slice so that it can
+// be sent again on each attempt.
+func (c *Client) do(ctx context.Context, method, endpoint, contentType string, body []byte, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, reader)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("api_access_token", c.APIKey)
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			return nil
+		}
+
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		apiErr := &APIError{
+			Method:     method,
+			Endpoint:   endpoint,
+			StatusCode: resp.StatusCode,
+			Body:       string(bytes.TrimSpace(msg)),
+		}
+
+		if attempt >= c.MaxRetries || !retryable(method, resp.StatusCode) {
+			return apiErr
+		}
+
+		timer := time.NewTimer(c.retryWait(attempt, resp.Header.Get("Retry-After")))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	var payload map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// retryable reports whether a failed request can be sent again. A 429 is
+// rejected before Chatwoot handles the request, so it is always retried; a 5xx
+// may come after a POST was applied, and retrying it could post a message or
+// create a contact twice.
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
 	}
-	return payload, nil
+	return status >= 500 && method != http.MethodPost
 }
 
-// doRequest performs an HTTP request
-func (c *Client) doRequest(method, endpoint string, body io.Reader) (*http.Response, error) {
-	url := c.BaseURL + endpoint
-
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// retryWait returns the wait before the next attempt
+func (c *Client) retryWait(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		if wait := time.Duration(seconds) * time.Second; wait < maxRetryWait {
+			return wait
+		}
+		return maxRetryWait
 	}
 
-	req.Header.Set("api_access_token", c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	return c.HTTPClient.Do(req)
+	wait := c.RetryWait << attempt
+	if wait <= 0 || wait > maxRetryWait {
+		return maxRetryWait
+	}
+	return wait
 }
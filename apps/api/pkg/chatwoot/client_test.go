@@ -0,0 +1,91 @@
+package chatwoot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(url string) *Client {
+	c := New(url, "token")
+	c.RetryWait = time.Millisecond
+	return c
+}
+
+func TestRetriesRateLimitedRequests(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"payload":[{"id":1,"title":"vip"}]}`))
+	}))
+	defer srv.Close()
+
+	labels, err := newTestClient(srv.URL).ListLabels(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("list labels: %v", err)
+	}
+	if calls != 3 || len(labels) != 1 || labels[0].Title != "vip" {
+		t.Fatalf("unexpected result after %d calls: %+v", calls, labels)
+	}
+}
+
+func TestDoesNotRetryFailedPosts(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(srv.URL).CreateMessage(context.Background(), 1, 2, CreateMessageRequest{Content: "hi", MessageType: "outgoing"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected API error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("POST should not be retried on 5xx, got %d calls", calls)
+	}
+}
+
+func TestCreateMessageWithAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("parse form: %v", err)
+		}
+		if r.FormValue("content") != "see file" || r.FormValue("message_type") != "outgoing" {
+			t.Errorf("unexpected fields: %v", r.MultipartForm.Value)
+		}
+		files := r.MultipartForm.File["attachments[]"]
+		if len(files) != 1 || files[0].Filename != "a.txt" {
+			t.Fatalf("unexpected files: %v", files)
+		}
+		f, _ := files[0].Open()
+		data, _ := io.ReadAll(f)
+		if string(data) != "hello" {
+			t.Errorf("unexpected file content: %q", data)
+		}
+		w.Write([]byte(`{"id":9,"attachments":[{"id":3,"file_type":"file"}]}`))
+	}))
+	defer srv.Close()
+
+	msg, err := newTestClient(srv.URL).CreateMessage(context.Background(), 1, 2, CreateMessageRequest{
+		Content:     "see file",
+		MessageType: "outgoing",
+		Attachments: []Upload{{Filename: "a.txt", ContentType: "text/plain", Data: []byte("hello")}},
+	})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	if msg.ID != 9 || len(msg.Attachments) != 1 {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+}
@@ -0,0 +1,517 @@
+package chatwoot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Conversation statuses
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+	StatusPending  = "pending"
+	StatusSnoozed  = "snoozed"
+)
+
+// Message types, as returned by the API
+const (
+	MessageIncoming = 0
+	MessageOutgoing = 1
+	MessageActivity = 2
+	MessageTemplate = 3
+)
+
+// Page sizes of the paginated endpoints, fixed by Chatwoot
+const (
+	ContactsPerPage      = 15
+	ConversationsPerPage = 25
+)
+
+// Contact represents a Chatwoot contact
+type Contact struct {
+	ID               int                    `json:"id"`
+	Name             string                 `json:"name"`
+	Email            string                 `json:"email"`
+	PhoneNumber      string                 `json:"phone_number"`
+	Identifier       string                 `json:"identifier"`
+	Thumbnail        string                 `json:"thumbnail"`
+	CustomAttributes map[string]interface{} `json:"custom_attributes,omitempty"`
+	ContactInboxes   []ContactInbox         `json:"contact_inboxes"`
+}
+
+// ContactInbox links a contact to an inbox through a source ID
+type ContactInbox struct {
+	SourceID string `json:"source_id"`
+	Inbox    Inbox  `json:"inbox"`
+}
+
+// Conversation represents a Chatwoot conversation
+type Conversation struct {
+	ID                   int                    `json:"id"`
+	AccountID            int                    `json:"account_id"`
+	InboxID              int                    `json:"inbox_id"`
+	Status               string                 `json:"status"`
+	Priority             string                 `json:"priority,omitempty"`
+	Labels               []string               `json:"labels"`
+	UnreadCount          int                    `json:"unread_count"`
+	CustomAttributes     map[string]interface{} `json:"custom_attributes,omitempty"`
+	AdditionalAttributes map[string]interface{} `json:"additional_attributes,omitempty"`
+	Meta                 ConversationMeta       `json:"meta"`
+	Messages             []Message              `json:"messages,omitempty"`
+	CreatedAt            int64                  `json:"created_at"`
+	LastActivityAt       int64                  `json:"last_activity_at"`
+}
+
+// ConversationMeta holds the contact, assignee and team of a conversation
+type ConversationMeta struct {
+	Sender   *Contact `json:"sender,omitempty"`
+	Assignee *User    `json:"assignee,omitempty"`
+	Team     *Team    `json:"team,omitempty"`
+	Channel  string   `json:"channel,omitempty"`
+}
+
+// Message represents a Chatwoot message
+type Message struct {
+	ID                int                    `json:"id"`
+	Content           string                 `json:"content"`
+	MessageType       int                    `json:"message_type"`
+	ContentType       string                 `json:"content_type,omitempty"`
+	ContentAttributes map[string]interface{} `json:"content_attributes,omitempty"`
+	ConversationID    int                    `json:"conversation_id"`
+	Private           bool                   `json:"private"`
+	Status            string                 `json:"status,omitempty"`
+	SourceID          string                 `json:"source_id,omitempty"`
+	Sender            *MessageSender         `json:"sender,omitempty"`
+	Attachments       []Attachment           `json:"attachments,omitempty"`
+	CreatedAt         int64                  `json:"created_at"`
+}
+
+// MessageSender is the contact or agent who sent a message
+type MessageSender struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"` // contact, user, agent_bot
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	ID        int    `json:"id"`
+	FileType  string `json:"file_type"` // image, audio, video, file, location...
+	Extension string `json:"extension,omitempty"`
+	DataURL   string `json:"data_url"`
+	ThumbURL  string `json:"thumb_url,omitempty"`
+	FileSize  int64  `json:"file_size"`
+}
+
+// Upload is a file to attach to a new message
+type Upload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ContactPage is a page of contacts
+type ContactPage struct {
+	Contacts []Contact
+	Page     int
+	Count    int // Contacts in the account
+}
+
+// HasMore reports whether there are contacts after this page
+func (p *ContactPage) HasMore() bool {
+	return p.Page*ContactsPerPage < p.Count
+}
+
+// ConversationFilter selects the conversations returned by ListConversations
+type ConversationFilter struct {
+	Status       string // open (Chatwoot's default), resolved, pending, snoozed or all
+	AssigneeType string // me, unassigned, assigned or all
+	InboxID      int
+	TeamID       int
+	Labels       []string
+	Page         int // Starts at 1
+}
+
+// ConversationPage is a page of conversations with the counts of the filter
+type ConversationPage struct {
+	Conversations   []Conversation
+	Page            int
+	MineCount       int
+	AssignedCount   int
+	UnassignedCount int
+	AllCount        int
+}
+
+// HasMore reports whether there are conversations after this page
+func (p *ConversationPage) HasMore() bool {
+	return len(p.Conversations) == ConversationsPerPage
+}
+
+// CreateContactRequest is the payload for creating a contact
+type CreateContactRequest struct {
+	InboxID          int                    `json:"inbox_id"`
+	Name             string                 `json:"name,omitempty"`
+	Email            string                 `json:"email,omitempty"`
+	PhoneNumber      string                 `json:"phone_number,omitempty"`
+	Identifier       string                 `json:"identifier,omitempty"`
+	CustomAttributes map[string]interface{} `json:"custom_attributes,omitempty"`
+}
+
+// UpdateContactRequest is the payload for updating a contact; empty fields are left unchanged
+type UpdateContactRequest struct {
+	Name             string                 `json:"name,omitempty"`
+	Email            string                 `json:"email,omitempty"`
+	PhoneNumber      string                 `json:"phone_number,omitempty"`
+	Identifier       string                 `json:"identifier,omitempty"`
+	CustomAttributes map[string]interface{} `json:"custom_attributes,omitempty"`
+}
+
+// CreateConversationRequest is the payload for creating a conversation
+type CreateConversationRequest struct {
+	SourceID             string                 `json:"source_id"`
+	InboxID              int                    `json:"inbox_id"`
+	ContactID            int                    `json:"contact_id"`
+	Status               string                 `json:"status,omitempty"`
+	AssigneeID           int                    `json:"assignee_id,omitempty"`
+	TeamID               int                    `json:"team_id,omitempty"`
+	CustomAttributes     map[string]interface{} `json:"custom_attributes,omitempty"`
+	AdditionalAttributes map[string]interface{} `json:"additional_attributes,omitempty"`
+}
+
+// CreateMessageRequest is the payload for creating a message. Messages with
+// attachments are sent as multipart forms.
+type CreateMessageRequest struct {
+	Content     string   `json:"content"`
+	MessageType string   `json:"message_type"` // incoming, outgoing
+	Private     bool     `json:"private"`
+	SourceID    string   `json:"source_id,omitempty"` // External message ID (e.g. the WhatsApp message ID)
+	Attachments []Upload `json:"-"`
+}
+
+// SearchContacts searches contacts by name, email, phone number or identifier
+func (c *Client) SearchContacts(ctx context.Context, accountID int, query string) ([]Contact, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts/search?q=%s", accountID, url.QueryEscape(query))
+
+	var response struct {
+		Payload []Contact `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+// CreateContact creates a contact attached to an inbox
+func (c *Client) CreateContact(ctx context.Context, accountID int, req CreateContactRequest) (*Contact, *ContactInbox, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts", accountID)
+
+	var response struct {
+		Payload struct {
+			Contact      Contact      `json:"contact"`
+			ContactInbox ContactInbox `json:"contact_inbox"`
+		} `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, endpoint, req, &response); err != nil {
+		return nil, nil, err
+	}
+	return &response.Payload.Contact, &response.Payload.ContactInbox, nil
+}
+
+// ListContacts returns a page of the contacts of an account, starting at page 1
+func (c *Client) ListContacts(ctx context.Context, accountID, page int) (*ContactPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts?page=%d", accountID, page)
+
+	var response struct {
+		Meta struct {
+			Count int `json:"count"`
+		} `json:"meta"`
+		Payload []Contact `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return &ContactPage{Contacts: response.Payload, Page: page, Count: response.Meta.Count}, nil
+}
+
+// UpdateContact updates a contact; custom attributes are merged into the existing ones
+func (c *Client) UpdateContact(ctx context.Context, accountID, contactID int, req UpdateContactRequest) (*Contact, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts/%d", accountID, contactID)
+
+	var response struct {
+		Payload Contact `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodPut, endpoint, req, &response); err != nil {
+		return nil, err
+	}
+	return &response.Payload, nil
+}
+
+// CreateContactInbox attaches an existing contact to an inbox
+func (c *Client) CreateContactInbox(ctx context.Context, accountID, contactID, inboxID int, sourceID string) (*ContactInbox, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts/%d/contact_inboxes", accountID, contactID)
+	body := map[string]interface{}{"inbox_id": inboxID}
+	if sourceID != "" {
+		body["source_id"] = sourceID
+	}
+
+	var contactInbox ContactInbox
+	if err := c.doJSON(ctx, http.MethodPost, endpoint, body, &contactInbox); err != nil {
+		return nil, err
+	}
+	return &contactInbox, nil
+}
+
+// ListContactConversations returns the conversations of a contact
+func (c *Client) ListContactConversations(ctx context.Context, accountID, contactID int) ([]Conversation, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/contacts/%d/conversations", accountID, contactID)
+
+	var response struct {
+		Payload []Conversation `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+// ListConversations returns a page of the conversations of an account matching the filter
+func (c *Client) ListConversations(ctx context.Context, accountID int, filter ConversationFilter) (*ConversationPage, error) {
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	query := url.Values{"page": {strconv.Itoa(page)}}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.AssigneeType != "" {
+		query.Set("assignee_type", filter.AssigneeType)
+	}
+	if filter.InboxID > 0 {
+		query.Set("inbox_id", strconv.Itoa(filter.InboxID))
+	}
+	if filter.TeamID > 0 {
+		query.Set("team_id", strconv.Itoa(filter.TeamID))
+	}
+	for _, label := range filter.Labels {
+		query.Add("labels[]", label)
+	}
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations?%s", accountID, query.Encode())
+
+	var response struct {
+		Data struct {
+			Meta struct {
+				MineCount       int `json:"mine_count"`
+				AssignedCount   int `json:"assigned_count"`
+				UnassignedCount int `json:"unassigned_count"`
+				AllCount        int `json:"all_count"`
+			} `json:"meta"`
+			Payload []Conversation `json:"payload"`
+		} `json:"data"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	meta := response.Data.Meta
+	return &ConversationPage{
+		Conversations:   response.Data.Payload,
+		Page:            page,
+		MineCount:       meta.MineCount,
+		AssignedCount:   meta.AssignedCount,
+		UnassignedCount: meta.UnassignedCount,
+		AllCount:        meta.AllCount,
+	}, nil
+}
+
+// GetConversation returns a conversation
+func (c *Client) GetConversation(ctx context.Context, accountID, conversationID int) (*Conversation, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d", accountID, conversationID)
+
+	var conversation Conversation
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// CreateConversation opens a new conversation for a contact
+func (c *Client) CreateConversation(ctx context.Context, accountID int, req CreateConversationRequest) (*Conversation, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations", accountID)
+
+	var conversation Conversation
+	if err := c.doJSON(ctx, http.MethodPost, endpoint, req, &conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// CreateMessage posts a message into a conversation
+func (c *Client) CreateMessage(ctx context.Context, accountID, conversationID int, req CreateMessageRequest) (*Message, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/messages", accountID, conversationID)
+
+	var message Message
+	if len(req.Attachments) == 0 {
+		if err := c.doJSON(ctx, http.MethodPost, endpoint, req, &message); err != nil {
+			return nil, err
+		}
+		return &message, nil
+	}
+
+	body, contentType, err := messageForm(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(ctx, http.MethodPost, endpoint, contentType, body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// ListMessages returns up to 20 messages of a conversation, oldest first. With
+// before set to a message ID, the messages preceding it are returned; with 0,
+// the latest ones.
+func (c *Client) ListMessages(ctx context.Context, accountID, conversationID, before int) ([]Message, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/messages", accountID, conversationID)
+	if before > 0 {
+		endpoint += "?before=" + strconv.Itoa(before)
+	}
+
+	var response struct {
+		Payload []Message `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+// UpdateMessageStatus sets the delivery status of a message (API channel inboxes only)
+func (c *Client) UpdateMessageStatus(ctx context.Context, accountID, conversationID, messageID int, status, externalError string) error {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/messages/%d", accountID, conversationID, messageID)
+	body := map[string]string{"status": status}
+	if externalError != "" {
+		body["external_error"] = externalError
+	}
+	return c.doJSON(ctx, http.MethodPatch, endpoint, body, nil)
+}
+
+// ToggleConversationStatus sets the status of a conversation and returns the resulting status
+func (c *Client) ToggleConversationStatus(ctx context.Context, accountID, conversationID int, status string) (string, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/toggle_status", accountID, conversationID)
+
+	var response struct {
+		Payload struct {
+			CurrentStatus string `json:"current_status"`
+		} `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, endpoint, map[string]string{"status": status}, &response); err != nil {
+		return "", err
+	}
+	return response.Payload.CurrentStatus, nil
+}
+
+// SetConversationCustomAttributes replaces the custom attributes of a conversation
+func (c *Client) SetConversationCustomAttributes(ctx context.Context, accountID, conversationID int, attributes map[string]interface{}) error {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/custom_attributes", accountID, conversationID)
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	return c.doJSON(ctx, http.MethodPost, endpoint, map[string]interface{}{"custom_attributes": attributes}, nil)
+}
+
+// AssignConversation assigns a conversation to an agent
+func (c *Client) AssignConversation(ctx context.Context, accountID, conversationID, assigneeID int) error {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/assignments", accountID, conversationID)
+	return c.doJSON(ctx, http.MethodPost, endpoint, map[string]int{"assignee_id": assigneeID}, nil)
+}
+
+// AssignConversationTeam assigns a conversation to a team
+func (c *Client) AssignConversationTeam(ctx context.Context, accountID, conversationID, teamID int) error {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/assignments", accountID, conversationID)
+	return c.doJSON(ctx, http.MethodPost, endpoint, map[string]int{"team_id": teamID}, nil)
+}
+
+// ListConversationLabels returns the labels of a conversation
+func (c *Client) ListConversationLabels(ctx context.Context, accountID, conversationID int) ([]string, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/labels", accountID, conversationID)
+
+	var response struct {
+		Payload []string `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+// SetConversationLabels replaces the labels of a conversation
+func (c *Client) SetConversationLabels(ctx context.Context, accountID, conversationID int, labels []string) ([]string, error) {
+	endpoint := fmt.Sprintf("/api/v1/accounts/%d/conversations/%d/labels", accountID, conversationID)
+	if labels == nil {
+		labels = []string{}
+	}
+
+	var response struct {
+		Payload []string `json:"payload"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, endpoint, map[string][]string{"labels": labels}, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+// messageForm encodes a message with attachments as a multipart form
+func messageForm(req CreateMessageRequest) ([]byte, string, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+
+	fields := map[string]string{
+		"content":      req.Content,
+		"message_type": req.MessageType,
+		"private":      strconv.FormatBool(req.Private),
+	}
+	if req.SourceID != "" {
+		fields["source_id"] = req.SourceID
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, upload := range req.Attachments {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachments[]"; filename="%s"`, quoteEscaper.Replace(upload.Filename)))
+		contentType := upload.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(upload.Data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), form.FormDataContentType(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
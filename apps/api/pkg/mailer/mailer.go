@@ -0,0 +1,127 @@
+// Package mailer sends plain text e-mails through an SMTP server
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipients is returned when an e-mail has nobody to go to
+var ErrNoRecipients = errors.New("e-mail without recipients")
+
+// Mailer sends e-mails
+type Mailer interface {
+	Send(ctx context.Context, to []string, subject, body string) error
+}
+
+// Options configures the SMTP server
+type Options struct {
+	Host     string
+	Port     string // Defaults to 587; STARTTLS is used whenever the server offers it
+	Username string
+	Password string
+	From     string // e.g. "WhatPro Hub <billing@example.com>"
+}
+
+// SMTP is a Mailer backed by an SMTP server
+type SMTP struct {
+	opts Options
+}
+
+// New creates the mailer of the SMTP server. An empty host returns a nil
+// mailer, so callers can tell e-mail is disabled.
+func New(opts Options) Mailer {
+	if opts.Host == "" {
+		return nil
+	}
+	if opts.Port == "" {
+		opts.Port = "587"
+	}
+	return &SMTP{opts: opts}
+}
+
+// Send sends a plain text e-mail
+func (m *SMTP) Send(ctx context.Context, to []string, subject, body string) error {
+	if len(to) == 0 {
+		return ErrNoRecipients
+	}
+
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.opts.Host, m.opts.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.opts.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.opts.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(m.opts.From)); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(address(rcpt)); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message(m.opts.From, to, subject, body)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds a UTF-8 plain text message with CRLF line endings
+func message(from string, to []string, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// address returns the bare address of "Name <address>"
+func address(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
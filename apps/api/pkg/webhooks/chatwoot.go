@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -37,6 +38,15 @@ type ConversationCreatedPayload struct {
 	Messages       []MessageInfo          `json:"messages"`
 }
 
+// ConversationStatusChangedPayload represents conversation_status_changed event
+type ConversationStatusChangedPayload struct {
+	ID         int    `json:"id"`
+	AccountID  int    `json:"account_id"`
+	InboxID    int    `json:"inbox_id"`
+	Status     string `json:"status"` // open, resolved, pending, snoozed
+	AssigneeID int    `json:"assignee_id"`
+}
+
 // MessageCreatedPayload represents message_created event
 type MessageCreatedPayload struct {
 	ID             int                    `json:"id"`
@@ -44,11 +54,60 @@ type MessageCreatedPayload struct {
 	AccountID      int                    `json:"account_id"`
 	InboxID        int                    `json:"inbox_id"`
 	ConversationID int                    `json:"conversation_id"`
-	MessageType    int                    `json:"message_type"`
+	MessageType    MessageType            `json:"message_type"`
 	CreatedAt      time.Time              `json:"created_at"`
 	Private        bool                   `json:"private"`
+	SourceID       string                 `json:"source_id"`
 	Sender         SenderInfo             `json:"sender"`
 	Contact        ContactInfo            `json:"contact"`
+	Attachments    []AttachmentInfo       `json:"attachments"`
+}
+
+// MessageType is the Chatwoot message type. Webhooks send it either as the
+// numeric enum or as its name, so both forms are accepted.
+type MessageType int
+
+// Chatwoot message types
+const (
+	MessageTypeIncoming MessageType = 0
+	MessageTypeOutgoing MessageType = 1
+	MessageTypeActivity MessageType = 2
+	MessageTypeTemplate MessageType = 3
+)
+
+// UnmarshalJSON accepts both 1 and "outgoing"
+func (t *MessageType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*t = MessageType(n)
+		return nil
+	}
+
+	switch name {
+	case "incoming":
+		*t = MessageTypeIncoming
+	case "outgoing":
+		*t = MessageTypeOutgoing
+	case "activity":
+		*t = MessageTypeActivity
+	case "template":
+		*t = MessageTypeTemplate
+	default:
+		return fmt.Errorf("unknown message type %q", name)
+	}
+	return nil
+}
+
+// AttachmentInfo represents a message attachment
+type AttachmentInfo struct {
+	ID       int    `json:"id"`
+	FileType string `json:"file_type"` // image, audio, video, file
+	DataURL  string `json:"data_url"`
+	FileName string `json:"file_name"`
 }
 
 // ContactInfo represents contact information
@@ -133,3 +192,18 @@ func ParseMessageCreated(data map[string]interface{}) (*MessageCreatedPayload, e
 
 	return &payload, nil
 }
+
+// ParseConversationStatusChanged parses a conversation_status_changed event
+func ParseConversationStatusChanged(data map[string]interface{}) (*ConversationStatusChangedPayload, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload ConversationStatusChangedPayload
+	if err := json.Unmarshal(jsonData, &payload); err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
@@ -0,0 +1,162 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Evolution API event names (normalized to the dotted lowercase form)
+const (
+	EvolutionMessagesUpsert   = "messages.upsert"
+	EvolutionMessagesUpdate   = "messages.update"
+	EvolutionConnectionUpdate = "connection.update"
+)
+
+// EvolutionWebhook represents a webhook event from Evolution API
+type EvolutionWebhook struct {
+	Event    string          `json:"event"`
+	Instance string          `json:"instance"`
+	Data     json.RawMessage `json:"data"`
+	DateTime string          `json:"date_time"`
+	Sender   string          `json:"sender"`
+}
+
+// EvolutionMessageKey identifies a WhatsApp message
+type EvolutionMessageKey struct {
+	RemoteJID   string `json:"remoteJid"`
+	FromMe      bool   `json:"fromMe"`
+	ID          string `json:"id"`
+	Participant string `json:"participant"`
+}
+
+// EvolutionMessage represents the data of a messages.upsert event
+type EvolutionMessage struct {
+	Key              EvolutionMessageKey    `json:"key"`
+	PushName         string                 `json:"pushName"`
+	Message          map[string]interface{} `json:"message"`
+	MessageType      string                 `json:"messageType"`
+	MessageTimestamp int64                  `json:"messageTimestamp"`
+}
+
+// EvolutionMessageStatus represents the data of a messages.update event
+type EvolutionMessageStatus struct {
+	KeyID     string              `json:"keyId"`
+	MessageID string              `json:"messageId"`
+	RemoteJID string              `json:"remoteJid"`
+	FromMe    bool                `json:"fromMe"`
+	Status    string              `json:"status"`
+	Key       EvolutionMessageKey `json:"key"`
+}
+
+// EvolutionConnection represents the data of a connection.update event
+type EvolutionConnection struct {
+	Instance     string `json:"instance"`
+	State        string `json:"state"`
+	StatusReason int    `json:"statusReason"`
+}
+
+// ParseEvolutionWebhook parses an Evolution API webhook payload.
+// Event names are normalized so that "MESSAGES_UPSERT" and "messages.upsert" match.
+func ParseEvolutionWebhook(payload []byte) (*EvolutionWebhook, error) {
+	var webhook EvolutionWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	webhook.Event = strings.ToLower(strings.ReplaceAll(webhook.Event, "_", "."))
+	return &webhook, nil
+}
+
+// ParseEvolutionMessage parses the data of a messages.upsert event
+func ParseEvolutionMessage(data json.RawMessage) (*EvolutionMessage, error) {
+	var msg EvolutionMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	return &msg, nil
+}
+
+// ParseEvolutionMessageStatus parses the data of a messages.update event
+func ParseEvolutionMessageStatus(data json.RawMessage) (*EvolutionMessageStatus, error) {
+	var status EvolutionMessageStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	// Older Evolution versions only send the key object
+	if status.KeyID == "" {
+		status.KeyID = status.Key.ID
+	}
+	if status.RemoteJID == "" {
+		status.RemoteJID = status.Key.RemoteJID
+	}
+	return &status, nil
+}
+
+// ParseEvolutionConnection parses the data of a connection.update event
+func ParseEvolutionConnection(data json.RawMessage) (*EvolutionConnection, error) {
+	var conn EvolutionConnection
+	if err := json.Unmarshal(data, &conn); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	return &conn, nil
+}
+
+// Text extracts the human readable content of a WhatsApp message.
+// Media messages fall back to their caption or a short placeholder.
+func (m *EvolutionMessage) Text() string {
+	if text, ok := m.Message["conversation"].(string); ok && text != "" {
+		return text
+	}
+
+	if ext, ok := m.Message["extendedTextMessage"].(map[string]interface{}); ok {
+		if text, ok := ext["text"].(string); ok {
+			return text
+		}
+	}
+
+	placeholders := map[string]string{
+		"imageMessage":    "[imagem]",
+		"videoMessage":    "[vídeo]",
+		"audioMessage":    "[áudio]",
+		"documentMessage": "[documento]",
+		"stickerMessage":  "[figurinha]",
+		"locationMessage": "[localização]",
+		"contactMessage":  "[contato]",
+	}
+	for key, placeholder := range placeholders {
+		media, ok := m.Message[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if caption, ok := media["caption"].(string); ok && caption != "" {
+			return caption
+		}
+		if fileName, ok := media["fileName"].(string); ok && fileName != "" {
+			return placeholder + " " + fileName
+		}
+		return placeholder
+	}
+
+	return ""
+}
+
+// PhoneFromJID converts a WhatsApp JID (5511999999999@s.whatsapp.net) to E.164
+func PhoneFromJID(jid string) string {
+	number := jid
+	if i := strings.Index(number, "@"); i >= 0 {
+		number = number[:i]
+	}
+	if i := strings.Index(number, ":"); i >= 0 {
+		number = number[:i]
+	}
+	if number == "" {
+		return ""
+	}
+	return "+" + number
+}
+
+// IsGroupJID reports whether a JID belongs to a group or broadcast list
+func IsGroupJID(jid string) bool {
+	return strings.HasSuffix(jid, "@g.us") || strings.HasSuffix(jid, "@broadcast")
+}